@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"update-google-sheets/pkg/sheetsync"
+	"update-google-sheets/src/config"
+)
+
+// runAuditTail prints to w the last n records of every audit_log the
+// config at path names, one line per changed cell, for -audit-tail. The
+// result is the exit code.
+func runAuditTail(path string, n int, w io.Writer) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	cfgs, err := config.ParseAll(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "parse %s: %v\n", path, err)
+		return 1
+	}
+	var files []string
+	for _, cfg := range cfgs {
+		file := strings.TrimSpace(cfg.AuditLog)
+		if file != "" && !slices.Contains(files, file) {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "%s does not set audit_log\n", path)
+		return 1
+	}
+	for i, file := range files {
+		records, err := sheetsync.ReadAuditLog(file, n)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(files) > 1 {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "==> %s <==\n", file)
+		}
+		for _, r := range records {
+			fmt.Fprintf(w, "%s  %s  %s@%s  %s  %s: %q -> %q\n", r.Time, r.RunID, r.User, r.Host, r.Mode, r.Range, fmt.Sprint(r.Before), fmt.Sprint(r.After))
+		}
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunAuditTail(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.jsonl")
+	second := filepath.Join(dir, "second.jsonl")
+	records := map[string]string{
+		first: `{"time":"2026-10-16T09:00:00Z","run_id":"r1","range":"Plan!A1","before":"","after":"Alice","mode":"write","user":"ci","host":"runner"}
+{"time":"2026-10-16T09:05:00Z","run_id":"r2","range":"Plan!A2","before":"x","after":"Bob","mode":"sync","user":"ci","host":"runner"}
+`,
+		second: `{"time":"2026-10-16T10:00:00Z","run_id":"r3","range":"Log!B1","before":"","after":"done","mode":"write","user":"ci","host":"runner"}
+`,
+	}
+	for path, data := range records {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig := func(yaml string) string {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name  string
+		yaml  string
+		n     int
+		want  int
+		lines []string
+	}{
+		{"last record", "audit_log: " + first + "\n", 1, 0, []string{
+			`2026-10-16T09:05:00Z  r2  ci@runner  sync  Plan!A2: "x" -> "Bob"`,
+		}},
+		{"every log of a pipeline once", "audit_log: " + first + "\n---\naudit_log: " + second + "\n---\naudit_log: " + first + "\n", 1, 0, []string{
+			"==> " + first + " <==",
+			`2026-10-16T09:05:00Z  r2  ci@runner  sync  Plan!A2: "x" -> "Bob"`,
+			"",
+			"==> " + second + " <==",
+			`2026-10-16T10:00:00Z  r3  ci@runner  write  Log!B1: "" -> "done"`,
+		}},
+		{"no audit_log", "lookup_value: Alice\n", 1, 1, nil},
+		{"missing audit_log file", "audit_log: " + filepath.Join(dir, "absent.jsonl") + "\n", 1, 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if got := runAuditTail(writeConfig(tt.yaml), tt.n, &out); got != tt.want {
+				t.Fatalf("runAuditTail = %d, want %d", got, tt.want)
+			}
+			var lines []string
+			if out.Len() > 0 {
+				lines = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			}
+			if strings.Join(lines, "\n") != strings.Join(tt.lines, "\n") {
+				t.Errorf("output:\n%s\nwant:\n%s", out.String(), strings.Join(tt.lines, "\n"))
+			}
+		})
+	}
+	if got := runAuditTail(filepath.Join(dir, "absent.yaml"), 1, &bytes.Buffer{}); got != 1 {
+		t.Errorf("runAuditTail on a missing config = %d, want 1", got)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+
+	"update-google-sheets/src/config"
+)
+
+// importPaths collects repeated -import flags, in order.
+type importPaths []string
+
+func (p *importPaths) String() string {
+	return strings.Join(*p, ", ")
+}
+
+func (p *importPaths) Set(path string) error {
+	*p = append(*p, strings.TrimSpace(path))
+	return nil
+}
+
+// merge layers each imported file over cfg in turn, so later files win.
+func (p importPaths) merge(cfg config.Config, strategy string) (config.Config, error) {
+	for _, path := range p {
+		var err error
+		if cfg, err = config.MergeFile(cfg, path, strategy); err != nil {
+			return config.Config{}, err
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"update-google-sheets/src/config"
+)
+
+func TestImportPathsMerge(t *testing.T) {
+	base := func() config.Config {
+		return config.Config{
+			SpreadsheetID: "sheet-id",
+			LookupValue:   "Alice",
+			WriteValue:    "Done",
+			SheetFilter:   config.SheetList{"Week1"},
+			Writes:        []config.CellWrite{{Offset: "0,1", Value: "a"}},
+		}
+	}
+	with := func(change func(*config.Config)) config.Config {
+		cfg := base()
+		change(&cfg)
+		return cfg
+	}
+	lists := "config_sheet: [Week1, Week2]\nwrites: [{offset: '0,1', value: c}, {offset: '0,2', value: b}]\n"
+	tests := []struct {
+		name     string
+		files    []string
+		strategy string
+		want     config.Config
+		wantErr  string
+	}{
+		{"replace", []string{lists}, config.MergeReplace, with(func(c *config.Config) {
+			c.SheetFilter = config.SheetList{"Week1", "Week2"}
+			c.Writes = []config.CellWrite{{Offset: "0,1", Value: "c"}, {Offset: "0,2", Value: "b"}}
+		}), ""},
+		{"append", []string{lists}, config.MergeAppend, with(func(c *config.Config) {
+			c.SheetFilter = config.SheetList{"Week1", "Week1", "Week2"}
+			c.Writes = []config.CellWrite{{Offset: "0,1", Value: "a"}, {Offset: "0,1", Value: "c"}, {Offset: "0,2", Value: "b"}}
+		}), ""},
+		{"key", []string{lists}, config.MergeByKey, with(func(c *config.Config) {
+			c.SheetFilter = config.SheetList{"Week1", "Week2"}
+			c.Writes = []config.CellWrite{{Offset: "0,1", Value: "c"}, {Offset: "0,2", Value: "b"}}
+		}), ""},
+		{"later file wins", []string{"lookup_value: Bob\ntarget_col_offset: 2\n", "lookup_value: Carol\n"}, config.MergeReplace, with(func(c *config.Config) {
+			c.LookupValue = "Carol"
+			c.TargetColOffset = 2
+		}), ""},
+		{"null clears", []string{"write_value: null\n"}, config.MergeReplace, with(func(c *config.Config) { c.WriteValue = "" }), ""},
+		{"no files", nil, config.MergeReplace, base(), ""},
+		{"unknown strategy", []string{lists}, "merge", config.Config{}, `merge strategy must be replace, append or key, got "merge"`},
+		{"several documents", []string{"lookup_value: Bob\n---\nlookup_value: Carol\n"}, config.MergeReplace, config.Config{}, "holds 2 documents"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var imports importPaths
+			for i, content := range tt.files {
+				path := filepath.Join(dir, fmt.Sprintf("import%d.yaml", i))
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if err := imports.Set(" " + path + " "); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := imports.merge(base(), tt.strategy)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("merged config = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -8,51 +9,117 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	_ "time/tzdata" // timezone validates on images without tzdata installed
 
 	survey "github.com/AlecAivazis/survey/v2"
+	"gopkg.in/yaml.v3"
 
 	"update-google-sheets/src/config"
 )
 
 func main() {
-	existing, _ := config.Load(config.DefaultPath)
+	existing := loadExisting()
 	nonInteractive := flag.Bool("non-interactive", false, "Use flags instead of prompts")
 	spreadsheet := flag.String("spreadsheet", existing.SpreadsheetID, "Spreadsheet ID")
-	sheetFilter := flag.String("sheet", existing.SheetFilter, "Sheet name filter")
+	sheetFilter := flag.String("sheet", strings.Join(existing.SheetFilter, ","), "Sheet name filter (comma separated for several)")
 	lookup := flag.String("lookup", existing.LookupValue, "Lookup value")
 	workbookSrc := flag.String("workbook-src", "", "Path to workbook to copy into cfg (blank keeps existing)")
+	var imports importPaths
+	flag.Var(&imports, "import", "Deep-merge this config file into the current one before the prompts or flags apply; repeat to layer several, later files winning")
+	mergeStrategy := flag.String("merge-strategy", config.MergeReplace, "How -import merges lists: replace, append, or key (update items sharing a key, append the rest)")
+	show := flag.Bool("show", false, "Print the resulting config instead of writing it")
+	resetConfig := flag.Bool("reset", false, "Back up and remove "+config.DefaultPath+", after confirmation, and exit; the workbook is never touched")
+	all := flag.Bool("all", false, "With -reset, also back up and remove the state_file of every document")
+	assumeYes := flag.Bool("yes", false, "With -reset, skip the confirmation")
+	example := flag.Bool("example", false, "Print an example config with every setting described, and exit")
+	fromStdin := flag.Bool("stdin", false, "With -non-interactive, read the complete config document from stdin instead of flags")
+	skipFileChecks := flag.Bool("skip-file-checks", false, "With -stdin, do not require the workbook to exist yet")
+	restore := flag.Bool("restore-workbook", false, "List the backups of the workbook, restore the one you pick, and exit")
+	testConn := flag.Bool("test", false, "After writing, check that the credentials can read the configured spreadsheet")
 	flag.Parse()
 
+	if *example {
+		data, err := config.Example()
+		if err != nil {
+			log.Fatal(err)
+		}
+		_, _ = os.Stdout.Write(data)
+		return
+	}
+
+	if *resetConfig {
+		if err := reset(*all, *assumeYes); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *restore {
+		if err := restoreWorkbook(existing); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *testConn && *show {
+		log.Fatal("-test checks the written config and cannot be combined with -show")
+	}
+	if *testConn {
+		defer func() {
+			if err := testConnection(context.Background(), config.DefaultPath, nil); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+	if *fromStdin {
+		if !*nonInteractive {
+			log.Fatal("-stdin requires -non-interactive")
+		}
+		if err := writeFromStdin(os.Stdin, strings.TrimSpace(*workbookSrc), *skipFileChecks); err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Configuration updated at", config.DefaultPath)
+		return
+	}
+	refuseMultiDocument()
+
+	base, err := imports.merge(existing, *mergeStrategy)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	if *nonInteractive {
-		cfg := config.Config{
-			SpreadsheetID: strings.TrimSpace(*spreadsheet),
-			SheetFilter:   strings.TrimSpace(*sheetFilter),
-			LookupValue:   strings.TrimSpace(*lookup),
+		// Flags left unset fall back to the merged config rather than the
+		// defaults read before the imports.
+		explicit := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+		if !explicit["spreadsheet"] {
+			*spreadsheet = base.SpreadsheetID
+		}
+		if !explicit["sheet"] {
+			*sheetFilter = strings.Join(base.SheetFilter, ",")
 		}
+		if !explicit["lookup"] {
+			*lookup = base.LookupValue
+		}
+		cfg := withAnswers(base, *spreadsheet, *sheetFilter, *lookup)
 		if cfg.SpreadsheetID == "" || cfg.LookupValue == "" {
 			log.Fatal("provide -spreadsheet and -lookup")
 		}
 		copySrc := strings.TrimSpace(*workbookSrc)
-		if err := writeConfig(cfg, copySrc); err != nil {
-			log.Fatal(err)
-		}
-		log.Println("Configuration updated at", config.DefaultPath)
+		save(cfg, copySrc, *show)
 		return
 	}
 
-	runInteractive()
+	runInteractive(base, *show)
 }
 
-func runInteractive() {
-	existing, _ := config.Load(config.DefaultPath)
-
+func runInteractive(existing config.Config, show bool) {
 	prompt := &survey.Input{Message: "Google Spreadsheet ID", Default: existing.SpreadsheetID}
 	var spreadsheetID string
 	if err := survey.AskOne(prompt, &spreadsheetID); err != nil {
 		log.Fatal(err)
 	}
 
-	prompt = &survey.Input{Message: "Sheet filter", Default: existing.SheetFilter}
+	prompt = &survey.Input{Message: "Sheet filter (comma separated)", Default: strings.Join(existing.SheetFilter, ",")}
 	var sheetFilter string
 	if err := survey.AskOne(prompt, &sheetFilter); err != nil {
 		log.Fatal(err)
@@ -69,12 +136,28 @@ func runInteractive() {
 		log.Fatal(err)
 	}
 
-	cfg := config.Config{
-		SpreadsheetID: strings.TrimSpace(spreadsheetID),
-		SheetFilter:   strings.TrimSpace(sheetFilter),
-		LookupValue:   strings.TrimSpace(lookupValue),
-	}
+	save(withAnswers(existing, spreadsheetID, sheetFilter, lookupValue), workbookSrc, show)
+}
 
+// withAnswers sets the spreadsheet, sheet filter and lookup value the user
+// gave on existing, keeping every other setting it holds, such as
+// source_col_offset, that the wizard does not ask about.
+func withAnswers(existing config.Config, spreadsheetID, sheetFilter, lookupValue string) config.Config {
+	cfg := existing
+	cfg.SpreadsheetID = strings.TrimSpace(spreadsheetID)
+	cfg.SheetFilter = config.ParseSheetList(strings.Split(sheetFilter, ",")...)
+	cfg.LookupValue = strings.TrimSpace(lookupValue)
+	return cfg
+}
+
+// save writes cfg, or with show prints it to stdout and writes nothing.
+func save(cfg config.Config, workbookSrc string, show bool) {
+	if show {
+		if err := yaml.NewEncoder(os.Stdout).Encode(cfg); err != nil {
+			log.Fatal(fmt.Errorf("encode config: %w", err))
+		}
+		return
+	}
 	if err := writeConfig(cfg, workbookSrc); err != nil {
 		log.Fatal(err)
 	}
@@ -102,13 +185,50 @@ func chooseWorkbookInteractive() (string, error) {
 	return "", nil
 }
 
+// loadExisting reads the current config, or returns an empty one when there
+// is none, leaving the questions to the wizard or the flags.
+func loadExisting() config.Config {
+	if _, err := os.Stat(config.DefaultPath); err != nil {
+		return config.Config{}
+	}
+	existing, _ := config.Load(config.DefaultPath)
+	return existing
+}
+
+// refuseMultiDocument stops before a multi-document config would be
+// rewritten as its first document alone.
+func refuseMultiDocument() {
+	data, err := os.ReadFile(config.DefaultPath)
+	if err != nil {
+		return
+	}
+	if cfgs, err := config.ParseAll(data); err == nil && len(cfgs) > 1 {
+		log.Fatalf("%s holds %d documents; edit it by hand, since saving here would keep only the first", config.DefaultPath, len(cfgs))
+	}
+}
+
 func writeConfig(cfg config.Config, workbookSrc string) error {
-	if err := config.Write(cfg, workbookSrc); err != nil {
+	backup, err := config.Write(cfg, workbookSrc)
+	printBackup(cfg, backup)
+	if err != nil {
 		return fmt.Errorf("write config: %w", err)
 	}
 	return nil
 }
 
+// printBackup says where the workbook a copy replaced was backed up, if it
+// was.
+func printBackup(cfg config.Config, backup string) {
+	if backup == "" {
+		return
+	}
+	dest := cfg.Workbook
+	if dest == "" {
+		dest = config.DefaultWorkbook
+	}
+	fmt.Printf("Previous %s backed up to %s\n", dest, backup)
+}
+
 func destExists(path string) error {
 	_, err := os.Stat(path)
 	return err
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"update-google-sheets/src/config"
+)
+
+func TestWithAnswersKeepsOtherSettings(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(filepath.Dir(config.DefaultWorkbook), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := excelize.NewFile().SaveAs(config.DefaultWorkbook); err != nil {
+		t.Fatal(err)
+	}
+	const id = "1AbCdEfGhIjKlMnOpQrStUvWxYz0123456789"
+	existing := config.Config{
+		SpreadsheetID:   "1ZyXwVuTsRqPoNmLkJiHgFeDcBa9876543210",
+		SheetFilter:     config.SheetList{"Old"},
+		LookupValue:     "Bob",
+		SourceRowOffset: -1,
+		SourceColOffset: 2,
+		TargetColOffset: 3,
+		Mode:            config.ModeSync,
+	}
+
+	cfg := withAnswers(existing, " "+id+" ", "Week 1, Week 2", " Alice ")
+	if err := writeConfig(cfg, ""); err != nil {
+		t.Fatal(err)
+	}
+	got, err := config.Load(config.DefaultPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SpreadsheetID != id || got.LookupValue != "Alice" || !reflect.DeepEqual(got.SheetFilter, config.SheetList{"Week 1", "Week 2"}) {
+		t.Errorf("answers saved as %q, %q, %q", got.SpreadsheetID, got.LookupValue, got.SheetFilter)
+	}
+	if got.SourceRowOffset != -1 || got.SourceColOffset != 2 || got.TargetColOffset != 3 || got.Mode != config.ModeSync {
+		t.Errorf("kept settings = source (%d,%d), target col %d, mode %q; want (-1,2), 3, sync",
+			got.SourceRowOffset, got.SourceColOffset, got.TargetColOffset, got.Mode)
+	}
+	if existing.LookupValue != "Bob" || existing.SheetFilter[0] != "Old" {
+		t.Errorf("existing changed to %+v", existing)
+	}
+}
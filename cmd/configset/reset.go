@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	survey "github.com/AlecAivazis/survey/v2"
+
+	"update-google-sheets/src/config"
+)
+
+// resetFiles returns the files -reset removes: the config itself and, with
+// all, the state_file and the undo_dir CSV files of every document.
+// Workbooks are never included, even when a state_file points at one.
+func resetFiles(all bool) []string {
+	data, err := os.ReadFile(config.DefaultPath)
+	if err != nil {
+		return nil
+	}
+	files := []string{config.DefaultPath}
+	if !all {
+		return files
+	}
+	cfgs, err := config.ParseAll(data)
+	if err != nil {
+		return files
+	}
+	workbooks := []string{filepath.Clean(config.DefaultWorkbook)}
+	for _, cfg := range cfgs {
+		if wb := strings.TrimSpace(cfg.Workbook); wb != "" {
+			workbooks = append(workbooks, filepath.Clean(wb))
+		}
+	}
+	for _, cfg := range cfgs {
+		path := strings.TrimSpace(cfg.StateFile)
+		if path == "" || slices.Contains(files, path) || slices.Contains(workbooks, filepath.Clean(path)) {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	for _, cfg := range cfgs {
+		dir := strings.TrimSpace(cfg.UndoDir)
+		if dir == "" {
+			continue
+		}
+		undo, _ := filepath.Glob(filepath.Join(dir, "*.csv"))
+		for _, path := range undo {
+			if !slices.Contains(files, path) {
+				files = append(files, path)
+			}
+		}
+	}
+	return files
+}
+
+// reset moves each file -reset covers to a timestamped backup next to it,
+// after confirmation unless yes, and prints what went where.
+func reset(all, yes bool) error {
+	files := resetFiles(all)
+	if len(files) == 0 {
+		fmt.Println("Nothing to reset:", config.DefaultPath, "does not exist")
+		return nil
+	}
+	fmt.Println("Reset removes:")
+	for _, path := range files {
+		fmt.Println("  " + path)
+	}
+	if !yes {
+		if !isTerminal(os.Stdin) {
+			return errors.New("refusing to reset without confirmation; pass -yes")
+		}
+		var ok bool
+		if err := survey.AskOne(&survey.Confirm{Message: "Back up and remove these files?"}, &ok); err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Reset cancelled; nothing removed")
+			return nil
+		}
+	}
+	stamp := time.Now().Format("20060102-150405")
+	for _, path := range files {
+		backup := fmt.Sprintf("%s.%s.bak", path, stamp)
+		if err := os.Rename(path, backup); err != nil {
+			return fmt.Errorf("back up %s: %w", path, err)
+		}
+		fmt.Printf("Removed %s (backup: %s)\n", path, backup)
+	}
+	return nil
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
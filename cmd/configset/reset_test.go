@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResetFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for path, data := range map[string]string{
+		"cfg/config.yaml": "spreadsheet_id: abc\nlookup_value: Alice\nmode: clear\nstate_file: cfg/state.json\nundo_dir: undo\n" +
+			"---\nspreadsheet_id: abc\nlookup_value: Bob\nmode: clear\nundo_dir: undo\n",
+		"cfg/state.json":           "{}",
+		"undo/20261016-150405.csv": "range,value\nPlan!B1,Done\n",
+		"undo/20261016-160000.csv": "range,value\nPlan!B2,Done\n",
+		"undo/notes.txt":           "kept",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		all  bool
+		want []string
+	}{
+		{false, []string{"cfg/config.yaml"}},
+		{true, []string{"cfg/config.yaml", "cfg/state.json", "undo/20261016-150405.csv", "undo/20261016-160000.csv"}},
+	}
+	for _, tt := range tests {
+		if got := resetFiles(tt.all); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("resetFiles(%v) = %v, want %v", tt.all, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	survey "github.com/AlecAivazis/survey/v2"
+
+	"update-google-sheets/src/config"
+)
+
+// restoreWorkbook lists the backups of cfg's workbook, newest first, and
+// restores the one picked. The workbook it replaces is backed up in turn.
+func restoreWorkbook(cfg config.Config) error {
+	dest := cfg.Workbook
+	if dest == "" {
+		dest = config.DefaultWorkbook
+	}
+	backups, err := config.Backups(dest)
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		fmt.Println("No backups of", dest)
+		return nil
+	}
+	fmt.Printf("Backups of %s, newest first:\n", dest)
+	for _, b := range backups {
+		fmt.Println("  " + b)
+	}
+	if !isTerminal(os.Stdin) {
+		return errors.New("pick a backup interactively, or copy one into place with -workbook-src")
+	}
+	var picked string
+	prompt := &survey.Select{Message: "Restore which backup?", Options: backups, Default: backups[0]}
+	if err := survey.AskOne(prompt, &picked); err != nil {
+		return err
+	}
+	replaced, err := config.RestoreWorkbook(cfg, picked)
+	if err != nil {
+		return err
+	}
+	printBackup(cfg, replaced)
+	fmt.Println("Restored", dest, "from", picked)
+	return nil
+}
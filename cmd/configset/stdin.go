@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"update-google-sheets/src/config"
+)
+
+// writeFromStdin replaces the config with the single YAML document read
+// from r. The workbook is copied only when workbookSrc names one, never
+// inferred from the document. skipFileChecks leaves out the check that the
+// workbook exists, for provisioning before it is in place.
+func writeFromStdin(r io.Reader, workbookSrc string, skipFileChecks bool) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("read stdin: %w", err)
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return errors.New("stdin is empty; pipe a YAML config document")
+	}
+	cfgs, err := config.ParseAll(data)
+	if err != nil {
+		return fmt.Errorf("parse stdin: %w", err)
+	}
+	if len(cfgs) > 1 {
+		return fmt.Errorf("stdin holds %d documents; -stdin takes a single config document", len(cfgs))
+	}
+	cfg := cfgs[0]
+	switch {
+	case workbookSrc != "":
+		var backup string
+		backup, err = config.Write(cfg, workbookSrc)
+		printBackup(cfg, backup)
+	case skipFileChecks:
+		err = config.WriteSettings(cfg)
+	default:
+		_, err = config.Write(cfg, "")
+	}
+	if err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	return nil
+}
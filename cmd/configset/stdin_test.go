@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"update-google-sheets/src/config"
+)
+
+func TestWriteFromStdin(t *testing.T) {
+	const doc = "spreadsheet_id: 1AbCdEfGhIjKlMnOpQrStUvWxYz0123456789\nlookup_value: Alice\n"
+	tests := []struct {
+		name           string
+		input          string
+		skipFileChecks bool
+		withWorkbook   bool
+		wantErr        string
+	}{
+		{"valid document", doc, false, true, ""},
+		{"workbook not in place", doc, false, false, "write config: access cfg/Schedule.xlsx"},
+		{"skip-file-checks without a workbook", doc, true, false, ""},
+		{"skip-file-checks still validates settings", "spreadsheet_id: 1AbCdEfGhIjKlMnOpQrStUvWxYz0123456789\n", true, false, "lookup_value is required"},
+		{"empty", " \n", false, true, "stdin is empty"},
+		{"not YAML", "lookup_value: [Alice\n", false, true, "parse stdin"},
+		{"not a config", "- Alice\n", false, true, "parse stdin"},
+		{"several documents", doc + "---\n" + doc, false, true, "stdin holds 2 documents"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			if tt.withWorkbook {
+				if err := os.MkdirAll(filepath.Dir(config.DefaultWorkbook), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := excelize.NewFile().SaveAs(config.DefaultWorkbook); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := writeFromStdin(strings.NewReader(tt.input), "", tt.skipFileChecks)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				if _, err := os.Stat(config.DefaultPath); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("a rejected document was saved: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := config.Load(config.DefaultPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.LookupValue != "Alice" || got.SpreadsheetID != "1AbCdEfGhIjKlMnOpQrStUvWxYz0123456789" {
+				t.Errorf("saved config = %+v, want the document's settings", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"google.golang.org/api/option"
+
+	"update-google-sheets/src/config"
+	"update-google-sheets/src/secrets"
+	"update-google-sheets/src/sheets"
+)
+
+// testConnection reads the config saved at path and checks that the
+// credentials a run would use can fetch the metadata of every spreadsheet
+// it names. Secret references are resolved first, through resolver or, when
+// it is nil, Secret Manager. extra client options are passed to the Sheets
+// service.
+func testConnection(ctx context.Context, path string, resolver config.SecretResolver, extra ...option.ClientOption) error {
+	cfgs, err := config.LoadAll(path)
+	if err != nil {
+		return err
+	}
+	for _, cfg := range cfgs {
+		if cfg.HasSecretRefs() {
+			if resolver == nil {
+				if resolver, err = secrets.NewSecretManager(ctx); err != nil {
+					return fmt.Errorf("connection test failed: %w", err)
+				}
+			}
+			if err := cfg.ResolveSecrets(ctx, resolver); err != nil {
+				return fmt.Errorf("connection test failed: %w", err)
+			}
+		}
+		ids := cfg.SpreadsheetIDs
+		if len(ids) == 0 {
+			ids = []string{cfg.SpreadsheetID}
+		}
+		svc, err := sheets.NewService(ctx, cfg, sheets.Options{DryRun: true}, extra...)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if id == "" {
+				return fmt.Errorf("connection test failed: %s sets no spreadsheet_id", path)
+			}
+			title, err := sheets.SpreadsheetTitle(ctx, svc, cfg, id)
+			if err != nil {
+				return fmt.Errorf("connection test failed: %w", err)
+			}
+			log.Printf("Connection test passed: spreadsheet %s (%q) is readable", id, title)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/option"
+)
+
+// fakeSpreadsheets answers spreadsheets.get with a title for the IDs in
+// titles and a 404 for any other.
+func fakeSpreadsheets(t *testing.T, titles map[string]string) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/v4/spreadsheets/")
+		w.Header().Set("Content-Type", "application/json")
+		title, ok := titles[id]
+		if r.Method != http.MethodGet || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]interface{}{"code": 404, "message": "Requested entity was not found."},
+			})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"spreadsheetId": id,
+			"properties":    map[string]string{"title": title},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestTestConnection(t *testing.T) {
+	endpoint := fakeSpreadsheets(t, map[string]string{"good-id": "Roster", "other-id": "Archive"})
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"readable", "spreadsheet_id: good-id\nlookup_value: Alice\n", ""},
+		{"every listed spreadsheet", "spreadsheet_ids: [good-id, other-id]\nlookup_value: Alice\n", ""},
+		{"missing spreadsheet", "spreadsheet_id: wrong-id\nlookup_value: Alice\n", "connection test failed: spreadsheet wrong-id not found or not shared"},
+		{"one of several missing", "spreadsheet_ids: [good-id, wrong-id]\nlookup_value: Alice\n", "spreadsheet wrong-id not found"},
+		{"no spreadsheet", "lookup_value: Alice\n", "sets no spreadsheet_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			err := testConnection(context.Background(), path, nil, option.WithEndpoint(endpoint), option.WithoutAuthentication())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// fakeResolver answers secret lookups from a map.
+type fakeResolver map[string]string
+
+func (f fakeResolver) ResolveSecret(_ context.Context, name string) (string, error) {
+	v, ok := f[name]
+	if !ok {
+		return "", fmt.Errorf("secret %s not found", name)
+	}
+	return v, nil
+}
+
+func TestTestConnectionResolvesSecrets(t *testing.T) {
+	endpoint := fakeSpreadsheets(t, map[string]string{"good-id": "Roster"})
+	resolver := fakeResolver{"projects/p/secrets/sheet/versions/latest": "good-id"}
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"resolved spreadsheet", "spreadsheet_id: sm://projects/p/secrets/sheet/versions/latest\nlookup_value: Alice\n", ""},
+		{"unknown secret", "spreadsheet_id: sm://projects/p/secrets/other/versions/latest\nlookup_value: Alice\n", "connection test failed: resolve spreadsheet_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			err := testConnection(context.Background(), path, resolver, option.WithEndpoint(endpoint), option.WithoutAuthentication())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
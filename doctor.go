@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2/google"
+
+	"update-google-sheets/src/config"
+	"update-google-sheets/src/secrets"
+	"update-google-sheets/src/sheets"
+)
+
+// doctorCheck is one line of the -doctor report. A failed critical check
+// makes -doctor exit non-zero.
+type doctorCheck struct {
+	Name     string `json:"name"`
+	OK       bool   `json:"ok"`
+	Critical bool   `json:"critical"`
+	Detail   string `json:"detail"`
+	Skipped  bool   `json:"skipped,omitempty"`
+}
+
+// doctorTimeout bounds each network check so an unreachable host does not
+// hang the report.
+const doctorTimeout = 20 * time.Second
+
+// doctorEnv is what -doctor examines: the config file, and how it finds
+// credentials, reaches the spreadsheet and probes the network. Results are
+// printed to out.
+type doctorEnv struct {
+	configPath  string
+	credentials func(context.Context) (string, error)
+	access      func(context.Context, config.Config) (string, error)
+	reachable   func(context.Context, config.Config) error
+	out         io.Writer
+}
+
+// liveDoctorEnv examines the real config file, credentials, spreadsheet
+// and network, printing to stdout.
+func liveDoctorEnv() doctorEnv {
+	return doctorEnv{
+		configPath:  config.DefaultPath,
+		credentials: credentialMechanism,
+		access:      spreadsheetAccess,
+		reachable:   sheets.CheckReachable,
+		out:         os.Stdout,
+	}
+}
+
+// runDoctor checks the config, workbook, credentials, spreadsheet access,
+// timezone data and network in turn, prints the results and returns the
+// exit code. Checks that depend on an earlier failure are reported as
+// skipped rather than run.
+func runDoctor(ctx context.Context, env doctorEnv, importPath string, asJSON bool) int {
+	var checks []doctorCheck
+	add := func(name string, critical bool, err error, detail string) bool {
+		c := doctorCheck{Name: name, OK: err == nil, Critical: critical, Detail: detail}
+		if err != nil {
+			c.Detail = err.Error()
+		}
+		checks = append(checks, c)
+		return err == nil
+	}
+	skip := func(name, reason string) {
+		checks = append(checks, doctorCheck{Name: name, Critical: true, Detail: "skipped: " + reason, Skipped: true})
+	}
+
+	cfg, cfgOK := doctorConfig(ctx, env.configPath, importPath, add)
+
+	switch {
+	case !cfgOK:
+		skip("workbook", "config is invalid")
+		skip("lookup value", "config is invalid")
+	case !cfg.ScansWorkbook():
+		add("workbook", false, nil, "not scanned in this mode")
+	default:
+		matches, scanned, err := sheets.FindMatches(ctx, cfg)
+		if add("workbook", true, workbookErr(err), fmt.Sprintf("%s opened; sheets %s", cfg.Workbook, strings.Join(scanned, ", "))) {
+			cells := make([]string, len(matches))
+			for i, m := range matches {
+				cells[i] = m.A1
+			}
+			add("lookup value", true, lookupErr(err), fmt.Sprintf("%q found %d time(s): %s", cfg.LookupValue, len(matches), strings.Join(cells, ", ")))
+		} else {
+			skip("lookup value", "workbook check failed")
+		}
+	}
+
+	mechanism, err := env.credentials(ctx)
+	credsOK := add("credentials", true, err, mechanism)
+
+	switch {
+	case !cfgOK:
+		skip("spreadsheet access", "config is invalid")
+	case !credsOK:
+		skip("spreadsheet access", "no credentials")
+	default:
+		ids := cfg.SpreadsheetIDs
+		if len(ids) == 0 {
+			ids = []string{cfg.SpreadsheetID}
+		}
+		for _, id := range ids {
+			one := cfg
+			one.SpreadsheetID = id
+			actx, cancel := context.WithTimeout(ctx, doctorTimeout)
+			title, err := env.access(actx, one)
+			cancel()
+			add("spreadsheet access", true, err, fmt.Sprintf("%q (%s) is readable and writable", title, id))
+		}
+	}
+
+	_, err = time.LoadLocation(config.DefaultTimezone)
+	add("timezone data", false, err, config.DefaultTimezone+" loads")
+
+	nctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	err = env.reachable(nctx, cfg)
+	cancel()
+	add("network", true, err, "sheets.googleapis.com:443 reachable")
+
+	code := 0
+	for _, c := range checks {
+		if c.Critical && !c.OK {
+			code = 1
+		}
+	}
+	if asJSON {
+		out, err := json.MarshalIndent(struct {
+			OK     bool          `json:"ok"`
+			Checks []doctorCheck `json:"checks"`
+		}{code == 0, checks}, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "encode doctor result: %v\n", err)
+			return 1
+		}
+		fmt.Fprintln(env.out, string(out))
+		return code
+	}
+	for _, c := range checks {
+		status := "PASS"
+		switch {
+		case c.Skipped:
+			status = "SKIP"
+		case !c.OK && c.Critical:
+			status = "FAIL"
+		case !c.OK:
+			status = "WARN"
+		}
+		fmt.Fprintf(env.out, "[%s] %s: %s\n", status, c.Name, c.Detail)
+	}
+	return code
+}
+
+// doctorConfig loads and validates the config at path without ever falling
+// back to the interactive setup, which would make no sense in a diagnostic.
+func doctorConfig(ctx context.Context, path, importPath string, add func(string, bool, error, string) bool) (config.Config, bool) {
+	if _, err := os.Stat(path); err != nil {
+		return config.Config{}, add("config", true, err, "")
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return cfg, add("config", true, err, "")
+	}
+	if importPath != "" {
+		cfg.ImportFile = importPath
+	}
+	if cfg.HasSecretRefs() {
+		resolver, err := secrets.NewSecretManager(ctx)
+		if err == nil {
+			err = cfg.ResolveSecrets(ctx, resolver)
+		}
+		if err != nil {
+			return cfg, add("config", true, err, "")
+		}
+	}
+	if err := cfg.ValidateSettings(); err != nil {
+		return cfg, add("config", true, err, "")
+	}
+	return cfg, add("config", true, nil, path+" parses and validates")
+}
+
+// workbookErr keeps only the failures that mean the workbook itself could
+// not be used; a missing lookup value is reported by its own check.
+func workbookErr(err error) error {
+	if lookupErr(err) != nil {
+		return nil
+	}
+	return err
+}
+
+func lookupErr(err error) error {
+	if err != nil && (errors.Is(err, sheets.ErrValueNotFound) || errors.Is(err, sheets.ErrAnchorNotUnique)) {
+		return err
+	}
+	return nil
+}
+
+// credentialMechanism finds Application Default Credentials the way the
+// API client does and says where they came from.
+func credentialMechanism(ctx context.Context) (string, error) {
+	creds, err := google.FindDefaultCredentials(ctx, "https://www.googleapis.com/auth/spreadsheets")
+	if err != nil {
+		return "", err
+	}
+	if len(creds.JSON) == 0 {
+		return "metadata server (attached service account)", nil
+	}
+	var kind struct {
+		Type string `json:"type"`
+	}
+	_ = json.Unmarshal(creds.JSON, &kind)
+	source := "gcloud application-default login"
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		source = "GOOGLE_APPLICATION_CREDENTIALS=" + path
+	}
+	return fmt.Sprintf("%s credentials from %s", kind.Type, source), nil
+}
+
+func spreadsheetAccess(ctx context.Context, cfg config.Config) (string, error) {
+	svc, err := sheets.NewService(ctx, cfg, sheets.Options{})
+	if err != nil {
+		return "", err
+	}
+	return sheets.CheckAccess(ctx, svc, cfg)
+}
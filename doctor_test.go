@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+	"google.golang.org/api/option"
+	gsheets "google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+	"update-google-sheets/src/sheets"
+)
+
+// doctorSheets serves the spreadsheet metadata and write probe -doctor's
+// access check sends, failing the probe with writeStatus when set.
+func doctorSheets(t *testing.T, writeStatus int) func(context.Context, config.Config) (string, error) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp interface{}
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/values:batchUpdate") && writeStatus != 0:
+			http.Error(w, `{"error":{"code":403,"message":"The caller does not have permission"}}`, writeStatus)
+			return
+		case strings.HasSuffix(r.URL.Path, "/values:batchUpdate"):
+			resp = gsheets.BatchUpdateValuesResponse{}
+		default:
+			resp = gsheets.Spreadsheet{
+				Properties: &gsheets.SpreadsheetProperties{Title: "Budget"},
+				Sheets:     []*gsheets.Sheet{{Properties: &gsheets.SheetProperties{Title: "Plan"}}},
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return func(ctx context.Context, cfg config.Config) (string, error) {
+		svc, err := gsheets.NewService(ctx, option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+		if err != nil {
+			return "", err
+		}
+		return sheets.CheckAccess(ctx, svc, cfg)
+	}
+}
+
+func TestRunDoctor(t *testing.T) {
+	dir := t.TempDir()
+	workbook := filepath.Join(dir, "book.xlsx")
+	f := excelize.NewFile()
+	if err := f.SetSheetName("Sheet1", "Plan"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetCellValue("Plan", "B2", "Alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SaveAs(workbook); err != nil {
+		t.Fatal(err)
+	}
+	const id = "1AbCdEfGhIjKlMnOpQrStUvWxYz0123456789"
+	good := "spreadsheet_id: " + id + "\nlookup_value: Alice\nconfig_xlsx: " + workbook + "\n"
+	writeConfig := func(yaml string) string {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	noCredentials := func(context.Context) (string, error) { return "", errors.New("could not find default credentials") }
+
+	tests := []struct {
+		name        string
+		configPath  string
+		credentials func(context.Context) (string, error)
+		writeStatus int
+		reachable   error
+		code        int
+		lines       []string
+	}{
+		{
+			name:       "all pass",
+			configPath: writeConfig(good),
+			lines: []string{
+				"[PASS] config: ",
+				"[PASS] workbook: " + workbook + " opened; sheets Plan",
+				`[PASS] lookup value: "Alice" found 1 time(s): Plan!B2`,
+				"[PASS] credentials: service_account credentials from test",
+				`[PASS] spreadsheet access: "Budget" (` + id + ") is readable and writable",
+				"[PASS] timezone data: ",
+				"[PASS] network: sheets.googleapis.com:443 reachable",
+			},
+		},
+		{
+			name:       "missing config skips what depends on it",
+			configPath: filepath.Join(dir, "absent.yaml"),
+			code:       1,
+			lines: []string{
+				"[FAIL] config: ",
+				"[SKIP] workbook: skipped: config is invalid",
+				"[SKIP] lookup value: skipped: config is invalid",
+				"[PASS] credentials: ",
+				"[SKIP] spreadsheet access: skipped: config is invalid",
+				"[PASS] timezone data: ",
+				"[PASS] network: ",
+			},
+		},
+		{
+			name:       "lookup value not in the workbook",
+			configPath: writeConfig(strings.Replace(good, "Alice", "Carol", 1)),
+			code:       1,
+			lines: []string{
+				"[PASS] config: ",
+				"[PASS] workbook: ",
+				"[FAIL] lookup value: ",
+				"[PASS] credentials: ",
+				"[PASS] spreadsheet access: ",
+				"[PASS] timezone data: ",
+				"[PASS] network: ",
+			},
+		},
+		{
+			name:        "no credentials",
+			configPath:  writeConfig(good),
+			credentials: noCredentials,
+			code:        1,
+			lines: []string{
+				"[PASS] config: ",
+				"[PASS] workbook: ",
+				"[PASS] lookup value: ",
+				"[FAIL] credentials: could not find default credentials",
+				"[SKIP] spreadsheet access: skipped: no credentials",
+				"[PASS] timezone data: ",
+				"[PASS] network: ",
+			},
+		},
+		{
+			name:        "read-only access",
+			configPath:  writeConfig(good),
+			writeStatus: http.StatusForbidden,
+			code:        1,
+			lines: []string{
+				"[PASS] config: ",
+				"[PASS] workbook: ",
+				"[PASS] lookup value: ",
+				"[PASS] credentials: ",
+				"[FAIL] spreadsheet access: ",
+				"[PASS] timezone data: ",
+				"[PASS] network: ",
+			},
+		},
+		{
+			name:       "network down",
+			configPath: writeConfig(good),
+			reachable:  errors.New("reach https://sheets.googleapis.com/: connection refused"),
+			code:       1,
+			lines: []string{
+				"[PASS] config: ",
+				"[PASS] workbook: ",
+				"[PASS] lookup value: ",
+				"[PASS] credentials: ",
+				"[PASS] spreadsheet access: ",
+				"[PASS] timezone data: ",
+				"[FAIL] network: reach https://sheets.googleapis.com/: connection refused",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := doctorTestEnv(t, tt.configPath, tt.credentials, tt.writeStatus, tt.reachable)
+			var out bytes.Buffer
+			env.out = &out
+			if code := runDoctor(context.Background(), env, "", false); code != tt.code {
+				t.Errorf("exit code = %d, want %d", code, tt.code)
+			}
+			lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			if len(lines) != len(tt.lines) {
+				t.Fatalf("output:\n%s\nwant %d lines", out.String(), len(tt.lines))
+			}
+			for i, want := range tt.lines {
+				if !strings.HasPrefix(lines[i], want) || (!strings.HasSuffix(want, ": ") && lines[i] != want) {
+					t.Errorf("line %d = %q, want %q", i+1, lines[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunDoctorJSON(t *testing.T) {
+	env := doctorTestEnv(t, filepath.Join(t.TempDir(), "absent.yaml"), nil, 0, nil)
+	var out bytes.Buffer
+	env.out = &out
+	if code := runDoctor(context.Background(), env, "", true); code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+	var result struct {
+		OK     bool          `json:"ok"`
+		Checks []doctorCheck `json:"checks"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("output %q: %v", out.String(), err)
+	}
+	if result.OK {
+		t.Error("ok = true with a missing config")
+	}
+	var names []string
+	for _, c := range result.Checks {
+		names = append(names, c.Name)
+	}
+	if got, want := strings.Join(names, ","), "config,workbook,lookup value,credentials,spreadsheet access,timezone data,network"; got != want {
+		t.Errorf("checks = %s, want %s", got, want)
+	}
+	if c := result.Checks[0]; c.OK || !c.Critical {
+		t.Errorf("config check = %+v, want a critical failure", c)
+	}
+	if c := result.Checks[1]; !c.Skipped || c.Detail != "skipped: config is invalid" {
+		t.Errorf("workbook check = %+v, want skipped", c)
+	}
+	if !strings.Contains(out.String(), `"skipped": true`) || strings.Count(out.String(), `"skipped"`) != 3 {
+		t.Errorf("skipped is not omitted from checks that ran:\n%s", out.String())
+	}
+}
+
+// doctorTestEnv examines configPath with fake credentials, a fake Sheets
+// server and a network probe returning reachable.
+func doctorTestEnv(t *testing.T, configPath string, credentials func(context.Context) (string, error), writeStatus int, reachable error) doctorEnv {
+	if credentials == nil {
+		credentials = func(context.Context) (string, error) { return "service_account credentials from test", nil }
+	}
+	return doctorEnv{
+		configPath:  configPath,
+		credentials: credentials,
+		access:      doctorSheets(t, writeStatus),
+		reachable:   func(context.Context, config.Config) error { return reachable },
+	}
+}
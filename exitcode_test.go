@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+	"go.uber.org/zap"
+
+	"update-google-sheets/pkg/sheetsync"
+	"update-google-sheets/src/config"
+)
+
+func TestExitCode(t *testing.T) {
+	discrepant := sheetsync.Summary{Discrepancies: []sheetsync.Discrepancy{{}}}
+	skipped := sheetsync.Summary{SkippedReason: "already up to date"}
+	tests := []struct {
+		name    string
+		summary sheetsync.Summary
+		err     error
+		flags   runFlags
+		want    int
+	}{
+		{"success", sheetsync.Summary{}, nil, runFlags{}, 0},
+		{"failure", sheetsync.Summary{}, errors.New("boom"), runFlags{}, 1},
+		{"failure under check", discrepant, errors.New("boom"), runFlags{check: true}, 1},
+		{"check consistent", sheetsync.Summary{AlreadyCorrect: 2}, nil, runFlags{check: true}, 0},
+		{"check discrepancies", discrepant, nil, runFlags{check: true}, exitInconsistent},
+		{"report", skipped, nil, runFlags{reportPath: "report.csv", failOnSkip: true}, 0},
+		{"dry run", sheetsync.Summary{DryRun: true}, nil, runFlags{failOnSkip: true}, 0},
+		{"skip", skipped, nil, runFlags{}, 0},
+		{"skip with fail-on-skip", skipped, nil, runFlags{failOnSkip: true}, 1},
+		{"fail-on-skip after updates", sheetsync.Summary{Ranges: []string{"Plan!B2"}}, nil, runFlags{failOnSkip: true}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.summary, tt.err, tt.flags); got != tt.want {
+				t.Errorf("exitCode = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckOutcome(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Schedule.xlsx")
+	f := excelize.NewFile()
+	t.Cleanup(func() { _ = f.Close() })
+	if err := f.SetSheetName("Sheet1", "Plan"); err != nil {
+		t.Fatal(err)
+	}
+	for _, cell := range []string{"A1", "A2"} {
+		if err := f.SetCellValue("Plan", cell, "Alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		remote map[string][][]interface{}
+		code   int
+		want   []sheetsync.Discrepancy
+	}{
+		{"consistent", map[string][][]interface{}{"Plan!B1": {{"Alice"}}, "Plan!B2": {{"Alice"}}}, 0, []sheetsync.Discrepancy{}},
+		{"remote differs", map[string][][]interface{}{"Plan!B1": {{"Bob"}}, "Plan!B2": {{"Alice"}}}, exitInconsistent,
+			[]sheetsync.Discrepancy{{Cell: "Plan!B1", Expected: "Alice", Actual: "Bob"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path, TargetColOffset: 1}
+			updater := sheetsync.NewUpdater(sheetsync.WithService(remoteSheets(t, tt.remote)), sheetsync.WithCheck())
+			summary, err := updater.Run(ctx, cfg)
+			code, result := outcome(ctx, zap.NewNop(), cfg, summary, err, runFlags{check: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != tt.code {
+				t.Errorf("exit code = %d, want %d", code, tt.code)
+			}
+			if result == nil {
+				t.Fatal("no -check result")
+			}
+			if result.Consistent != (len(tt.want) == 0) || result.Checked != 2 || !reflect.DeepEqual(result.Discrepancies, tt.want) {
+				t.Errorf("result = %+v, want 2 checked with discrepancies %+v", *result, tt.want)
+			}
+		})
+	}
+}
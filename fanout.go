@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+
+	"update-google-sheets/pkg/sheetsync"
+	"update-google-sheets/src/config"
+)
+
+// runFanOut applies cfg to every spreadsheet of spreadsheet_ids, logs
+// each outcome and then a line per spreadsheet, and returns the highest
+// exit code.
+func runFanOut(ctx context.Context, log *zap.Logger, updater *sheetsync.Updater, cfg config.Config, f runFlags) int {
+	results, err := updater.RunEach(ctx, cfg)
+	if err != nil {
+		err = runtimeErr(ctx, err, f.maxRuntime)
+		log.Error("update failed", zap.Error(err))
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var (
+		code  int
+		recap []string
+	)
+	for _, r := range results {
+		if r.NotRun {
+			recap = append(recap, r.SpreadsheetID+": not run")
+			continue
+		}
+		slog := log.With(zap.String("spreadsheet_id", r.SpreadsheetID))
+		c, _ := outcome(ctx, slog, cfg, r.Summary, r.Err, f)
+		code = max(code, c)
+		switch {
+		case r.Err != nil:
+			recap = append(recap, fmt.Sprintf("%s: failed: %v", r.SpreadsheetID, r.Err))
+		case r.Summary.SkippedReason != "":
+			recap = append(recap, fmt.Sprintf("%s: skipped: %s", r.SpreadsheetID, r.Summary.SkippedReason))
+		default:
+			recap = append(recap, fmt.Sprintf("%s: ok, %d cells in %d ranges", r.SpreadsheetID, r.Summary.TotalCells, len(r.Summary.Ranges)))
+		}
+	}
+	log.Info("fan-out complete", zap.Strings("spreadsheets", recap))
+	return code
+}
@@ -2,62 +2,524 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"time"
+	_ "time/tzdata" // timezones work on images without tzdata installed
 
+	survey "github.com/AlecAivazis/survey/v2"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
 
+	"update-google-sheets/pkg/sheetsync"
 	"update-google-sheets/src/config"
 	"update-google-sheets/src/logger"
-	sheetops "update-google-sheets/src/sheets"
+	"update-google-sheets/src/secrets"
 )
 
 func main() {
-	cfg, err := config.Load(config.DefaultPath)
+	failOnSkip := flag.Bool("fail-on-skip", false, "Exit non-zero when the run performs no updates")
+	assumeYes := flag.Bool("yes", false, "Skip the confirmation prompt before writing")
+	interactiveReview := flag.Bool("interactive-review", false, "Ask about each range before writing it and write only the approved ones (needs a terminal)")
+	dryRun := flag.Bool("dry-run", false, "Plan the run and report what would change without writing")
+	dryRunCheckWrite := flag.Bool("dry-run-check-write", false, "Dry run that also verifies write access with a no-op write")
+	inPlace := flag.Bool("in-place", false, "In pull mode, overwrite the workbook instead of writing <name>.updated.xlsx")
+	reportPath := flag.String("report", "", "Write a CSV reconciliation of matched cells against Google Sheets to this path instead of updating")
+	check := flag.Bool("check", false, "Verify every target cell already matches Google Sheets; print discrepancies as JSON and exit 3 when any differ")
+	importPath := flag.String("import", "", "Push the range,value rows of this CSV instead of scanning the workbook")
+	emitPath := flag.String("emit-ranges", "", "Save the run's target ranges as JSON to this path, for a later -ranges-from")
+	rangesFrom := flag.String("ranges-from", "", "Write into the ranges saved by an earlier -emit-ranges instead of scanning the workbook")
+	responseOut := flag.String("response-out", "", "Save the Sheets API response to the run's writes, with the values echoed for each range, as JSON to this path")
+	maxRuntime := flag.Duration("max-runtime", 0, "Abort the whole run, including workbook parsing, after this long (e.g. 5m); 0 disables")
+	reprocess := flag.Bool("reprocess", false, "Write lookup values that state_file already records as done")
+	printConfig := flag.Bool("print-config", false, "Print the effective config, after defaults and secret resolution, as YAML with secrets redacted, and exit")
+	validatePath := flag.String("validate", "", "Lint this config file (settings, workbook, spreadsheet ID) without calling any API, then exit")
+	doctor := flag.Bool("doctor", false, "Check the config, workbook, credentials, spreadsheet access and network, print pass/fail for each and exit")
+	asJSON := flag.Bool("json", false, "With -doctor, print the results as JSON")
+	debug := flag.Bool("debug", false, "Log at debug level, including every Sheets API request with its latency and a latency summary per API method")
+	auditTail := flag.Int("audit-tail", 0, "Print the last `N` records of audit_log and exit")
+	var sets setPairs
+	flag.Var(&sets, "set", "Find the lookup in the workbook and write the value at the target, overriding lookup_value and write_value (`lookup=value`); repeat to run several pairs in turn")
+	flag.Parse()
+
+	ctx := context.Background()
+	if *maxRuntime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *maxRuntime)
+		defer cancel()
+	}
+
+	if *validatePath != "" {
+		os.Exit(runValidate(*validatePath, *importPath))
+	}
+	if *doctor {
+		os.Exit(runDoctor(ctx, liveDoctorEnv(), *importPath, *asJSON))
+	}
+	if *auditTail > 0 {
+		os.Exit(runAuditTail(config.DefaultPath, *auditTail, os.Stdout))
+	}
+
+	cfgs, err := config.LoadAll(config.DefaultPath)
 	if err != nil {
 		exitErr("%v", err)
 	}
+	pipeline := len(cfgs) > 1
+	if pipeline && (*importPath != "" || len(sets) > 0 || *reportPath != "" || *emitPath != "" || *rangesFrom != "" || *responseOut != "") {
+		exitErr("-import, -set, -report, -emit-ranges, -ranges-from and -response-out cannot be combined with a multi-document config")
+	}
+	if *responseOut != "" && (*dryRun || *dryRunCheckWrite || *check || *reportPath != "") {
+		exitErr("-response-out only applies to runs that write; drop -dry-run, -dry-run-check-write, -check and -report")
+	}
 
-	if err := cfg.Validate(); err != nil {
-		exitErr("%v", err)
+	if *interactiveReview && (*dryRun || *dryRunCheckWrite || *check || *reportPath != "") {
+		exitErr("-interactive-review only applies to runs that write; drop -dry-run, -dry-run-check-write, -check and -report")
+	}
+	if *interactiveReview && !isTerminal(os.Stdin) {
+		exitErr("-interactive-review needs a terminal to prompt on")
 	}
 
-	log, err := logger.New()
+	if len(sets) > 1 && (*emitPath != "" || *responseOut != "") {
+		exitErr("-emit-ranges and -response-out save one run's output and cannot be combined with several -set pairs")
+	}
+
+	var resolver config.SecretResolver
+	raws := make([]config.Config, len(cfgs))
+	for i := range cfgs {
+		cfg := &cfgs[i]
+		if *importPath != "" {
+			cfg.ImportFile = *importPath
+		}
+		if *rangesFrom != "" {
+			cfg.RangesFrom = *rangesFrom
+		}
+		if len(sets) > 0 {
+			if cfg.ImportFile != "" || cfg.RangesFrom != "" {
+				exitErr("-set cannot be combined with -import, -ranges-from, import_file or ranges_from")
+			}
+			// Validate the first pair here; every pair is validated again when it runs.
+			*cfg = sets.configs(*cfg)[0]
+		}
+
+		raws[i] = *cfg
+		if cfg.HasSecretRefs() {
+			if resolver == nil {
+				if resolver, err = secrets.NewSecretManager(ctx); err != nil {
+					exitErr("%v", err)
+				}
+			}
+			if err := cfg.ResolveSecrets(ctx, resolver); err != nil {
+				exitErr("%v", docErr(pipeline, i, runtimeErr(ctx, err, *maxRuntime)))
+			}
+		}
+
+		if err := cfg.Validate(); err != nil {
+			exitErr("%v", docErr(pipeline, i, err))
+		}
+		if len(cfg.SpreadsheetIDs) > 0 {
+			if pipeline {
+				exitErr("%v", docErr(pipeline, i, errors.New("spreadsheet_ids is not available in a multi-document config")))
+			}
+			if *check || *reportPath != "" || *emitPath != "" || *responseOut != "" {
+				exitErr("-check, -report, -emit-ranges and -response-out cannot be combined with spreadsheet_ids")
+			}
+		}
+		if *interactiveReview && (cfg.Mode != config.ModeWrite && cfg.Mode != config.ModeSync || cfg.InsertRowBeforeMatch) {
+			exitErr("%v", docErr(pipeline, i, fmt.Errorf("-interactive-review needs mode %s or %s without insert_row_before_match", config.ModeWrite, config.ModeSync)))
+		}
+	}
+	if *printConfig {
+		enc := yaml.NewEncoder(os.Stdout)
+		for i, cfg := range cfgs {
+			if err := enc.Encode(cfg.Redacted(raws[i])); err != nil {
+				exitErr("encode config: %v", err)
+			}
+		}
+		_ = enc.Close()
+		return
+	}
+	cfg := cfgs[0]
+
+	level := zapcore.InfoLevel
+	if *debug {
+		level = zapcore.DebugLevel
+	}
+	log, err := logger.NewAt(level)
 	if err != nil {
 		exitErr("initialise logger: %v", err)
 	}
 	defer func() { _ = log.Sync() }()
-	log.Info(
-		"using configuration",
-		zap.String("spreadsheet_id", cfg.SpreadsheetID),
-		zap.String("workbook", config.DefaultWorkbook),
-		zap.String("sheet_filter", cfg.SheetFilter),
-		zap.String("lookup_value", cfg.LookupValue),
-	)
+	if pipeline {
+		log.Info("using multi-document configuration", zap.Int("documents", len(cfgs)))
+	} else {
+		log.Info(
+			"using configuration",
+			zap.String("spreadsheet_id", cfg.SpreadsheetID),
+			zap.Strings("spreadsheet_ids", cfg.SpreadsheetIDs),
+			zap.String("workbook", cfg.Workbook),
+			zap.Strings("sheet_filter", cfg.SheetFilter),
+			zap.String("lookup_value", cfg.LookupValue),
+			zap.String("mode", cfg.Mode),
+		)
+	}
+
+	confirm := func(preview string) (bool, error) {
+		log.Info("preview", zap.String("preview", preview))
+		if *assumeYes || !isTerminal(os.Stdin) {
+			return true, nil
+		}
+		var ok bool
+		err := survey.AskOne(&survey.Confirm{Message: preview + " Continue?"}, &ok)
+		return ok, err
+	}
+
+	opts := []sheetsync.UpdaterOption{sheetsync.WithConfirm(confirm), sheetsync.WithLogger(log)}
+	if *interactiveReview {
+		opts = append(opts, sheetsync.WithReview(reviewRange))
+	}
+	switch {
+	case *dryRunCheckWrite:
+		opts = append(opts, sheetsync.WithWriteCheck())
+	case *dryRun:
+		opts = append(opts, sheetsync.WithDryRun())
+	}
+	if *inPlace {
+		opts = append(opts, sheetsync.WithInPlace())
+	}
+	if *check {
+		opts = append(opts, sheetsync.WithCheck())
+	}
+	if *reprocess {
+		opts = append(opts, sheetsync.WithReprocess())
+	}
+	if *reportPath != "" {
+		report, err := os.Create(*reportPath)
+		if err != nil {
+			exitErr("create report: %v", err)
+		}
+		defer func() { _ = report.Close() }()
+		opts = append(opts, sheetsync.WithReport(report))
+	}
+	if *emitPath != "" {
+		emit, err := os.Create(*emitPath)
+		if err != nil {
+			exitErr("create ranges file: %v", err)
+		}
+		defer func() { _ = emit.Close() }()
+		opts = append(opts, sheetsync.WithEmitRanges(emit))
+	}
+	if *responseOut != "" {
+		out, err := os.Create(*responseOut)
+		if err != nil {
+			exitErr("create response file: %v", err)
+		}
+		defer func() { _ = out.Close() }()
+		opts = append(opts, sheetsync.WithResponseOut(out))
+	}
+	updater := sheetsync.NewUpdater(opts...)
+	if cfg.QuotaProject != "" {
+		log.Info("using quota project", zap.String("quota_project", cfg.QuotaProject))
+	}
+	if cfg.ProxyURL != "" {
+		log.Info("using proxy", zap.String("proxy_url", redactURL(cfg.ProxyURL)))
+	}
+	if cfg.CABundleFile != "" {
+		log.Info("trusting extra CA bundle", zap.String("ca_bundle_file", cfg.CABundleFile))
+	}
+	log.Info("using oauth scope", zap.String("scope", updater.Scope()))
+	flags := runFlags{check: *check, reportPath: *reportPath, emitPath: *emitPath, responseOut: *responseOut, failOnSkip: *failOnSkip, maxRuntime: *maxRuntime}
+	code := 0
+	if pipeline {
+		code = runPipeline(ctx, log, updater, cfgs, flags, os.Stdout)
+	} else {
+		for _, run := range sets.configs(cfg) {
+			if len(sets) > 0 {
+				log.Info("running -set pair", zap.String("lookup_value", run.LookupValue), zap.String("write_value", run.WriteValue))
+			}
+			if len(run.SpreadsheetIDs) > 0 {
+				code = max(code, runFanOut(ctx, log, updater, run, flags))
+				continue
+			}
+			code = max(code, runOnce(ctx, log, updater, run, flags))
+		}
+	}
+	if code != 0 {
+		_ = log.Sync()
+		os.Exit(code)
+	}
+}
 
-	summary, err := sheetops.Update(context.Background(), cfg)
+// runFlags are the command-line flags that shape how a run's outcome is
+// reported.
+type runFlags struct {
+	check       bool
+	reportPath  string
+	emitPath    string
+	responseOut string
+	failOnSkip  bool
+	maxRuntime  time.Duration
+}
+
+// runOnce performs one run of cfg, logs its outcome and returns the exit
+// code it calls for.
+func runOnce(ctx context.Context, log *zap.Logger, updater *sheetsync.Updater, cfg config.Config, f runFlags) int {
+	summary, err := updater.Run(ctx, cfg)
+	code, result := outcome(ctx, log, cfg, summary, err, f)
+	if result != nil {
+		if err := printJSON(os.Stdout, result); err != nil {
+			log.Error("encode check result", zap.Error(err))
+			return 1
+		}
+	}
+	return code
+}
+
+// outcome logs the result of one run and returns the exit code it calls
+// for, plus the -check result when -check is set and the run succeeded.
+func outcome(ctx context.Context, log *zap.Logger, cfg config.Config, summary sheetsync.Summary, err error, f runFlags) (int, *checkResult) {
+	code := exitCode(summary, err, f)
 	if err != nil {
+		err = runtimeErr(ctx, err, f.maxRuntime)
 		log.Error("update failed", zap.Error(err))
-		exitErr("%v", err)
+		fmt.Fprintln(os.Stderr, err)
+		return code, nil
+	}
+	if len(summary.ResolvedSheetFilters) > 0 {
+		log.Info("sheet indexes resolved", zap.Strings("config_sheet", summary.ResolvedSheetFilters))
 	}
 	if len(summary.TemplateSheets) > 0 {
 		log.Info("template sheets scanned", zap.Strings("template_sheets", summary.TemplateSheets))
 	}
+	if len(summary.Matches) > 0 {
+		cells := make([]string, len(summary.Matches))
+		headers := make([]string, len(summary.Matches))
+		for i, m := range summary.Matches {
+			cells[i], headers[i] = m.A1, m.Header
+		}
+		log.Info("lookup value matched", zap.Int("count", len(cells)), zap.Strings("cells", cells), zap.Strings("headers", headers))
+	}
 	if len(summary.TargetSheets) > 0 {
 		log.Info("target sheets detected", zap.Strings("target_sheets", summary.TargetSheets))
 	}
+	if len(summary.Anchors) > 0 {
+		log.Info("anchor targets", zap.Strings("anchors", summary.Anchors))
+	}
+	if len(summary.StoppedEarly) > 0 {
+		log.Info("sheet scan stopped early", zap.Strings("sheets", summary.StoppedEarly))
+	}
+	if len(summary.ScanTruncated) > 0 {
+		log.Debug("sheet scan truncated", zap.Strings("sheets", summary.ScanTruncated))
+	}
+	if len(summary.Protected) > 0 {
+		log.Warn("header row protected", zap.Strings("protected", summary.Protected))
+	}
+	if len(summary.Overrides) > 0 {
+		log.Info("sheet overrides applied", zap.Strings("overrides", summary.Overrides))
+	}
+	if len(summary.Occupied) > 0 {
+		log.Info("occupied target cells", zap.Strings("occupied", summary.Occupied))
+	}
+	if summary.RetryCount > 0 {
+		log.Info("retried transient API errors", zap.Int("retries", summary.RetryCount), zap.Int("retry_budget", summary.RetryBudget))
+	}
+	if len(summary.SkippedMatches) > 0 {
+		log.Warn("matches skipped", zap.Strings("skipped_matches", summary.SkippedMatches))
+	}
+	if f.emitPath != "" {
+		log.Info("target ranges saved", zap.String("path", f.emitPath), zap.Int("ranges", summary.EmittedRanges))
+	}
+
+	if f.check {
+		result := checkOutcome(log, summary)
+		return code, &result
+	}
+	if f.reportPath != "" {
+		log.Info("reconciliation report written", zap.String("path", f.reportPath), zap.Int("rows", summary.ReportRows))
+		return code, nil
+	}
+
+	if cfg.Mode == config.ModeSync {
+		log.Info(
+			"sync results",
+			zap.Int("filled_empty", summary.FilledEmpty),
+			zap.Int("corrected_differing", summary.CorrectedDiffering),
+			zap.Int("already_correct", summary.AlreadyCorrect),
+		)
+	}
+	if summary.Touched != "" {
+		log.Info("touched sync timestamp", zap.String("cell", summary.Touched))
+	}
+
+	if summary.DryRun {
+		log.Info(
+			"dry run complete; nothing written",
+			zap.Strings("planned_ranges", summary.Ranges),
+			zap.Bool("write_access_checked", summary.WriteChecked),
+		)
+		return code, nil
+	}
 
 	if summary.SkippedReason != "" {
-		log.Info("no updates performed", zap.String("reason", summary.SkippedReason))
-		return
+		if f.failOnSkip {
+			log.Error("no updates performed", zap.String("reason", summary.SkippedReason))
+			fmt.Fprintf(os.Stderr, "no updates performed: %s\n", summary.SkippedReason)
+		} else {
+			log.Info("no updates performed", zap.String("reason", summary.SkippedReason))
+		}
+		return code, nil
 	}
 
+	if len(summary.Pulled) > 0 {
+		log.Info("pulled cells into workbook", zap.String("workbook", summary.PulledTo), zap.Strings("cells", summary.Pulled))
+	}
+	if len(summary.ConditionalFormats) > 0 {
+		log.Info("added conditional format rule", zap.Strings("columns", summary.ConditionalFormats))
+	}
+	if summary.NumberFormatted > 0 {
+		log.Info("applied number format", zap.Int("cells", summary.NumberFormatted))
+	}
+	if len(summary.Unverified) > 0 {
+		log.Warn("written values differ from what was sent", zap.Strings("cells", summary.Unverified))
+	}
+	if len(summary.CreatedSheets) > 0 {
+		log.Info("sheets created", zap.Strings("sheets", summary.CreatedSheets))
+	}
+	if summary.Snapshot != "" {
+		log.Info("snapshot saved", zap.String("dir", summary.Snapshot))
+	}
+	if summary.UndoFile != "" {
+		log.Info("undo file saved", zap.String("file", summary.UndoFile))
+	}
+	if len(summary.SnapshotSkipped) > 0 {
+		log.Warn("snapshot incomplete", zap.Strings("skipped", summary.SnapshotSkipped))
+	}
+	if summary.ResponseSaved {
+		log.Info("API response saved", zap.String("path", f.responseOut))
+	}
+	if summary.WorkbookLogged > 0 {
+		log.Info("recorded run in workbook", zap.String("sheet", sheetsync.WorkbookLogSheet), zap.Int("rows", summary.WorkbookLogged))
+	}
+	if summary.AuditLogged > 0 {
+		log.Info("recorded changes in audit log", zap.String("run_id", summary.RunID), zap.Int("records", summary.AuditLogged))
+	}
+	if len(summary.Rejected) > 0 {
+		log.Info("ranges rejected at review", zap.Strings("ranges", summary.Rejected))
+	}
+	if len(summary.Cleared) > 0 {
+		log.Info("cleared previous values", zap.Strings("cleared", summary.Cleared))
+	}
 	log.Info(
 		"update complete",
 		zap.Strings("ranges", summary.Ranges),
 		zap.Int64("rows", summary.TotalRows),
 		zap.Int64("cells", summary.TotalCells),
+		zap.Duration("api_duration", summary.APIDuration),
+		zap.Int("retries", summary.RetryCount),
 	)
+	return code, nil
+}
+
+// exitInconsistent is the -check exit code when discrepancies are found,
+// distinct from the generic failure code 1.
+const exitInconsistent = 3
+
+// exitCode returns the exit code a run calls for: 1 when it failed or,
+// under -fail-on-skip, performed no updates; exitInconsistent when -check
+// found discrepancies; 0 otherwise.
+func exitCode(summary sheetsync.Summary, err error, f runFlags) int {
+	switch {
+	case err != nil:
+		return 1
+	case f.check:
+		if len(summary.Discrepancies) > 0 {
+			return exitInconsistent
+		}
+		return 0
+	case f.reportPath != "" || summary.DryRun:
+		return 0
+	case summary.SkippedReason != "" && f.failOnSkip:
+		return 1
+	}
+	return 0
+}
+
+// checkResult is the -check outcome printed as JSON. In a pipeline each
+// document gets one, numbered, and a failed document carries its error.
+type checkResult struct {
+	Document      int                     `json:"document,omitempty"`
+	Consistent    bool                    `json:"consistent"`
+	Checked       int                     `json:"checked"`
+	Discrepancies []sheetsync.Discrepancy `json:"discrepancies"`
+	Error         string                  `json:"error,omitempty"`
+}
+
+// checkOutcome builds the -check result and logs it.
+func checkOutcome(log *zap.Logger, summary sheetsync.Summary) checkResult {
+	result := checkResult{
+		Consistent:    len(summary.Discrepancies) == 0,
+		Checked:       summary.AlreadyCorrect + len(summary.Discrepancies),
+		Discrepancies: summary.Discrepancies,
+	}
+	if result.Discrepancies == nil {
+		result.Discrepancies = []sheetsync.Discrepancy{}
+	}
+	if !result.Consistent {
+		log.Warn("workbook and spreadsheet differ", zap.Int("discrepancies", len(summary.Discrepancies)))
+		return result
+	}
+	log.Info("workbook and spreadsheet are consistent", zap.Int("cells", result.Checked))
+	return result
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
+
+// reviewRange prints the cells rng would change and asks whether to write
+// it, for -interactive-review.
+func reviewRange(rng string, changes []string) (bool, error) {
+	fmt.Printf("\n%s\n", rng)
+	for _, ch := range changes {
+		fmt.Println("  " + ch)
+	}
+	ok := true
+	err := survey.AskOne(&survey.Confirm{Message: fmt.Sprintf("Write %s?", rng), Default: true}, &ok)
+	return ok, err
+}
+
+// runtimeErr makes a failure caused by the -max-runtime deadline say so.
+func runtimeErr(ctx context.Context, err error, limit time.Duration) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("exceeded max runtime of %s: %w", limit, err)
+	}
+	return err
+}
+
+// redactURL hides any proxy password before logging.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
 }
 
 func exitErr(msg string, args ...interface{}) {
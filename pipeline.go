@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.uber.org/zap"
+
+	"update-google-sheets/pkg/sheetsync"
+	"update-google-sheets/src/config"
+)
+
+// runPipeline performs the documents of a multi-document config in order
+// with one shared client, logs each outcome and then a line per document,
+// and returns the highest exit code. A failed document stops the ones
+// after it unless it sets continue_on_error. With -check, the results are
+// printed to out as one JSON array.
+func runPipeline(ctx context.Context, log *zap.Logger, updater *sheetsync.Updater, cfgs []config.Config, f runFlags, out io.Writer) int {
+	p, err := updater.Pipeline(ctx, cfgs[0])
+	if err != nil {
+		log.Error("update failed", zap.Error(err))
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer func() { _ = p.Close() }()
+
+	var (
+		code    int
+		stopped bool
+		recap   []string
+		checks  = []checkResult{}
+	)
+	for i, cfg := range cfgs {
+		doc := i + 1
+		name := fmt.Sprintf("%d (%s)", doc, cfg.Mode)
+		if stopped {
+			recap = append(recap, name+": not run")
+			continue
+		}
+		dlog := log.With(zap.Int("document", doc))
+		dlog.Info(
+			"running document",
+			zap.String("spreadsheet_id", cfg.SpreadsheetID),
+			zap.String("lookup_value", cfg.LookupValue),
+			zap.String("mode", cfg.Mode),
+		)
+		summary, err := p.Run(ctx, cfg)
+		c, result := outcome(ctx, dlog, cfg, summary, err, f)
+		code = max(code, c)
+		switch {
+		case err != nil:
+			recap = append(recap, fmt.Sprintf("%s: failed: %v", name, err))
+			if f.check {
+				checks = append(checks, checkResult{Document: doc, Discrepancies: []sheetsync.Discrepancy{}, Error: err.Error()})
+			}
+		case result != nil:
+			result.Document = doc
+			checks = append(checks, *result)
+			recap = append(recap, fmt.Sprintf("%s: checked %d cells, %d discrepancies", name, result.Checked, len(result.Discrepancies)))
+		case summary.SkippedReason != "":
+			recap = append(recap, fmt.Sprintf("%s: skipped: %s", name, summary.SkippedReason))
+		default:
+			recap = append(recap, fmt.Sprintf("%s: ok, %d cells in %d ranges", name, summary.TotalCells, len(summary.Ranges)))
+		}
+		// Failures, including skips under -fail-on-skip, stop the pipeline;
+		// -check discrepancies do not.
+		stopped = c == 1 && !cfg.ContinueOnError
+	}
+	if f.check {
+		if err := printJSON(out, checks); err != nil {
+			log.Error("encode check result", zap.Error(err))
+			code = max(code, 1)
+		}
+	}
+	log.Info("pipeline complete", zap.Strings("documents", recap))
+	return code
+}
+
+// docErr prefixes err with its 1-based document number in a multi-document
+// config.
+func docErr(pipeline bool, i int, err error) error {
+	if !pipeline {
+		return err
+	}
+	return fmt.Errorf("document %d: %w", i+1, err)
+}
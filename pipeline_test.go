@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/pkg/sheetsync"
+	"update-google-sheets/src/config"
+)
+
+// emptySheets answers every read with an empty range and accepts every
+// write, echoing the values sent.
+func emptySheets(t *testing.T) *sheets.Service {
+	t.Helper()
+	return remoteSheets(t, nil)
+}
+
+// remoteSheets is emptySheets with reads of a range answered from cells,
+// keyed by range.
+func remoteSheets(t *testing.T, cells map[string][][]interface{}) *sheets.Service {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := interface{}(sheets.ValueRange{})
+		if _, rng, ok := strings.Cut(r.URL.Path, "/values/"); ok && r.Method == http.MethodGet {
+			resp = sheets.ValueRange{Range: rng, Values: cells[rng]}
+		}
+		if strings.HasSuffix(r.URL.Path, "/values:batchUpdate") {
+			var req sheets.BatchUpdateValuesRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			out := sheets.BatchUpdateValuesResponse{}
+			for _, vr := range req.Data {
+				out.Responses = append(out.Responses, &sheets.UpdateValuesResponse{UpdatedRange: vr.Range, UpdatedData: vr})
+				for _, row := range vr.Values {
+					out.TotalUpdatedCells += int64(len(row))
+				}
+			}
+			resp = out
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	svc, err := sheets.NewService(context.Background(), option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func TestRunPipeline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "book.xlsx")
+	f := excelize.NewFile()
+	if err := f.SetSheetName("Sheet1", "Plan"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetCellValue("Plan", "A1", "Alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	doc := func(workbook string, continueOnError bool) config.Config {
+		return config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: workbook, TargetColOffset: 1, Mode: config.ModeWrite, ContinueOnError: continueOnError}
+	}
+	missing := filepath.Join(t.TempDir(), "missing.xlsx")
+
+	tests := []struct {
+		name  string
+		cfgs  []config.Config
+		check bool
+		code  int
+		recap []string
+		// docs lists the documents of the -check JSON array and whether
+		// each carries an error.
+		docs map[int]bool
+	}{
+		{
+			name:  "every document runs",
+			cfgs:  []config.Config{doc(path, false), doc(path, false)},
+			recap: []string{"1 (write): ok, 1 cells in 1 ranges", "2 (write): ok, 1 cells in 1 ranges"},
+		},
+		{
+			name:  "a failure stops the rest",
+			cfgs:  []config.Config{doc(path, false), doc(missing, false), doc(path, false), doc(path, false)},
+			code:  1,
+			recap: []string{"1 (write): ok, 1 cells in 1 ranges", "2 (write): failed: ", "3 (write): not run", "4 (write): not run"},
+		},
+		{
+			name:  "continue_on_error runs the rest",
+			cfgs:  []config.Config{doc(missing, true), doc(path, false)},
+			code:  1,
+			recap: []string{"1 (write): failed: ", "2 (write): ok, 1 cells in 1 ranges"},
+		},
+		{
+			name:  "check prints one array",
+			cfgs:  []config.Config{doc(path, false), doc(path, false)},
+			check: true,
+			code:  exitInconsistent,
+			recap: []string{"1 (write): checked 1 cells, 1 discrepancies", "2 (write): checked 1 cells, 1 discrepancies"},
+			docs:  map[int]bool{1: false, 2: false},
+		},
+		{
+			name:  "check records the failure and stops",
+			cfgs:  []config.Config{doc(missing, false), doc(path, false)},
+			check: true,
+			code:  1,
+			recap: []string{"1 (write): failed: ", "2 (write): not run"},
+			docs:  map[int]bool{1: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []sheetsync.UpdaterOption{sheetsync.WithService(emptySheets(t))}
+			if tt.check {
+				opts = append(opts, sheetsync.WithCheck())
+			}
+			core, logs := observer.New(zap.InfoLevel)
+			var out bytes.Buffer
+			code := runPipeline(context.Background(), zap.New(core), sheetsync.NewUpdater(opts...), tt.cfgs, runFlags{check: tt.check}, &out)
+			if code != tt.code {
+				t.Errorf("exit code = %d, want %d", code, tt.code)
+			}
+
+			entries := logs.FilterMessage("pipeline complete").All()
+			if len(entries) != 1 {
+				t.Fatalf("pipeline complete logged %d times", len(entries))
+			}
+			recap, _ := entries[0].ContextMap()["documents"].([]interface{})
+			if len(recap) != len(tt.recap) {
+				t.Fatalf("recap = %q, want %q", recap, tt.recap)
+			}
+			for i, want := range tt.recap {
+				if got := fmt.Sprint(recap[i]); !strings.HasPrefix(got, want) || (!strings.HasSuffix(want, ": ") && got != want) {
+					t.Errorf("recap[%d] = %q, want %q", i, got, want)
+				}
+			}
+
+			if !tt.check {
+				if out.Len() != 0 {
+					t.Errorf("printed %q without -check", out.String())
+				}
+				return
+			}
+			var results []checkResult
+			if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+				t.Fatalf("-check output %q: %v", out.String(), err)
+			}
+			if len(results) != len(tt.docs) {
+				t.Fatalf("results = %+v, want documents %v", results, tt.docs)
+			}
+			for _, r := range results {
+				failed, ok := tt.docs[r.Document]
+				if !ok || failed != (r.Error != "") {
+					t.Errorf("result %+v, want document in %v", r, tt.docs)
+				}
+				if r.Discrepancies == nil {
+					t.Errorf("document %d discrepancies encode as null", r.Document)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+// Package sheetsync is the public API for pushing lookup-derived values from
+// an Excel workbook into Google Sheets. The update-google-sheets command is
+// a thin wrapper around it.
+//
+// Nothing here reads the CLI's config file or default paths: callers build a
+// Config themselves and name the workbook explicitly.
+//
+//	u := sheetsync.NewUpdater(sheetsync.WithLogger(logger))
+//	summary, err := u.Run(ctx, sheetsync.Config{
+//		SpreadsheetID: "1EXmDCBWbrCynRtxOn2eRVj9eMt3yIKwSqFRtnenRm3E",
+//		SheetFilter:   sheetsync.SheetList{"Week 1"},
+//		LookupValue:   "Alice",
+//		Workbook:      "/srv/planning/Schedule.xlsx",
+//	})
+//	if errors.Is(err, sheetsync.ErrValueNotFound) {
+//		// nothing to do this week
+//	}
+//
+// Plan and Apply split a run so the planned writes can be reviewed first.
+// Apply refuses with ErrPlanChanged if the writes it finds differ from the
+// plan:
+//
+//	plan, err := u.Plan(ctx, cfg)
+//	if err != nil {
+//		return err
+//	}
+//	log.Print(plan.Summary.Preview)
+//	summary, err := u.Apply(ctx, plan)
+//
+// Workbooks need not live on disk. OpenWorkbook reads one from any
+// io.Reader, optionally encrypted or size-limited, and WithWorkbook hands it
+// to the Updater:
+//
+//	wb, err := sheetsync.OpenWorkbook(req.Body, "upload.xlsx", sheetsync.WithUnzipSizeLimit(32<<20))
+//	if err != nil {
+//		return err
+//	}
+//	defer wb.Close()
+//	summary, err := sheetsync.Update(ctx, cfg, sheetsync.WithWorkbook(wb))
+//
+// Run-time behaviour is set with functional options on NewUpdater, such as
+// WithDryRun, WithConfirm or WithWriteValue, so nothing needs YAML. Update
+// is a one-shot shorthand:
+//
+//	summary, err := sheetsync.Update(ctx, cfg, sheetsync.WithDryRun())
+//
+// Credentials default to Application Default Credentials. WithClientOptions
+// adds client options such as option.WithCredentialsFile, WithHTTPClient
+// supplies an authenticating HTTP client, and WithService supplies a
+// ready-made Sheets service.
+//
+// WithSource takes the ranges and values from a ValueSource instead of
+// scanning the workbook, so a run can write values from anywhere:
+//
+//	src := sheetsync.StaticSource{Ranges: []string{"'Daily'!B2:B9"}, Value: "done"}
+//	summary, err := sheetsync.Update(ctx, cfg, sheetsync.WithSource(src))
+package sheetsync
@@ -0,0 +1,107 @@
+package sheetsync_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/pkg/sheetsync"
+)
+
+// exampleService returns a Sheets service backed by an empty, in-memory
+// stand-in for the API; real callers rely on Application Default
+// Credentials instead.
+func exampleService() (*sheets.Service, func()) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp interface{} = sheets.ValueRange{}
+		if strings.HasSuffix(r.URL.Path, "/values:batchUpdate") {
+			var req sheets.BatchUpdateValuesRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			out := sheets.BatchUpdateValuesResponse{}
+			for _, vr := range req.Data {
+				out.Responses = append(out.Responses, &sheets.UpdateValuesResponse{UpdatedRange: vr.Range, UpdatedData: vr})
+				for _, row := range vr.Values {
+					out.TotalUpdatedCells += int64(len(row))
+				}
+			}
+			resp = out
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	svc, err := sheets.NewService(context.Background(), option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+	if err != nil {
+		panic(err)
+	}
+	return svc, srv.Close
+}
+
+func ExampleUpdater_Plan() {
+	svc, done := exampleService()
+	defer done()
+	ctx := context.Background()
+
+	u := sheetsync.NewUpdater(sheetsync.WithService(svc))
+	plan, err := u.Plan(ctx, sheetsync.Config{
+		SpreadsheetID: "example-sheet",
+		SheetFilter:   sheetsync.SheetList{"Week 1"},
+		LookupValue:   "Alice",
+		Workbook:      "testdata/Schedule.xlsx",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(plan.Summary.Preview)
+	summary, err := u.Apply(ctx, plan)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(summary.Ranges, summary.TotalCells)
+	// Output:
+	// About to write 2 cells across 1 sheet in spreadsheet example-sheet.
+	// ['Week 1'!A2 'Week 1'!B3] 2
+}
+
+func ExampleUpdate() {
+	svc, done := exampleService()
+	defer done()
+
+	summary, err := sheetsync.Update(context.Background(), sheetsync.Config{
+		SpreadsheetID: "example-sheet",
+		SheetFilter:   sheetsync.SheetList{"Week 1"},
+		LookupValue:   "Alice",
+		Workbook:      "testdata/Schedule.xlsx",
+	}, sheetsync.WithService(svc), sheetsync.WithDryRun())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(summary.DryRun, summary.Ranges)
+	// Output:
+	// true ['Week 1'!A2 'Week 1'!B3]
+}
+
+func ExampleErrNoWorkbook() {
+	svc, done := exampleService()
+	defer done()
+
+	_, err := sheetsync.Update(context.Background(), sheetsync.Config{
+		SpreadsheetID: "example-sheet",
+		LookupValue:   "Alice",
+	}, sheetsync.WithService(svc))
+	fmt.Println(errors.Is(err, sheetsync.ErrNoWorkbook))
+	// Output:
+	// true
+}
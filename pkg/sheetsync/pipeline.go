@@ -0,0 +1,98 @@
+package sheetsync
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+	sheetops "update-google-sheets/src/sheets"
+)
+
+// Pipeline performs several runs in order, such as the documents of a
+// multi-document config file, with one Sheets service and each workbook
+// opened once. Build one with Updater.Pipeline and Close it when done.
+type Pipeline struct {
+	u     *Updater
+	first Config
+	svc   *sheets.Service
+	// opts carries the retry budget and API clock every run shares.
+	opts  Options
+	books map[string]*Workbook
+}
+
+// Pipeline builds the service for a sequence of runs from first, which
+// also supplies the retry settings; every run must use the same
+// quota_project, proxy_url and ca_bundle_file.
+func (u *Updater) Pipeline(ctx context.Context, first Config) (*Pipeline, error) {
+	p := &Pipeline{u: u, first: first, svc: u.svc, opts: u.opts, books: make(map[string]*Workbook)}
+	if p.svc == nil {
+		if err := first.ValidateSettings(); err != nil {
+			return nil, err
+		}
+		svc, err := u.newService(ctx, first, &p.opts)
+		if err != nil {
+			return nil, err
+		}
+		p.svc = svc
+	}
+	return p, nil
+}
+
+// Run performs one run of the pipeline. Its Summary counts only this run's
+// retries and API time.
+func (p *Pipeline) Run(ctx context.Context, cfg Config) (Summary, error) {
+	if !sameClient(cfg, p.first) {
+		return Summary{}, errors.New("quota_project, proxy_url and ca_bundle_file must be the same for every run of a pipeline, which shares one client")
+	}
+	opts := p.opts
+	if opts.Workbook == nil && opts.Source == nil && sharesWorkbook(cfg) {
+		wb, err := p.workbook(strings.TrimSpace(cfg.Workbook))
+		if err != nil {
+			return Summary{}, err
+		}
+		opts.Workbook = wb
+	}
+	retries, elapsed := opts.Retries.Used(), opts.Clock.Elapsed()
+	summary, err := p.u.runWith(ctx, cfg, opts, p.svc)
+	summary.RetryCount -= retries
+	summary.APIDuration -= elapsed
+	return summary, err
+}
+
+// Close closes the workbooks the pipeline opened.
+func (p *Pipeline) Close() error {
+	var errs []error
+	for _, wb := range p.books {
+		errs = append(errs, wb.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Pipeline) workbook(path string) (*Workbook, error) {
+	if wb, ok := p.books[path]; ok {
+		return wb, nil
+	}
+	wb, err := sheetops.OpenWorkbookFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p.books[path] = wb
+	return wb, nil
+}
+
+// sharesWorkbook reports whether a run of cfg only reads its workbook, so
+// the copy opened for an earlier run can serve it. Pull mode and
+// workbook_log write the file and open it themselves.
+func sharesWorkbook(cfg Config) bool {
+	mode := strings.ToLower(strings.TrimSpace(cfg.Mode))
+	return strings.TrimSpace(cfg.Workbook) != "" && strings.TrimSpace(cfg.ImportFile) == "" && strings.TrimSpace(cfg.RangesFrom) == "" &&
+		mode != config.ModeAppend && mode != config.ModePull && !cfg.WorkbookLog
+}
+
+func sameClient(a, b Config) bool {
+	same := func(x, y string) bool { return strings.TrimSpace(x) == strings.TrimSpace(y) }
+	return same(a.QuotaProject, b.QuotaProject) && same(a.ProxyURL, b.ProxyURL) && same(a.CABundleFile, b.CABundleFile)
+}
@@ -0,0 +1,417 @@
+package sheetsync
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	_ "time/tzdata" // timezone validates on images without tzdata installed
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+	sheetops "update-google-sheets/src/sheets"
+)
+
+// Config describes one run. Callers set Workbook explicitly; the CLI's
+// default paths are not applied here.
+type Config = config.Config
+
+// SheetList names the sheets Config.SheetFilter limits a scan to.
+type SheetList = config.SheetList
+
+// Options, Summary, Confirmer, Reviewer, Match and Discrepancy are the
+// run-time options and results shared with the CLI.
+type (
+	Options     = sheetops.Options
+	Summary     = sheetops.Summary
+	Confirmer   = sheetops.Confirmer
+	Reviewer    = sheetops.Reviewer
+	Match       = sheetops.Match
+	Discrepancy = sheetops.Discrepancy
+)
+
+// Workbook is an opened Excel workbook; WorkbookOption adjusts how it is
+// opened.
+type (
+	Workbook       = sheetops.Workbook
+	WorkbookOption = sheetops.WorkbookOption
+)
+
+// OpenWorkbook reads a workbook from r, such as an HTTP upload or a file in
+// an fs.FS. name is used only in messages.
+func OpenWorkbook(r io.Reader, name string, opts ...WorkbookOption) (*Workbook, error) {
+	return sheetops.OpenWorkbook(r, name, opts...)
+}
+
+// WithPassword opens an encrypted workbook.
+func WithPassword(password string) WorkbookOption {
+	return sheetops.WithPassword(password)
+}
+
+// WithUnzipSizeLimit caps the unpacked size of a workbook in bytes.
+func WithUnzipSizeLimit(limit int64) WorkbookOption {
+	return sheetops.WithUnzipSizeLimit(limit)
+}
+
+// ValueSource supplies the ranges and values a run writes; ExcelSource
+// scans a workbook, as runs without a source do, StaticSource writes one
+// value into fixed ranges and NamedRangeSource into the spreadsheet's
+// named ranges.
+type (
+	ValueSource      = sheetops.ValueSource
+	ExcelSource      = sheetops.ExcelSource
+	StaticSource     = sheetops.StaticSource
+	NamedRangeSource = sheetops.NamedRangeSource
+)
+
+// WorkbookLogSheet names the sheet Config.WorkbookLog appends to.
+const WorkbookLogSheet = sheetops.WorkbookLogSheet
+
+// APICall and APIMethodStats describe the API requests traced when the
+// logger has debug enabled.
+type (
+	APICall        = sheetops.APICall
+	APIMethodStats = sheetops.APIMethodStats
+)
+
+// SpreadsheetResult is the outcome of RunEach for one spreadsheet.
+type SpreadsheetResult = sheetops.SpreadsheetResult
+
+// AuditRecord is one line of Config.AuditLog.
+type AuditRecord = sheetops.AuditRecord
+
+// ReadAuditLog returns the last n records of the audit log at path.
+func ReadAuditLog(path string, n int) ([]AuditRecord, error) {
+	return sheetops.ReadAuditLog(path, n)
+}
+
+// Errors returned by Run, Plan and Apply, for use with errors.Is.
+var (
+	ErrSheetNotFound     = sheetops.ErrSheetNotFound
+	ErrValueNotFound     = sheetops.ErrValueNotFound
+	ErrAnchorNotUnique   = sheetops.ErrAnchorNotUnique
+	ErrOccupied          = sheetops.ErrOccupied
+	ErrExpectationNotMet = sheetops.ErrExpectationNotMet
+	ErrRetryBudgetSpent  = sheetops.ErrRetryBudgetSpent
+	ErrNoWriteAccess     = sheetops.ErrNoWriteAccess
+	ErrSchemaMismatch    = sheetops.ErrSchemaMismatch
+	// ErrSpreadsheetNotFound means the spreadsheet does not exist or is
+	// not shared with the credentials.
+	ErrSpreadsheetNotFound = sheetops.ErrSpreadsheetNotFound
+	// ErrPlanChanged means Apply found different writes than Plan did,
+	// because the workbook or the spreadsheet changed in between.
+	ErrPlanChanged = sheetops.ErrPlanChanged
+	// ErrNoWorkbook means Config.Workbook was left blank for a run that
+	// scans the workbook.
+	ErrNoWorkbook = errors.New("config has no workbook")
+	// ErrManySpreadsheets means Run, Plan or a pipeline was given a config
+	// with Config.SpreadsheetIDs, which only RunEach applies.
+	ErrManySpreadsheets = errors.New("config lists spreadsheet_ids; use RunEach")
+)
+
+// Updater runs configs against Google Sheets. Build one with NewUpdater;
+// its options apply to every run.
+type Updater struct {
+	svc        *sheets.Service
+	clientOpts []option.ClientOption
+	opts       Options
+	writeValue *string
+	log        *zap.Logger
+	// ownClient is set by WithHTTPClient; such clients are used as given,
+	// without the retry layer.
+	ownClient bool
+}
+
+// UpdaterOption configures an Updater.
+type UpdaterOption func(*Updater)
+
+// WithService makes the Updater use svc for every run instead of building
+// one from Application Default Credentials. Config.MaxRetries does not
+// apply to it.
+func WithService(svc *sheets.Service) UpdaterOption {
+	return func(u *Updater) { u.svc = svc }
+}
+
+// WithClientOptions adds Google API client options, such as credentials or
+// an endpoint, to the service built for each run.
+func WithClientOptions(opts ...option.ClientOption) UpdaterOption {
+	return func(u *Updater) { u.clientOpts = append(u.clientOpts, opts...) }
+}
+
+// WithHTTPClient sends every request through c, which must authenticate
+// the requests itself. It takes precedence over proxy_url and ca_bundle_file,
+// and Config.MaxRetries does not apply to it.
+func WithHTTPClient(c *http.Client) UpdaterOption {
+	return func(u *Updater) {
+		u.clientOpts = append(u.clientOpts, option.WithHTTPClient(c))
+		u.ownClient = true
+	}
+}
+
+// WithDryRun plans each run, including the precondition fetches, without
+// writing.
+func WithDryRun() UpdaterOption {
+	return func(u *Updater) { u.opts.DryRun = true }
+}
+
+// WithWriteCheck is WithDryRun plus a no-op write that proves write access.
+func WithWriteCheck() UpdaterOption {
+	return func(u *Updater) { u.opts.DryRun, u.opts.CheckWrite = true, true }
+}
+
+// WithConfirm asks c before the first write of each run.
+func WithConfirm(c Confirmer) UpdaterOption {
+	return func(u *Updater) { u.opts.Confirm = c }
+}
+
+// WithReview asks r about each range of a write or sync run after the
+// confirmation, and writes only the ranges it approves.
+func WithReview(r Reviewer) UpdaterOption {
+	return func(u *Updater) { u.opts.Review = r }
+}
+
+// WithInPlace makes pull mode overwrite the workbook.
+func WithInPlace() UpdaterOption {
+	return func(u *Updater) { u.opts.InPlace = true }
+}
+
+// WithReport writes a CSV reconciliation to w instead of updating.
+func WithReport(w io.Writer) UpdaterOption {
+	return func(u *Updater) { u.opts.Report = w }
+}
+
+// WithEmitRanges writes the run's target ranges to w as JSON, which a
+// later run can load through Config.RangesFrom.
+func WithEmitRanges(w io.Writer) UpdaterOption {
+	return func(u *Updater) { u.opts.EmitRanges = w }
+}
+
+// WithResponseOut writes the Sheets API response to the run's value
+// writes to w as JSON. Runs that write nothing leave w untouched.
+func WithResponseOut(w io.Writer) UpdaterOption {
+	return func(u *Updater) { u.opts.ResponseOut = w }
+}
+
+// WithCheck reports discrepancies in Summary.Discrepancies instead of
+// updating.
+func WithCheck() UpdaterOption {
+	return func(u *Updater) { u.opts.Check = true }
+}
+
+// WithReprocess writes lookup values that Config.StateFile records as
+// already done.
+func WithReprocess() UpdaterOption {
+	return func(u *Updater) { u.opts.Reprocess = true }
+}
+
+// WithWriteValue overrides Config.WriteValue for every run.
+func WithWriteValue(v string) UpdaterOption {
+	return func(u *Updater) { u.writeValue = &v }
+}
+
+// WithSource writes the ranges and values src supplies instead of scanning
+// the workbook; Config.Workbook may then be left blank. Named range
+// targets, the merge settings and the modes still apply.
+func WithSource(src ValueSource) UpdaterOption {
+	return func(u *Updater) { u.opts.Source = src }
+}
+
+// WithWorkbook scans wb instead of opening Config.Workbook, which may then
+// be left blank. The caller keeps ownership of wb and closes it.
+func WithWorkbook(wb *Workbook) UpdaterOption {
+	return func(u *Updater) { u.opts.Workbook = wb }
+}
+
+// WithLogger logs each run's plan and outcome to l at debug level. When
+// debug is enabled, every API request is also logged with its latency,
+// and each run ends with a latency summary per API method.
+func WithLogger(l *zap.Logger) UpdaterOption {
+	return func(u *Updater) { u.log = l }
+}
+
+// NewUpdater returns an Updater with opts applied.
+func NewUpdater(opts ...UpdaterOption) *Updater {
+	u := &Updater{log: zap.NewNop()}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
+}
+
+// Update runs cfg once with opts, for callers that need no Updater.
+func Update(ctx context.Context, cfg Config, opts ...UpdaterOption) (Summary, error) {
+	return NewUpdater(opts...).Run(ctx, cfg)
+}
+
+// Scope returns the OAuth scope the Updater's runs need.
+func (u *Updater) Scope() string {
+	return sheetops.RequiredScope(u.opts)
+}
+
+// Run validates cfg and performs one run.
+func (u *Updater) Run(ctx context.Context, cfg Config) (Summary, error) {
+	return u.run(ctx, cfg, u.opts)
+}
+
+func (u *Updater) run(ctx context.Context, cfg Config, opts Options) (Summary, error) {
+	return u.runWith(ctx, cfg, opts, u.svc)
+}
+
+// runWith performs one run against svc, or against a service built for
+// the run when svc is nil.
+func (u *Updater) runWith(ctx context.Context, cfg Config, opts Options, svc *sheets.Service) (Summary, error) {
+	if u.writeValue != nil {
+		cfg.WriteValue = *u.writeValue
+	}
+	if err := validate(&cfg, opts.Workbook != nil || opts.Source != nil); err != nil {
+		return Summary{}, err
+	}
+	if len(cfg.SpreadsheetIDs) > 0 {
+		return Summary{}, ErrManySpreadsheets
+	}
+	if svc == nil {
+		var err error
+		if svc, err = u.newService(ctx, cfg, &opts); err != nil {
+			return Summary{}, err
+		}
+	}
+	summary, err := sheetops.UpdateWithService(ctx, svc, cfg, opts)
+	u.logRun(cfg.SpreadsheetID, summary, err)
+	return summary, err
+}
+
+// RunEach validates cfg and applies it to every spreadsheet of
+// Config.SpreadsheetIDs, deriving the targets once. The error is for
+// problems that stop every spreadsheet, such as an invalid config; each
+// spreadsheet's own failure is in its result.
+func (u *Updater) RunEach(ctx context.Context, cfg Config) ([]SpreadsheetResult, error) {
+	opts := u.opts
+	if u.writeValue != nil {
+		cfg.WriteValue = *u.writeValue
+	}
+	if err := validate(&cfg, opts.Workbook != nil || opts.Source != nil); err != nil {
+		return nil, err
+	}
+	if len(cfg.SpreadsheetIDs) == 0 {
+		return nil, errors.New("RunEach needs Config.SpreadsheetIDs; use Run for a single spreadsheet")
+	}
+	svc := u.svc
+	if svc == nil {
+		var err error
+		if svc, err = u.newService(ctx, cfg, &opts); err != nil {
+			return nil, err
+		}
+	}
+	results, err := sheetops.UpdateEach(ctx, svc, cfg, opts)
+	for _, r := range results {
+		if !r.NotRun {
+			u.logRun(r.SpreadsheetID, r.Summary, r.Err)
+		}
+	}
+	return results, err
+}
+
+// logRun logs the API latency and outcome of a run against spreadsheetID
+// at debug level.
+func (u *Updater) logRun(spreadsheetID string, summary Summary, err error) {
+	for _, s := range summary.APICalls {
+		u.log.Debug("api latency",
+			zap.String("method", s.Method),
+			zap.Int("calls", s.Calls),
+			zap.Duration("total", s.Total),
+			zap.Duration("max", s.Max),
+			zap.Ints("buckets", s.Buckets),
+		)
+	}
+	if err != nil {
+		u.log.Debug("run failed", zap.String("spreadsheet_id", spreadsheetID), zap.Error(err))
+		return
+	}
+	u.log.Debug("run finished",
+		zap.String("spreadsheet_id", spreadsheetID),
+		zap.String("preview", summary.Preview),
+		zap.Bool("dry_run", summary.DryRun),
+		zap.Strings("ranges", summary.Ranges),
+		zap.String("skipped_reason", summary.SkippedReason),
+	)
+}
+
+// newService builds a service for cfg with a fresh retry budget and API
+// clock in opts, shared by every call the service makes.
+func (u *Updater) newService(ctx context.Context, cfg Config, opts *Options) (*sheets.Service, error) {
+	if !u.ownClient {
+		opts.Retries = sheetops.NewRetryBudget(cfg)
+		opts.Clock = &sheetops.APIClock{}
+		if u.log.Core().Enabled(zapcore.DebugLevel) {
+			opts.Trace = &sheetops.APITrace{OnCall: u.logCall}
+		}
+	}
+	return sheetops.NewService(ctx, cfg, *opts, u.clientOpts...)
+}
+
+// logCall logs one traced API request at debug level.
+func (u *Updater) logCall(c APICall) {
+	u.log.Debug("api call",
+		zap.String("method", c.Method),
+		zap.Strings("ranges", c.Ranges),
+		zap.Int("status", c.Status),
+		zap.Int64("bytes", c.Bytes),
+		zap.Duration("latency", c.Latency),
+		zap.Error(c.Err),
+	)
+}
+
+// Plan is the outcome of a dry run, to be reviewed and then passed to Apply.
+type Plan struct {
+	Config  Config
+	Options Options
+	// Summary holds the planned ranges and the preview line, and keeps
+	// the planned values for Apply to compare.
+	Summary Summary
+}
+
+// Empty reports whether the plan has nothing to write.
+func (p Plan) Empty() bool {
+	return p.Summary.SkippedReason != ""
+}
+
+// Plan derives the targets for cfg and fetches their current values
+// without writing anything.
+func (u *Updater) Plan(ctx context.Context, cfg Config) (Plan, error) {
+	dry := u.opts
+	dry.DryRun = true
+	summary, err := u.run(ctx, cfg, dry)
+	if err != nil {
+		return Plan{}, err
+	}
+	return Plan{Config: cfg, Options: u.opts, Summary: summary}, nil
+}
+
+// Apply carries out p. It re-plans before writing and fails with
+// ErrPlanChanged, writing nothing, when the ranges or values it would
+// write differ from p. Templates such as {{time}} expand as they did in p.
+func (u *Updater) Apply(ctx context.Context, p Plan) (Summary, error) {
+	if p.Empty() {
+		return p.Summary, nil
+	}
+	opts := sheetops.ExpectPlanned(p.Options, p.Summary)
+	opts.DryRun = false
+	opts.CheckWrite = false
+	return u.run(ctx, p.Config, opts)
+}
+
+func validate(cfg *Config, haveWorkbook bool) error {
+	if haveWorkbook {
+		return cfg.ValidateSettings()
+	}
+	scans := !strings.EqualFold(strings.TrimSpace(cfg.Mode), config.ModeAppend) && strings.TrimSpace(cfg.ImportFile) == "" && strings.TrimSpace(cfg.RangesFrom) == ""
+	if strings.TrimSpace(cfg.Workbook) == "" && scans {
+		return ErrNoWorkbook
+	}
+	return cfg.Validate()
+}
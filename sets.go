@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"update-google-sheets/src/config"
+)
+
+// setPair is one -set lookup=value: find lookup in the workbook and write
+// value at the configured target.
+type setPair struct {
+	Lookup, Value string
+}
+
+// setPairs collects repeated -set flags, in order.
+type setPairs []setPair
+
+func (p *setPairs) String() string {
+	parts := make([]string, len(*p))
+	for i, s := range *p {
+		parts[i] = s.Lookup + "=" + s.Value
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Set parses lookup=value. Only the first '=' separates, so the value may
+// contain more; a blank value writes the lookup value itself.
+func (p *setPairs) Set(arg string) error {
+	lookup, value, ok := strings.Cut(arg, "=")
+	lookup = strings.TrimSpace(lookup)
+	if !ok || lookup == "" {
+		return fmt.Errorf("want lookup=value, got %q", arg)
+	}
+	*p = append(*p, setPair{Lookup: lookup, Value: strings.TrimSpace(value)})
+	return nil
+}
+
+// configs returns one config per pair, each overriding lookup_value and
+// write_value, or cfg alone when no -set was given.
+func (p setPairs) configs(cfg config.Config) []config.Config {
+	if len(p) == 0 {
+		return []config.Config{cfg}
+	}
+	out := make([]config.Config, len(p))
+	for i, s := range p {
+		out[i] = cfg
+		out[i].LookupValue, out[i].WriteValue = s.Lookup, s.Value
+	}
+	return out
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"testing"
+
+	"update-google-sheets/src/config"
+)
+
+func TestSetPairs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    setPairs
+		wantErr bool
+	}{
+		{"none", nil, nil, false},
+		{"one", []string{"-set", "Monday=Present"}, setPairs{{"Monday", "Present"}}, false},
+		{
+			"several in order",
+			[]string{"-set", "Monday=Present", "-set", " Tuesday = Absent ", "-set", "Wednesday=a=b"},
+			setPairs{{"Monday", "Present"}, {"Tuesday", "Absent"}, {"Wednesday", "a=b"}},
+			false,
+		},
+		{"blank value", []string{"-set", "Monday="}, setPairs{{"Monday", ""}}, false},
+		{"no equals", []string{"-set", "Monday"}, nil, true},
+		{"blank lookup", []string{"-set", " =Present"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			var sets setPairs
+			fs.Var(&sets, "set", "")
+			err := fs.Parse(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(sets, tt.want) {
+				t.Errorf("pairs = %#v, want %#v", sets, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetPairsConfigs(t *testing.T) {
+	base := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", WriteValue: "x", TargetColOffset: 2}
+
+	if got := (setPairs(nil)).configs(base); !reflect.DeepEqual(got, []config.Config{base}) {
+		t.Errorf("configs without -set = %+v, want the base config", got)
+	}
+
+	got := setPairs{{"Monday", "Present"}, {"Tuesday", "Absent"}}.configs(base)
+	mapping := map[string]string{}
+	for _, cfg := range got {
+		if cfg.SpreadsheetID != base.SpreadsheetID || cfg.TargetColOffset != base.TargetColOffset {
+			t.Errorf("config %+v lost the base settings", cfg)
+		}
+		mapping[cfg.LookupValue] = cfg.WriteValue
+	}
+	if want := map[string]string{"Monday": "Present", "Tuesday": "Absent"}; !reflect.DeepEqual(mapping, want) {
+		t.Errorf("lookup/value mapping = %v, want %v", mapping, want)
+	}
+	if got[0].LookupValue != "Monday" {
+		t.Errorf("first config looks up %q, want Monday", got[0].LookupValue)
+	}
+}
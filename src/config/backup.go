@@ -0,0 +1,117 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// backupLayout timestamps backups so that they sort oldest first by name.
+const backupLayout = "20060102-150405"
+
+// backupFile moves path to <path>.<timestamp of now>.bak and returns the
+// backup's path, or "" when path does not exist. A second backup in the
+// same second gets _2, and so on, numbered past the highest one there, so
+// a pruned name is never reused for a newer backup.
+func backupFile(path string, now time.Time) (string, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	stamp := now.Format(backupLayout)
+	same, err := filepath.Glob(globEscape(path) + "." + stamp + "*.bak")
+	if err != nil {
+		return "", err
+	}
+	seq := 0
+	for _, b := range same {
+		if s, n := backupOrder(path, b); s == stamp {
+			seq = max(seq, n)
+		}
+	}
+	backup := fmt.Sprintf("%s.%s.bak", path, stamp)
+	if seq > 0 {
+		backup = fmt.Sprintf("%s.%s_%d.bak", path, stamp, seq+1)
+	}
+	if err := os.Rename(path, backup); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
+
+// backupOrder splits a backup of path into its timestamp and its number
+// within that second: 1 for the first, which has none, then 2, 3 and on.
+func backupOrder(path, backup string) (string, int) {
+	name := strings.TrimSuffix(strings.TrimPrefix(backup, path+"."), ".bak")
+	stamp, n, found := strings.Cut(name, "_")
+	if !found {
+		return stamp, 1
+	}
+	seq, err := strconv.Atoi(n)
+	if err != nil {
+		return stamp, 1
+	}
+	return stamp, seq
+}
+
+// Backups returns the backups of path that Write made, newest first.
+func Backups(path string) ([]string, error) {
+	matches, err := filepath.Glob(globEscape(path) + ".*.bak")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		si, ni := backupOrder(path, matches[i])
+		sj, nj := backupOrder(path, matches[j])
+		if si != sj {
+			return si > sj
+		}
+		return ni > nj
+	})
+	return matches, nil
+}
+
+// pruneBackups removes the oldest backups of path beyond keep.
+func pruneBackups(path string, keep int) error {
+	backups, err := Backups(path)
+	if err != nil || len(backups) <= keep {
+		return err
+	}
+	var errs []error
+	for _, old := range backups[keep:] {
+		errs = append(errs, os.Remove(old))
+	}
+	return errors.Join(errs...)
+}
+
+// RestoreWorkbook copies backup, one of Backups(cfg's workbook), back into
+// place the way Write copies a new workbook, so the workbook it replaces
+// is itself backed up. It returns that backup's path, or "" when none was
+// taken.
+func RestoreWorkbook(cfg Config, backup string) (string, error) {
+	dest := cfg.Workbook
+	if dest == "" {
+		dest = DefaultWorkbook
+	}
+	replaced, err := copyFile(backup, dest, cfg.KeptWorkbookBackups())
+	if err != nil {
+		return "", fmt.Errorf("restore workbook: %w", err)
+	}
+	return replaced, nil
+}
+
+// globEscape quotes the pattern characters in path for filepath.Glob.
+func globEscape(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,259 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// writeTestWorkbook saves a one-sheet workbook whose A1 holds value and
+// returns its bytes.
+func writeTestWorkbook(t *testing.T, path, value string) []byte {
+	t.Helper()
+	f := excelize.NewFile()
+	defer func() { _ = f.Close() }()
+	if err := f.SetCellValue("Sheet1", "A1", value); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestBackupFile(t *testing.T) {
+	now := time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		existing []string // files present before the backup, by suffix
+		want     string   // suffix of the backup's name; "" for none
+	}{
+		{"missing file", nil, ""},
+		{"first backup", []string{""}, ".20261016-093000.bak"},
+		{"same second", []string{"", ".20261016-093000.bak"}, ".20261016-093000_2.bak"},
+		{"third in a second", []string{"", ".20261016-093000.bak", ".20261016-093000_2.bak"}, ".20261016-093000_3.bak"},
+		{"after a pruned first", []string{"", ".20261016-093000_2.bak"}, ".20261016-093000_3.bak"},
+		{"other seconds", []string{"", ".20261016-092959_4.bak"}, ".20261016-093000.bak"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "Schedule.xlsx")
+			for _, suffix := range tt.existing {
+				if err := os.WriteFile(path+suffix, []byte("content"+suffix), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := backupFile(path, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" {
+				if got != "" {
+					t.Errorf("backupFile = %q, want no backup", got)
+				}
+				return
+			}
+			if want := path + tt.want; got != want {
+				t.Errorf("backupFile = %q, want %q", got, want)
+			}
+			if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("%s still exists after the backup: %v", path, err)
+			}
+			if data := readFile(t, got); string(data) != "content" {
+				t.Errorf("backup holds %q, want the original's content", data)
+			}
+		})
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	stamps := []string{"20260101-000000", "20260102-000000", "20260102-000000_2", "20260102-000000_10", "20260103-000000"}
+	tests := []struct {
+		name string
+		keep int
+		want []string
+	}{
+		{"keep all", 6, []string{"20260103-000000", "20260102-000000_10", "20260102-000000_2", "20260102-000000", "20260101-000000"}},
+		{"keep exactly all", 5, []string{"20260103-000000", "20260102-000000_10", "20260102-000000_2", "20260102-000000", "20260101-000000"}},
+		{"keep three", 3, []string{"20260103-000000", "20260102-000000_10", "20260102-000000_2"}},
+		{"keep one", 1, []string{"20260103-000000"}},
+		{"keep none", 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "Sche[d]ule.xlsx")
+			for _, s := range stamps {
+				if err := os.WriteFile(path+"."+s+".bak", nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := pruneBackups(path, tt.keep); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Backups(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []string
+			for _, s := range tt.want {
+				want = append(want, path+"."+s+".bak")
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("backups left = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestCopyFileBackups(t *testing.T) {
+	tests := []struct {
+		name       string
+		dest       string // A1 of the workbook already in place; "" for none
+		src        string
+		wantBackup bool
+	}{
+		{"no previous workbook", "", "new", false},
+		{"different workbook", "old", "new", true},
+		{"identical workbook", "same", "same", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src, dest := filepath.Join(dir, "src.xlsx"), filepath.Join(dir, "cfg", "Schedule.xlsx")
+			want := writeTestWorkbook(t, src, tt.src)
+			var before []byte
+			if tt.dest != "" {
+				if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				before = writeTestWorkbook(t, dest, tt.dest)
+				if tt.dest == tt.src {
+					// Save the very bytes so the checksums agree.
+					before = want
+					if err := os.WriteFile(dest, want, 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			backup, err := copyFile(src, dest, 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readFile(t, dest); !reflect.DeepEqual(got, want) {
+				t.Error("dest does not hold the source workbook")
+			}
+			backups, err := Backups(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.wantBackup {
+				if backup != "" || len(backups) != 0 {
+					t.Errorf("backup = %q, backups = %v, want none", backup, backups)
+				}
+				return
+			}
+			if len(backups) != 1 || backups[0] != backup {
+				t.Fatalf("backup = %q, backups = %v, want the one returned", backup, backups)
+			}
+			if got := readFile(t, backup); !reflect.DeepEqual(got, before) {
+				t.Error("backup does not hold the replaced workbook")
+			}
+		})
+	}
+}
+
+func TestCopyFileKeepsNewestBackups(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "Schedule.xlsx")
+	writeTestWorkbook(t, dest, "v0")
+	const keep = 2
+	var returned []string
+	for _, v := range []string{"v1", "v2", "v3", "v4"} {
+		src := filepath.Join(dir, v+".xlsx")
+		writeTestWorkbook(t, src, v)
+		backup, err := copyFile(src, dest, keep)
+		if err != nil {
+			t.Fatal(err)
+		}
+		returned = append(returned, backup)
+	}
+	backups, err := Backups(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The backups of v2 and v3, newest first.
+	if want := []string{returned[3], returned[2]}; !reflect.DeepEqual(backups, want) {
+		t.Errorf("backups = %v, want %v", backups, want)
+	}
+}
+
+func TestFailedCopyLeavesWorkbook(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "Schedule.xlsx")
+	before := writeTestWorkbook(t, dest, "current")
+	full := writeTestWorkbook(t, filepath.Join(dir, "full.xlsx"), "new")
+	sum, err := fileChecksum(filepath.Join(dir, "full.xlsx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		copy    func(src string) (string, error)
+		content []byte
+		wantErr string
+	}{
+		{"truncated source", func(src string) (string, error) { return copyFile(src, dest, 5) },
+			full[:len(full)/2], "is not a valid workbook"},
+		{"not a workbook", func(src string) (string, error) { return copyFile(src, dest, 5) },
+			[]byte("range,value\n"), "is not a valid workbook"},
+		// A copy cut short on its way to disk no longer matches the
+		// source's checksum.
+		{"copy does not match the source", func(src string) (string, error) {
+			return installCopy(src, sum, filepath.Join(dir, "full.xlsx"), dest, 5)
+		}, full[:len(full)-1], "does not match the source's"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := filepath.Join(t.TempDir(), "copy.xlsx")
+			if err := os.WriteFile(src, tt.content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			backup, err := tt.copy(src)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+			if backup != "" {
+				t.Errorf("backup = %q after a failed copy", backup)
+			}
+			if got := readFile(t, dest); !reflect.DeepEqual(got, before) {
+				t.Error("the workbook in place was changed")
+			}
+			if backups, _ := Backups(dest); len(backups) != 0 {
+				t.Errorf("backups = %v, want none", backups)
+			}
+			if tmps, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(tmps) != 0 {
+				t.Errorf("left temporary files %v", tmps)
+			}
+		})
+	}
+}
@@ -1,35 +1,442 @@
 package config
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"math"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	survey "github.com/AlecAivazis/survey/v2"
+	"github.com/xuri/excelize/v2"
 	"gopkg.in/yaml.v3"
 )
 
 const (
 	DefaultPath     = "cfg/config.yaml"
 	DefaultWorkbook = "cfg/Schedule.xlsx"
+	DefaultTimezone = "Asia/Bangkok"
+	// DefaultMaxRequestBytes keeps write requests well under the Sheets API
+	// body limit.
+	DefaultMaxRequestBytes = 2 << 20
+	// DefaultWorkbookBackups is how many replaced workbooks Write keeps.
+	DefaultWorkbookBackups = 5
+	// DefaultSnapshotMaxCells is the largest tab, by grid size, that
+	// snapshot_dir downloads.
+	DefaultSnapshotMaxCells = 1000000
+)
+
+// Policies for cells that do not hold expect_current_value.
+const (
+	ExpectPolicySkip = "skip"
+	ExpectPolicyFail = "fail"
+)
+
+// Value input options: USER_ENTERED parses values as if typed into the
+// sheet, so "=SUM(A1:A3)" becomes a formula and "007" a number; RAW
+// stores them as given.
+const (
+	InputUserEntered = "USER_ENTERED"
+	InputRaw         = "RAW"
+)
+
+// Policies for a snapshot that could not be taken in full.
+const (
+	SnapshotPolicyWarn = "warn"
+	SnapshotPolicyFail = "fail"
+)
+
+// Policies for target cells that already contain data.
+const (
+	OccupiedSkip      = "skip"
+	OccupiedOverwrite = "overwrite"
+	OccupiedError     = "error"
+)
+
+// Run modes selected by the mode field.
+const (
+	ModeWrite  = "write"
+	ModeClear  = "clear"
+	ModeAppend = "append"
+	ModeSync   = "sync"
+	ModePull   = "pull"
 )
 
 // Config captures the data needed to perform an update.
 type Config struct {
-	SpreadsheetID string `yaml:"spreadsheet_id"`
-	SheetFilter   string `yaml:"config_sheet"`
-	LookupValue   string `yaml:"lookup_value"`
+	SpreadsheetID string    `yaml:"spreadsheet_id"`
+	SheetFilter   SheetList `yaml:"config_sheet"`
+	LookupValue   string    `yaml:"lookup_value"`
+	// QuotaProject bills API quota to this Google Cloud project instead of
+	// the credentials' own project.
+	QuotaProject string `yaml:"quota_project,omitempty"`
+	// ProxyURL routes API traffic through an HTTP(S) proxy; credentials in
+	// the URL are sent as proxy authentication. CABundleFile adds PEM
+	// certificates to the trusted roots, for proxies with a private CA.
+	ProxyURL     string `yaml:"proxy_url,omitempty"`
+	CABundleFile string `yaml:"ca_bundle_file,omitempty"`
+	// MaxRetries retries each API call up to this many times on rate
+	// limiting and transient errors; 0 disables retries. RetryBudget and
+	// RetryBudgetTime (a Go duration of total waiting) cap the retries of
+	// the whole run; blank or 0 leaves that cap off.
+	MaxRetries      int    `yaml:"max_retries,omitempty"`
+	RetryBudget     int    `yaml:"retry_budget,omitempty"`
+	RetryBudgetTime string `yaml:"retry_budget_time,omitempty"`
+	// Workbook is the Excel stencil to scan; blank means DefaultWorkbook.
+	Workbook string `yaml:"config_xlsx,omitempty"`
+	// WorkbookBackups is how many timestamped copies of the workbook Write
+	// keeps when a new one replaces it; 0 means DefaultWorkbookBackups.
+	WorkbookBackups int `yaml:"workbook_backups,omitempty"`
+	// WriteValue replaces the lookup value as the text written to Google
+	// Sheets. WriteType (string, number, bool) controls how it is encoded.
+	WriteValue string `yaml:"write_value,omitempty"`
+	WriteType  string `yaml:"write_type,omitempty"`
+	// DecimalComma reads a number write value with a decimal comma, such
+	// as "12,5" or "1.234,50" (dots group thousands).
+	DecimalComma bool `yaml:"decimal_comma,omitempty"`
+	// StrictTemplate makes an unset ${VAR} or an unknown {{name}} in a
+	// template an error rather than an empty string or literal text. See
+	// ExpandTemplates.
+	StrictTemplate bool `yaml:"strict_template,omitempty"`
+	// TouchCell (e.g. Meta!B1) is stamped with the current time on every
+	// successful run, whether or not anything matched. Its sheet, like
+	// AppendSheet, may be given as gid:<number> instead of a title.
+	TouchCell string `yaml:"touch_cell,omitempty"`
+	// Timezone names the IANA zone used for timestamps; defaults to DefaultTimezone.
+	Timezone string `yaml:"timezone,omitempty"`
+	// Mode is write (default), sync, which also corrects differing cells,
+	// clear, which blanks the derived ranges instead, or append, which adds AppendValues as a new row on AppendSheet
+	// without scanning the workbook. {{now}} and {{lookup}} are expanded.
+	// pull reverses the direction and refreshes the workbook from Google Sheets.
+	Mode         string   `yaml:"mode,omitempty"`
+	AppendSheet  string   `yaml:"append_sheet,omitempty"`
+	AppendValues []string `yaml:"append_values,omitempty"`
+	// OccupiedCellPolicy decides what happens to target cells that already
+	// hold data in write mode: skip (default), overwrite, or error.
+	OccupiedCellPolicy string `yaml:"occupied_cell_policy,omitempty"`
+	// InsertOnly is shorthand for occupied_cell_policy: error, for runs that
+	// expect every target to be blank.
+	InsertOnly bool `yaml:"insert_only,omitempty"`
+	// ValueRenderOption (FORMATTED_VALUE, UNFORMATTED_VALUE, FORMULA) and
+	// DateTimeRenderOption (SERIAL_NUMBER, FORMATTED_STRING) control how
+	// current values are read before merging. Blank keeps the API defaults.
+	ValueRenderOption    string `yaml:"value_render_option,omitempty"`
+	DateTimeRenderOption string `yaml:"date_time_render_option,omitempty"`
+	// ResponseValueRenderOption controls how the values echoed back by a
+	// write are rendered; blank keeps FORMATTED_VALUE. VerifyWrites compares
+	// those echoed values with what was sent.
+	ResponseValueRenderOption string `yaml:"response_value_render_option,omitempty"`
+	VerifyWrites              bool   `yaml:"verify_writes,omitempty"`
+	// ValueInputOption (USER_ENTERED or RAW) is how written values are
+	// interpreted; blank means USER_ENTERED. Entries of writes and rows of
+	// import_file may choose their own.
+	ValueInputOption string `yaml:"value_input_option,omitempty"`
+	// MaxRequestBytes caps the estimated JSON size of one write request;
+	// larger batches are split across several requests.
+	MaxRequestBytes int `yaml:"max_request_bytes,omitempty"`
+	// AllowOverwritingFormulas lets writes replace cells that hold a
+	// formula; by default such cells count as occupied, even when they
+	// render empty.
+	AllowOverwritingFormulas bool `yaml:"allow_overwriting_formulas,omitempty"`
+	// OccupiedIfWhitespace makes remote cells holding only whitespace
+	// (spaces, tabs, non-breaking spaces) count as occupied. By default
+	// they count as empty and are filled like blank cells.
+	OccupiedIfWhitespace bool `yaml:"occupied_if_whitespace,omitempty"`
+	// ExpectCurrentValue, when set, only lets a cell be written while it
+	// currently holds this value ("" means it must be empty). ExpectPolicy
+	// decides whether other cells are skipped (default) or fail the run.
+	ExpectCurrentValue *string `yaml:"expect_current_value,omitempty"`
+	ExpectPolicy       string  `yaml:"expect_policy,omitempty"`
+	// In sync mode, remote cells that differ from the desired value are
+	// overwritten. Comparison trims whitespace unless SyncExactWhitespace.
+	SyncIgnoreCase      bool `yaml:"sync_ignore_case,omitempty"`
+	SyncExactWhitespace bool `yaml:"sync_exact_whitespace,omitempty"`
+
+	// StreamWorkbook scans sheets row by row instead of loading each sheet
+	// into memory, for very large workbooks. Results are identical.
+	StreamWorkbook bool `yaml:"stream_workbook,omitempty"`
+
+	// ScanRange (e.g. A1:F100, no sheet prefix) bounds the cells examined
+	// on every scanned sheet.
+	ScanRange string `yaml:"search_range,omitempty"`
+	// SearchDefinedName restricts matching to the rectangle an Excel defined
+	// name refers to, overriding SheetFilter and ScanRange.
+	SearchDefinedName string `yaml:"search_defined_name,omitempty"`
+	// MaxScanRows and MaxScanCols, when positive, stop the scan of every
+	// sheet after that many rows and columns, counted from A1. They narrow
+	// search_range and search_defined_name rather than replace them.
+	MaxScanRows int `yaml:"max_scan_rows,omitempty"`
+	MaxScanCols int `yaml:"max_scan_cols,omitempty"`
+	// ScanConcurrency is how many sheets are scanned at once; 0 means
+	// GOMAXPROCS, at most 4, and 1 scans one sheet at a time. Results are
+	// identical either way.
+	ScanConcurrency int `yaml:"scan_concurrency,omitempty"`
+	// NumericTolerance, when positive, matches cells whose number is within
+	// this distance of a numeric lookup value, so 3.1 matches 3.10.
+	// Non-numeric cells still compare as text.
+	NumericTolerance float64 `yaml:"numeric_tolerance,omitempty"`
+	// SheetFilterCaseInsensitive lets config_sheet names match sheets that
+	// differ only in case, as well as in surrounding spaces. Defaults to
+	// true; an exact match always wins.
+	SheetFilterCaseInsensitive *bool `yaml:"sheet_filter_case_insensitive,omitempty"`
+	// SheetRegex keeps only the sheets whose names match this regular
+	// expression, after config_sheet has been applied.
+	SheetRegex string `yaml:"sheet_regex,omitempty"`
+	// SchemaFile is a YAML file listing the sheets the workbook must have
+	// and the header labels each must hold in header_row; the run fails
+	// before scanning when the workbook differs.
+	SchemaFile string `yaml:"schema_file,omitempty"`
+	// HeaderRow is the 1-based row holding each sheet's column headings,
+	// for workbooks with metadata above the header. Defaults to 1. It does
+	// not limit the scan.
+	HeaderRow int `yaml:"header_row,omitempty"`
+	// ProtectHeaderRow drops every workbook-derived target that touches
+	// HeaderRow, so a match in the headings never overwrites them.
+	ProtectHeaderRow bool `yaml:"protect_header_row,omitempty"`
+
+	// Source offsets pick the workbook cell, relative to each match, whose
+	// value is written instead of the lookup value.
+	SourceRowOffset int `yaml:"source_row_offset,omitempty"`
+	SourceColOffset int `yaml:"source_col_offset,omitempty"`
+	// WriteMatchedCell writes each match's workbook cell exactly as read,
+	// untrimmed and, under numeric_tolerance, as the workbook spells the
+	// number, instead of the lookup value.
+	WriteMatchedCell bool `yaml:"write_matched_cell,omitempty"`
+	// Target offsets move the Google Sheets cell written for each match.
+	TargetRowOffset int `yaml:"target_row_offset,omitempty"`
+	TargetColOffset int `yaml:"target_col_offset,omitempty"`
+	// Writes replaces the single target of each match with one cell per
+	// entry, at the entry's offset from the match and holding its value.
+	Writes []CellWrite `yaml:"writes,omitempty"`
+	// SheetOverrides replaces occupied_cell_policy, the target offsets,
+	// write_value or the number of matches written, for the matches on the
+	// named workbook sheets.
+	SheetOverrides map[string]Override `yaml:"sheet_overrides,omitempty"`
+	// TargetRelativeTo (below, right, above, left) writes into the neighbour
+	// of each anchor match. It cannot be combined with the target offsets.
+	TargetRelativeTo   string `yaml:"target_relative_to,omitempty"`
+	AnchorMustBeUnique bool   `yaml:"anchor_must_be_unique,omitempty"`
+	// WriteLimit writes the targets of only the first WriteLimit matches,
+	// in workbook order, and reports the rest as skipped; 0 writes all.
+	WriteLimit int `yaml:"write_limit,omitempty"`
+	// PerSheetMatchLimit stops scanning a sheet once it has this many
+	// matches: a number such as 1, or all (the default). With the -strict
+	// suffix, as in 1-strict, the scan goes on and one more match fails the
+	// run instead.
+	PerSheetMatchLimit string `yaml:"per_sheet_match_limit,omitempty"`
+	// TargetColumn pins every write to this column letter (e.g. F or AA) on
+	// the matched row, whatever column the match was in.
+	TargetColumn string `yaml:"target_column,omitempty"`
+
+	// WriteToRowEnd widens each target from the matched column to the last
+	// populated column of that workbook row. RowValues, when set, supplies
+	// the values left to right instead of repeating the single write value.
+	WriteToRowEnd bool     `yaml:"write_to_row_end,omitempty"`
+	RowValues     []string `yaml:"row_values,omitempty"`
+
+	// TargetBlockRows and TargetBlockCols widen each target into a block of
+	// that many rows and columns anchored at the target cell; 0 means 1.
+	// BlockValues fills the block left to right, top to bottom; without it
+	// the source block at the source offsets, or else the write value in
+	// every cell, is written.
+	TargetBlockRows int      `yaml:"target_block_rows,omitempty"`
+	TargetBlockCols int      `yaml:"target_block_cols,omitempty"`
+	BlockValues     []string `yaml:"block_values,omitempty"`
+
+	// InsertRowBeforeMatch inserts a blank Google Sheets row above each
+	// matched row and writes into that new row instead.
+	InsertRowBeforeMatch bool `yaml:"insert_row_before_match,omitempty"`
+	// CreateMissingSheets adds target tabs the spreadsheet lacks, after
+	// confirmation and before writing, instead of failing the run.
+	CreateMissingSheets bool `yaml:"create_missing_sheets,omitempty"`
+
+	// NamedRangeTargets lists Google Sheets named ranges that receive the
+	// lookup value alongside the workbook-derived ranges.
+	NamedRangeTargets []string `yaml:"named_range_targets,omitempty"`
+
+	// WorkbookLog appends a row per written range to a SyncLog sheet in the
+	// workbook after each run, as an offline audit trail.
+	WorkbookLog bool `yaml:"workbook_log,omitempty"`
+
+	// AuditLog is a JSON Lines file that receives one record per cell a
+	// run writes or clears, with its value before and after.
+	AuditLog string `yaml:"audit_log,omitempty"`
+
+	// ImportFile pushes the range,value rows of this CSV instead of scanning
+	// the workbook. The CLI sets it from -import.
+	ImportFile string `yaml:"import_file,omitempty"`
+	// RangesFrom writes the lookup or write value into the ranges a
+	// previous run saved with -emit-ranges, instead of scanning the
+	// workbook. The CLI sets it from -ranges-from.
+	RangesFrom string `yaml:"ranges_from,omitempty"`
+
+	// StateFile is a JSON file recording, per spreadsheet and lookup value,
+	// the last successful write. A value already written within StateTTL
+	// (a Go duration such as 20h; empty means forever) is skipped.
+	StateFile string `yaml:"state_file,omitempty"`
+	StateTTL  string `yaml:"state_ttl,omitempty"`
+
+	// SnapshotDir saves every tab a run is about to change as CSV under
+	// SnapshotDir/<run id>/ before writing. Tabs larger than
+	// SnapshotMaxCells (0 means DefaultSnapshotMaxCells) are left out;
+	// SnapshotPolicy decides whether an incomplete snapshot only warns or
+	// stops the run.
+	SnapshotDir      string `yaml:"snapshot_dir,omitempty"`
+	SnapshotMaxCells int    `yaml:"snapshot_max_cells,omitempty"`
+	SnapshotPolicy   string `yaml:"snapshot_policy,omitempty"`
+	// UndoDir, in clear mode, saves the cells a run is about to clear, with
+	// their values, to UndoDir/<run id>.csv as range,value rows that
+	// import_file can write back.
+	UndoDir string `yaml:"undo_dir,omitempty"`
+
+	// ContinueOnError lets the documents after this one in a multi-document
+	// config still run when this one fails.
+	ContinueOnError bool `yaml:"continue_on_error,omitempty"`
+
+	// SpreadsheetIDs, set instead of SpreadsheetID, applies the same
+	// update to each of these spreadsheets: the targets are derived once
+	// and every spreadsheet gets its own preview and summary. SheetMaps
+	// renames tabs per spreadsheet, from the workbook's sheet name to the
+	// spreadsheet's tab title or gid:<number>. A failed spreadsheet stops
+	// the ones after it only with StopOnError. SpreadsheetConcurrency is how
+	// many spreadsheets run at once; 0 and 1 run them one at a time.
+	SpreadsheetIDs         []string                     `yaml:"spreadsheet_ids,omitempty"`
+	SheetMaps              map[string]map[string]string `yaml:"sheet_maps,omitempty"`
+	StopOnError            bool                         `yaml:"stop_on_error,omitempty"`
+	SpreadsheetConcurrency int                          `yaml:"spreadsheet_concurrency,omitempty"`
+	// DefaultTabFromURL sends the targets of workbook sheets that sheet_maps
+	// does not rename to the tab a spreadsheet_id pasted as a URL points
+	// at, the #gid= of the URL.
+	DefaultTabFromURL bool `yaml:"default_tab_from_url,omitempty"`
+	// urlGIDs holds the gid of each spreadsheet ID pasted as a URL that
+	// carried one.
+	urlGIDs map[string]int64
+
+	// ConditionalFormat installs a persistent conditional-format rule over
+	// each written column, once per column.
+	ConditionalFormat *ConditionalFormat `yaml:"conditional_format,omitempty"`
+	// NumberFormat is a Sheets number-format pattern, such as "#,##0.00",
+	// set on every cell the run writes a number to.
+	NumberFormat string `yaml:"number_format,omitempty"`
+}
+
+// CellWrite is one cell written for each match: Offset is "rows,cols" from the
+// match, such as "+1,0" for the cell below, and Value may use {{now}} and
+// {{lookup}}.
+type CellWrite struct {
+	Offset string `yaml:"offset"`
+	Value  string `yaml:"value"`
+	// ValueInputOption overrides the config's value_input_option for this
+	// cell.
+	ValueInputOption string `yaml:"value_input_option,omitempty"`
+}
+
+// Offsets parses Offset into a row and column shift.
+func (w CellWrite) Offsets() (int, int, error) {
+	rows, cols, ok := strings.Cut(w.Offset, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("offset %q must be rows,cols such as +1,0", w.Offset)
+	}
+	r, err := strconv.Atoi(strings.TrimSpace(rows))
+	if err != nil {
+		return 0, 0, fmt.Errorf("offset %q must be rows,cols such as +1,0", w.Offset)
+	}
+	c, err := strconv.Atoi(strings.TrimSpace(cols))
+	if err != nil {
+		return 0, 0, fmt.Errorf("offset %q must be rows,cols such as +1,0", w.Offset)
+	}
+	return r, c, nil
+}
+
+// ConditionalFormat describes a Sheets boolean conditional-format rule.
+type ConditionalFormat struct {
+	// Condition is a Sheets condition type such as TEXT_EQ, NUMBER_GREATER
+	// or NOT_BLANK; Values are its operands.
+	Condition string   `yaml:"condition"`
+	Values    []string `yaml:"values,omitempty"`
+	// Color is the background applied to matching cells, as #RRGGBB.
+	Color string `yaml:"color"`
+}
+
+// RGB returns Color as red, green and blue fractions between 0 and 1.
+func (f ConditionalFormat) RGB() (float64, float64, float64, error) {
+	hex := strings.TrimPrefix(f.Color, "#")
+	if len(hex) != 6 {
+		return 0, 0, 0, fmt.Errorf("conditional_format color %q must look like #RRGGBB", f.Color)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("conditional_format color %q must look like #RRGGBB", f.Color)
+	}
+	return float64(v>>16&0xff) / 255, float64(v>>8&0xff) / 255, float64(v&0xff) / 255, nil
+}
+
+// SheetList holds sheet names for config_sheet, which accepts either a single
+// string or a YAML sequence.
+type SheetList []string
+
+// UnmarshalYAML accepts both the scalar and the sequence form.
+func (l *SheetList) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		var name string
+		if err := node.Decode(&name); err != nil {
+			return err
+		}
+		*l = ParseSheetList(name)
+	case yaml.SequenceNode:
+		var names []string
+		if err := node.Decode(&names); err != nil {
+			return err
+		}
+		*l = ParseSheetList(names...)
+	default:
+		return fmt.Errorf("line %d: config_sheet must be a sheet name or a list of sheet names", node.Line)
+	}
+	return nil
+}
+
+// MarshalYAML keeps the scalar form when at most one sheet is configured.
+func (l SheetList) MarshalYAML() (interface{}, error) {
+	switch len(l) {
+	case 0:
+		return "", nil
+	case 1:
+		return l[0], nil
+	}
+	return []string(l), nil
+}
+
+// ParseSheetList trims the given names and drops blanks.
+func ParseSheetList(names ...string) SheetList {
+	var out SheetList
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			out = append(out, name)
+		}
+	}
+	return out
 }
 
 // Load reads the config file or falls back to interactive prompts.
 func Load(path string) (Config, error) {
 	data, err := os.ReadFile(path)
 	if err == nil {
-		var cfg Config
-		if err := yaml.Unmarshal(data, &cfg); err != nil {
+		cfg, err := Parse(data)
+		if err != nil {
 			return Config{}, fmt.Errorf("parse %s: %w", path, err)
 		}
 		return cfg, nil
@@ -41,34 +448,972 @@ func Load(path string) (Config, error) {
 	return prompt(), nil
 }
 
-// Validate normalises defaults and checks required fields.
+// Parse decodes a YAML config without validating it.
+func Parse(data []byte) (Config, error) {
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// LoadAll is Load for a config file that may hold several YAML documents,
+// one run each, returned in file order.
+func LoadAll(path string) ([]Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		cfg, err := Load(path)
+		return []Config{cfg}, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	cfgs, err := ParseAll(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return cfgs, nil
+}
+
+// ParseAll decodes every document of a multi-document YAML config, without
+// validating them. Empty documents are skipped.
+func ParseAll(data []byte) ([]Config, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var cfgs []Config
+	for doc := 1; ; doc++ {
+		var node yaml.Node
+		err := dec.Decode(&node)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", doc, err)
+		}
+		if len(node.Content) == 0 || node.Content[0].Tag == "!!null" {
+			continue
+		}
+		var cfg Config
+		if err := node.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("document %d: %w", doc, err)
+		}
+		cfgs = append(cfgs, cfg)
+	}
+	if len(cfgs) == 0 {
+		return []Config{{}}, nil
+	}
+	return cfgs, nil
+}
+
+// spreadsheetIDPattern matches the ID in a Google Sheets URL, between /d/
+// and the next slash.
+var spreadsheetIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{20,}$`)
+
+// ValidSpreadsheetID reports whether id is shaped like a spreadsheet ID.
+// It does not check that the spreadsheet exists.
+func ValidSpreadsheetID(id string) bool {
+	return spreadsheetIDPattern.MatchString(strings.TrimSpace(id))
+}
+
+// Validate normalises defaults, checks required fields and checks that the
+// workbook file is accessible.
 func (c *Config) Validate() error {
-	c.SpreadsheetID = strings.TrimSpace(c.SpreadsheetID)
-	c.SheetFilter = strings.TrimSpace(c.SheetFilter)
-	c.LookupValue = strings.TrimSpace(c.LookupValue)
+	if err := c.ValidateSettings(); err != nil {
+		return err
+	}
+	return c.checkWorkbookFile()
+}
+
+// ValidateSettings is Validate without the checks on the workbook file, for
+// callers that supply the workbook contents some other way.
+func (c *Config) ValidateSettings() error {
+	c.normalize()
+	c.defaults()
+	for i, name := range c.NamedRangeTargets {
+		if name == "" {
+			return fmt.Errorf("named_range_targets[%d] is empty", i)
+		}
+	}
 
-	if c.SpreadsheetID == "" {
+	switch {
+	case c.SpreadsheetID == "" && len(c.SpreadsheetIDs) == 0:
 		return errors.New("spreadsheet_id is required")
+	case c.SpreadsheetID != "" && len(c.SpreadsheetIDs) > 0:
+		return errors.New("set spreadsheet_id or spreadsheet_ids, not both")
+	}
+	if err := c.validateFanOut(); err != nil {
+		return err
 	}
-	if c.LookupValue == "" {
+	if c.LookupValue == "" && c.ScansWorkbook() {
 		return errors.New("lookup_value is required")
 	}
-	if _, err := os.Stat(DefaultWorkbook); err != nil {
-		return fmt.Errorf("access %s: %w", DefaultWorkbook, err)
+	if _, err := c.TypedWriteValue(); err != nil && !IsTemplate(c.WriteValue) {
+		return err
+	}
+	switch c.Mode {
+	case ModeWrite, ModeSync, ModeClear:
+	case ModeAppend:
+		if c.AppendSheet == "" {
+			return errors.New("append_sheet is required in append mode")
+		}
+		if len(c.AppendValues) == 0 {
+			return errors.New("append_values is required in append mode")
+		}
+	case ModePull:
+		if len(c.NamedRangeTargets) > 0 {
+			return errors.New("named_range_targets has no workbook cell to pull into")
+		}
+		if c.TouchCell != "" {
+			return errors.New("touch_cell is not written in pull mode; remove it")
+		}
+	default:
+		return fmt.Errorf("mode must be %s, %s, %s, %s or %s; got %q", ModeWrite, ModeSync, ModeClear, ModeAppend, ModePull, c.Mode)
+	}
+	switch c.ValueRenderOption {
+	case "", "FORMATTED_VALUE", "UNFORMATTED_VALUE", "FORMULA":
+	default:
+		return fmt.Errorf("value_render_option must be FORMATTED_VALUE, UNFORMATTED_VALUE or FORMULA; got %q", c.ValueRenderOption)
+	}
+	switch c.ResponseValueRenderOption {
+	case "", "FORMATTED_VALUE", "UNFORMATTED_VALUE", "FORMULA":
+	default:
+		return fmt.Errorf("response_value_render_option must be FORMATTED_VALUE, UNFORMATTED_VALUE or FORMULA; got %q", c.ResponseValueRenderOption)
+	}
+	if err := CheckInputOption(c.ValueInputOption); err != nil {
+		return fmt.Errorf("value_input_option: %w", err)
+	}
+	if c.MaxRequestBytes < 0 {
+		return fmt.Errorf("max_request_bytes must be positive; got %d", c.MaxRequestBytes)
+	}
+	switch c.DateTimeRenderOption {
+	case "", "SERIAL_NUMBER", "FORMATTED_STRING":
+	default:
+		return fmt.Errorf("date_time_render_option must be SERIAL_NUMBER or FORMATTED_STRING; got %q", c.DateTimeRenderOption)
+	}
+	if c.InsertOnly && c.OccupiedCellPolicy != OccupiedError {
+		return fmt.Errorf("insert_only conflicts with occupied_cell_policy: %s", c.OccupiedCellPolicy)
+	}
+	switch c.OccupiedCellPolicy {
+	case OccupiedSkip, OccupiedOverwrite, OccupiedError:
+	default:
+		return fmt.Errorf("occupied_cell_policy must be %s, %s or %s; got %q", OccupiedSkip, OccupiedOverwrite, OccupiedError, c.OccupiedCellPolicy)
+	}
+	switch c.ExpectPolicy {
+	case ExpectPolicySkip, ExpectPolicyFail:
+	default:
+		return fmt.Errorf("expect_policy must be %s or %s; got %q", ExpectPolicySkip, ExpectPolicyFail, c.ExpectPolicy)
+	}
+	if c.ExpectCurrentValue != nil && c.Mode != ModeWrite {
+		return fmt.Errorf("expect_current_value requires mode %s", ModeWrite)
+	}
+	if c.ScanRange != "" {
+		if strings.Contains(c.ScanRange, "!") {
+			return fmt.Errorf("search_range %q must not include a sheet name", c.ScanRange)
+		}
+		for _, cell := range strings.Split(c.ScanRange, ":") {
+			if _, _, err := excelize.CellNameToCoordinates(cell); err != nil {
+				return fmt.Errorf("search_range %q is not a valid A1 range", c.ScanRange)
+			}
+		}
+	}
+	if c.MaxScanRows < 0 || c.MaxScanCols < 0 {
+		return fmt.Errorf("max_scan_rows and max_scan_cols must not be negative; got %d and %d", c.MaxScanRows, c.MaxScanCols)
+	}
+	if c.ScanConcurrency < 0 {
+		return fmt.Errorf("scan_concurrency must not be negative; got %d", c.ScanConcurrency)
+	}
+	if (c.MaxScanRows > 0 || c.MaxScanCols > 0) && !c.ScansWorkbook() {
+		return errors.New("max_scan_rows and max_scan_cols limit the workbook scan; they cannot be used without one")
+	}
+	for _, f := range c.SheetFilter {
+		if f == "#0" || f == "#-0" {
+			return fmt.Errorf("config_sheet %q: sheet indexes start at #1 (first) or #-1 (last)", f)
+		}
+	}
+	if c.SheetRegex != "" {
+		if _, err := regexp.Compile(c.SheetRegex); err != nil {
+			return fmt.Errorf("sheet_regex %q: %w", c.SheetRegex, err)
+		}
+		if c.SearchDefinedName != "" {
+			return errors.New("sheet_regex cannot be combined with search_defined_name, which picks its own sheet")
+		}
+	}
+	if c.WriteLimit < 0 {
+		return fmt.Errorf("write_limit must not be negative; got %d", c.WriteLimit)
+	}
+	if c.WriteLimit > 0 && !c.ScansWorkbook() {
+		return errors.New("write_limit caps workbook matches; it cannot be used without scanning the workbook")
+	}
+	limit, _, err := c.MatchLimit()
+	if err != nil {
+		return err
+	}
+	if limit > 0 && !c.ScansWorkbook() {
+		return errors.New("per_sheet_match_limit limits workbook matches; it cannot be used without scanning the workbook")
+	}
+	if c.WorkbookBackups < 0 {
+		return fmt.Errorf("workbook_backups must not be negative; got %d", c.WorkbookBackups)
+	}
+	if c.NumericTolerance < 0 || math.IsNaN(c.NumericTolerance) || math.IsInf(c.NumericTolerance, 0) {
+		return fmt.Errorf("numeric_tolerance must be a finite number, 0 or more; got %g", c.NumericTolerance)
+	}
+	if c.HeaderRow < 0 {
+		return fmt.Errorf("header_row must be 1 or more; got %d", c.HeaderRow)
+	}
+	if c.InsertRowBeforeMatch && c.Mode != ModeWrite {
+		return fmt.Errorf("insert_row_before_match requires mode %s", ModeWrite)
+	}
+	if c.CreateMissingSheets && (c.Mode != ModeWrite && c.Mode != ModeSync || c.InsertRowBeforeMatch) {
+		return fmt.Errorf("create_missing_sheets requires mode %s or %s without insert_row_before_match", ModeWrite, ModeSync)
+	}
+	if c.TargetRelativeTo != "" {
+		if _, ok := relativeOffsets[c.TargetRelativeTo]; !ok {
+			return fmt.Errorf("target_relative_to must be one of below, right, above, left; got %q", c.TargetRelativeTo)
+		}
+		if c.TargetRowOffset != 0 || c.TargetColOffset != 0 {
+			return errors.New("target_relative_to cannot be combined with target_row_offset/target_col_offset")
+		}
+	}
+	if rows, _ := c.TargetOffset(); c.InsertRowBeforeMatch && rows != 0 {
+		return errors.New("insert_row_before_match writes into the inserted row; it cannot be combined with target_row_offset or target_relative_to above or below")
+	}
+	if c.TargetColumn != "" {
+		if _, err := c.TargetColumnNumber(); err != nil {
+			return err
+		}
+		if c.TargetColOffset != 0 {
+			return errors.New("target_column and target_col_offset are mutually exclusive")
+		}
+		if c.TargetRelativeTo == "left" || c.TargetRelativeTo == "right" {
+			return fmt.Errorf("target_column cannot be combined with target_relative_to: %s", c.TargetRelativeTo)
+		}
+	}
+	if err := c.validateOverrides(); err != nil {
+		return err
+	}
+	if err := c.validateBlock(); err != nil {
+		return err
+	}
+	if err := c.validateWrites(); err != nil {
+		return err
+	}
+	if err := c.validateMatchedCell(); err != nil {
+		return err
+	}
+	if c.ConditionalFormat != nil {
+		if c.ConditionalFormat.Condition == "" {
+			return errors.New("conditional_format requires a condition such as TEXT_EQ")
+		}
+		if _, _, _, err := c.ConditionalFormat.RGB(); err != nil {
+			return err
+		}
+		if c.Mode != ModeWrite && c.Mode != ModeSync {
+			return fmt.Errorf("conditional_format requires mode %s or %s", ModeWrite, ModeSync)
+		}
+	}
+	if c.NumberFormat != "" && c.Mode != ModeWrite && c.Mode != ModeSync {
+		return fmt.Errorf("number_format requires mode %s or %s", ModeWrite, ModeSync)
+	}
+	if c.ProxyURL != "" {
+		u, err := url.Parse(c.ProxyURL)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("proxy_url %q must be an absolute URL such as http://proxy:8080", c.ProxyURL)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("proxy_url scheme must be http, https or socks5; got %q", u.Scheme)
+		}
+	}
+	if c.MaxRetries < 0 || c.RetryBudget < 0 {
+		return errors.New("max_retries and retry_budget must not be negative")
+	}
+	if c.RetryBudgetTime != "" {
+		if d, err := time.ParseDuration(c.RetryBudgetTime); err != nil || d <= 0 {
+			return fmt.Errorf("retry_budget_time %q must be a positive duration such as 2m", c.RetryBudgetTime)
+		}
+	}
+	if (c.RetryBudget > 0 || c.RetryBudgetTime != "") && c.MaxRetries == 0 {
+		return errors.New("retry_budget and retry_budget_time require max_retries")
+	}
+	if c.CABundleFile != "" {
+		if _, err := os.Stat(c.CABundleFile); err != nil {
+			return fmt.Errorf("ca_bundle_file: %w", err)
+		}
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		return fmt.Errorf("timezone %q: %w", c.Timezone, err)
+	}
+	if c.TouchCell != "" && !strings.Contains(c.TouchCell, "!") {
+		return fmt.Errorf("touch_cell %q must include the sheet name, e.g. Meta!B1", c.TouchCell)
+	}
+	if c.TouchCell != "" {
+		if _, _, err := TabGID(c.TouchCell[:strings.LastIndex(c.TouchCell, "!")]); err != nil {
+			return fmt.Errorf("touch_cell: %w", err)
+		}
+	}
+	if _, _, err := TabGID(c.AppendSheet); err != nil {
+		return fmt.Errorf("append_sheet: %w", err)
+	}
+	if c.DefaultTabFromURL {
+		if c.Mode == ModePull {
+			return errors.New("default_tab_from_url cannot be used in pull mode, which writes back to the workbook's own sheets")
+		}
+		if len(c.urlGIDs) == 0 {
+			return errors.New("default_tab_from_url needs spreadsheet_id or spreadsheet_ids pasted as a URL with #gid=<number>")
+		}
+	}
+	if c.ImportFile != "" {
+		if c.Mode == ModeAppend || c.Mode == ModePull {
+			return fmt.Errorf("import_file cannot be used in mode %s", c.Mode)
+		}
+		if c.InsertRowBeforeMatch || len(c.NamedRangeTargets) > 0 {
+			return errors.New("import_file replaces workbook matching; remove insert_row_before_match and named_range_targets")
+		}
+		if _, err := os.Stat(c.ImportFile); err != nil {
+			return fmt.Errorf("import_file: %w", err)
+		}
+	}
+	if c.RangesFrom != "" {
+		if c.Mode == ModeAppend || c.Mode == ModePull {
+			return fmt.Errorf("ranges_from cannot be used in mode %s", c.Mode)
+		}
+		if c.ImportFile != "" {
+			return errors.New("ranges_from cannot be combined with import_file; both replace workbook matching")
+		}
+		if c.InsertRowBeforeMatch {
+			return errors.New("ranges_from replaces workbook matching; remove insert_row_before_match")
+		}
+		if c.WriteValue == "" && c.LookupValue == "" {
+			return errors.New("ranges_from needs write_value or lookup_value as the value to write")
+		}
+		if _, err := os.Stat(c.RangesFrom); err != nil {
+			return fmt.Errorf("ranges_from: %w", err)
+		}
+	}
+	if c.SchemaFile != "" {
+		if !c.ScansWorkbook() {
+			return errors.New("schema_file checks the scanned workbook; it cannot be used without one")
+		}
+		if _, err := os.Stat(c.SchemaFile); err != nil {
+			return fmt.Errorf("schema_file: %w", err)
+		}
+	}
+	if c.WorkbookLog && (!c.ScansWorkbook() || c.Mode == ModePull) {
+		return fmt.Errorf("workbook_log needs a workbook-scanning write run, not mode %s, import_file or ranges_from", c.Mode)
+	}
+	if c.AuditLog != "" && (c.Mode == ModeAppend || c.Mode == ModePull) {
+		return fmt.Errorf("audit_log records cell changes in modes %s, %s and %s, not %s", ModeWrite, ModeSync, ModeClear, c.Mode)
+	}
+	if c.StateTTL != "" {
+		if c.StateFile == "" {
+			return errors.New("state_ttl requires state_file")
+		}
+		if ttl, err := time.ParseDuration(c.StateTTL); err != nil || ttl <= 0 {
+			return fmt.Errorf("state_ttl %q must be a positive duration such as 20h", c.StateTTL)
+		}
+	}
+	if c.StateFile != "" && c.Mode == ModePull {
+		return fmt.Errorf("state_file cannot be used in mode %s", c.Mode)
+	}
+	if c.SnapshotDir == "" {
+		if c.SnapshotMaxCells != 0 || c.SnapshotPolicy != "" {
+			return errors.New("snapshot_max_cells and snapshot_policy require snapshot_dir")
+		}
+	} else if c.Mode == ModeAppend || c.Mode == ModePull {
+		return fmt.Errorf("snapshot_dir cannot be used in mode %s", c.Mode)
+	}
+	if c.UndoDir != "" && c.Mode != ModeClear {
+		return fmt.Errorf("undo_dir records cleared cells; it requires mode %s", ModeClear)
+	}
+	if c.SnapshotMaxCells < 0 {
+		return fmt.Errorf("snapshot_max_cells must not be negative; got %d", c.SnapshotMaxCells)
+	}
+	switch c.SnapshotPolicy {
+	case "", SnapshotPolicyWarn, SnapshotPolicyFail:
+	default:
+		return fmt.Errorf("snapshot_policy must be %s or %s; got %q", SnapshotPolicyWarn, SnapshotPolicyFail, c.SnapshotPolicy)
+	}
+	return nil
+}
+
+// validateFanOut checks spreadsheet_ids, sheet_maps, stop_on_error and
+// spreadsheet_concurrency.
+func (c *Config) validateFanOut() error {
+	if c.SpreadsheetConcurrency < 0 {
+		return fmt.Errorf("spreadsheet_concurrency must not be negative; got %d", c.SpreadsheetConcurrency)
+	}
+	if len(c.SpreadsheetIDs) == 0 {
+		if len(c.SheetMaps) > 0 || c.StopOnError || c.SpreadsheetConcurrency > 1 {
+			return errors.New("sheet_maps, stop_on_error and spreadsheet_concurrency require spreadsheet_ids")
+		}
+		return nil
+	}
+	if c.SpreadsheetConcurrency > 1 && c.WorkbookLog {
+		return errors.New("workbook_log rewrites the workbook after each spreadsheet, so it needs spreadsheet_concurrency 1")
+	}
+	seen := make(map[string]bool)
+	for i, id := range c.SpreadsheetIDs {
+		switch {
+		case id == "":
+			return fmt.Errorf("spreadsheet_ids[%d] is empty", i)
+		case seen[id]:
+			return fmt.Errorf("spreadsheet_ids lists %s twice", id)
+		}
+		seen[id] = true
+	}
+	for id, tabs := range c.SheetMaps {
+		if !seen[id] {
+			return fmt.Errorf("sheet_maps names %s, which is not in spreadsheet_ids", id)
+		}
+		for from, to := range tabs {
+			if strings.TrimSpace(from) == "" || strings.TrimSpace(to) == "" {
+				return fmt.Errorf("sheet_maps %s: tab names must not be blank", id)
+			}
+			if _, _, err := TabGID(to); err != nil {
+				return fmt.Errorf("sheet_maps %s: %w", id, err)
+			}
+		}
+	}
+	switch {
+	case c.Mode == ModePull:
+		return fmt.Errorf("spreadsheet_ids cannot be used in mode %s, which has a single spreadsheet to pull from", c.Mode)
+	case c.StateFile != "":
+		return errors.New("spreadsheet_ids cannot be combined with state_file, which records one spreadsheet's run")
+	}
+	return nil
+}
+
+func (c *Config) checkWorkbookFile() error {
+	if !c.ScansWorkbook() {
+		return nil
+	}
+	if _, err := os.Stat(c.Workbook); err != nil {
+		return fmt.Errorf("access %s: %w", c.Workbook, err)
+	}
+	if c.WorkbookLog {
+		w, err := os.OpenFile(c.Workbook, os.O_WRONLY, 0)
+		if err != nil {
+			return fmt.Errorf("workbook_log: %s is not writable: %w", c.Workbook, err)
+		}
+		_ = w.Close()
+	}
+	return nil
+}
+
+// GIDPrefix marks a Google Sheets tab given by its gid, the number after
+// #gid= in its URL, rather than its title: gid:123456789. Titles change
+// when a tab is renamed; gids do not.
+const GIDPrefix = "gid:"
+
+// TabGID returns the gid of a tab reference written as gid:<number>, and
+// false for a plain title.
+func TabGID(ref string) (int64, bool, error) {
+	digits, ok := strings.CutPrefix(ref, GIDPrefix)
+	if !ok {
+		return 0, false, nil
+	}
+	gid, err := strconv.ParseInt(strings.TrimSpace(digits), 10, 64)
+	if err != nil || gid < 0 {
+		return 0, false, fmt.Errorf("%q: a gid must be a number, as in #gid=123456789 of the tab's URL", ref)
+	}
+	return gid, true, nil
+}
+
+// DefaultTab returns the tab, as gid:<number>, that default_tab_from_url
+// sends the unmapped workbook sheets of spreadsheet id to. It is empty when
+// the option is off or id was not pasted as a URL with a gid.
+func (c Config) DefaultTab(id string) string {
+	gid, ok := c.urlGIDs[id]
+	if !c.DefaultTabFromURL || !ok {
+		return ""
+	}
+	return GIDPrefix + strconv.FormatInt(gid, 10)
+}
+
+// parseSpreadsheetURL returns the spreadsheet ID of a pasted Google Sheets
+// URL and the gid of the tab it was opened on, if any. ok is false when s
+// is not such a URL.
+func parseSpreadsheetURL(s string) (id string, gid int64, hasGID, ok bool) {
+	u, err := url.Parse(s)
+	if err != nil || u.Host != "docs.google.com" {
+		return "", 0, false, false
+	}
+	_, rest, found := strings.Cut(u.Path, "/d/")
+	if !found || !strings.HasPrefix(u.Path, "/spreadsheets/") {
+		return "", 0, false, false
+	}
+	id, _, _ = strings.Cut(rest, "/")
+	// The gid is in the fragment (#gid=1) and, in newer links, also in
+	// the query (?gid=1#gid=1).
+	raw := u.Query().Get("gid")
+	if frag, err := url.ParseQuery(u.Fragment); err == nil && frag.Get("gid") != "" {
+		raw = frag.Get("gid")
+	}
+	if gid, err = strconv.ParseInt(raw, 10, 64); err != nil || gid < 0 {
+		return id, 0, false, true
+	}
+	return id, gid, true, true
+}
+
+// ScansWorkbook reports whether the run derives its targets from the
+// workbook, as opposed to append mode, an import file or saved ranges.
+func (c Config) ScansWorkbook() bool {
+	return c.Mode != ModeAppend && c.ImportFile == "" && c.RangesFrom == ""
+}
+
+// TargetColumnNumber returns the 1-based column for TargetColumn, or 0 when
+// unset. The error is for a config that skipped Validate, whose
+// TargetColumn is not a column letter.
+func (c Config) TargetColumnNumber() (int, error) {
+	if c.TargetColumn == "" {
+		return 0, nil
+	}
+	n, err := excelize.ColumnNameToNumber(c.TargetColumn)
+	if err != nil {
+		return 0, fmt.Errorf("target_column %q is not a valid column letter", c.TargetColumn)
+	}
+	return n, nil
+}
+
+// normalize trims free-text fields in place without validating them.
+func (c *Config) normalize() {
+	c.SpreadsheetID = c.normalizeSpreadsheetID(c.SpreadsheetID)
+	for i, id := range c.SpreadsheetIDs {
+		c.SpreadsheetIDs[i] = c.normalizeSpreadsheetID(id)
+	}
+	c.Workbook = strings.TrimSpace(c.Workbook)
+	c.QuotaProject = strings.TrimSpace(c.QuotaProject)
+	c.ProxyURL = strings.TrimSpace(c.ProxyURL)
+	c.CABundleFile = strings.TrimSpace(c.CABundleFile)
+	c.ImportFile = strings.TrimSpace(c.ImportFile)
+	c.RangesFrom = strings.TrimSpace(c.RangesFrom)
+	c.SchemaFile = strings.TrimSpace(c.SchemaFile)
+	c.StateFile = strings.TrimSpace(c.StateFile)
+	c.StateTTL = strings.TrimSpace(c.StateTTL)
+	c.SnapshotDir = strings.TrimSpace(c.SnapshotDir)
+	c.UndoDir = strings.TrimSpace(c.UndoDir)
+	c.AuditLog = strings.TrimSpace(c.AuditLog)
+	c.SnapshotPolicy = strings.ToLower(strings.TrimSpace(c.SnapshotPolicy))
+	c.RetryBudgetTime = strings.TrimSpace(c.RetryBudgetTime)
+	c.Mode = strings.ToLower(strings.TrimSpace(c.Mode))
+	c.AppendSheet = strings.TrimSpace(c.AppendSheet)
+	c.TouchCell = strings.TrimSpace(c.TouchCell)
+	c.Timezone = strings.TrimSpace(c.Timezone)
+	c.WriteType = strings.ToLower(strings.TrimSpace(c.WriteType))
+	c.NumberFormat = strings.TrimSpace(c.NumberFormat)
+	c.ExpectPolicy = strings.ToLower(strings.TrimSpace(c.ExpectPolicy))
+	c.OccupiedCellPolicy = strings.ToLower(strings.TrimSpace(c.OccupiedCellPolicy))
+	c.ValueRenderOption = strings.ToUpper(strings.TrimSpace(c.ValueRenderOption))
+	c.DateTimeRenderOption = strings.ToUpper(strings.TrimSpace(c.DateTimeRenderOption))
+	c.ResponseValueRenderOption = strings.ToUpper(strings.TrimSpace(c.ResponseValueRenderOption))
+	c.ValueInputOption = strings.ToUpper(strings.TrimSpace(c.ValueInputOption))
+	for i := range c.Writes {
+		c.Writes[i].ValueInputOption = strings.ToUpper(strings.TrimSpace(c.Writes[i].ValueInputOption))
+	}
+	c.SheetFilter = ParseSheetList(c.SheetFilter...)
+	c.LookupValue = strings.TrimSpace(c.LookupValue)
+	c.SearchDefinedName = strings.TrimSpace(c.SearchDefinedName)
+	c.SheetRegex = strings.TrimSpace(c.SheetRegex)
+	c.PerSheetMatchLimit = strings.ToLower(strings.TrimSpace(c.PerSheetMatchLimit))
+	c.ScanRange = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(c.ScanRange), "$", ""))
+	c.TargetRelativeTo = strings.ToLower(strings.TrimSpace(c.TargetRelativeTo))
+	c.TargetColumn = strings.ToUpper(strings.TrimSpace(c.TargetColumn))
+	if c.ConditionalFormat != nil {
+		c.ConditionalFormat.Condition = strings.ToUpper(strings.TrimSpace(c.ConditionalFormat.Condition))
+		c.ConditionalFormat.Color = strings.TrimSpace(c.ConditionalFormat.Color)
+	}
+	for sheet, o := range c.SheetOverrides {
+		o.OccupiedCellPolicy = strings.ToLower(strings.TrimSpace(o.OccupiedCellPolicy))
+		c.SheetOverrides[sheet] = o
+	}
+	if c.NamedRangeTargets != nil {
+		names := make([]string, len(c.NamedRangeTargets))
+		for i, name := range c.NamedRangeTargets {
+			names[i] = strings.TrimSpace(name)
+		}
+		c.NamedRangeTargets = names
+	}
+}
+
+// defaults fills in the settings Validate gives a value when left blank.
+func (c *Config) defaults() {
+	if c.Mode == "" {
+		c.Mode = ModeWrite
+	}
+	if c.MaxRequestBytes == 0 {
+		c.MaxRequestBytes = DefaultMaxRequestBytes
+	}
+	if c.OccupiedCellPolicy == "" {
+		c.OccupiedCellPolicy = OccupiedSkip
+		if c.InsertOnly {
+			c.OccupiedCellPolicy = OccupiedError
+		}
+	}
+	if c.ExpectPolicy == "" {
+		c.ExpectPolicy = ExpectPolicySkip
+	}
+	if c.HeaderRow == 0 {
+		c.HeaderRow = 1
+	}
+	if c.Workbook == "" {
+		c.Workbook = DefaultWorkbook
+	}
+	if c.Timezone == "" {
+		c.Timezone = DefaultTimezone
+	}
+	if c.SnapshotPolicy == "" && c.SnapshotDir != "" {
+		c.SnapshotPolicy = SnapshotPolicyWarn
+	}
+}
+
+// clone returns a copy of c that shares none of the slices, maps and
+// pointers normalize rewrites in place.
+func (c Config) clone() Config {
+	c.SpreadsheetIDs = slices.Clone(c.SpreadsheetIDs)
+	c.Writes = slices.Clone(c.Writes)
+	c.SheetOverrides = maps.Clone(c.SheetOverrides)
+	c.urlGIDs = maps.Clone(c.urlGIDs)
+	if c.ConditionalFormat != nil {
+		cf := *c.ConditionalFormat
+		c.ConditionalFormat = &cf
+	}
+	return c
+}
+
+// normalizeSpreadsheetID trims id and, when it is a pasted Google Sheets
+// URL, returns the spreadsheet ID from it, remembering the URL's gid for
+// DefaultTab.
+func (c *Config) normalizeSpreadsheetID(id string) string {
+	id = strings.TrimSpace(id)
+	parsed, gid, hasGID, ok := parseSpreadsheetURL(id)
+	if !ok {
+		return id
+	}
+	if hasGID {
+		if c.urlGIDs == nil {
+			c.urlGIDs = make(map[string]int64)
+		}
+		c.urlGIDs[parsed] = gid
+	}
+	return parsed
+}
+
+// Hash returns a stable SHA-256 fingerprint of the normalised configuration
+// with Validate's defaults applied, leaving c untouched. Two configs that
+// differ only in whitespace, YAML key order or spelling out a default hash
+// equally. Unlike a plain fingerprint it also returns an error, for a
+// config that cannot be encoded, such as one whose numeric_tolerance is
+// NaN; Validate rejects those.
+func (c Config) Hash() (string, error) {
+	c = c.clone()
+	c.normalize()
+	c.defaults()
+	// The gid of a pasted URL picks the tab written to, so it is part of
+	// the fingerprint even though spreadsheet_id keeps only the ID.
+	data, err := json.Marshal(struct {
+		Config
+		URLGIDs map[string]int64 `json:",omitempty"`
+	}{c, c.urlGIDs})
+	if err != nil {
+		return "", fmt.Errorf("encode config for hashing: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+var relativeOffsets = map[string][2]int{
+	"below": {1, 0},
+	"right": {0, 1},
+	"above": {-1, 0},
+	"left":  {0, -1},
+}
+
+// TargetOffset returns the row and column shift applied to each match,
+// honouring TargetRelativeTo when set.
+func (c Config) TargetOffset() (int, int) {
+	if off, ok := relativeOffsets[c.TargetRelativeTo]; ok {
+		return off[0], off[1]
+	}
+	return c.TargetRowOffset, c.TargetColOffset
+}
+
+// SheetIndex parses a config_sheet entry written as #N or #-N, a 1-based
+// sheet position where negative counts from the last sheet.
+func SheetIndex(filter string) (int, bool) {
+	rest, ok := strings.CutPrefix(filter, "#")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(rest)
+	if err != nil || n == 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// SheetFilterFoldsCase reports whether config_sheet matching ignores case.
+func (c Config) SheetFilterFoldsCase() bool {
+	return c.SheetFilterCaseInsensitive == nil || *c.SheetFilterCaseInsensitive
+}
+
+// SheetPattern returns the compiled SheetRegex, or nil when unset or
+// invalid. Validate rejects invalid patterns up front.
+func (c Config) SheetPattern() *regexp.Regexp {
+	if c.SheetRegex == "" {
+		return nil
+	}
+	re, err := regexp.Compile(c.SheetRegex)
+	if err != nil {
+		return nil
+	}
+	return re
+}
+
+// KeptWorkbookBackups returns WorkbookBackups, or DefaultWorkbookBackups
+// when unset.
+func (c Config) KeptWorkbookBackups() int {
+	if c.WorkbookBackups <= 0 {
+		return DefaultWorkbookBackups
+	}
+	return c.WorkbookBackups
+}
+
+// SnapshotCellLimit returns SnapshotMaxCells, or DefaultSnapshotMaxCells
+// when unset.
+func (c Config) SnapshotCellLimit() int {
+	if c.SnapshotMaxCells <= 0 {
+		return DefaultSnapshotMaxCells
+	}
+	return c.SnapshotMaxCells
+}
+
+// StateMaxAge returns StateTTL, or 0 when state entries never expire.
+func (c Config) StateMaxAge() time.Duration {
+	ttl, _ := time.ParseDuration(c.StateTTL)
+	return ttl
+}
+
+// RetryBudgetWait returns RetryBudgetTime, or 0 when unset.
+func (c Config) RetryBudgetWait() time.Duration {
+	d, _ := time.ParseDuration(c.RetryBudgetTime)
+	return d
+}
+
+// Location returns the configured timezone, falling back to UTC when it
+// cannot be loaded. Validate rejects unknown zones up front.
+func (c Config) Location() *time.Location {
+	name := c.Timezone
+	if name == "" {
+		name = DefaultTimezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// ScanWorkers returns how many sheets to scan at once: scan_concurrency,
+// or GOMAXPROCS capped at 4 when it is unset.
+func (c Config) ScanWorkers() int {
+	if c.ScanConcurrency > 0 {
+		return c.ScanConcurrency
+	}
+	return min(runtime.GOMAXPROCS(0), 4)
+}
+
+// SpreadsheetWorkers returns how many spreadsheets of spreadsheet_ids to
+// run at once: spreadsheet_concurrency, or 1 when it is unset.
+func (c Config) SpreadsheetWorkers() int {
+	return max(c.SpreadsheetConcurrency, 1)
+}
+
+// MatchLimit parses per_sheet_match_limit into the number of matches kept
+// per sheet, 0 meaning all, and whether one more is an error.
+func (c Config) MatchLimit() (int, bool, error) {
+	if c.PerSheetMatchLimit == "" || c.PerSheetMatchLimit == "all" {
+		return 0, false, nil
+	}
+	num, strict := strings.CutSuffix(c.PerSheetMatchLimit, "-strict")
+	n, err := strconv.Atoi(num)
+	if err != nil || n < 1 {
+		return 0, false, fmt.Errorf("per_sheet_match_limit must be all, a positive number such as 1, or a number with -strict such as 1-strict; got %q", c.PerSheetMatchLimit)
+	}
+	return n, strict, nil
+}
+
+// InputOption returns the value input option for written values:
+// ValueInputOption, or InputUserEntered when unset.
+func (c Config) InputOption() string {
+	if c.ValueInputOption == "" {
+		return InputUserEntered
+	}
+	return c.ValueInputOption
+}
+
+// CheckInputOption fails unless option is blank, InputUserEntered or
+// InputRaw.
+func CheckInputOption(option string) error {
+	switch option {
+	case "", InputUserEntered, InputRaw:
+		return nil
+	}
+	return fmt.Errorf("must be %s or %s; got %q", InputUserEntered, InputRaw, option)
+}
+
+// TypedWriteValue returns the value written for each match, converted to the
+// Go type selected by WriteType so the API receives a JSON number or boolean.
+func (c Config) TypedWriteValue() (interface{}, error) {
+	raw := c.WriteValue
+	if raw == "" {
+		raw = c.LookupValue
+	}
+	switch c.WriteType {
+	case "", "string":
+		return raw, nil
+	case "number":
+		s := strings.TrimSpace(raw)
+		if c.DecimalComma {
+			s = strings.ReplaceAll(strings.ReplaceAll(s, ".", ""), ",", ".")
+		}
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("write_value %q is not a number", raw)
+		}
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, fmt.Errorf("write_value %q is not a finite number", raw)
+		}
+		return n, nil
+	case "bool":
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("write_value %q is not a boolean", raw)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("write_type must be string, number or bool; got %q", c.WriteType)
+}
+
+func (c *Config) validateBlock() error {
+	if c.TargetBlockRows < 0 || c.TargetBlockCols < 0 {
+		return errors.New("target_block_rows and target_block_cols must not be negative")
+	}
+	if len(c.BlockValues) > 0 && !c.UsesTargetBlock() {
+		return errors.New("block_values requires target_block_rows or target_block_cols")
+	}
+	if !c.UsesTargetBlock() {
+		return nil
+	}
+	rows, cols := c.TargetBlock()
+	switch {
+	case c.WriteToRowEnd || len(c.RowValues) > 0:
+		return errors.New("target_block_rows/target_block_cols cannot be combined with write_to_row_end or row_values")
+	case c.InsertRowBeforeMatch && rows > 1:
+		return errors.New("insert_row_before_match inserts one row; target_block_rows must be 1")
+	case len(c.BlockValues) > 0 && c.UsesSourceCell():
+		return errors.New("block_values and the source offsets both supply the block's values; use one")
+	case len(c.BlockValues) > 0 && len(c.BlockValues) != rows*cols:
+		return fmt.Errorf("block_values has %d values but the %dx%d block has %d cells", len(c.BlockValues), rows, cols, rows*cols)
+	case c.UsesSourceCell() && c.StreamWorkbook:
+		return errors.New("stream_workbook cannot read a source block; turn it off or drop the source offsets")
 	}
 	return nil
 }
 
+// validateMatchedCell rejects write_matched_cell alongside every other
+// setting that chooses the written value.
+func (c *Config) validateMatchedCell() error {
+	if !c.WriteMatchedCell {
+		return nil
+	}
+	switch {
+	case !c.ScansWorkbook():
+		return errors.New("write_matched_cell writes the cells the workbook scan matches; it needs a workbook scan")
+	case c.WriteValue != "":
+		return errors.New("write_matched_cell and write_value both choose the written value; use one")
+	case c.WriteType != "" && c.WriteType != "string":
+		return fmt.Errorf("write_matched_cell writes the cell text; write_type %s does not apply", c.WriteType)
+	case len(c.Writes) > 0:
+		return errors.New("write_matched_cell cannot be combined with writes, whose entries carry their own values")
+	case c.UsesSourceCell():
+		return errors.New("write_matched_cell cannot be combined with the source offsets, which write another cell")
+	case len(c.RowValues) > 0 || len(c.BlockValues) > 0:
+		return errors.New("write_matched_cell cannot be combined with row_values or block_values")
+	}
+	for _, sheet := range c.OverrideSheets() {
+		if c.SheetOverrides[sheet].WriteValue != nil {
+			return fmt.Errorf("sheet_overrides[%s]: write_value cannot be combined with write_matched_cell", sheet)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateWrites() error {
+	if len(c.Writes) == 0 {
+		return nil
+	}
+	seen := make(map[[2]int]int, len(c.Writes))
+	for i, w := range c.Writes {
+		r, col, err := w.Offsets()
+		if err != nil {
+			return fmt.Errorf("writes[%d]: %w", i, err)
+		}
+		if err := CheckInputOption(w.ValueInputOption); err != nil {
+			return fmt.Errorf("writes[%d] value_input_option: %w", i, err)
+		}
+		if j, dup := seen[[2]int{r, col}]; dup {
+			return fmt.Errorf("writes[%d] and writes[%d] both write offset %d,%d", j, i, r, col)
+		}
+		seen[[2]int{r, col}] = i
+	}
+	switch {
+	case c.WriteValue != "":
+		return errors.New("writes gives every cell its own value; remove write_value")
+	case c.TargetRowOffset != 0 || c.TargetColOffset != 0 || c.TargetRelativeTo != "" || c.TargetColumn != "":
+		return errors.New("writes sets its own offsets; remove target_row_offset, target_col_offset, target_relative_to and target_column")
+	case c.WriteToRowEnd || len(c.RowValues) > 0 || c.UsesTargetBlock():
+		return errors.New("writes cannot be combined with write_to_row_end, row_values or a target block")
+	case c.UsesSourceCell():
+		return errors.New("writes cannot be combined with the source offsets")
+	case c.InsertRowBeforeMatch:
+		return errors.New("writes cannot be combined with insert_row_before_match")
+	}
+	for _, sheet := range c.OverrideSheets() {
+		o := c.SheetOverrides[sheet]
+		if o.TargetRowOffset != nil || o.TargetColOffset != nil || o.WriteValue != nil {
+			return fmt.Errorf("sheet_overrides[%s]: writes sets offsets and values; override only occupied_cell_policy or max_matches", sheet)
+		}
+	}
+	return nil
+}
+
+// UsesTargetBlock reports whether each target is wider or taller than one cell.
+func (c Config) UsesTargetBlock() bool {
+	return c.TargetBlockRows > 1 || c.TargetBlockCols > 1
+}
+
+// TargetBlock returns the rows and columns of each target block, at least 1x1.
+func (c Config) TargetBlock() (int, int) {
+	return max(c.TargetBlockRows, 1), max(c.TargetBlockCols, 1)
+}
+
+// UsesSourceCell reports whether write values come from a workbook cell next to the match.
+func (c Config) UsesSourceCell() bool {
+	return c.SourceRowOffset != 0 || c.SourceColOffset != 0
+}
+
 func prompt() Config {
 	var cfg Config
 	if err := survey.AskOne(&survey.Input{Message: "Google Spreadsheet ID"}, &cfg.SpreadsheetID, survey.WithValidator(survey.Required)); err != nil {
 		fmt.Fprintln(os.Stderr, "input cancelled:", err)
 		os.Exit(1)
 	}
-	if err := survey.AskOne(&survey.Input{Message: "Limit lookup to a single sheet (press Enter for all)"}, &cfg.SheetFilter); err != nil {
+	var sheetFilter string
+	if err := survey.AskOne(&survey.Input{Message: "Limit lookup to sheets, comma separated (press Enter for all)"}, &sheetFilter); err != nil {
 		fmt.Fprintln(os.Stderr, "input cancelled:", err)
 		os.Exit(1)
 	}
+	cfg.SheetFilter = ParseSheetList(strings.Split(sheetFilter, ",")...)
 	if err := survey.AskOne(&survey.Input{Message: "Lookup value to search for"}, &cfg.LookupValue, survey.WithValidator(survey.Required)); err != nil {
 		fmt.Fprintln(os.Stderr, "input cancelled:", err)
 		os.Exit(1)
@@ -79,15 +1424,41 @@ func prompt() Config {
 }
 
 // Write saves the configuration and optionally copies a workbook into place.
-func Write(cfg Config, workbookSource string) error {
+// It returns where the workbook it replaced was backed up, or "" when no
+// backup was taken. cfg is saved as given, without the defaults and
+// normalisation validating it applies.
+func Write(cfg Config, workbookSource string) (string, error) {
+	var backup string
 	if workbookSource != "" {
-		if err := copyFile(workbookSource, DefaultWorkbook); err != nil {
-			return fmt.Errorf("copy workbook: %w", err)
+		dest := cfg.Workbook
+		if dest == "" {
+			dest = DefaultWorkbook
 		}
+		var err error
+		if backup, err = copyFile(workbookSource, dest, cfg.KeptWorkbookBackups()); err != nil {
+			return "", fmt.Errorf("copy workbook: %w", err)
+		}
+	}
+	checked := cfg.clone()
+	if err := checked.Validate(); err != nil {
+		return backup, err
 	}
-	if err := cfg.Validate(); err != nil {
+	return backup, save(cfg)
+}
+
+// WriteSettings is Write without the workbook copy and the checks on the
+// workbook file, for configs written before their workbook is in place.
+func WriteSettings(cfg Config) error {
+	checked := cfg.clone()
+	if err := checked.ValidateSettings(); err != nil {
 		return err
 	}
+	return save(cfg)
+}
+
+// save writes cfg to DefaultPath. The file is replaced by rename so a
+// crash never leaves it half written.
+func save(cfg Config) error {
 	if err := os.MkdirAll(filepath.Dir(DefaultPath), 0o755); err != nil {
 		return fmt.Errorf("ensure config dir: %w", err)
 	}
@@ -95,25 +1466,127 @@ func Write(cfg Config, workbookSource string) error {
 	if err != nil {
 		return fmt.Errorf("encode config: %w", err)
 	}
-	return os.WriteFile(DefaultPath, data, 0o644)
+	tmp, err := os.CreateTemp(filepath.Dir(DefaultPath), filepath.Base(DefaultPath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("replace %s: %w", DefaultPath, err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("replace %s: %w", DefaultPath, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("replace %s: %w", DefaultPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("replace %s: %w", DefaultPath, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("replace %s: %w", DefaultPath, err)
+	}
+	if err := os.Rename(tmp.Name(), DefaultPath); err != nil {
+		return fmt.Errorf("replace %s: %w", DefaultPath, err)
+	}
+	return nil
 }
 
-func copyFile(src, dest string) error {
+// copyFile replaces dest with the workbook at src. src must open as a
+// workbook with at least one sheet; it is copied to a temporary file next
+// to dest, synced, checked against src's checksum and only then renamed
+// into place, so a failed check leaves dest untouched. The previous dest is
+// kept as a timestamped backup, up to keep of them, unless it is identical
+// to src. It returns the backup's path, or "" when none was taken.
+func copyFile(src, dest string, keep int) (string, error) {
+	if err := checkWorkbook(src); err != nil {
+		return "", err
+	}
 	in, err := os.Open(src)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer func() { _ = in.Close() }()
 	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
-		return err
+		return "", err
 	}
-	out, err := os.Create(dest)
+	tmp, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".*.tmp")
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer func() { _ = out.Close() }()
-	if _, err := io.Copy(out, in); err != nil {
-		return err
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	sum := sha256.New()
+	if _, err := io.Copy(tmp, io.TeeReader(in, sum)); err != nil {
+		_ = tmp.Close()
+		return "", fmt.Errorf("copy %s: %w", src, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return "", fmt.Errorf("sync copy of %s: %w", src, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("sync copy of %s: %w", src, err)
+	}
+	return installCopy(tmp.Name(), hex.EncodeToString(sum.Sum(nil)), src, dest, keep)
+}
+
+// installCopy renames tmp, a copy of src, over dest once its checksum is
+// want, backing up dest as copyFile describes. A copy that does not match
+// leaves dest untouched.
+func installCopy(tmp, want, src, dest string, keep int) (string, error) {
+	copied, err := fileChecksum(tmp)
+	if err != nil {
+		return "", fmt.Errorf("verify copy of %s: %w", src, err)
+	}
+	if copied != want {
+		return "", fmt.Errorf("verify copy of %s: checksum %s does not match the source's %s; %s was left unchanged", src, copied, want, dest)
+	}
+	if current, err := fileChecksum(dest); err == nil && current == want {
+		return "", nil
+	}
+	if err := os.Chmod(tmp, 0o644); err != nil {
+		return "", err
+	}
+	backup, err := backupFile(dest, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("back up %s: %w", dest, err)
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		if backup != "" {
+			_ = os.Rename(backup, dest)
+		}
+		return "", err
+	}
+	if backup != "" {
+		if err := pruneBackups(dest, keep); err != nil {
+			return backup, fmt.Errorf("prune backups of %s: %w", dest, err)
+		}
+	}
+	return backup, nil
+}
+
+// checkWorkbook fails unless path opens as a workbook with a sheet.
+func checkWorkbook(path string) error {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return fmt.Errorf("%s is not a valid workbook: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+	if len(f.GetSheetList()) == 0 {
+		return fmt.Errorf("%s is not a valid workbook: it has no sheets", path)
+	}
+	return nil
+}
+
+// fileChecksum returns the hex SHA-256 of the file at path.
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return "", err
 	}
-	return out.Sync()
+	return hex.EncodeToString(sum.Sum(nil)), nil
 }
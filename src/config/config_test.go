@@ -0,0 +1,832 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSheetListUnmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want SheetList
+	}{
+		{"scalar", "config_sheet: Week1\n", SheetList{"Week1"}},
+		{"scalar is trimmed", "config_sheet: '  Week1 '\n", SheetList{"Week1"}},
+		{"sequence", "config_sheet: [Week1, Week2]\n", SheetList{"Week1", "Week2"}},
+		{"block sequence drops blanks", "config_sheet:\n  - Week1\n  - ''\n  - ' Week2'\n", SheetList{"Week1", "Week2"}},
+		{"empty scalar", "config_sheet: ''\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			if err := yaml.Unmarshal([]byte(tt.doc), &cfg); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg.SheetFilter, tt.want) {
+				t.Errorf("SheetFilter = %#v, want %#v", cfg.SheetFilter, tt.want)
+			}
+		})
+	}
+}
+
+func TestSheetListUnmarshalRejectsMapping(t *testing.T) {
+	var cfg Config
+	if err := yaml.Unmarshal([]byte("config_sheet: {a: b}\n"), &cfg); err == nil {
+		t.Fatal("want an error for a mapping")
+	}
+}
+
+func TestSheetListMarshalRoundTrip(t *testing.T) {
+	for _, list := range []SheetList{{"Week1"}, {"Week1", "Week2"}} {
+		data, err := yaml.Marshal(Config{SheetFilter: list})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back Config
+		if err := yaml.Unmarshal(data, &back); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(back.SheetFilter, list) {
+			t.Errorf("round trip of %v gave %v (yaml %q)", list, back.SheetFilter, data)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	base := Config{SpreadsheetID: "abc", SheetFilter: SheetList{"Week1"}, LookupValue: "Alice"}
+	same := func(c Config) Config { return c }
+	tests := []struct {
+		name  string
+		edit  func(Config) Config
+		equal bool
+	}{
+		{"identical", same, true},
+		{"surrounding whitespace", func(c Config) Config {
+			c.SpreadsheetID, c.LookupValue = " abc ", "Alice\t"
+			return c
+		}, true},
+		{"changed lookup value", func(c Config) Config { c.LookupValue = "Bob"; return c }, false},
+		{"changed sheet filter", func(c Config) Config { c.SheetFilter = SheetList{"Week2"}; return c }, false},
+		{"changed offset", func(c Config) Config { c.TargetColOffset = 1; return c }, false},
+		{"default mode spelled out", func(c Config) Config { c.Mode = ModeWrite; return c }, true},
+		{"default policies spelled out", func(c Config) Config {
+			c.OccupiedCellPolicy, c.ExpectPolicy, c.HeaderRow = OccupiedSkip, ExpectPolicySkip, 1
+			return c
+		}, true},
+		{"default workbook spelled out", func(c Config) Config { c.Workbook = DefaultWorkbook; return c }, true},
+		{"other mode", func(c Config) Config { c.Mode = ModeSync; return c }, false},
+		{"pasted as a URL", func(c Config) Config {
+			c.SpreadsheetID = "https://docs.google.com/spreadsheets/d/abc/edit"
+			return c
+		}, true},
+		{"URL gid", func(c Config) Config {
+			c.SpreadsheetID = "https://docs.google.com/spreadsheets/d/abc/edit#gid=42"
+			return c
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mustHash(t, tt.edit(base)) == mustHash(t, base)
+			if got != tt.equal {
+				t.Errorf("hashes equal = %v, want %v", got, tt.equal)
+			}
+		})
+	}
+}
+
+func TestHashIgnoresKeyOrder(t *testing.T) {
+	var a, b Config
+	if err := yaml.Unmarshal([]byte("spreadsheet_id: abc\nlookup_value: Alice\n"), &a); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal([]byte("lookup_value: Alice\nspreadsheet_id: abc\n"), &b); err != nil {
+		t.Fatal(err)
+	}
+	if mustHash(t, a) != mustHash(t, b) {
+		t.Error("key order changed the hash")
+	}
+}
+
+func TestHashLeavesConfigUntouched(t *testing.T) {
+	cf := &ConditionalFormat{Condition: " text_eq ", Color: " #ff0000 "}
+	c := Config{
+		SpreadsheetIDs:    []string{" north "},
+		Writes:            []CellWrite{{Offset: "0,1", ValueInputOption: "raw"}},
+		SheetOverrides:    map[string]Override{"Plan": {OccupiedCellPolicy: " Overwrite "}},
+		ConditionalFormat: cf,
+		LookupValue:       "Alice",
+	}
+	mustHash(t, c)
+	if c.SpreadsheetIDs[0] != " north " || c.Writes[0].ValueInputOption != "raw" ||
+		c.SheetOverrides["Plan"].OccupiedCellPolicy != " Overwrite " || cf.Condition != " text_eq " || c.Mode != "" {
+		t.Errorf("Hash changed its receiver: %+v, conditional format %+v", c, *cf)
+	}
+}
+
+func TestHashConcurrent(t *testing.T) {
+	c := Config{SpreadsheetIDs: []string{" north ", "south"}, Writes: []CellWrite{{Offset: "0,1", ValueInputOption: "raw"}}, LookupValue: "Alice"}
+	want := mustHash(t, c)
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := c.Hash(); err != nil || got != want {
+				t.Errorf("concurrent Hash = %s, %v; want %s", got, err, want)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestHashUnencodableConfig(t *testing.T) {
+	if _, err := (Config{NumericTolerance: math.NaN()}).Hash(); err == nil {
+		t.Error("Hash of a NaN numeric_tolerance succeeded")
+	}
+}
+
+func mustHash(t *testing.T, c Config) string {
+	t.Helper()
+	h, err := c.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestValidateNumericTolerance(t *testing.T) {
+	chdirWithWorkbook(t)
+	tests := []struct {
+		tolerance float64
+		wantErr   bool
+	}{
+		{0, false},
+		{0.01, false},
+		{-0.01, true},
+		{math.NaN(), true},
+		{math.Inf(1), true},
+		{math.Inf(-1), true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.tolerance), func(t *testing.T) {
+			c := Config{SpreadsheetID: "sheet-id", LookupValue: "3.1", NumericTolerance: tt.tolerance}
+			err := c.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "numeric_tolerance") {
+				t.Errorf("Validate = %v, want a numeric_tolerance error", err)
+			}
+		})
+	}
+}
+
+func TestValidateDefaultsWorkbook(t *testing.T) {
+	dir := chdirWithWorkbook(t)
+	custom := filepath.Join(dir, "Custom.xlsx")
+	if err := os.WriteFile(custom, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		workbook string
+		want     string
+	}{
+		{"blank", "", DefaultWorkbook},
+		{"whitespace", "  ", DefaultWorkbook},
+		{"explicit", custom, custom},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{SpreadsheetID: "abc", LookupValue: "Alice", Workbook: tt.workbook}
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if cfg.Workbook != tt.want {
+				t.Errorf("Workbook = %q, want %q", cfg.Workbook, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateMissingWorkbook(t *testing.T) {
+	t.Chdir(t.TempDir())
+	cfg := Config{SpreadsheetID: "abc", LookupValue: "Alice"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), DefaultWorkbook) {
+		t.Errorf("Validate error = %v, want mention of %s", err, DefaultWorkbook)
+	}
+}
+
+func TestTypedWriteValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		want    interface{}
+		wantErr bool
+	}{
+		{"lookup value by default", Config{LookupValue: "Alice"}, "Alice", false},
+		{"number", Config{WriteValue: "3", WriteType: "number"}, 3.0, false},
+		{"bool", Config{WriteValue: "true", WriteType: "bool"}, true, false},
+		{"bad number", Config{WriteValue: "three", WriteType: "number"}, nil, true},
+		{"NaN", Config{WriteValue: "NaN", WriteType: "number"}, nil, true},
+		{"infinity", Config{WriteValue: "-Inf", WriteType: "number"}, nil, true},
+		{"overflow", Config{WriteValue: "1e400", WriteType: "number"}, nil, true},
+		{"bad bool", Config{WriteValue: "yes please", WriteType: "bool"}, nil, true},
+		{"unknown type", Config{WriteValue: "x", WriteType: "date"}, nil, true},
+		{"decimal comma", Config{WriteValue: "12,5", WriteType: "number", DecimalComma: true}, 12.5, false},
+		{"decimal comma with grouping", Config{WriteValue: "1.234,50", WriteType: "number", DecimalComma: true}, 1234.5, false},
+		{"decimal comma leaves strings alone", Config{WriteValue: "1,5", WriteType: "string", DecimalComma: true}, "1,5", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cfg.TypedWriteValue()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateScanRange(t *testing.T) {
+	chdirWithWorkbook(t)
+	tests := []struct {
+		scanRange string
+		want      string
+		wantErr   bool
+	}{
+		{"a1:f100", "A1:F100", false},
+		{"$B$2", "B2", false},
+		{"Plan!A1:B2", "", true},
+		{"A1:nope", "", true},
+	}
+	for _, tt := range tests {
+		cfg := Config{SpreadsheetID: "abc", LookupValue: "Alice", ScanRange: tt.scanRange}
+		err := cfg.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: err = %v, wantErr %v", tt.scanRange, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && cfg.ScanRange != tt.want {
+			t.Errorf("%q: normalised to %q, want %q", tt.scanRange, cfg.ScanRange, tt.want)
+		}
+	}
+}
+
+// chdirWithWorkbook moves the test into an empty directory holding a
+// placeholder DefaultWorkbook, so Validate's existence check passes.
+func chdirWithWorkbook(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.MkdirAll(filepath.Dir(DefaultWorkbook), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(DefaultWorkbook, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestWriteSavesConfigAsGiven(t *testing.T) {
+	chdirWithWorkbook(t)
+	if _, err := Write(Config{SpreadsheetID: "sheet-id", LookupValue: "Alice"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(DefaultPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.OccupiedCellPolicy != "" {
+		t.Errorf("saved occupied_cell_policy = %q, want it left unset", cfg.OccupiedCellPolicy)
+	}
+	// insert_only needs the error policy, which a saved default would
+	// have ruled out.
+	cfg.InsertOnly = true
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("insert_only after a round trip: %v", err)
+	}
+}
+
+func TestValidateInsertOnly(t *testing.T) {
+	chdirWithWorkbook(t)
+	tests := []struct {
+		policy  string
+		wantErr bool
+	}{
+		{"", false},
+		{"error", false},
+		{"overwrite", true},
+		{"skip", true},
+	}
+	for _, tt := range tests {
+		cfg := Config{SpreadsheetID: "abc", LookupValue: "Alice", InsertOnly: true, OccupiedCellPolicy: tt.policy}
+		err := cfg.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("policy %q: err = %v, wantErr %v", tt.policy, err, tt.wantErr)
+			continue
+		}
+		if err == nil && cfg.OccupiedCellPolicy != OccupiedError {
+			t.Errorf("policy %q: OccupiedCellPolicy = %q, want %q", tt.policy, cfg.OccupiedCellPolicy, OccupiedError)
+		}
+	}
+}
+
+func TestLocationFallsBackToUTC(t *testing.T) {
+	tests := []struct {
+		zone, want string
+	}{
+		{"", DefaultTimezone},
+		{"Europe/Berlin", "Europe/Berlin"},
+		{"Nowhere/Missing_Zone", "UTC"},
+	}
+	for _, tt := range tests {
+		if got := (Config{Timezone: tt.zone}).Location().String(); got != tt.want {
+			t.Errorf("Location(%q) = %s, want %s", tt.zone, got, tt.want)
+		}
+	}
+}
+
+func TestCellWriteOffsets(t *testing.T) {
+	tests := []struct {
+		offset     string
+		rows, cols int
+		wantErr    bool
+	}{
+		{"+1,0", 1, 0, false},
+		{" -2 , +3 ", -2, 3, false},
+		{"0,0", 0, 0, false},
+		{"1", 0, 0, true},
+		{"a,1", 0, 0, true},
+		{"1,b", 0, 0, true},
+	}
+	for _, tt := range tests {
+		r, c, err := CellWrite{Offset: tt.offset}.Offsets()
+		if (err != nil) != tt.wantErr || r != tt.rows || c != tt.cols {
+			t.Errorf("Offsets(%q) = %d, %d, %v; want %d, %d, error %v", tt.offset, r, c, err, tt.rows, tt.cols, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateWrites(t *testing.T) {
+	chdirWithWorkbook(t)
+	writes := []CellWrite{{Offset: "+1,0", Value: "DONE"}, {Offset: "0,1", Value: "x"}}
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"plain", Config{Writes: writes}, ""},
+		{"duplicate offset", Config{Writes: []CellWrite{{Offset: "1,0"}, {Offset: "+1,+0"}}}, "both write offset 1,0"},
+		{"bad offset", Config{Writes: []CellWrite{{Offset: "down"}}}, "writes[0]"},
+		{"with write_value", Config{Writes: writes, WriteValue: "x"}, "remove write_value"},
+		{"with offsets", Config{Writes: writes, TargetRowOffset: 1}, "sets its own offsets"},
+		{"with row_values", Config{Writes: writes, RowValues: []string{"a"}}, "cannot be combined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.SpreadsheetID = "sheet-id"
+			tt.cfg.LookupValue = "Alice"
+			err := tt.cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateWriteMatchedCell(t *testing.T) {
+	chdirWithWorkbook(t)
+	other := "x"
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"plain", Config{}, ""},
+		{"with target offset", Config{TargetColOffset: 1}, ""},
+		{"with write_value", Config{WriteValue: "x"}, "both choose the written value"},
+		{"with number write_type", Config{LookupValue: "3", WriteType: "number"}, "write_type number"},
+		{"with writes", Config{Writes: []CellWrite{{Offset: "0,1", Value: "x"}}}, "cannot be combined with writes"},
+		{"with source offset", Config{SourceColOffset: 1}, "source offsets"},
+		{"with row_values", Config{RowValues: []string{"a"}}, "row_values"},
+		{"with override write_value", Config{SheetOverrides: map[string]Override{"Plan": {WriteValue: &other}}}, "sheet_overrides[Plan]"},
+		{"without a workbook scan", Config{Mode: ModeAppend, AppendSheet: "Log", AppendValues: []string{"a"}}, "needs a workbook scan"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.SpreadsheetID = "sheet-id"
+			if tt.cfg.LookupValue == "" {
+				tt.cfg.LookupValue = "Alice"
+			}
+			tt.cfg.WriteMatchedCell = true
+			err := tt.cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSheetRegex(t *testing.T) {
+	chdirWithWorkbook(t)
+	tests := []struct {
+		regex, definedName string
+		wantErr            string
+	}{
+		{`^Week\d+$`, "", ""},
+		{`^Week(`, "", "sheet_regex"},
+		{`^Week`, "Roster", "search_defined_name"},
+	}
+	for _, tt := range tests {
+		cfg := Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", SheetRegex: tt.regex, SearchDefinedName: tt.definedName}
+		err := cfg.Validate()
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("Validate(%q) = %v", tt.regex, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Validate(%q) = %v, want %q", tt.regex, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateSpreadsheetConcurrency(t *testing.T) {
+	chdirWithWorkbook(t)
+	ids := []string{"north", "south"}
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"serial", Config{SpreadsheetIDs: ids, SpreadsheetConcurrency: 1}, ""},
+		{"concurrent", Config{SpreadsheetIDs: ids, SpreadsheetConcurrency: 4}, ""},
+		{"negative", Config{SpreadsheetIDs: ids, SpreadsheetConcurrency: -1}, "must not be negative"},
+		{"without spreadsheet_ids", Config{SpreadsheetID: "sheet-id", SpreadsheetConcurrency: 2}, "require spreadsheet_ids"},
+		{"with workbook_log", Config{SpreadsheetIDs: ids, SpreadsheetConcurrency: 2, WorkbookLog: true}, "spreadsheet_concurrency 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.LookupValue = "Alice"
+			err := tt.cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSpreadsheetURL(t *testing.T) {
+	chdirWithWorkbook(t)
+	tests := []struct {
+		name, in, wantID, wantTab string
+	}{
+		{"plain ID", "1AbCdEfGhIjKlMnOpQrStUvWxYz", "1AbCdEfGhIjKlMnOpQrStUvWxYz", ""},
+		{"URL without gid", "https://docs.google.com/spreadsheets/d/1AbCdEfGhIjKlMnOpQrStUvWxYz/edit", "1AbCdEfGhIjKlMnOpQrStUvWxYz", ""},
+		{"URL with fragment gid", " https://docs.google.com/spreadsheets/d/1AbCdEfGhIjKlMnOpQrStUvWxYz/edit#gid=123456789 ", "1AbCdEfGhIjKlMnOpQrStUvWxYz", "gid:123456789"},
+		{"URL with query and fragment gid", "https://docs.google.com/spreadsheets/d/1AbCdEfGhIjKlMnOpQrStUvWxYz/edit?gid=0#gid=0", "1AbCdEfGhIjKlMnOpQrStUvWxYz", "gid:0"},
+		{"other host", "https://example.com/spreadsheets/d/1AbCdEfGhIjKlMnOpQrStUvWxYz/edit#gid=1", "https://example.com/spreadsheets/d/1AbCdEfGhIjKlMnOpQrStUvWxYz/edit#gid=1", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{SpreadsheetID: tt.in, LookupValue: "Alice", DefaultTabFromURL: tt.wantTab != ""}
+			if err := c.ValidateSettings(); err != nil {
+				t.Fatalf("ValidateSettings: %v", err)
+			}
+			if c.SpreadsheetID != tt.wantID {
+				t.Errorf("SpreadsheetID = %q, want %q", c.SpreadsheetID, tt.wantID)
+			}
+			if got := c.DefaultTab(c.SpreadsheetID); got != tt.wantTab {
+				t.Errorf("DefaultTab = %q, want %q", got, tt.wantTab)
+			}
+		})
+	}
+	// Without the opt-in the URL's gid is not used.
+	c := Config{SpreadsheetID: "https://docs.google.com/spreadsheets/d/abc/edit#gid=7", LookupValue: "Alice"}
+	if err := c.ValidateSettings(); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.DefaultTab("abc"); got != "" {
+		t.Errorf("DefaultTab without default_tab_from_url = %q, want empty", got)
+	}
+}
+
+func TestWriteKeepsSpreadsheetURL(t *testing.T) {
+	chdirWithWorkbook(t)
+	url := "https://docs.google.com/spreadsheets/d/north/edit#gid=7"
+	if _, err := Write(Config{SpreadsheetID: url, LookupValue: "Alice", DefaultTabFromURL: true}, ""); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(DefaultPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SpreadsheetID != url {
+		t.Errorf("saved spreadsheet_id = %q, want the URL %q", cfg.SpreadsheetID, url)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("default_tab_from_url after a round trip: %v", err)
+	}
+	if got := cfg.DefaultTab("north"); got != "gid:7" {
+		t.Errorf("DefaultTab = %q, want gid:7", got)
+	}
+}
+
+func TestValidateTabGIDs(t *testing.T) {
+	chdirWithWorkbook(t)
+	url := "https://docs.google.com/spreadsheets/d/north/edit#gid=7"
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"append_sheet gid", Config{SpreadsheetID: "sheet-id", Mode: ModeAppend, AppendSheet: "gid:7", AppendValues: []string{"x"}}, ""},
+		{"append_sheet bad gid", Config{SpreadsheetID: "sheet-id", Mode: ModeAppend, AppendSheet: "gid:log", AppendValues: []string{"x"}}, "append_sheet"},
+		{"touch_cell gid", Config{SpreadsheetID: "sheet-id", TouchCell: "gid:7!B1"}, ""},
+		{"touch_cell bad gid", Config{SpreadsheetID: "sheet-id", TouchCell: "gid:-7!B1"}, "touch_cell"},
+		{"sheet_maps gid", Config{SpreadsheetIDs: []string{"north"}, SheetMaps: map[string]map[string]string{"north": {"Plan": "gid:7"}}}, ""},
+		{"sheet_maps bad gid", Config{SpreadsheetIDs: []string{"north"}, SheetMaps: map[string]map[string]string{"north": {"Plan": "gid:seven"}}}, "sheet_maps north"},
+		{"default tab", Config{SpreadsheetID: url, DefaultTabFromURL: true}, ""},
+		{"default tab for spreadsheet_ids", Config{SpreadsheetIDs: []string{url, "south"}, DefaultTabFromURL: true}, ""},
+		{"default tab without URL gid", Config{SpreadsheetID: "sheet-id", DefaultTabFromURL: true}, "default_tab_from_url needs"},
+		{"default tab in pull mode", Config{SpreadsheetID: url, DefaultTabFromURL: true, Mode: ModePull}, "pull mode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.LookupValue = "Alice"
+			err := tt.cfg.ValidateSettings()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateSettings: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateSettings = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateTargetColumn(t *testing.T) {
+	chdirWithWorkbook(t)
+	tests := []struct {
+		name    string
+		cfg     Config
+		want    int
+		wantErr string
+	}{
+		{"single letter", Config{TargetColumn: "F"}, 6, ""},
+		{"multi letter", Config{TargetColumn: "AA"}, 27, ""},
+		{"lowercase", Config{TargetColumn: " ab "}, 28, ""},
+		{"with row offset", Config{TargetColumn: "C", TargetRowOffset: 1}, 3, ""},
+		{"with relative below", Config{TargetColumn: "C", TargetRelativeTo: "below"}, 3, ""},
+		{"invalid letter", Config{TargetColumn: "F1"}, 0, `target_column "F1" is not a valid column letter`},
+		{"past the last column", Config{TargetColumn: "ZZZZ"}, 0, "not a valid column letter"},
+		{"with col offset", Config{TargetColumn: "F", TargetColOffset: 1}, 0, "target_column and target_col_offset are mutually exclusive"},
+		{"with relative right", Config{TargetColumn: "F", TargetRelativeTo: "right"}, 0, "target_column cannot be combined with target_relative_to: right"},
+		{"with relative left", Config{TargetColumn: "F", TargetRelativeTo: "left"}, 0, "target_column cannot be combined with target_relative_to: left"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.SpreadsheetID, tt.cfg.LookupValue = "sheet-id", "Alice"
+			err := tt.cfg.Validate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Validate = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if got, err := tt.cfg.TargetColumnNumber(); err != nil || got != tt.want {
+				t.Errorf("TargetColumnNumber = %d, %v, want %d", got, err, tt.want)
+			}
+		})
+	}
+	// A config that skipped Validate reports the bad column instead of
+	// falling back to the match's own column.
+	if _, err := (Config{TargetColumn: "1"}).TargetColumnNumber(); err == nil {
+		t.Error("TargetColumnNumber accepted an invalid column without Validate")
+	}
+}
+
+func TestValidateMaxScan(t *testing.T) {
+	chdirWithWorkbook(t)
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"rows and columns", Config{MaxScanRows: 500, MaxScanCols: 26}, ""},
+		{"with search_range", Config{MaxScanRows: 5, ScanRange: "B2:D9"}, ""},
+		{"negative rows", Config{MaxScanRows: -1}, "must not be negative; got -1 and 0"},
+		{"negative columns", Config{MaxScanCols: -2}, "must not be negative; got 0 and -2"},
+		{"append mode", Config{MaxScanRows: 5, Mode: ModeAppend, AppendSheet: "Log", AppendValues: []string{"x"}}, "cannot be used without one"},
+		{"import_file", Config{MaxScanCols: 5, ImportFile: "cfg/Schedule.xlsx"}, "cannot be used without one"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.SpreadsheetID, tt.cfg.LookupValue = "sheet-id", "Alice"
+			err := tt.cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateInsertRowBeforeMatchOffsets(t *testing.T) {
+	chdirWithWorkbook(t)
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"no offset", Config{}, false},
+		{"column offset", Config{TargetColOffset: 2}, false},
+		{"relative right", Config{TargetRelativeTo: "right"}, false},
+		{"relative left", Config{TargetRelativeTo: "left"}, false},
+		{"row offset", Config{TargetRowOffset: 1}, true},
+		{"negative row offset", Config{TargetRowOffset: -1, TargetColOffset: 1}, true},
+		{"relative above", Config{TargetRelativeTo: "above"}, true},
+		{"relative below", Config{TargetRelativeTo: "below"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.SpreadsheetID, tt.cfg.LookupValue, tt.cfg.InsertRowBeforeMatch = "sheet-id", "Alice", true
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "insert_row_before_match") {
+				t.Errorf("Validate = %v, want an insert_row_before_match error", err)
+			}
+		})
+	}
+}
+
+func TestValidateUndoDir(t *testing.T) {
+	chdirWithWorkbook(t)
+	for _, mode := range []string{ModeWrite, ModeSync, ModeClear} {
+		c := Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Mode: mode, UndoDir: "undo"}
+		err := c.Validate()
+		if wantErr := mode != ModeClear; (err != nil) != wantErr {
+			t.Errorf("mode %s: Validate = %v, wantErr %v", mode, err, wantErr)
+		}
+	}
+}
+
+func TestValidatePullMode(t *testing.T) {
+	chdirWithWorkbook(t)
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"matched cells", Config{TargetColOffset: 1}, ""},
+		{"named ranges", Config{NamedRangeTargets: []string{"Totals"}}, "named_range_targets has no workbook cell"},
+		{"touch_cell", Config{TouchCell: "Meta!B1"}, "touch_cell is not written in pull mode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.SpreadsheetID, tt.cfg.LookupValue, tt.cfg.Mode = "sheet-id", "Alice", ModePull
+			err := tt.cfg.ValidateSettings()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateSettings: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateSettings = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateBlock(t *testing.T) {
+	chdirWithWorkbook(t)
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"single cell", Config{}, ""},
+		{"row block", Config{TargetBlockCols: 3}, ""},
+		{"block_values", Config{TargetBlockRows: 2, TargetBlockCols: 2, BlockValues: []string{"a", "b", "c", "d"}}, ""},
+		{"source block", Config{TargetBlockCols: 3, SourceColOffset: 1}, ""},
+		{"one-row block with insert_row_before_match", Config{TargetBlockCols: 3, InsertRowBeforeMatch: true}, ""},
+		{"negative", Config{TargetBlockRows: -1}, "must not be negative"},
+		{"block_values without a block", Config{BlockValues: []string{"a"}}, "block_values requires target_block_rows"},
+		{"write_to_row_end", Config{TargetBlockCols: 2, WriteToRowEnd: true}, "cannot be combined with write_to_row_end"},
+		{"row_values", Config{TargetBlockCols: 2, RowValues: []string{"a", "b"}}, "cannot be combined with write_to_row_end or row_values"},
+		{"taller block with insert_row_before_match", Config{TargetBlockRows: 2, InsertRowBeforeMatch: true}, "target_block_rows must be 1"},
+		{"block_values and source offsets", Config{TargetBlockCols: 2, BlockValues: []string{"a", "b"}, SourceColOffset: 1}, "block_values and the source offsets"},
+		{"block_values count", Config{TargetBlockRows: 2, TargetBlockCols: 2, BlockValues: []string{"a", "b", "c"}}, "block_values has 3 values but the 2x2 block has 4 cells"},
+		{"source block while streaming", Config{TargetBlockCols: 2, SourceColOffset: 1, StreamWorkbook: true}, "stream_workbook cannot read a source block"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.SpreadsheetID, tt.cfg.LookupValue = "sheet-id", "Alice"
+			err := tt.cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatchLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		limit   int
+		strict  bool
+		wantErr bool
+	}{
+		{"", 0, false, false},
+		{"all", 0, false, false},
+		{"1", 1, false, false},
+		{"25", 25, false, false},
+		{"1-strict", 1, true, false},
+		{"3-strict", 3, true, false},
+		{"0", 0, false, true},
+		{"-1", 0, false, true},
+		{"0-strict", 0, false, true},
+		{"strict", 0, false, true},
+		{"one", 0, false, true},
+		{"1-lenient", 0, false, true},
+		{"1.5", 0, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			limit, strict, err := Config{PerSheetMatchLimit: tt.value}.MatchLimit()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if limit != tt.limit || strict != tt.strict {
+				t.Errorf("MatchLimit = %d, %v; want %d, %v", limit, strict, tt.limit, tt.strict)
+			}
+		})
+	}
+}
+
+func TestValidatePerSheetMatchLimit(t *testing.T) {
+	chdirWithWorkbook(t)
+	c := Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", PerSheetMatchLimit: " 1-STRICT "}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if c.PerSheetMatchLimit != "1-strict" {
+		t.Errorf("per_sheet_match_limit = %q, want it normalised to 1-strict", c.PerSheetMatchLimit)
+	}
+	c = Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", PerSheetMatchLimit: "none"}
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "per_sheet_match_limit") {
+		t.Errorf("Validate = %v, want a per_sheet_match_limit error", err)
+	}
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExampleLoadsAndValidates(t *testing.T) {
+	dir := chdirWithWorkbook(t)
+	out, err := Example()
+	if err != nil {
+		t.Fatalf("Example: %v", err)
+	}
+	filled := strings.NewReplacer(
+		"YOUR_SPREADSHEET_ID", "1AbCdEfGhIjKlMnOpQrStUvWxYz0123456789",
+		"YOUR_LOOKUP_VALUE", "Alice",
+	).Replace(string(out))
+	for _, line := range strings.Split(filled, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") && strings.Contains(line, "YOUR_") {
+			t.Fatalf("example has a placeholder this test does not fill: %s", line)
+		}
+	}
+	path := dir + "/config.yaml"
+	if err := os.WriteFile(path, []byte(filled), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if cfg.SpreadsheetID != "1AbCdEfGhIjKlMnOpQrStUvWxYz0123456789" || cfg.LookupValue != "Alice" {
+		t.Errorf("loaded spreadsheet_id %q and lookup_value %q, want the filled placeholders", cfg.SpreadsheetID, cfg.LookupValue)
+	}
+}
+
+func TestFieldDocsCoverConfig(t *testing.T) {
+	if err := checkFieldDocs(); err != nil {
+		t.Fatal(err)
+	}
+}
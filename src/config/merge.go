@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Strategies for lists when one config is merged into another. Mappings
+// such as sheet_overrides are always merged key by key, and scalars are
+// replaced.
+const (
+	// MergeReplace replaces a list with the incoming one.
+	MergeReplace = "replace"
+	// MergeAppend adds the incoming items after the existing ones.
+	MergeAppend = "append"
+	// MergeByKey updates items that share a key with an incoming item and
+	// appends the rest: writes are keyed by offset, plain lists such as
+	// config_sheet by value.
+	MergeByKey = "key"
+)
+
+// listKeys names the field that identifies an item of a list of mappings
+// under MergeByKey.
+var listKeys = map[string]string{
+	"writes": "offset",
+}
+
+// MergeFile deep-merges the single-document config at path into base, with
+// the file's settings winning. The result is not validated.
+func MergeFile(base Config, path, strategy string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("read %s: %w", path, err)
+	}
+	cfg, err := Merge(base, data, strategy)
+	if err != nil {
+		return Config{}, fmt.Errorf("merge %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Merge deep-merges the YAML config in data into base, with data winning.
+// An explicit null in data clears the setting.
+func Merge(base Config, data []byte, strategy string) (Config, error) {
+	switch strategy {
+	case MergeReplace, MergeAppend, MergeByKey:
+	default:
+		return Config{}, fmt.Errorf("merge strategy must be %s, %s or %s, got %q", MergeReplace, MergeAppend, MergeByKey, strategy)
+	}
+	docs, err := ParseAll(data)
+	if err != nil {
+		return Config{}, err
+	}
+	if len(docs) > 1 {
+		return Config{}, fmt.Errorf("holds %d documents; only a single-document config can be merged", len(docs))
+	}
+	var overlay yaml.Node
+	if err := yaml.Unmarshal(data, &overlay); err != nil {
+		return Config{}, err
+	}
+	if len(overlay.Content) == 0 || overlay.Content[0].Tag == "!!null" {
+		return base, nil
+	}
+	if overlay.Content[0].Kind != yaml.MappingNode {
+		return Config{}, fmt.Errorf("line %d: a config must be a mapping of settings", overlay.Content[0].Line)
+	}
+	var merged yaml.Node
+	if err := merged.Encode(base); err != nil {
+		return Config{}, fmt.Errorf("encode config: %w", err)
+	}
+	root := mergeNode(&merged, overlay.Content[0], "", strategy)
+	var cfg Config
+	if err := root.Decode(&cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// mergeNode merges src into dst, the value of the setting named key, and
+// returns the result.
+func mergeNode(dst, src *yaml.Node, key, strategy string) *yaml.Node {
+	if src.Kind == yaml.SequenceNode && dst.Kind == yaml.ScalarNode && dst.Value != "" && strategy != MergeReplace {
+		// config_sheet keeps a single sheet in the scalar form.
+		dst = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{dst}}
+	}
+	if dst.Kind != src.Kind {
+		return src
+	}
+	switch src.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			name, value := src.Content[i], src.Content[i+1]
+			if j := mappingIndex(dst, name.Value); j >= 0 {
+				dst.Content[j] = mergeNode(dst.Content[j], value, name.Value, strategy)
+			} else {
+				dst.Content = append(dst.Content, name, value)
+			}
+		}
+		return dst
+	case yaml.SequenceNode:
+		switch strategy {
+		case MergeAppend:
+			dst.Content = append(dst.Content, src.Content...)
+			return dst
+		case MergeByKey:
+			for _, item := range src.Content {
+				if j := sequenceIndex(dst, item, listKeys[key]); j >= 0 {
+					dst.Content[j] = mergeNode(dst.Content[j], item, "", strategy)
+				} else {
+					dst.Content = append(dst.Content, item)
+				}
+			}
+			return dst
+		}
+	}
+	return src
+}
+
+// mappingIndex returns the index of the value stored under name in the
+// mapping node m, or -1.
+func mappingIndex(m *yaml.Node, name string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == name {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// sequenceIndex returns the index of the item of seq that item updates
+// under MergeByKey, or -1: scalars match by value, mappings by their field
+// named field. Mappings without a key field never match.
+func sequenceIndex(seq, item *yaml.Node, field string) int {
+	for i, existing := range seq.Content {
+		switch {
+		case item.Kind == yaml.ScalarNode && existing.Kind == yaml.ScalarNode:
+			if existing.Value == item.Value {
+				return i
+			}
+		case item.Kind == yaml.MappingNode && existing.Kind == yaml.MappingNode && field != "":
+			a, b := mappingIndex(existing, field), mappingIndex(item, field)
+			if a >= 0 && b >= 0 && existing.Content[a].Value == item.Content[b].Value {
+				return i
+			}
+		}
+	}
+	return -1
+}
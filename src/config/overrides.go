@@ -0,0 +1,103 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Override replaces some settings for the matches on one sheet. Fields left
+// out keep the global value.
+type Override struct {
+	OccupiedCellPolicy string  `yaml:"occupied_cell_policy,omitempty"`
+	TargetRowOffset    *int    `yaml:"target_row_offset,omitempty"`
+	TargetColOffset    *int    `yaml:"target_col_offset,omitempty"`
+	WriteValue         *string `yaml:"write_value,omitempty"`
+	// MaxMatches caps how many matches on the sheet produce a target, in
+	// sheet order; 0 writes nothing there.
+	MaxMatches *int `yaml:"max_matches,omitempty"`
+}
+
+// overrideKeys are the settings an Override may hold.
+var overrideKeys = []string{"occupied_cell_policy", "target_row_offset", "target_col_offset", "write_value", "max_matches"}
+
+// UnmarshalYAML rejects keys that cannot be overridden, so a misspelt or
+// unsupported setting is not silently ignored.
+func (o *Override) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: a sheet override must be a mapping of settings", node.Line)
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if !slices.Contains(overrideKeys, key.Value) {
+			return fmt.Errorf("line %d: %q cannot be overridden per sheet; allowed: %s", key.Line, key.Value, strings.Join(overrideKeys, ", "))
+		}
+	}
+	type plain Override
+	return node.Decode((*plain)(o))
+}
+
+func (c *Config) validateOverrides() error {
+	for _, sheet := range c.OverrideSheets() {
+		o := c.SheetOverrides[sheet]
+		if strings.TrimSpace(sheet) == "" {
+			return errors.New("sheet_overrides has an entry without a sheet name")
+		}
+		switch o.OccupiedCellPolicy {
+		case "", OccupiedSkip, OccupiedOverwrite, OccupiedError:
+		default:
+			return fmt.Errorf("sheet_overrides[%s]: occupied_cell_policy must be %s, %s or %s; got %q", sheet, OccupiedSkip, OccupiedOverwrite, OccupiedError, o.OccupiedCellPolicy)
+		}
+		if o.MaxMatches != nil && *o.MaxMatches < 0 {
+			return fmt.Errorf("sheet_overrides[%s]: max_matches must not be negative", sheet)
+		}
+		if o.TargetRowOffset != nil || o.TargetColOffset != nil {
+			if c.TargetRelativeTo != "" {
+				return fmt.Errorf("sheet_overrides[%s]: target offsets cannot be combined with target_relative_to", sheet)
+			}
+			if o.TargetColOffset != nil && c.TargetColumn != "" {
+				return fmt.Errorf("sheet_overrides[%s]: target_col_offset cannot be combined with target_column", sheet)
+			}
+		}
+		if _, err := c.ForSheet(sheet).TypedWriteValue(); err != nil && !IsTemplate(c.ForSheet(sheet).WriteValue) {
+			return fmt.Errorf("sheet_overrides[%s]: %w", sheet, err)
+		}
+	}
+	return nil
+}
+
+// OverrideSheets returns the sheets named in SheetOverrides, sorted.
+func (c Config) OverrideSheets() []string {
+	names := make([]string, 0, len(c.SheetOverrides))
+	for name := range c.SheetOverrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ForSheet returns c with the override for sheet, if any, applied.
+func (c Config) ForSheet(sheet string) Config {
+	o, ok := c.SheetOverrides[sheet]
+	if !ok {
+		return c
+	}
+	if o.OccupiedCellPolicy != "" {
+		c.OccupiedCellPolicy = o.OccupiedCellPolicy
+		c.InsertOnly = false
+	}
+	if o.TargetRowOffset != nil {
+		c.TargetRowOffset = *o.TargetRowOffset
+	}
+	if o.TargetColOffset != nil {
+		c.TargetColOffset = *o.TargetColOffset
+	}
+	if o.WriteValue != nil {
+		c.WriteValue = *o.WriteValue
+	}
+	return c
+}
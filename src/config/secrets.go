@@ -0,0 +1,75 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// SecretScheme prefixes config values that name a Secret Manager secret
+// version, e.g. sm://projects/p/secrets/s/versions/latest.
+const SecretScheme = "sm://"
+
+// SecretResolver returns the payload of a secret version given its resource
+// name (the part after SecretScheme).
+type SecretResolver interface {
+	ResolveSecret(ctx context.Context, name string) (string, error)
+}
+
+// secretFields lists the settings that may reference a secret, keyed by
+// their YAML name for error messages.
+func (c *Config) secretFields() map[string]*string {
+	return map[string]*string{
+		"spreadsheet_id": &c.SpreadsheetID,
+		"lookup_value":   &c.LookupValue,
+		"quota_project":  &c.QuotaProject,
+		"proxy_url":      &c.ProxyURL,
+		"ca_bundle_file": &c.CABundleFile,
+		"config_xlsx":    &c.Workbook,
+	}
+}
+
+// HasSecretRefs reports whether any setting references a secret.
+func (c *Config) HasSecretRefs() bool {
+	for _, v := range c.secretFields() {
+		if strings.HasPrefix(strings.TrimSpace(*v), SecretScheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveSecrets replaces every secret reference with its payload. Values
+// without SecretScheme pass through unchanged.
+func (c *Config) ResolveSecrets(ctx context.Context, r SecretResolver) error {
+	for field, v := range c.secretFields() {
+		ref := strings.TrimSpace(*v)
+		if !strings.HasPrefix(ref, SecretScheme) {
+			continue
+		}
+		val, err := r.ResolveSecret(ctx, strings.TrimPrefix(ref, SecretScheme))
+		if err != nil {
+			return fmt.Errorf("resolve %s from %s: %w", field, ref, err)
+		}
+		*v = strings.TrimSpace(val)
+	}
+	return nil
+}
+
+// Redacted returns c with every value that raw (the config before
+// ResolveSecrets) took from a secret put back as its reference, and any
+// proxy password masked, so the result is safe to print.
+func (c Config) Redacted(raw Config) Config {
+	out := c
+	refs := raw.secretFields()
+	for field, v := range out.secretFields() {
+		if ref := strings.TrimSpace(*refs[field]); strings.HasPrefix(ref, SecretScheme) {
+			*v = ref
+		}
+	}
+	if u, err := url.Parse(out.ProxyURL); err == nil && !strings.HasPrefix(out.ProxyURL, SecretScheme) {
+		out.ProxyURL = u.Redacted()
+	}
+	return out
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// templateToken matches ${VAR} environment references and {{name}}
+// built-in tokens in a write value.
+var templateToken = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\{\{\s*([A-Za-z_]+)\s*\}\}`)
+
+// IsTemplate reports whether s holds a ${VAR} or {{name}} token.
+func IsTemplate(s string) bool {
+	return templateToken.MatchString(s)
+}
+
+// ExpandTemplates returns c with the tokens of write_value, of every
+// sheet_overrides write_value, of each writes value and of append_values
+// expanded: ${VAR} is the environment variable, {{date}}, {{time}} and
+// {{now}} (RFC 3339) are now in the configured timezone, {{lookup}} is
+// lookup_value and {{user}} is the current OS user. An undefined variable
+// expands to "" and any other {{name}} is kept as written, unless
+// StrictTemplate, when either is an error.
+func (c Config) ExpandTemplates(now time.Time) (Config, error) {
+	value, err := c.expandTemplate(c.WriteValue, now)
+	if err != nil {
+		return c, fmt.Errorf("write_value: %w", err)
+	}
+	c.WriteValue = value
+	if len(c.Writes) > 0 {
+		writes := slices.Clone(c.Writes)
+		for i := range writes {
+			if writes[i].Value, err = c.expandTemplate(writes[i].Value, now); err != nil {
+				return c, fmt.Errorf("writes[%d]: value: %w", i, err)
+			}
+		}
+		c.Writes = writes
+	}
+	if len(c.AppendValues) > 0 {
+		row := make([]string, len(c.AppendValues))
+		for i, v := range c.AppendValues {
+			if row[i], err = c.expandTemplate(v, now); err != nil {
+				return c, fmt.Errorf("append_values[%d]: %w", i, err)
+			}
+		}
+		c.AppendValues = row
+	}
+	if len(c.SheetOverrides) == 0 {
+		return c, nil
+	}
+	overrides := make(map[string]Override, len(c.SheetOverrides))
+	for sheet, o := range c.SheetOverrides {
+		if o.WriteValue != nil {
+			value, err := c.expandTemplate(*o.WriteValue, now)
+			if err != nil {
+				return c, fmt.Errorf("sheet_overrides[%s]: write_value: %w", sheet, err)
+			}
+			o.WriteValue = &value
+		}
+		overrides[sheet] = o
+	}
+	c.SheetOverrides = overrides
+	return c, nil
+}
+
+func (c Config) expandTemplate(s string, now time.Time) (string, error) {
+	var firstErr error
+	out := templateToken.ReplaceAllStringFunc(s, func(tok string) string {
+		m := templateToken.FindStringSubmatch(tok)
+		if m[1] != "" {
+			val, ok := os.LookupEnv(m[1])
+			if !ok && c.StrictTemplate && firstErr == nil {
+				firstErr = fmt.Errorf("environment variable %s is not set (strict_template)", m[1])
+			}
+			return val
+		}
+		switch m[2] {
+		case "date":
+			return now.In(c.Location()).Format("2006-01-02")
+		case "time":
+			return now.In(c.Location()).Format("15:04:05")
+		case "now":
+			return now.In(c.Location()).Format(time.RFC3339)
+		case "lookup":
+			return c.LookupValue
+		case "user":
+			return currentUser()
+		}
+		if c.StrictTemplate && firstErr == nil {
+			firstErr = fmt.Errorf("unknown template token %s (strict_template); use {{date}}, {{time}}, {{now}}, {{lookup}}, {{user}} or ${VAR}", tok)
+		}
+		return tok
+	})
+	return out, firstErr
+}
+
+// currentUser names the OS user running the process, falling back to the
+// USER or USERNAME environment variable.
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
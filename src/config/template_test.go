@@ -0,0 +1,97 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandTemplates(t *testing.T) {
+	t.Setenv("SYNC_HOST", "runner-1")
+	t.Setenv("USER", "ci")
+	now := time.Date(2024, 3, 5, 1, 2, 3, 0, time.UTC)
+	tests := []struct {
+		name    string
+		value   string
+		strict  bool
+		want    string
+		wantErr bool
+	}{
+		{"plain value", "done", false, "done", false},
+		{"env", "synced by ${SYNC_HOST}", false, "synced by runner-1", false},
+		{"date and time in timezone", "{{date}} {{time}}", false, "2024-03-05 08:02:03", false},
+		{"now", "{{ now }}", false, "2024-03-05T08:02:03+07:00", false},
+		{"lookup", "{{lookup}}: ok", false, "Alice: ok", false},
+		{"undefined env expands to empty", "[${SYNC_MISSING}]", false, "[]", false},
+		{"undefined env is an error when strict", "${SYNC_MISSING}", true, "", true},
+		{"unknown token is kept", "{{host}} and {{ x }}", false, "{{host}} and {{ x }}", false},
+		{"unknown token is an error when strict", "{{host}}", true, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{WriteValue: tt.value, LookupValue: "Alice", Timezone: "Asia/Bangkok", StrictTemplate: tt.strict}
+			got, err := c.ExpandTemplates(now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.WriteValue != tt.want {
+				t.Errorf("write_value = %q, want %q", got.WriteValue, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandTemplatesUser(t *testing.T) {
+	got, err := Config{WriteValue: "{{user}}"}.ExpandTemplates(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.WriteValue != currentUser() || got.WriteValue == "" {
+		t.Errorf("{{user}} = %q, want current user %q", got.WriteValue, currentUser())
+	}
+}
+
+func TestExpandTemplatesOverrides(t *testing.T) {
+	t.Setenv("SYNC_HOST", "runner-1")
+	value := "by ${SYNC_HOST}"
+	c := Config{SheetOverrides: map[string]Override{"Plan": {WriteValue: &value}, "Log": {}}}
+	got, err := c.ExpandTemplates(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := got.SheetOverrides["Plan"].WriteValue; v == nil || *v != "by runner-1" {
+		t.Errorf("Plan write_value = %v, want by runner-1", v)
+	}
+	if got.SheetOverrides["Log"].WriteValue != nil {
+		t.Errorf("Log write_value = %v, want unset", *got.SheetOverrides["Log"].WriteValue)
+	}
+	if value != "by ${SYNC_HOST}" {
+		t.Errorf("expansion changed the caller's override to %q", value)
+	}
+}
+
+func TestExpandTemplatesWritesAndAppendValues(t *testing.T) {
+	now := time.Date(2024, 3, 5, 1, 2, 3, 0, time.UTC)
+	writes := []CellWrite{{Offset: "0,1", Value: "{{date}}"}, {Offset: "0,2", Value: "by {{lookup}} {{host}}"}}
+	appendValues := []string{"{{now}}", "{{lookup}}"}
+	c := Config{LookupValue: "Alice", Timezone: "UTC", Writes: writes, AppendValues: appendValues}
+	got, err := c.ExpandTemplates(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Writes[0].Value != "2024-03-05" || got.Writes[1].Value != "by Alice {{host}}" {
+		t.Errorf("writes = %+v, want expanded values", got.Writes)
+	}
+	if want := []string{"2024-03-05T01:02:03Z", "Alice"}; !slices.Equal(got.AppendValues, want) {
+		t.Errorf("append_values = %q, want %q", got.AppendValues, want)
+	}
+	if writes[0].Value != "{{date}}" || appendValues[0] != "{{now}}" {
+		t.Error("expansion changed the caller's writes or append_values")
+	}
+
+	c.StrictTemplate = true
+	if _, err := c.ExpandTemplates(now); err == nil || !strings.Contains(err.Error(), "writes[1]") {
+		t.Errorf("strict err = %v, want one naming writes[1]", err)
+	}
+}
@@ -1,25 +1,48 @@
 package logger
 
 import (
-	"fmt"
 	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-// New returns a production logger configured for console output with Bangkok timestamps.
+// zone is the timezone log timestamps are written in.
+var zone = "Asia/Bangkok"
+
+// New returns a production logger configured for console output with Bangkok
+// timestamps. When the zone cannot be loaded it logs in UTC and says so
+// rather than failing.
 func New() (*zap.Logger, error) {
-	loc, err := time.LoadLocation("Asia/Bangkok")
-	if err != nil {
-		return nil, fmt.Errorf("load timezone: %w", err)
-	}
+	return NewAt(zapcore.InfoLevel)
+}
+
+// NewAt is New logging at level and above.
+func NewAt(level zapcore.Level) (*zap.Logger, error) {
+	loc, locErr := loadZone(zone)
 	cfg := zap.NewProductionConfig()
+	cfg.Level = zap.NewAtomicLevelAt(level)
 	cfg.Encoding = "console"
 	cfg.EncoderConfig = zap.NewProductionEncoderConfig()
 	cfg.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
 	cfg.EncoderConfig.EncodeTime = func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
 		enc.AppendString(t.In(loc).Format(time.RFC3339))
 	}
-	return cfg.Build()
+	log, err := cfg.Build()
+	if err != nil {
+		return nil, err
+	}
+	if locErr != nil {
+		log.Warn("timezone data unavailable; logging in UTC", zap.Error(locErr))
+	}
+	return log, nil
+}
+
+// loadZone returns the named location, or UTC together with the load error.
+func loadZone(name string) (*time.Location, error) {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC, err
+	}
+	return loc, nil
 }
@@ -0,0 +1,39 @@
+package logger
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadZoneFallsBackToUTC(t *testing.T) {
+	loc, err := loadZone("Nowhere/Missing_Zone")
+	if err == nil {
+		t.Fatal("loadZone succeeded for an unknown zone")
+	}
+	if loc != time.UTC {
+		t.Errorf("loc = %v, want UTC", loc)
+	}
+
+	loc, err = loadZone("Asia/Bangkok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.String() != "Asia/Bangkok" {
+		t.Errorf("loc = %v, want Asia/Bangkok", loc)
+	}
+}
+
+func TestNewSurvivesMissingZone(t *testing.T) {
+	old := zone
+	zone = "Nowhere/Missing_Zone"
+	t.Cleanup(func() { zone = old })
+
+	log, err := New()
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if log == nil {
+		t.Fatal("New returned a nil logger")
+	}
+	_ = log.Sync()
+}
@@ -0,0 +1,44 @@
+// Package secrets resolves config secret references through Google Secret
+// Manager.
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/secretmanager/v1"
+)
+
+// SecretManager implements config.SecretResolver with Application Default
+// Credentials.
+type SecretManager struct {
+	svc *secretmanager.Service
+}
+
+// NewSecretManager connects to Secret Manager.
+func NewSecretManager(ctx context.Context) (*SecretManager, error) {
+	svc, err := secretmanager.NewService(ctx, option.WithScopes(secretmanager.CloudPlatformScope))
+	if err != nil {
+		return nil, fmt.Errorf("initialise Secret Manager service: %w", err)
+	}
+	return &SecretManager{svc: svc}, nil
+}
+
+// ResolveSecret accesses the secret version named like
+// projects/p/secrets/s/versions/latest.
+func (m *SecretManager) ResolveSecret(ctx context.Context, name string) (string, error) {
+	resp, err := m.svc.Projects.Secrets.Versions.Access(name).Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	if resp.Payload == nil {
+		return "", fmt.Errorf("secret %s has no payload", name)
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("decode secret %s: %w", name, err)
+	}
+	return string(data), nil
+}
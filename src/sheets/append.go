@@ -0,0 +1,49 @@
+package sheets
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+// appendRow adds one row built from cfg.AppendValues to the end of cfg.AppendSheet.
+func appendRow(ctx context.Context, svc *sheets.Service, cfg config.Config, summary Summary) (Summary, error) {
+	vr := &sheets.ValueRange{
+		MajorDimension: "ROWS",
+		Values:         [][]interface{}{appendedRow(cfg)},
+	}
+	rng := formatRange(cfg.AppendSheet, "A1")
+	resp, err := svc.Spreadsheets.Values.Append(cfg.SpreadsheetID, rng, vr).
+		ValueInputOption(cfg.InputOption()).
+		InsertDataOption("INSERT_ROWS").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return summary, fmt.Errorf("append row failed: %w", err)
+	}
+	summary.TargetSheets = []string{cfg.AppendSheet}
+	if resp.Updates != nil {
+		summary.Ranges = []string{resp.Updates.UpdatedRange}
+		summary.TotalCells = resp.Updates.UpdatedCells
+		summary.TotalRows = resp.Updates.UpdatedRows
+	}
+	return summary, nil
+}
+
+// plannedAppend lists the appended row as a planned write.
+func plannedAppend(cfg config.Config) []*sheets.ValueRange {
+	return []*sheets.ValueRange{{Range: formatRange(cfg.AppendSheet, "A1"), Values: [][]interface{}{appendedRow(cfg)}}}
+}
+
+// appendedRow is the row of cfg.AppendValues, whose templates
+// UpdateWithService has already expanded.
+func appendedRow(cfg config.Config) []interface{} {
+	row := make([]interface{}, len(cfg.AppendValues))
+	for i, v := range cfg.AppendValues {
+		row[i] = v
+	}
+	return row
+}
@@ -0,0 +1,39 @@
+package sheets
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"update-google-sheets/src/config"
+)
+
+func TestAppendRow(t *testing.T) {
+	fake := &fakeSheets{}
+	svc := newFakeService(t, fake)
+	cfg := config.Config{
+		SpreadsheetID: "sheet-id", LookupValue: "Alice", Mode: config.ModeAppend,
+		AppendSheet: "Sync Log", AppendValues: []string{"{{lookup}}", "done"},
+	}
+	for i, wantRange := range []string{"'Sync Log'!A1:B1", "'Sync Log'!A2:B2"} {
+		summary, err := UpdateWithService(context.Background(), svc, cfg, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fake.appended[i]; !reflect.DeepEqual(got.Values, [][]interface{}{{"Alice", "done"}}) || got.MajorDimension != "ROWS" {
+			t.Errorf("append %d sent %s %v, want ROWS [[Alice done]]", i, got.MajorDimension, got.Values)
+		}
+		if q := fake.appendQueries[i]; q.Get("valueInputOption") != "USER_ENTERED" || q.Get("insertDataOption") != "INSERT_ROWS" {
+			t.Errorf("append %d query = %v, want USER_ENTERED and INSERT_ROWS", i, q)
+		}
+		if !reflect.DeepEqual(summary.Ranges, []string{wantRange}) || summary.TotalCells != 2 || summary.TotalRows != 1 {
+			t.Errorf("summary ranges %v, %d cells, %d rows; want [%s], 2 cells, 1 row", summary.Ranges, summary.TotalCells, summary.TotalRows, wantRange)
+		}
+		if !reflect.DeepEqual(summary.TargetSheets, []string{"Sync Log"}) {
+			t.Errorf("target sheets = %v, want [Sync Log]", summary.TargetSheets)
+		}
+	}
+	if want := "POST /v4/spreadsheets/sheet-id/values/'Sync Log'!A1:append"; fake.requests[len(fake.requests)-1] != want {
+		t.Errorf("last request = %q, want %q", fake.requests[len(fake.requests)-1], want)
+	}
+}
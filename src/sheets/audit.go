@@ -0,0 +1,149 @@
+package sheets
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"update-google-sheets/src/config"
+)
+
+// AuditRecord is one line of audit_log: a cell a run changed.
+type AuditRecord struct {
+	Time          string      `json:"time"`
+	RunID         string      `json:"run_id"`
+	SpreadsheetID string      `json:"spreadsheet_id"`
+	Range         string      `json:"range"`
+	Before        interface{} `json:"before"`
+	After         interface{} `json:"after"`
+	Mode          string      `json:"mode"`
+	User          string      `json:"user"`
+	Host          string      `json:"host"`
+}
+
+// cellChange is one cell a run writes or clears and the value it held.
+// Range is the written range the cell belongs to.
+type cellChange struct {
+	Range  string
+	Cell   string
+	Before interface{}
+	After  interface{}
+}
+
+// newRunID names a run by its start time plus a random suffix, e.g.
+// 20261016-150405-3fa2, so ids sort by time and never collide.
+func newRunID(cfg config.Config) string {
+	suffix := make([]byte, 2)
+	_, _ = rand.Read(suffix)
+	return time.Now().In(cfg.Location()).Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// changedCells lists the cells of rng whose value values changes. nil
+// entries, and cells the merge rewrote with their current value, are left
+// out.
+func changedCells(rng string, existing, values [][]interface{}, cfg config.Config) []cellChange {
+	var changes []cellChange
+	for r, row := range values {
+		for c, v := range row {
+			if v == nil {
+				continue
+			}
+			var before interface{} = ""
+			if remoteHasValue(existing, r, c, cfg) {
+				before = existing[r][c]
+			}
+			if fmt.Sprint(before) == fmt.Sprint(v) {
+				continue
+			}
+			changes = append(changes, cellChange{Range: rng, Cell: cellInRange(rng, r, c), Before: before, After: v})
+		}
+	}
+	return changes
+}
+
+// clearedCells lists the cells of rng that hold a value, as cleared.
+func clearedCells(rng string, existing [][]interface{}, cfg config.Config) []cellChange {
+	var changes []cellChange
+	for r, row := range existing {
+		for c := range row {
+			if remoteHasValue(existing, r, c, cfg) {
+				changes = append(changes, cellChange{Range: rng, Cell: cellInRange(rng, r, c), Before: existing[r][c], After: ""})
+			}
+		}
+	}
+	return changes
+}
+
+// appendAuditLog appends one record per change to cfg.AuditLog. Each
+// record is a single write to a file opened for appending, so concurrent
+// runs never interleave partial lines.
+func appendAuditLog(cfg config.Config, runID string, changes []cellChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(cfg.AuditLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open audit_log: %w", err)
+	}
+	host, _ := os.Hostname()
+	var name string
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	stamp := time.Now().In(cfg.Location()).Format(time.RFC3339)
+	for _, ch := range changes {
+		line, err := json.Marshal(AuditRecord{
+			Time:          stamp,
+			RunID:         runID,
+			SpreadsheetID: cfg.SpreadsheetID,
+			Range:         ch.Cell,
+			Before:        ch.Before,
+			After:         ch.After,
+			Mode:          cfg.Mode,
+			User:          name,
+			Host:          host,
+		})
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("encode audit record for %s: %w", ch.Cell, err)
+		}
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			f.Close()
+			return fmt.Errorf("write audit_log: %w", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write audit_log: %w", err)
+	}
+	return nil
+}
+
+// ReadAuditLog returns the last n records of the audit log at path, oldest
+// first.
+func ReadAuditLog(path string, n int) ([]AuditRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read audit_log: %w", err)
+	}
+	lines := bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n"))
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	records := make([]AuditRecord, 0, len(lines))
+	for _, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var rec AuditRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
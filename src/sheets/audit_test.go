@@ -0,0 +1,96 @@
+package sheets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"update-google-sheets/src/config"
+)
+
+func TestChangedCells(t *testing.T) {
+	existing := [][]interface{}{{"old", "", "same", "kept"}}
+	values := [][]interface{}{{"new", "filled", "same", nil}}
+	got := changedCells("Plan!B2:E2", existing, values, config.Config{})
+	want := []cellChange{
+		{Range: "Plan!B2:E2", Cell: "Plan!B2", Before: "old", After: "new"},
+		{Range: "Plan!B2:E2", Cell: "Plan!C2", Before: "", After: "filled"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %+v, want %+v", got, want)
+	}
+}
+
+func TestAuditLogRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	cfg := config.Config{SpreadsheetID: "sheet-id", AuditLog: path, Mode: config.ModeSync}
+	for i, value := range []string{"one", "two", "three"} {
+		change := cellChange{Range: "Plan!A1", Cell: "Plan!A1", Before: "", After: value}
+		if err := appendAuditLog(cfg, "run-"+value, []cellChange{change}); err != nil {
+			t.Fatalf("append %d: %v", i, err)
+		}
+	}
+	if err := appendAuditLog(cfg, "run-none", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := ReadAuditLog(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].After != "two" || records[1].After != "three" {
+		t.Fatalf("last 2 records = %+v, want two then three", records)
+	}
+	r := records[1]
+	if r.RunID != "run-three" || r.SpreadsheetID != "sheet-id" || r.Range != "Plan!A1" || r.Before != "" || r.Mode != config.ModeSync || r.Time == "" {
+		t.Errorf("record = %+v", r)
+	}
+	if all, err := ReadAuditLog(path, 10); err != nil || len(all) != 3 {
+		t.Errorf("10 records = %d, %v; want all 3", len(all), err)
+	}
+
+	if _, err := ReadAuditLog(filepath.Join(t.TempDir(), "absent.jsonl"), 1); err == nil {
+		t.Error("missing audit_log read without error")
+	}
+	broken := filepath.Join(t.TempDir(), "broken.jsonl")
+	if err := os.WriteFile(broken, []byte("not json\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadAuditLog(broken, 1); err == nil {
+		t.Error("malformed audit_log read without error")
+	}
+}
+
+// failingWriter fails every write, standing in for a -response-out file
+// that cannot be written.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestAuditLogAfterLaterFailure(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	audit := filepath.Join(t.TempDir(), "audit.jsonl")
+	cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path, AuditLog: audit}
+	fake := &fakeSheets{}
+	summary, err := updateWithService(context.Background(), newFakeService(t, fake), cfg, Options{ResponseOut: failingWriter{}})
+	if err == nil || !strings.Contains(err.Error(), "saving the API response failed") {
+		t.Fatalf("err = %v, want the response-out failure", err)
+	}
+	if len(fake.written) != 1 {
+		t.Fatalf("written = %v, want Plan!A1", fake.writes())
+	}
+	records, rerr := ReadAuditLog(audit, 10)
+	if rerr != nil {
+		t.Fatal(rerr)
+	}
+	if len(records) != 1 || records[0].Range != "Plan!A1" || records[0].After != "Alice" || records[0].RunID != summary.RunID {
+		t.Errorf("records = %+v, want the write to Plan!A1", records)
+	}
+	if summary.AuditLogged != 1 {
+		t.Errorf("audit logged = %d, want 1", summary.AuditLogged)
+	}
+}
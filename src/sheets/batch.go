@@ -0,0 +1,53 @@
+package sheets
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// requestOverhead allows for the request fields around Data, such as
+// valueInputOption, when estimating a request's size.
+const requestOverhead = 256
+
+// chunkPayloads splits data, in order, into groups whose estimated request
+// size stays within limit. A single range that is too big on its own is an
+// error, since splitting it would change what the caller asked to write.
+// A limit of 0 or less sends everything in one request.
+func chunkPayloads(data []*sheets.ValueRange, limit int) ([][]*sheets.ValueRange, error) {
+	if limit <= 0 || len(data) == 0 {
+		return [][]*sheets.ValueRange{data}, nil
+	}
+	var (
+		chunks [][]*sheets.ValueRange
+		chunk  []*sheets.ValueRange
+		size   = requestOverhead
+	)
+	for _, vr := range data {
+		n, err := payloadSize(vr)
+		if err != nil {
+			return nil, err
+		}
+		if requestOverhead+n > limit {
+			return nil, fmt.Errorf("a request for range %s alone would be about %d bytes, over max_request_bytes %d; write a smaller range or raise the limit", vr.Range, requestOverhead+n, limit)
+		}
+		if len(chunk) > 0 && size+n > limit {
+			chunks = append(chunks, chunk)
+			chunk, size = nil, requestOverhead
+		}
+		chunk = append(chunk, vr)
+		size += n
+	}
+	return append(chunks, chunk), nil
+}
+
+// payloadSize is the serialised size of vr plus its separator in the Data
+// array.
+func payloadSize(vr *sheets.ValueRange) (int, error) {
+	b, err := json.Marshal(vr)
+	if err != nil {
+		return 0, fmt.Errorf("encode %s: %w", vr.Range, err)
+	}
+	return len(b) + 1, nil
+}
@@ -0,0 +1,194 @@
+package sheets
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+// sizedRange returns a one-cell ValueRange whose estimated payload size is
+// exactly n bytes.
+func sizedRange(t *testing.T, rng string, n int) *sheets.ValueRange {
+	t.Helper()
+	vr := &sheets.ValueRange{Range: rng, Values: [][]interface{}{{""}}}
+	base, err := payloadSize(vr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < base {
+		t.Fatalf("size %d is below the %d-byte minimum for %s", n, base, rng)
+	}
+	vr.Values[0][0] = strings.Repeat("x", n-base)
+	return vr
+}
+
+func chunkRanges(chunks [][]*sheets.ValueRange) [][]string {
+	var out [][]string
+	for _, c := range chunks {
+		var rs []string
+		for _, vr := range c {
+			rs = append(rs, vr.Range)
+		}
+		out = append(out, rs)
+	}
+	return out
+}
+
+func TestChunkPayloads(t *testing.T) {
+	const limit = requestOverhead + 1000
+	tests := []struct {
+		name    string
+		sizes   []int
+		limit   int
+		want    [][]string
+		wantErr string
+	}{
+		{
+			name:  "everything fits",
+			sizes: []int{300, 300, 300},
+			limit: limit,
+			want:  [][]string{{"A1", "A2", "A3"}},
+		},
+		{
+			name:  "exact fit stays together",
+			sizes: []int{500, 500},
+			limit: limit,
+			want:  [][]string{{"A1", "A2"}},
+		},
+		{
+			name:  "one byte over splits",
+			sizes: []int{500, 501},
+			limit: limit,
+			want:  [][]string{{"A1"}, {"A2"}},
+		},
+		{
+			name:  "order is kept across splits",
+			sizes: []int{900, 50, 50, 950, 100},
+			limit: limit,
+			want:  [][]string{{"A1", "A2", "A3"}, {"A4"}, {"A5"}},
+		},
+		{
+			name:  "many tiny ranges",
+			sizes: []int{100, 100, 100, 100, 100, 100, 100, 100, 100, 100, 100},
+			limit: limit,
+			want:  [][]string{{"A1", "A2", "A3", "A4", "A5", "A6", "A7", "A8", "A9", "A10"}, {"A11"}},
+		},
+		{
+			name:    "single range over the limit",
+			sizes:   []int{100, 1001},
+			limit:   limit,
+			wantErr: fmt.Sprintf("a request for range A2 alone would be about %d bytes, over max_request_bytes %d", requestOverhead+1001, limit),
+		},
+		{
+			name:  "no limit",
+			sizes: []int{5000, 5000},
+			want:  [][]string{{"A1", "A2"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data []*sheets.ValueRange
+			for i, n := range tt.sizes {
+				data = append(data, sizedRange(t, fmt.Sprintf("A%d", i+1), n))
+			}
+			chunks, err := chunkPayloads(data, tt.limit)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := chunkRanges(chunks); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chunks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchUpdateSplitsRequests(t *testing.T) {
+	fake := &fakeSheets{}
+	svc := newFakeService(t, fake)
+	var data []*sheets.ValueRange
+	for i := 1; i <= 3; i++ {
+		data = append(data, sizedRange(t, fmt.Sprintf("Plan!A%d", i), 600))
+	}
+	cfg := config.Config{SpreadsheetID: "sheet-id", MaxRequestBytes: requestOverhead + 1000}
+	resp, err := batchUpdate(context.Background(), svc, cfg, data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.valueRequests) != 3 {
+		t.Errorf("sent %d requests, want 3", len(fake.valueRequests))
+	}
+	if resp.TotalUpdatedCells != 3 || len(resp.Responses) != 3 {
+		t.Errorf("combined response has %d cells and %d responses, want 3 and 3", resp.TotalUpdatedCells, len(resp.Responses))
+	}
+}
+
+func TestBatchUpdateGroupsInputOptions(t *testing.T) {
+	fake := &fakeSheets{}
+	svc := newFakeService(t, fake)
+	data := []*sheets.ValueRange{
+		{Range: "Plan!A1", Values: [][]interface{}{{"=SUM(B1:B3)"}}},
+		{Range: "Plan!A2", Values: [][]interface{}{{"007", "008"}}},
+		{Range: "Plan!A3", Values: [][]interface{}{{"=B3"}}},
+		{Range: "Plan!A4", Values: [][]interface{}{{"text"}}},
+	}
+	inputs := map[string]string{"Plan!A2": config.InputRaw, "Plan!A4": config.InputRaw}
+	cfg := config.Config{SpreadsheetID: "sheet-id"}
+	resp, err := batchUpdate(context.Background(), svc, cfg, data, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type sent struct {
+		option string
+		ranges []string
+	}
+	var got []sent
+	for _, req := range fake.valueRequests {
+		s := sent{option: req.ValueInputOption}
+		for _, vr := range req.Data {
+			s.ranges = append(s.ranges, vr.Range)
+		}
+		got = append(got, s)
+	}
+	want := []sent{
+		{config.InputUserEntered, []string{"Plan!A1", "Plan!A3"}},
+		{config.InputRaw, []string{"Plan!A2", "Plan!A4"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %+v, want %+v", got, want)
+	}
+	if resp.TotalUpdatedCells != 5 || resp.TotalUpdatedRows != 4 {
+		t.Errorf("totals = %d cells, %d rows; want 5, 4", resp.TotalUpdatedCells, resp.TotalUpdatedRows)
+	}
+	var order []string
+	for _, r := range resp.Responses {
+		order = append(order, r.UpdatedRange)
+	}
+	if want := []string{"Plan!A1", "Plan!A2", "Plan!A3", "Plan!A4"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("responses in order %v, want payload order %v", order, want)
+	}
+}
+
+func TestBatchUpdateUsesConfigInputOption(t *testing.T) {
+	fake := &fakeSheets{}
+	data := []*sheets.ValueRange{{Range: "Plan!A1", Values: [][]interface{}{{"x"}}}, {Range: "Plan!A2", Values: [][]interface{}{{"y"}}}}
+	cfg := config.Config{SpreadsheetID: "sheet-id", ValueInputOption: config.InputRaw}
+	inputs := map[string]string{"Plan!A2": config.InputUserEntered}
+	if _, err := batchUpdate(context.Background(), newFakeService(t, fake), cfg, data, inputs); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.valueRequests) != 2 || fake.valueRequests[0].ValueInputOption != config.InputRaw || fake.valueRequests[1].ValueInputOption != config.InputUserEntered {
+		t.Errorf("got %d requests; want RAW for the config default, then USER_ENTERED", len(fake.valueRequests))
+	}
+}
@@ -0,0 +1,30 @@
+package sheets
+
+import (
+	"context"
+
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+// checkTargets plans a sync-mode write without applying it and records every
+// cell that would change as a discrepancy.
+func checkTargets(ctx context.Context, svc *sheets.Service, cfg config.Config, targets []target, summary Summary) (Summary, error) {
+	cfg.Mode = config.ModeSync
+	cfg.ExpectCurrentValue = nil
+	missing, _, err := missingTabs(ctx, svc, cfg, targets)
+	if err != nil {
+		return summary, err
+	}
+	_, stats, err := buildPayloads(ctx, svc, cfg, targets, missing)
+	if err != nil {
+		return summary, err
+	}
+	summary.Ranges = targetRanges(targets)
+	summary.Discrepancies = stats.Differing
+	summary.FilledEmpty = stats.Filled
+	summary.CorrectedDiffering = stats.Corrected
+	summary.AlreadyCorrect = stats.Unchanged
+	return summary, nil
+}
@@ -0,0 +1,36 @@
+package sheets
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"update-google-sheets/src/config"
+)
+
+func TestCheckReportsDiscrepancies(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}, {"Alice"}, {"Alice"}}})
+	fake := &fakeSheets{cells: map[string][][]interface{}{
+		"Plan!B1": {{"Done"}},
+		"Plan!B2": {{"Other"}},
+	}}
+	svc := newFakeService(t, fake)
+	cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", WriteValue: "Done", TargetColOffset: 1, Workbook: path}
+	summary, err := UpdateWithService(context.Background(), svc, cfg, Options{Check: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Discrepancy{
+		{Cell: "Plan!B2", Expected: "Done", Actual: "Other"},
+		{Cell: "Plan!B3", Expected: "Done", Actual: ""},
+	}
+	if !reflect.DeepEqual(summary.Discrepancies, want) {
+		t.Errorf("discrepancies = %+v, want %+v", summary.Discrepancies, want)
+	}
+	if summary.AlreadyCorrect != 1 {
+		t.Errorf("already correct = %d, want 1", summary.AlreadyCorrect)
+	}
+	if len(fake.written) != 0 || len(fake.probes) != 0 {
+		t.Errorf("check wrote %v or probed %v", fake.writes(), fake.probes)
+	}
+}
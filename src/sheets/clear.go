@@ -0,0 +1,89 @@
+package sheets
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+// clearPlan lists the ranges that still hold data and what they held.
+type clearPlan struct {
+	Ranges   []string
+	Previous []string
+	Cells    int64
+	Empty    []string
+	Changes  []cellChange
+}
+
+func buildClears(ctx context.Context, svc *sheets.Service, cfg config.Config, targets []target) (clearPlan, error) {
+	var plan clearPlan
+	for _, t := range targets {
+		existing, err := fetchRangeValues(ctx, svc, cfg, t.Range)
+		if err != nil {
+			return plan, fmt.Errorf("precondition failed for %s: %w", t.Range, err)
+		}
+		var cells int64
+		for r, row := range existing {
+			for c := range row {
+				if remoteHasValue(existing, r, c, cfg) {
+					cells++
+				}
+			}
+		}
+		if cells == 0 {
+			plan.Empty = append(plan.Empty, t.Range)
+			continue
+		}
+		plan.Ranges = append(plan.Ranges, t.Range)
+		plan.Previous = append(plan.Previous, fmt.Sprintf("%s: %v", t.Range, existing))
+		plan.Cells += cells
+		plan.Changes = append(plan.Changes, clearedCells(t.Range, existing, cfg)...)
+	}
+	return plan, nil
+}
+
+func batchClear(ctx context.Context, svc *sheets.Service, sheetID string, ranges []string) error {
+	req := &sheets.BatchClearValuesRequest{Ranges: ranges}
+	if _, err := svc.Spreadsheets.Values.BatchClear(sheetID, req).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("batch clear failed: %w", err)
+	}
+	return nil
+}
+
+// writeUndo saves changes, the cells a clear is about to blank, to
+// undo_dir/<runID>.csv as range,value rows in import_file's format, and
+// returns the file's path. It is written before the clear, so a failed
+// save leaves the cells untouched.
+func writeUndo(cfg config.Config, runID string, changes []cellChange) (string, error) {
+	if cfg.UndoDir == "" || len(changes) == 0 {
+		return "", nil
+	}
+	if err := os.MkdirAll(cfg.UndoDir, 0o755); err != nil {
+		return "", fmt.Errorf("create undo_dir: %w", err)
+	}
+	path := filepath.Join(cfg.UndoDir, runID+".csv")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("create undo file: %w", err)
+	}
+	w := csv.NewWriter(f)
+	_ = w.Write([]string{"range", "value"})
+	for _, ch := range changes {
+		_ = w.Write([]string{ch.Cell, fmt.Sprint(ch.Before)})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		_ = f.Close()
+		return "", fmt.Errorf("write undo file %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("write undo file %s: %w", path, err)
+	}
+	return path, nil
+}
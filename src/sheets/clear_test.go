@@ -0,0 +1,84 @@
+package sheets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"update-google-sheets/src/config"
+)
+
+func TestClearWritesUndoFile(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}, {"Alice"}, {"Alice"}}})
+	fake := &fakeSheets{cells: map[string][][]interface{}{
+		"Plan!B1": {{"Done"}},
+		"Plan!B2": {{"=SUM(1, 2)"}},
+	}}
+	undoDir := filepath.Join(t.TempDir(), "undo")
+	cfg := config.Config{SpreadsheetID: "XYZ", LookupValue: "Alice", TargetColOffset: 1, Mode: config.ModeClear, Workbook: path, UndoDir: undoDir}
+	summary, err := update(context.Background(), newFakeService(t, fake), cfg, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Plan!B1", "Plan!B2"}; !reflect.DeepEqual(fake.cleared, want) {
+		t.Fatalf("cleared = %v, want %v", fake.cleared, want)
+	}
+	if want := filepath.Join(undoDir, summary.RunID+".csv"); summary.UndoFile != want {
+		t.Fatalf("undo file = %q, want %q", summary.UndoFile, want)
+	}
+	data, err := os.ReadFile(summary.UndoFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "range,value\nPlan!B1,Done\nPlan!B2,\"=SUM(1, 2)\"\n"; string(data) != want {
+		t.Errorf("undo file =\n%s\nwant\n%s", data, want)
+	}
+
+	// The undo file is an import file that writes the cells back.
+	restore := config.Config{SpreadsheetID: "XYZ", ImportFile: summary.UndoFile}
+	if _, err := update(context.Background(), newFakeService(t, fake), restore, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	for rng, want := range map[string]string{"Plan!B1": "Done", "Plan!B2": "=SUM(1, 2)"} {
+		if got := fake.cells[rng]; !reflect.DeepEqual(got, [][]interface{}{{want}}) {
+			t.Errorf("%s after restore = %v, want %q", rng, got, want)
+		}
+	}
+}
+
+func TestClearUndoFileNotWritten(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	blocker := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		undoDir string
+		opts    Options
+		wantErr string
+	}{
+		{"dry run", filepath.Join(t.TempDir(), "undo"), Options{DryRun: true}, ""},
+		{"declined", filepath.Join(t.TempDir(), "undo"), Options{Confirm: func(string) (bool, error) { return false, nil }}, ""},
+		{"undo_dir cannot be created", filepath.Join(blocker, "undo"), Options{}, "nothing cleared"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSheets{cells: map[string][][]interface{}{"Plan!B1": {{"Done"}}}}
+			cfg := config.Config{SpreadsheetID: "XYZ", LookupValue: "Alice", TargetColOffset: 1, Mode: config.ModeClear, Workbook: path, UndoDir: tt.undoDir}
+			summary, err := update(context.Background(), newFakeService(t, fake), cfg, tt.opts)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+			if len(fake.cleared) != 0 || summary.UndoFile != "" {
+				t.Errorf("cleared %v with undo file %q", fake.cleared, summary.UndoFile)
+			}
+			if _, err := os.Stat(tt.undoDir); err == nil {
+				t.Errorf("undo_dir %s was created", tt.undoDir)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package sheets
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/xuri/excelize/v2"
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+// columnSpan is a whole-column stretch of one sheet, 1-based and inclusive.
+type columnSpan struct {
+	Sheet       string
+	First, Last int
+}
+
+// targetColumns lists the columns written by workbook-derived targets, once each.
+func targetColumns(targets []target) []columnSpan {
+	var spans []columnSpan
+	for _, t := range targets {
+		if t.Sheet == "" || len(t.Values) == 0 {
+			continue
+		}
+		span := columnSpan{Sheet: t.Sheet, First: t.Col, Last: t.Col + len(t.Values[0]) - 1}
+		if !slices.Contains(spans, span) {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+// applyConditionalFormat adds cfg.ConditionalFormat over every written
+// column that does not already carry the same rule, and returns the ranges
+// it was added to.
+func applyConditionalFormat(ctx context.Context, svc *sheets.Service, cfg config.Config, targets []target) ([]string, error) {
+	spans := targetColumns(targets)
+	if cfg.ConditionalFormat == nil || len(spans) == 0 {
+		return nil, nil
+	}
+	resp, err := svc.Spreadsheets.Get(cfg.SpreadsheetID).
+		Fields("sheets(properties(sheetId,title),conditionalFormats)").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("fetch conditional formats: %w", err)
+	}
+	bySheet := make(map[string]*sheets.Sheet)
+	for _, sh := range resp.Sheets {
+		if sh.Properties != nil {
+			bySheet[sh.Properties.Title] = sh
+		}
+	}
+
+	var (
+		requests []*sheets.Request
+		added    []string
+	)
+	for _, span := range spans {
+		sh, ok := bySheet[span.Sheet]
+		if !ok {
+			return nil, tag(ErrSheetNotFound, fmt.Errorf("conditional format: sheet %q not found in spreadsheet", span.Sheet))
+		}
+		req, err := conditionalFormatRequest(sh.Properties.SheetId, span, *cfg.ConditionalFormat)
+		if err != nil {
+			return nil, err
+		}
+		if hasRule(sh.ConditionalFormats, req.AddConditionalFormatRule.Rule) {
+			continue
+		}
+		requests = append(requests, req)
+		added = append(added, columnRange(span))
+	}
+	if len(requests) == 0 {
+		return nil, nil
+	}
+	batch := &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}
+	if _, err := svc.Spreadsheets.BatchUpdate(cfg.SpreadsheetID, batch).Context(ctx).Do(); err != nil {
+		return nil, fmt.Errorf("add conditional format failed: %w", err)
+	}
+	return added, nil
+}
+
+// conditionalFormatRequest builds the AddConditionalFormatRule request for
+// span. Row bounds are left open so the rule covers the whole column.
+func conditionalFormatRequest(sheetGID int64, span columnSpan, cf config.ConditionalFormat) (*sheets.Request, error) {
+	r, g, b, err := cf.RGB()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]*sheets.ConditionValue, len(cf.Values))
+	for i, v := range cf.Values {
+		values[i] = &sheets.ConditionValue{UserEnteredValue: v}
+	}
+	rule := &sheets.ConditionalFormatRule{
+		Ranges: []*sheets.GridRange{{
+			SheetId:          sheetGID,
+			StartColumnIndex: int64(span.First - 1),
+			EndColumnIndex:   int64(span.Last),
+			ForceSendFields:  []string{"SheetId", "StartColumnIndex"},
+		}},
+		BooleanRule: &sheets.BooleanRule{
+			Condition: &sheets.BooleanCondition{Type: cf.Condition, Values: values},
+			Format: &sheets.CellFormat{
+				BackgroundColor: &sheets.Color{Red: r, Green: g, Blue: b, ForceSendFields: []string{"Red", "Green", "Blue"}},
+			},
+		},
+	}
+	return &sheets.Request{AddConditionalFormatRule: &sheets.AddConditionalFormatRuleRequest{Rule: rule}}, nil
+}
+
+// hasRule reports whether existing already holds a boolean rule with the
+// same range and condition as want, so reruns do not stack duplicates.
+func hasRule(existing []*sheets.ConditionalFormatRule, want *sheets.ConditionalFormatRule) bool {
+	for _, rule := range existing {
+		if rule.BooleanRule == nil || rule.BooleanRule.Condition == nil || len(rule.Ranges) != 1 {
+			continue
+		}
+		got, wantRange := rule.Ranges[0], want.Ranges[0]
+		if got.SheetId != wantRange.SheetId || got.StartColumnIndex != wantRange.StartColumnIndex ||
+			got.EndColumnIndex != wantRange.EndColumnIndex || got.StartRowIndex != 0 || got.EndRowIndex != 0 {
+			continue
+		}
+		if conditionKey(rule.BooleanRule.Condition) == conditionKey(want.BooleanRule.Condition) {
+			return true
+		}
+	}
+	return false
+}
+
+func conditionKey(c *sheets.BooleanCondition) string {
+	key := c.Type
+	for _, v := range c.Values {
+		key += "\x00" + v.UserEnteredValue
+	}
+	return key
+}
+
+// columnRange renders span as an A1 column range such as Plan!C:C.
+func columnRange(span columnSpan) string {
+	first, _ := excelize.ColumnNumberToName(span.First)
+	last, _ := excelize.ColumnNumberToName(span.Last)
+	return formatRange(span.Sheet, first+":"+last)
+}
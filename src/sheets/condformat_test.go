@@ -0,0 +1,99 @@
+package sheets
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+func TestConditionalFormatRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		span       columnSpan
+		cf         config.ConditionalFormat
+		wantStart  int64
+		wantEnd    int64
+		wantValues []string
+		wantRGB    [3]float64
+	}{
+		{
+			name:       "single column text match",
+			span:       columnSpan{Sheet: "Plan", First: 3, Last: 3},
+			cf:         config.ConditionalFormat{Condition: "TEXT_EQ", Values: []string{"Alice"}, Color: "#FF0000"},
+			wantStart:  2,
+			wantEnd:    3,
+			wantValues: []string{"Alice"},
+			wantRGB:    [3]float64{1, 0, 0},
+		},
+		{
+			name:      "first column without operands",
+			span:      columnSpan{Sheet: "Plan", First: 1, Last: 4},
+			cf:        config.ConditionalFormat{Condition: "NOT_BLANK", Color: "#00ff00"},
+			wantStart: 0,
+			wantEnd:   4,
+			wantRGB:   [3]float64{0, 1, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := conditionalFormatRequest(42, tt.span, tt.cf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rule := req.AddConditionalFormatRule.Rule
+			gr := rule.Ranges[0]
+			if gr.SheetId != 42 || gr.StartColumnIndex != tt.wantStart || gr.EndColumnIndex != tt.wantEnd ||
+				gr.StartRowIndex != 0 || gr.EndRowIndex != 0 {
+				t.Errorf("range = %+v, want sheet 42 columns [%d,%d) on every row", gr, tt.wantStart, tt.wantEnd)
+			}
+			cond := rule.BooleanRule.Condition
+			var values []string
+			for _, v := range cond.Values {
+				values = append(values, v.UserEnteredValue)
+			}
+			if cond.Type != tt.cf.Condition || !reflect.DeepEqual(values, tt.wantValues) {
+				t.Errorf("condition = %s %v, want %s %v", cond.Type, values, tt.cf.Condition, tt.wantValues)
+			}
+			bg := rule.BooleanRule.Format.BackgroundColor
+			if got := [3]float64{bg.Red, bg.Green, bg.Blue}; got != tt.wantRGB {
+				t.Errorf("color = %v, want %v", got, tt.wantRGB)
+			}
+		})
+	}
+}
+
+func TestApplyConditionalFormatSkipsExistingRule(t *testing.T) {
+	cf := config.ConditionalFormat{Condition: "TEXT_EQ", Values: []string{"Alice"}, Color: "#FF0000"}
+	existing, err := conditionalFormatRequest(7, columnSpan{Sheet: "Plan", First: 1, Last: 1}, cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeSheets{meta: sheets.Spreadsheet{Sheets: []*sheets.Sheet{
+		{
+			Properties:         &sheets.SheetProperties{SheetId: 7, Title: "Plan"},
+			ConditionalFormats: []*sheets.ConditionalFormatRule{existing.AddConditionalFormatRule.Rule},
+		},
+		{Properties: &sheets.SheetProperties{SheetId: 9, Title: "Log"}},
+	}}}
+	svc := newFakeService(t, fake)
+	cfg := config.Config{SpreadsheetID: "sheet-id", ConditionalFormat: &cf}
+	targets := []target{
+		{Sheet: "Plan", Col: 1, Values: [][]interface{}{{"Alice"}}},
+		{Sheet: "Log", Col: 2, Values: [][]interface{}{{"Alice", "Alice"}}},
+		{Range: "named", Values: [][]interface{}{{"Alice"}}},
+	}
+	added, err := applyConditionalFormat(context.Background(), svc, cfg, targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Log!B:C"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("added = %v, want %v", added, want)
+	}
+	if len(fake.batches) != 1 || fake.batches[0].AddConditionalFormatRule.Rule.Ranges[0].SheetId != 9 {
+		t.Errorf("batch requests = %+v, want one rule on sheet 9", fake.batches)
+	}
+}
@@ -0,0 +1,126 @@
+package sheets
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+// Google Sheets gives a new tab this grid unless asked for more.
+const (
+	defaultGridRows = 1000
+	defaultGridCols = 26
+)
+
+// missingTabs returns the tabs of targets the spreadsheet lacks, when
+// create_missing_sheets is set; their cells count as empty until the tabs
+// are added. It also returns a cell on a tab that exists, for the write
+// probe. It returns nil and "" otherwise.
+func missingTabs(ctx context.Context, svc *sheets.Service, cfg config.Config, targets []target) (map[string]bool, string, error) {
+	if !cfg.CreateMissingSheets {
+		return nil, "", nil
+	}
+	meta, err := fetchMetadata(ctx, svc, cfg.SpreadsheetID)
+	if err != nil {
+		return nil, "", err
+	}
+	missing := make(map[string]bool)
+	for _, tab := range uniqueSheetNames(targetRanges(targets)) {
+		if _, ok := meta.sheetIDByTitle(tab); !ok {
+			missing[tab] = true
+		}
+	}
+	probe := ""
+	for _, props := range meta.sheets {
+		if probe == "" || props.Index == 0 {
+			probe = formatRange(props.Title, "A1")
+		}
+	}
+	return missing, probe, nil
+}
+
+// probeRange picks the range the write probe uses: the first payload on a
+// tab that exists, or else fallback.
+func probeRange(payloads []*sheets.ValueRange, missing map[string]bool, fallback string) string {
+	for _, p := range payloads {
+		if !missing[sheetNameFromRange(p.Range)] {
+			return p.Range
+		}
+	}
+	return fallback
+}
+
+// addSheets adds the tabs of missing that payloads write to, each with a
+// grid large enough for its ranges, in one request. It returns their
+// titles in sorted order.
+func addSheets(ctx context.Context, svc *sheets.Service, spreadsheetID string, missing map[string]bool, payloads []*sheets.ValueRange) ([]string, error) {
+	grids := make(map[string][2]int)
+	for _, p := range payloads {
+		tab := sheetNameFromRange(p.Range)
+		if !missing[tab] {
+			continue
+		}
+		area, err := parseArea(p.Range[strings.LastIndex(p.Range, "!")+1:])
+		if err != nil {
+			return nil, fmt.Errorf("size sheet %q: %w", tab, err)
+		}
+		g, ok := grids[tab]
+		if !ok {
+			g = [2]int{defaultGridRows, defaultGridCols}
+		}
+		grids[tab] = [2]int{max(g[0], area.MaxRow), max(g[1], area.MaxCol)}
+	}
+	if len(grids) == 0 {
+		return nil, nil
+	}
+	titles := make([]string, 0, len(grids))
+	for tab := range grids {
+		titles = append(titles, tab)
+	}
+	sort.Strings(titles)
+	requests := make([]*sheets.Request, 0, len(titles))
+	for _, tab := range titles {
+		requests = append(requests, &sheets.Request{AddSheet: &sheets.AddSheetRequest{
+			Properties: &sheets.SheetProperties{
+				Title: tab,
+				GridProperties: &sheets.GridProperties{
+					RowCount:    int64(grids[tab][0]),
+					ColumnCount: int64(grids[tab][1]),
+				},
+			},
+		}})
+	}
+	req := &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}
+	if _, err := svc.Spreadsheets.BatchUpdate(spreadsheetID, req).Context(ctx).Do(); err != nil {
+		return nil, fmt.Errorf("create sheets %s: %w", strings.Join(titles, ", "), err)
+	}
+	return titles, nil
+}
+
+// usedTabs lists, sorted, the tabs of missing that payloads write to.
+func usedTabs(payloads []*sheets.ValueRange, missing map[string]bool) []string {
+	var tabs []string
+	for _, tab := range uniqueSheetNames(payloadRanges(payloads)) {
+		if missing[tab] {
+			tabs = append(tabs, tab)
+		}
+	}
+	sort.Strings(tabs)
+	return tabs
+}
+
+// withoutTabs returns the ranges not on a tab of tabs.
+func withoutTabs(ranges []string, tabs map[string]bool) []string {
+	var out []string
+	for _, rng := range ranges {
+		if !tabs[sheetNameFromRange(rng)] {
+			out = append(out, rng)
+		}
+	}
+	return out
+}
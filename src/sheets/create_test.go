@@ -0,0 +1,102 @@
+package sheets
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+func TestCreateMissingSheets(t *testing.T) {
+	tall := make([][]string, 1500)
+	tall[0] = []string{"Alice"}
+	tall[1499] = []string{"Alice"}
+	path := writeWorkbook(t,
+		fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}},
+		fixtureSheet{name: "Week 9", rows: tall},
+	)
+	meta := sheets.Spreadsheet{Sheets: []*sheets.Sheet{{Properties: &sheets.SheetProperties{SheetId: 1, Title: "Plan"}}}}
+
+	tests := []struct {
+		name        string
+		existing    []string // tabs besides Plan
+		dryRun      bool
+		wantCreated []string
+		wantAdds    map[string][2]int64
+		wantWrites  []string
+	}{
+		{
+			name:        "missing tab is created before writing",
+			wantCreated: []string{"Week 9"},
+			wantAdds:    map[string][2]int64{"Week 9": {1500, 26}},
+			wantWrites:  []string{"Plan!A1", "'Week 9'!A1", "'Week 9'!A1500"},
+		},
+		{
+			name:       "existing tab is a no-op",
+			existing:   []string{"Week 9"},
+			wantWrites: []string{"Plan!A1", "'Week 9'!A1", "'Week 9'!A1500"},
+		},
+		{
+			name:   "dry run creates nothing",
+			dryRun: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := meta
+			m.Sheets = append([]*sheets.Sheet(nil), meta.Sheets...)
+			for i, tab := range tt.existing {
+				m.Sheets = append(m.Sheets, &sheets.Sheet{Properties: &sheets.SheetProperties{SheetId: int64(i + 2), Title: tab}})
+			}
+			fake := &fakeSheets{meta: m}
+			if len(tt.existing) == 0 {
+				fake.missingTabs = []string{"Week 9"}
+			}
+			cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path, CreateMissingSheets: true}
+			summary, err := update(context.Background(), newFakeService(t, fake), cfg, Options{DryRun: tt.dryRun})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(summary.CreatedSheets, tt.wantCreated) {
+				t.Errorf("CreatedSheets = %v, want %v", summary.CreatedSheets, tt.wantCreated)
+			}
+			adds := map[string][2]int64{}
+			for _, req := range fake.batches {
+				if req.AddSheet == nil {
+					t.Errorf("unexpected structural request %+v", req)
+					continue
+				}
+				p := req.AddSheet.Properties
+				adds[p.Title] = [2]int64{p.GridProperties.RowCount, p.GridProperties.ColumnCount}
+			}
+			if len(tt.wantAdds) == 0 && len(adds) != 0 || len(tt.wantAdds) != 0 && !reflect.DeepEqual(adds, tt.wantAdds) {
+				t.Errorf("AddSheet requests = %v, want %v", adds, tt.wantAdds)
+			}
+			if got := fake.writes(); !reflect.DeepEqual(got, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", got, tt.wantWrites)
+			}
+			for _, rng := range fake.probes {
+				if strings.Contains(rng, "Week 9") && len(tt.existing) == 0 {
+					t.Errorf("write probe targeted the missing tab: %s", rng)
+				}
+			}
+		})
+	}
+}
+
+func TestMissingTabWithoutCreateMissingSheets(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Week 9", rows: [][]string{{"Alice"}}})
+	fake := &fakeSheets{missingTabs: []string{"Week 9"}}
+	cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path}
+	_, err := update(context.Background(), newFakeService(t, fake), cfg, Options{})
+	if err == nil || !strings.Contains(err.Error(), "create_missing_sheets") {
+		t.Errorf("err = %v, want a pointer at create_missing_sheets", err)
+	}
+	if len(fake.batches) != 0 {
+		t.Errorf("created tabs without create_missing_sheets: %v", fake.batches)
+	}
+}
@@ -0,0 +1,33 @@
+// Package sheets pushes lookup-derived values from an Excel workbook into a
+// Google Sheets spreadsheet.
+//
+// Embedding programs should prefer the stable API in pkg/sheetsync; this
+// package is its implementation and may change between releases.
+//
+// Library callers build a config.Config, validate it, and hand it to Update.
+// Credentials are resolved through Application Default Credentials, the same
+// way the CLI does:
+//
+//	cfg := config.Config{
+//		SpreadsheetID: "1EXmDCBWbrCynRtxOn2eRVj9eMt3yIKwSqFRtnenRm3E",
+//		SheetFilter:   config.SheetList{"Week 1"},
+//		LookupValue:   "Alice",
+//		Workbook:      "cfg/Schedule.xlsx",
+//	}
+//	if err := cfg.Validate(); err != nil {
+//		return err
+//	}
+//	summary, err := sheets.Update(ctx, cfg)
+//	if err != nil {
+//		return err
+//	}
+//	if summary.SkippedReason != "" {
+//		log.Printf("nothing written: %s", summary.SkippedReason)
+//	}
+//
+// UpdateWithOptions adds run-time behaviour such as a dry run or a
+// confirmation callback:
+//
+//	summary, err := sheets.UpdateWithOptions(ctx, cfg, sheets.Options{DryRun: true})
+//	// summary.Ranges lists what would have been written.
+package sheets
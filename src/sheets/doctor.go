@@ -0,0 +1,95 @@
+package sheets
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+// sheetsEndpoint is probed by CheckReachable.
+const sheetsEndpoint = "https://sheets.googleapis.com/"
+
+// FindMatches scans cfg.Workbook for the lookup value the way a run would,
+// without contacting Google Sheets. It returns the matches and the sheets
+// that were scanned.
+func FindMatches(ctx context.Context, cfg config.Config) ([]Match, []string, error) {
+	d, err := deriveRangesFromExcel(ctx, cfg.Workbook, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return d.Matches, d.Sheets, nil
+}
+
+// CheckAccess fetches the spreadsheet title and sends the same null write
+// as -dry-run-check-write to its first sheet, so it proves edit access
+// without changing any cell.
+func CheckAccess(ctx context.Context, svc *sheets.Service, cfg config.Config) (string, error) {
+	resp, err := svc.Spreadsheets.Get(cfg.SpreadsheetID).
+		Fields("properties(title),sheets(properties(title))").
+		Context(ctx).
+		Do()
+	if err != nil {
+		if nf := missingSpreadsheet(ctx, cfg.SpreadsheetID, err); nf != nil {
+			return "", nf
+		}
+		return "", withQuotaHint(fmt.Errorf("fetch spreadsheet %s: %w", cfg.SpreadsheetID, err), cfg)
+	}
+	title := ""
+	if resp.Properties != nil {
+		title = resp.Properties.Title
+	}
+	if len(resp.Sheets) == 0 || resp.Sheets[0].Properties == nil {
+		return title, fmt.Errorf("spreadsheet %s has no sheets", cfg.SpreadsheetID)
+	}
+	probe := formatRange(resp.Sheets[0].Properties.Title, "A1")
+	if err := probeWrite(ctx, svc, cfg.SpreadsheetID, probe); err != nil {
+		return title, withQuotaHint(err, cfg)
+	}
+	return title, nil
+}
+
+// SpreadsheetTitle fetches the metadata of spreadsheet id and returns its
+// title. It only reads, so it works with the read-only scope.
+func SpreadsheetTitle(ctx context.Context, svc *sheets.Service, cfg config.Config, id string) (string, error) {
+	resp, err := svc.Spreadsheets.Get(id).
+		Fields("properties(title)").
+		Context(ctx).
+		Do()
+	if err != nil {
+		if nf := missingSpreadsheet(ctx, id, err); nf != nil {
+			return "", nf
+		}
+		return "", withQuotaHint(fmt.Errorf("fetch spreadsheet %s: %w", id, err), cfg)
+	}
+	if resp.Properties == nil {
+		return "", nil
+	}
+	return resp.Properties.Title, nil
+}
+
+// CheckReachable opens an HTTPS connection to the Sheets API through the
+// configured proxy_url and ca_bundle_file. Any HTTP response counts.
+func CheckReachable(ctx context.Context, cfg config.Config) error {
+	client := http.DefaultClient
+	tr, err := baseTransport(cfg)
+	if err != nil {
+		return err
+	}
+	if tr != nil {
+		client = &http.Client{Transport: tr}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, sheetsEndpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("reach %s: %w", sheetsEndpoint, err)
+	}
+	_ = resp.Body.Close()
+	return nil
+}
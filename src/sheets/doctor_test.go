@@ -0,0 +1,93 @@
+package sheets
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+func TestFindMatches(t *testing.T) {
+	path := writeWorkbook(t,
+		fixtureSheet{name: "Plan", rows: [][]string{{"x", "Alice"}}},
+		fixtureSheet{name: "Week2", rows: [][]string{{"Bob"}}},
+	)
+	matches, scanned, err := FindMatches(context.Background(), config.Config{LookupValue: "Alice", Workbook: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].A1 != "Plan!B1" {
+		t.Errorf("matches = %+v, want Plan!B1", matches)
+	}
+	if want := []string{"Plan", "Week2"}; !reflect.DeepEqual(scanned, want) {
+		t.Errorf("scanned = %q, want %q", scanned, want)
+	}
+	_, _, err = FindMatches(context.Background(), config.Config{LookupValue: "Carol", Workbook: path})
+	if err == nil || !strings.Contains(err.Error(), "Carol") {
+		t.Errorf("err = %v, want the missing lookup value", err)
+	}
+}
+
+func TestCheckAccess(t *testing.T) {
+	withTabs := sheets.Spreadsheet{
+		Properties: &sheets.SpreadsheetProperties{Title: "Budget"},
+		Sheets:     []*sheets.Sheet{{Properties: &sheets.SheetProperties{Title: "My Plan"}}, {Properties: &sheets.SheetProperties{Title: "Week2"}}},
+	}
+	tests := []struct {
+		name    string
+		fake    *fakeSheets
+		title   string
+		probes  []string
+		wantErr string
+	}{
+		{name: "readable and writable", fake: &fakeSheets{meta: withTabs}, title: "Budget", probes: []string{"'My Plan'!A1"}},
+		{name: "no sheets", fake: &fakeSheets{meta: sheets.Spreadsheet{Properties: withTabs.Properties}}, title: "Budget",
+			wantErr: "spreadsheet sheet-id has no sheets"},
+		{name: "read only", fake: &fakeSheets{meta: withTabs, writeStatus: http.StatusForbidden}, title: "Budget",
+			wantErr: "403"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			title, err := CheckAccess(context.Background(), newFakeService(t, tt.fake), config.Config{SpreadsheetID: "sheet-id"})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if title != tt.title {
+				t.Errorf("title = %q, want %q", title, tt.title)
+			}
+			if !reflect.DeepEqual(tt.fake.probes, tt.probes) {
+				t.Errorf("probes = %q, want %q", tt.fake.probes, tt.probes)
+			}
+			if len(tt.fake.written) != 0 {
+				t.Errorf("wrote %v", tt.fake.writes())
+			}
+		})
+	}
+}
+
+func TestSpreadsheetTitle(t *testing.T) {
+	fake := &fakeSheets{meta: sheets.Spreadsheet{Properties: &sheets.SpreadsheetProperties{Title: "Budget"}}}
+	title, err := SpreadsheetTitle(context.Background(), newFakeService(t, fake), config.Config{}, "sheet-id")
+	if err != nil || title != "Budget" {
+		t.Errorf("SpreadsheetTitle = %q, %v; want Budget", title, err)
+	}
+	if len(fake.probes) != 0 || len(fake.written) != 0 {
+		t.Errorf("SpreadsheetTitle wrote: probes %q, written %v", fake.probes, fake.writes())
+	}
+}
+
+func TestCheckReachableThroughBadProxy(t *testing.T) {
+	err := CheckReachable(context.Background(), config.Config{ProxyURL: "http://127.0.0.1:1"})
+	if err == nil || !strings.Contains(err.Error(), "reach "+sheetsEndpoint) {
+		t.Errorf("err = %v, want the endpoint unreachable", err)
+	}
+}
@@ -0,0 +1,36 @@
+package sheets
+
+import "errors"
+
+// Sentinel errors that callers can test for with errors.Is. The returned
+// errors keep their detailed messages; the sentinel only classifies them.
+var (
+	ErrSheetNotFound     = errors.New("sheet not found")
+	ErrValueNotFound     = errors.New("lookup value not found")
+	ErrAnchorNotUnique   = errors.New("anchor is not unique")
+	ErrOccupied          = errors.New("target cells already contain data")
+	ErrExpectationNotMet = errors.New("expect_current_value not met")
+	ErrNoWriteAccess     = errors.New("no write access")
+	ErrSchemaMismatch    = errors.New("workbook does not match schema_file")
+	// ErrSpreadsheetNotFound means the API answered 404 for the
+	// spreadsheet: a wrong spreadsheet_id, or one not shared with the
+	// credentials.
+	ErrSpreadsheetNotFound = errors.New("spreadsheet not found")
+	// ErrPlanChanged means a run given ExpectPlanned found different
+	// writes than the dry run it was given.
+	ErrPlanChanged = errors.New("plan changed since it was made")
+)
+
+// taggedError classifies err as kind without changing its message.
+type taggedError struct {
+	err  error
+	kind error
+}
+
+func tag(kind, err error) error {
+	return taggedError{err: err, kind: kind}
+}
+
+func (e taggedError) Error() string        { return e.err.Error() }
+func (e taggedError) Unwrap() error        { return e.err }
+func (e taggedError) Is(target error) bool { return target == e.kind }
@@ -0,0 +1,46 @@
+package sheets
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+func Example_update() {
+	// A stand-in for the Sheets API; real callers rely on Application
+	// Default Credentials instead.
+	srv := httptest.NewServer(&fakeSheets{cells: map[string][][]interface{}{}})
+	defer srv.Close()
+	ctx := context.Background()
+	svc, err := sheets.NewService(ctx, option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	cfg := config.Config{
+		SpreadsheetID: "example-sheet",
+		SheetFilter:   config.SheetList{"Week 1"},
+		LookupValue:   "Alice",
+		Workbook:      "testdata/Schedule.xlsx",
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Println(err)
+		return
+	}
+	summary, err := UpdateWithService(ctx, svc, cfg, Options{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(summary.Preview)
+	fmt.Println(summary.Ranges, summary.TotalCells)
+	// Output:
+	// About to write 2 cells across 1 sheet in spreadsheet example-sheet.
+	// ['Week 1'!A2 'Week 1'!B3] 2
+}
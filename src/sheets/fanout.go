@@ -0,0 +1,182 @@
+package sheets
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+// SpreadsheetResult is the outcome of a run against one spreadsheet of
+// spreadsheet_ids. NotRun marks spreadsheets skipped under stop_on_error
+// after an earlier one failed.
+type SpreadsheetResult struct {
+	SpreadsheetID string
+	Summary       Summary
+	Err           error
+	NotRun        bool
+}
+
+// UpdateEach applies cfg to every spreadsheet of cfg.SpreadsheetIDs,
+// spreadsheet_concurrency at a time. The targets are derived once; each
+// spreadsheet then gets them with its sheet_maps renames and runs as
+// UpdateWithService would, with its own confirmation, precondition fetches
+// and summary. Results are in spreadsheet_ids order. The error is only for
+// a failed derivation; a spreadsheet's failure is in its result and, under
+// stop_on_error, keeps the spreadsheets not yet started from running.
+//
+// Each summary's RetryCount counts the retries made while its spreadsheet
+// ran. Concurrent runs share one API clock and trace, so their summaries
+// leave APIDuration and APICalls unset, their RetryCount may include
+// retries of the spreadsheets running alongside, and their confirmation
+// and review prompts are asked one at a time.
+func UpdateEach(ctx context.Context, svc *sheets.Service, cfg config.Config, opts Options) ([]SpreadsheetResult, error) {
+	cfg, err := cfg.ExpandTemplates(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Mode != config.ModeAppend {
+		d, err := derive(ctx, cfg, opts)
+		if err != nil {
+			return nil, err
+		}
+		opts.derived = &d
+	}
+	derived := opts.derived
+	ids := cfg.SpreadsheetIDs
+	workers := min(cfg.SpreadsheetWorkers(), len(ids))
+	if workers > 1 {
+		opts = serializePrompts(opts)
+	}
+	results := make([]SpreadsheetResult, len(ids))
+	var (
+		mu      sync.Mutex
+		stopped bool
+	)
+	runOne := func(i int) {
+		id := ids[i]
+		mu.Lock()
+		skip := stopped
+		mu.Unlock()
+		if skip {
+			results[i] = SpreadsheetResult{SpreadsheetID: id, NotRun: true}
+			return
+		}
+		run := opts
+		if derived != nil {
+			d := renameTabs(*derived, cfg.SheetMaps[id], cfg.DefaultTab(id))
+			run.derived = &d
+		}
+		elapsed, retries := opts.Clock.Elapsed(), opts.Retries.Used()
+		summary, err := updateWithService(ctx, svc, forSpreadsheet(cfg, id), run)
+		if opts.Retries != nil {
+			summary.RetryCount = opts.Retries.Used() - retries
+			summary.RetryBudget = opts.Retries.max
+		}
+		if workers == 1 {
+			summary.APIDuration = opts.Clock.Elapsed() - elapsed
+			summary.APICalls = opts.Trace.Take()
+		}
+		results[i] = SpreadsheetResult{SpreadsheetID: id, Summary: summary, Err: err}
+		if err != nil && cfg.StopOnError {
+			mu.Lock()
+			stopped = true
+			mu.Unlock()
+		}
+	}
+	if workers <= 1 {
+		for i := range ids {
+			runOne(i)
+		}
+		return results, nil
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				runOne(i)
+			}
+		}()
+	}
+	for i := range ids {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	// The calls cannot be told apart by spreadsheet; drop them so a later
+	// run does not report them as its own.
+	opts.Trace.Take()
+	return results, nil
+}
+
+// serializePrompts returns opts with its Confirm and Review callbacks
+// taking turns, so concurrent runs never prompt at the same time.
+func serializePrompts(opts Options) Options {
+	var mu sync.Mutex
+	if confirm := opts.Confirm; confirm != nil {
+		opts.Confirm = func(preview string) (bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return confirm(preview)
+		}
+	}
+	if review := opts.Review; review != nil {
+		opts.Review = func(rng string, changes []string) (bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return review(rng, changes)
+		}
+	}
+	return opts
+}
+
+// forSpreadsheet returns the config of the run against id: SpreadsheetID
+// set, and append_sheet and touch_cell renamed per its sheet_maps entry.
+// default_tab_from_url is turned off, since UpdateEach has already applied
+// it to the targets.
+func forSpreadsheet(cfg config.Config, id string) config.Config {
+	tabs := cfg.SheetMaps[id]
+	cfg.SpreadsheetID = id
+	cfg.SpreadsheetIDs = nil
+	cfg.SheetMaps = nil
+	cfg.DefaultTabFromURL = false
+	if to, ok := tabs[cfg.AppendSheet]; ok {
+		cfg.AppendSheet = to
+	}
+	if cfg.TouchCell != "" {
+		if to, ok := tabs[sheetNameFromRange(cfg.TouchCell)]; ok {
+			cfg.TouchCell = formatRange(to, cfg.TouchCell[strings.LastIndex(cfg.TouchCell, "!")+1:])
+		}
+	}
+	return cfg
+}
+
+// renameTabs returns d with the targets on the tabs of tabs moved to their
+// new titles, and those on any other sheet to fallback when it is set.
+// Matches keep the workbook's sheet names.
+func renameTabs(d derivation, tabs map[string]string, fallback string) derivation {
+	if len(tabs) == 0 && fallback == "" {
+		return d
+	}
+	targets := make([]target, len(d.Targets))
+	for i, t := range d.Targets {
+		to, ok := tabs[t.Sheet]
+		if !ok {
+			to = fallback
+		}
+		if to != "" && t.Sheet != "" {
+			t.Range = formatRange(to, t.Range[strings.LastIndex(t.Range, "!")+1:])
+			t.Sheet = to
+		}
+		targets[i] = t
+	}
+	d.Targets = targets
+	return d
+}
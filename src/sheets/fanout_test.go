@@ -0,0 +1,175 @@
+package sheets
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+
+	"update-google-sheets/src/config"
+)
+
+// fakeSpreadsheets routes each request to the fake of its spreadsheet ID
+// and answers 404 for IDs it does not hold.
+type fakeSpreadsheets map[string]*fakeSheets
+
+func (f fakeSpreadsheets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, rest, _ := strings.Cut(r.URL.Path, "/spreadsheets/")
+	id, _, _ := strings.Cut(rest, "/")
+	id, _, _ = strings.Cut(id, ":")
+	fake, ok := f[id]
+	if !ok {
+		writeError(w, http.StatusNotFound)
+		return
+	}
+	fake.ServeHTTP(w, r)
+}
+
+// fanOutOutcome is the part of a result that does not vary between runs.
+type fanOutOutcome struct {
+	ID       string
+	Failed   bool
+	NotRun   bool
+	Ranges   []string
+	Skipped  string
+	Preview  string
+	Occupied []string
+}
+
+func runFanOut(t *testing.T, cfg config.Config, opts Options) ([]fanOutOutcome, fakeSpreadsheets) {
+	t.Helper()
+	fakes := fakeSpreadsheets{}
+	for i, id := range cfg.SpreadsheetIDs {
+		if id == "missing" {
+			continue
+		}
+		fake := &fakeSheets{cells: map[string][][]interface{}{}}
+		if i%2 == 1 {
+			// Every other spreadsheet already holds a value in one target.
+			fake.cells["Plan!B3"] = [][]interface{}{{"Other"}}
+		}
+		fakes[id] = fake
+	}
+	results, err := UpdateEach(context.Background(), newHandlerService(t, fakes), cfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outcomes := make([]fanOutOutcome, len(results))
+	for i, r := range results {
+		outcomes[i] = fanOutOutcome{
+			ID: r.SpreadsheetID, Failed: r.Err != nil, NotRun: r.NotRun,
+			Ranges: r.Summary.Ranges, Skipped: r.Summary.SkippedReason,
+			Preview: r.Summary.Preview, Occupied: r.Summary.Occupied,
+		}
+	}
+	return outcomes, fakes
+}
+
+func TestUpdateEachConcurrentMatchesSerial(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}, {""}, {"Alice"}}})
+	cfg := config.Config{
+		SpreadsheetIDs:  []string{"s1", "s2", "missing", "s4", "s5", "s6", "s7"},
+		LookupValue:     "Alice",
+		WriteValue:      "Done",
+		TargetColOffset: 1,
+		Workbook:        path,
+	}
+	serial, _ := runFanOut(t, cfg, Options{})
+	if len(serial) != len(cfg.SpreadsheetIDs) || !serial[2].Failed || len(serial[0].Ranges) != 2 || len(serial[1].Ranges) != 1 {
+		t.Fatalf("serial outcomes do not exercise failures and partial writes: %+v", serial)
+	}
+	for _, workers := range []int{2, 3, 10} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			cfg := cfg
+			cfg.SpreadsheetConcurrency = workers
+			got, fakes := runFanOut(t, cfg, Options{})
+			if !reflect.DeepEqual(got, serial) {
+				t.Errorf("outcomes differ from the serial run:\n got %+v\nwant %+v", got, serial)
+			}
+			for id, fake := range fakes {
+				if want := serial[slices.Index(cfg.SpreadsheetIDs, id)].Ranges; !reflect.DeepEqual(fake.writes(), want) {
+					t.Errorf("%s got writes %v, want %v", id, fake.writes(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateEachStopOnErrorSerial(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	cfg := config.Config{
+		SpreadsheetIDs: []string{"s1", "missing", "s3"},
+		LookupValue:    "Alice", WriteValue: "Done", TargetColOffset: 1, Workbook: path,
+		StopOnError: true,
+	}
+	got, _ := runFanOut(t, cfg, Options{})
+	if got[0].Failed || !got[1].Failed || !got[2].NotRun {
+		t.Errorf("outcomes = %+v, want s1 ok, missing failed, s3 not run", got)
+	}
+}
+
+func TestUpdateEachRetriesPerSpreadsheet(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	fakes := fakeSpreadsheets{
+		"s1": {cells: map[string][][]interface{}{}},
+		"s2": {cells: map[string][][]interface{}{}},
+	}
+	// s1 runs first, so only its first two requests are rate-limited.
+	h := &slowHandler{next: fakes}
+	h.limited.Store(2)
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	cfg := config.Config{SpreadsheetIDs: []string{"s1", "s2"}, LookupValue: "Alice", WriteValue: "Done", TargetColOffset: 1, Workbook: path, MaxRetries: 3}
+	opts := Options{Retries: NewRetryBudget(cfg)}
+	svc, err := NewService(ctx, cfg, opts, option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := UpdateEach(ctx, svc, cfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int{2, 0} {
+		if r := results[i]; r.Err != nil || r.Summary.RetryCount != want {
+			t.Errorf("%s: RetryCount = %d (err %v), want %d", r.SpreadsheetID, r.Summary.RetryCount, r.Err, want)
+		}
+	}
+}
+
+func TestUpdateEachConcurrentPromptsTakeTurns(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	cfg := config.Config{
+		SpreadsheetIDs: []string{"s1", "s2", "s3", "s4"},
+		LookupValue:    "Alice", WriteValue: "Done", TargetColOffset: 1, Workbook: path,
+		SpreadsheetConcurrency: 4,
+	}
+	var open, overlaps, asked atomic.Int32
+	confirm := func(string) (bool, error) {
+		if open.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		time.Sleep(5 * time.Millisecond)
+		open.Add(-1)
+		asked.Add(1)
+		return true, nil
+	}
+	got, _ := runFanOut(t, cfg, Options{Confirm: confirm})
+	if asked.Load() != 4 || overlaps.Load() != 0 {
+		t.Errorf("asked %d times with %d overlapping prompts, want 4 and 0", asked.Load(), overlaps.Load())
+	}
+	for _, o := range got {
+		if o.Failed || len(o.Ranges) != 1 {
+			t.Errorf("%s: %+v, want one range written", o.ID, o)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package sheets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+// protectFormulas blanks out desired cells whose remote cell holds a
+// formula, so the write leaves the formula alone. Null values in a
+// ValueRange are skipped by the API. Unless overwrite says the merge may
+// replace occupied cells, only cells that render empty can be written, so
+// only those are checked and the formula render is only fetched when some
+// target cell renders empty; it is never fetched when existing was already
+// read with it.
+func protectFormulas(ctx context.Context, svc *sheets.Service, cfg config.Config, rng string, existing, desired [][]interface{}, overwrite bool) ([][]interface{}, []string, error) {
+	if !overwrite && !anyEmptyTarget(existing, desired) {
+		return desired, nil, nil
+	}
+	formulas := existing
+	if cfg.ValueRenderOption != "FORMULA" {
+		resp, err := svc.Spreadsheets.Values.Get(cfg.SpreadsheetID, rng).
+			ValueRenderOption("FORMULA").
+			Context(ctx).
+			Do()
+		if err != nil {
+			return nil, nil, fmt.Errorf("fetch formulas: %w", err)
+		}
+		formulas = resp.Values
+	}
+	var (
+		masked  [][]interface{}
+		skipped []string
+	)
+	for r, row := range desired {
+		for c, val := range row {
+			if val == nil || !overwrite && cellHasValue(existing, r, c) || !isFormula(formulas, r, c) {
+				continue
+			}
+			if masked == nil {
+				masked = copyValues(desired)
+			}
+			masked[r][c] = nil
+			skipped = append(skipped, fmt.Sprintf("%s[%d,%d]: skipped: contains formula %s", rng, r, c, formulas[r][c]))
+		}
+	}
+	if masked == nil {
+		return desired, nil, nil
+	}
+	return masked, skipped, nil
+}
+
+func anyEmptyTarget(existing, desired [][]interface{}) bool {
+	for r, row := range desired {
+		for c := range row {
+			if !cellHasValue(existing, r, c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isFormula(values [][]interface{}, row, col int) bool {
+	if !cellHasValue(values, row, col) {
+		return false
+	}
+	text, ok := values[row][col].(string)
+	return ok && strings.HasPrefix(text, "=")
+}
+
+func copyValues(values [][]interface{}) [][]interface{} {
+	out := make([][]interface{}, len(values))
+	for i, row := range values {
+		out[i] = append([]interface{}(nil), row...)
+	}
+	return out
+}
@@ -0,0 +1,65 @@
+package sheets
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"update-google-sheets/src/config"
+)
+
+func TestProtectFormulas(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	tests := []struct {
+		name string
+		// rendered is what Plan!A1 shows; formula is its FORMULA render.
+		rendered, formula interface{}
+		cfg               config.Config
+		wantWrite         bool
+		wantSkip          bool
+		// wantGets is the number of values.get calls: the precondition
+		// read plus any formula fetch.
+		wantGets int
+	}{
+		{name: "formula rendering empty", rendered: "", formula: `=IF(B1="","",B1)`, wantSkip: true, wantGets: 2},
+		{name: "empty cell", rendered: nil, formula: nil, wantWrite: true, wantGets: 2},
+		{name: "allowed", rendered: "", formula: `=IF(B1="","",B1)`,
+			cfg: config.Config{AllowOverwritingFormulas: true}, wantWrite: true, wantGets: 1},
+		{name: "formula rendering a value is occupied", rendered: "6", formula: "=SUM(B1:B3)", wantGets: 1},
+		{name: "overwrite policy", rendered: "6", formula: "=SUM(B1:B3)",
+			cfg: config.Config{OccupiedCellPolicy: config.OccupiedOverwrite}, wantSkip: true, wantGets: 2},
+		{name: "overwrite policy replaces plain values", rendered: "6", formula: "6",
+			cfg: config.Config{OccupiedCellPolicy: config.OccupiedOverwrite}, wantWrite: true, wantGets: 2},
+		{name: "sync mode", rendered: "6", formula: "=SUM(B1:B3)",
+			cfg: config.Config{Mode: config.ModeSync}, wantSkip: true, wantGets: 2},
+		{name: "read with formulas already", rendered: `=IF(B1="","",B1)`, formula: `=IF(B1="","",B1)`,
+			cfg: config.Config{ValueRenderOption: "FORMULA", Mode: config.ModeSync}, wantSkip: true, wantGets: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSheets{
+				cells:   map[string][][]interface{}{"Plan!A1": {{tt.rendered}}},
+				renders: map[string]map[string][][]interface{}{"FORMULA": {"Plan!A1": {{tt.formula}}}},
+			}
+			if tt.cfg.ValueRenderOption == "FORMULA" {
+				fake.renders = nil
+			}
+			cfg := tt.cfg
+			cfg.SpreadsheetID, cfg.LookupValue, cfg.Workbook = "sheet-id", "Alice", path
+			summary, err := update(context.Background(), newFakeService(t, fake), cfg, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(fake.written) > 0; got != tt.wantWrite {
+				t.Errorf("written = %v, want %v", fake.written, tt.wantWrite)
+			}
+			skipped := strings.Join(summary.SkippedMatches, "; ")
+			if got := strings.Contains(skipped, "Plan!A1[0,0]: skipped: contains formula "); got != tt.wantSkip {
+				t.Errorf("skipped matches = %q, want formula skip %v", skipped, tt.wantSkip)
+			}
+			if len(fake.gets) != tt.wantGets {
+				t.Errorf("got %d reads, want %d", len(fake.gets), tt.wantGets)
+			}
+		})
+	}
+}
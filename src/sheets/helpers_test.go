@@ -0,0 +1,328 @@
+package sheets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+// fixtureSheet is one tab of a generated test workbook.
+type fixtureSheet struct {
+	name string
+	rows [][]string
+}
+
+// writeWorkbook saves a workbook holding sheets, in order, to a temporary
+// file and returns its path.
+func writeWorkbook(t testing.TB, sheets ...fixtureSheet) string {
+	t.Helper()
+	f := excelize.NewFile()
+	defer func() { _ = f.Close() }()
+	for i, sh := range sheets {
+		if i == 0 {
+			if err := f.SetSheetName("Sheet1", sh.name); err != nil {
+				t.Fatal(err)
+			}
+		} else if _, err := f.NewSheet(sh.name); err != nil {
+			t.Fatal(err)
+		}
+		for r, row := range sh.rows {
+			for c, v := range row {
+				if v == "" {
+					continue
+				}
+				cell, _ := excelize.CoordinatesToCellName(c+1, r+1)
+				if err := f.SetCellValue(sh.name, cell, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	path := filepath.Join(t.TempDir(), "fixture.xlsx")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// derived is what a workbook scan produced, flattened for comparison.
+type derived struct {
+	Ranges  []string
+	Values  [][][]interface{}
+	Skipped []string
+}
+
+// deriveFixture scans the workbook at path with cfg the way a run would.
+func deriveFixture(t testing.TB, path string, cfg config.Config) (derived, error) {
+	t.Helper()
+	der, err := deriveRangesFromExcel(context.Background(), path, cfg)
+	if err != nil {
+		return derived{}, err
+	}
+	d := derived{Skipped: der.Skipped}
+	for _, tg := range der.Targets {
+		d.Ranges = append(d.Ranges, tg.Range)
+		d.Values = append(d.Values, tg.Values)
+	}
+	return d, nil
+}
+
+// fakeSheets is an in-memory stand-in for the Sheets API. Cells holds the
+// current values keyed by A1 range; requests records every call by path.
+type fakeSheets struct {
+	mu       sync.Mutex
+	cells    map[string][][]interface{}
+	requests []string
+	written  []*sheets.ValueRange
+	// meta answers spreadsheets.get; batches records spreadsheets.batchUpdate.
+	meta    sheets.Spreadsheet
+	batches []*sheets.Request
+	// renders overrides cells per valueRenderOption; gets records the
+	// query of every values.get.
+	renders map[string]map[string][][]interface{}
+	gets    []url.Values
+	// valueRequests records every values:batchUpdate request; echo, when
+	// set, renders each written cell for the response.
+	valueRequests []*sheets.BatchUpdateValuesRequest
+	echo          func(renderOption string, sent interface{}) interface{}
+	// writeStatus, when set, fails every values:batchUpdate with that code.
+	writeStatus int
+	// readStatus, when set, fails every values read with that code.
+	readStatus int
+	// missingTabs lists sheets that reading a range of fails as the API
+	// does for a tab the spreadsheet lacks.
+	missingTabs []string
+	// probes records the ranges of write-access probes, which are kept out
+	// of written and valueRequests.
+	probes []string
+	// cleared records the ranges of every values:batchClear.
+	cleared []string
+	// appended records the rows of every values:append and appendQueries
+	// its query. Each append lands on the sheet's next row.
+	appended      []*sheets.ValueRange
+	appendQueries []url.Values
+}
+
+// isProbe reports whether req is probeWrite's single null write.
+func isProbe(req *sheets.BatchUpdateValuesRequest) bool {
+	if len(req.Data) != 1 || len(req.Data[0].Values) != 1 {
+		return false
+	}
+	row := req.Data[0].Values[0]
+	return len(row) == 1 && row[0] == nil
+}
+
+// newFakeService starts fake and returns a client pointed at it.
+func newFakeService(t testing.TB, fake *fakeSheets) *sheets.Service {
+	t.Helper()
+	if fake.cells == nil {
+		fake.cells = map[string][][]interface{}{}
+	}
+	return newHandlerService(t, fake)
+}
+
+// newHandlerService starts h and returns a client pointed at it.
+func newHandlerService(t testing.TB, h http.Handler) *sheets.Service {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	svc, err := sheets.NewService(context.Background(),
+		option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func (f *fakeSheets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := r.URL.Path
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = unescaped
+	}
+	f.requests = append(f.requests, r.Method+" "+path)
+	_, rest, _ := strings.Cut(path, "/values")
+	switch {
+	case strings.HasSuffix(path, "/values:batchUpdate") && f.writeStatus != 0:
+		writeError(w, f.writeStatus)
+	case strings.HasSuffix(path, "/values:batchUpdate"):
+		var req sheets.BatchUpdateValuesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if isProbe(&req) {
+			f.probes = append(f.probes, req.Data[0].Range)
+			writeJSON(w, sheets.BatchUpdateValuesResponse{})
+			return
+		}
+		f.valueRequests = append(f.valueRequests, &req)
+		resp := sheets.BatchUpdateValuesResponse{}
+		for _, vr := range req.Data {
+			f.written = append(f.written, vr)
+			f.cells[vr.Range] = overlay(f.cells[vr.Range], vr.Values)
+			if req.IncludeValuesInResponse {
+				resp.Responses = append(resp.Responses, &sheets.UpdateValuesResponse{
+					UpdatedRange: vr.Range,
+					UpdatedData:  &sheets.ValueRange{Range: vr.Range, Values: f.render(req.ResponseValueRenderOption, f.cells[vr.Range])},
+				})
+			}
+			resp.TotalUpdatedRows += int64(len(vr.Values))
+			for _, row := range vr.Values {
+				resp.TotalUpdatedCells += int64(len(row))
+			}
+		}
+		writeJSON(w, resp)
+	case strings.HasSuffix(path, "/values:batchClear"):
+		var req sheets.BatchClearValuesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, rng := range req.Ranges {
+			f.cleared = append(f.cleared, rng)
+			delete(f.cells, rng)
+		}
+		writeJSON(w, sheets.BatchClearValuesResponse{ClearedRanges: req.Ranges})
+	case strings.HasSuffix(path, ":batchUpdate"):
+		var req sheets.BatchUpdateSpreadsheetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.batches = append(f.batches, req.Requests...)
+		writeJSON(w, sheets.BatchUpdateSpreadsheetResponse{})
+	case strings.HasSuffix(path, "/values:batchGet"):
+		query := r.URL.Query()
+		resp := sheets.BatchGetValuesResponse{}
+		for _, rng := range query["ranges"] {
+			values := f.cells[rng]
+			if rendered, ok := f.renders[query.Get("valueRenderOption")][rng]; ok {
+				values = rendered
+			}
+			resp.ValueRanges = append(resp.ValueRanges, &sheets.ValueRange{Range: rng, Values: values})
+		}
+		writeJSON(w, resp)
+	case strings.HasSuffix(path, ":append"):
+		var vr sheets.ValueRange
+		if err := json.NewDecoder(r.Body).Decode(&vr); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sheet := sheetNameFromRange(strings.TrimSuffix(strings.TrimPrefix(rest, "/"), ":append"))
+		row := 1
+		for _, prev := range f.appended {
+			if sheetNameFromRange(prev.Range) == sheet {
+				row += len(prev.Values)
+			}
+		}
+		width := 0
+		for _, values := range vr.Values {
+			width = max(width, len(values))
+		}
+		start, _ := excelize.CoordinatesToCellName(1, row)
+		end, _ := excelize.CoordinatesToCellName(width, row+len(vr.Values)-1)
+		vr.Range = formatRange(sheet, start+":"+end)
+		f.appended = append(f.appended, &vr)
+		f.appendQueries = append(f.appendQueries, r.URL.Query())
+		writeJSON(w, sheets.AppendValuesResponse{Updates: &sheets.UpdateValuesResponse{
+			UpdatedRange: vr.Range,
+			UpdatedRows:  int64(len(vr.Values)),
+			UpdatedCells: int64(width * len(vr.Values)),
+		}})
+	case r.Method == http.MethodGet && rest == "":
+		writeJSON(w, f.meta)
+	case r.Method == http.MethodGet && strings.HasPrefix(rest, "/"):
+		rng := strings.TrimPrefix(rest, "/")
+		if f.readStatus != 0 {
+			writeError(w, f.readStatus)
+			return
+		}
+		if slices.Contains(f.missingTabs, sheetNameFromRange(rng)) {
+			writeErrorMessage(w, http.StatusBadRequest, "Unable to parse range: "+rng)
+			return
+		}
+		query := r.URL.Query()
+		f.gets = append(f.gets, query)
+		values := f.cells[rng]
+		if rendered, ok := f.renders[query.Get("valueRenderOption")][rng]; ok {
+			values = rendered
+		}
+		writeJSON(w, sheets.ValueRange{Range: rng, Values: values})
+	default:
+		http.Error(w, "unexpected request "+r.Method+" "+path, http.StatusNotImplemented)
+	}
+}
+
+// overlay writes values over current the way the API does: a null leaves
+// the cell it lands on unchanged.
+func overlay(current, values [][]interface{}) [][]interface{} {
+	out := make([][]interface{}, len(values))
+	for r, row := range values {
+		out[r] = make([]interface{}, len(row))
+		for c, v := range row {
+			if v == nil && r < len(current) && c < len(current[r]) {
+				v = current[r][c]
+			}
+			out[r][c] = v
+		}
+	}
+	return out
+}
+
+func (f *fakeSheets) render(option string, values [][]interface{}) [][]interface{} {
+	if f.echo == nil {
+		return values
+	}
+	out := make([][]interface{}, len(values))
+	for r, row := range values {
+		out[r] = make([]interface{}, len(row))
+		for c, v := range row {
+			out[r][c] = f.echo(option, v)
+		}
+	}
+	return out
+}
+
+// writes returns the ranges sent through values:batchUpdate, in order.
+func (f *fakeSheets) writes() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []string
+	for _, vr := range f.written {
+		out = append(out, vr.Range)
+	}
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers with a Google API error body carrying code.
+func writeError(w http.ResponseWriter, code int) {
+	writeErrorMessage(w, code, http.StatusText(code))
+}
+
+func writeErrorMessage(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": code, "message": msg},
+	})
+}
@@ -0,0 +1,89 @@
+package sheets
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"update-google-sheets/src/config"
+)
+
+// readImport turns a CSV of range,value rows into targets, bypassing the
+// workbook. A leading range,value header is skipped. Each range must be a
+// sheet-qualified A1 cell or rectangle; a rectangle receives the value in
+// every cell. An optional third column sets the row's value input option,
+// USER_ENTERED or RAW.
+func readImport(path string) ([]target, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open import file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	var targets []target
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+		line, _ := r.FieldPos(0)
+		if len(rec) < 2 || len(rec) > 3 {
+			return nil, fmt.Errorf("%s line %d: expected range,value or range,value,input_option; got %d fields", path, line, len(rec))
+		}
+		rng := strings.TrimSpace(strings.TrimPrefix(rec[0], "\ufeff"))
+		if len(targets) == 0 && strings.EqualFold(rng, "range") {
+			continue
+		}
+		t, err := importTarget(rng, rec[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		if len(rec) == 3 {
+			t.InputOption = strings.ToUpper(strings.TrimSpace(rec[2]))
+			if err := config.CheckInputOption(t.InputOption); err != nil {
+				return nil, fmt.Errorf("%s line %d: input option %w", path, line, err)
+			}
+		}
+		t.Anchor = fmt.Sprintf("%s line %d", path, line)
+		targets = append(targets, t)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%s holds no range,value rows", path)
+	}
+	return targets, nil
+}
+
+func importTarget(rng string, value interface{}) (target, error) {
+	sheet := sheetNameFromRange(rng)
+	if sheet == "" {
+		return target{}, fmt.Errorf("range %q must include the sheet name, e.g. Plan!B2", rng)
+	}
+	area, err := parseArea(rng[strings.LastIndex(rng, "!")+1:])
+	if err != nil {
+		return target{}, fmt.Errorf("range %q is not valid A1: %w", rng, err)
+	}
+	values := fillValues(value, area.MaxRow-area.MinRow+1, area.MaxCol-area.MinCol+1)
+	start, _ := excelize.CoordinatesToCellName(area.MinCol, area.MinRow)
+	end, _ := excelize.CoordinatesToCellName(area.MaxCol, area.MaxRow)
+	cells := start
+	if end != start {
+		cells += ":" + end
+	}
+	return target{
+		Range:  formatRange(sheet, cells),
+		Values: values,
+		Sheet:  sheet,
+		Row:    area.MinRow,
+		Col:    area.MinCol,
+	}, nil
+}
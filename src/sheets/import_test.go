@@ -0,0 +1,100 @@
+package sheets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"update-google-sheets/src/config"
+)
+
+func writeCSV(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "import.csv")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestImportPayloads(t *testing.T) {
+	path := writeCSV(t, "\ufeffrange,value\n"+
+		"Plan!B2,Alice\n"+
+		"'Week 2'!a1:b2,x\n"+
+		"Plan!C3,\"quoted, with comma\"\n")
+	fake := &fakeSheets{}
+	svc := newFakeService(t, fake)
+	fake.cells["Plan!C3"] = [][]interface{}{{"occupied"}}
+	cfg := config.Config{SpreadsheetID: "sheet-id", ImportFile: path}
+	summary, err := update(context.Background(), svc, cfg, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][][]interface{}{
+		"Plan!B2":        {{"Alice"}},
+		"'Week 2'!A1:B2": {{"x", "x"}, {"x", "x"}},
+	}
+	got := map[string][][]interface{}{}
+	for _, vr := range fake.written {
+		got[vr.Range] = vr.Values
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("payloads = %v, want %v", got, want)
+	}
+	if summary.TotalCells != 5 {
+		t.Errorf("TotalCells = %d, want 5", summary.TotalCells)
+	}
+}
+
+func TestImportRejectsBadRanges(t *testing.T) {
+	tests := []struct {
+		name, csv, wantErr string
+	}{
+		{"no sheet", "B2,x\n", `line 1: range "B2" must include the sheet name`},
+		{"not A1", "range,value\nPlan!B2,x\nPlan!2B,y\n", `line 3: range "Plan!2B" is not valid A1`},
+		{"bad input option", "Plan!B2,x,extra\n", `line 1: input option must be USER_ENTERED or RAW; got "EXTRA"`},
+		{"wrong field count", "Plan!B2,x,RAW,more\n", "expected range,value or range,value,input_option; got 4 fields"},
+		{"header only", "range,value\n", "holds no range,value rows"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readImport(writeCSV(t, tt.csv))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestImportMixedInputOptions(t *testing.T) {
+	path := writeCSV(t, "range,value\n"+
+		"Plan!A1,=SUM(B1:B3)\n"+
+		"Plan!A2,007,raw\n"+
+		"Plan!A3,=B3, USER_ENTERED\n"+
+		"Plan!A4,=literal,RAW\n")
+	fake := &fakeSheets{}
+	cfg := config.Config{SpreadsheetID: "sheet-id", ImportFile: path}
+	summary, err := update(context.Background(), newFakeService(t, fake), cfg, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]string{}
+	for _, req := range fake.valueRequests {
+		for _, vr := range req.Data {
+			got[req.ValueInputOption] = append(got[req.ValueInputOption], vr.Range)
+		}
+	}
+	want := map[string][]string{
+		config.InputUserEntered: {"Plan!A1", "Plan!A3"},
+		config.InputRaw:         {"Plan!A2", "Plan!A4"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ranges by option = %v, want %v", got, want)
+	}
+	if summary.TotalCells != 4 {
+		t.Errorf("TotalCells = %d, want 4", summary.TotalCells)
+	}
+}
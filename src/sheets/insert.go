@@ -0,0 +1,93 @@
+package sheets
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// insertRowsBeforeMatches inserts one blank row above every matched row and
+// retargets each workbook-derived target onto its freshly inserted row.
+// Inserts run bottom-up within a sheet so earlier indices stay valid.
+func insertRowsBeforeMatches(ctx context.Context, svc *sheets.Service, sheetID string, meta *spreadsheetMeta, targets []target) ([]target, error) {
+	rowsBySheet := make(map[string][]int)
+	var order []string
+	for _, t := range targets {
+		if t.Match == nil {
+			continue
+		}
+		if _, ok := rowsBySheet[t.Sheet]; !ok {
+			order = append(order, t.Sheet)
+		}
+		if !slices.Contains(rowsBySheet[t.Sheet], t.Match.Row) {
+			rowsBySheet[t.Sheet] = append(rowsBySheet[t.Sheet], t.Match.Row)
+		}
+	}
+	if len(order) == 0 {
+		return targets, nil
+	}
+
+	var requests []*sheets.Request
+	for _, sheet := range order {
+		gid, ok := meta.sheetIDByTitle(sheet)
+		if !ok {
+			return nil, tag(ErrSheetNotFound, fmt.Errorf("insert row: sheet %q not found in spreadsheet", sheet))
+		}
+		rows := rowsBySheet[sheet]
+		sort.Sort(sort.Reverse(sort.IntSlice(rows)))
+		requests = append(requests, insertRowRequests(gid, rows)...)
+	}
+	req := &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}
+	if _, err := svc.Spreadsheets.BatchUpdate(sheetID, req).Context(ctx).Do(); err != nil {
+		return nil, fmt.Errorf("insert rows failed: %w", err)
+	}
+
+	out := make([]target, 0, len(targets))
+	for _, t := range targets {
+		if t.Match != nil {
+			t.Row = insertedRow(rowsBySheet[t.Sheet], t.Match.Row)
+			rng, err := targetRange(t.Sheet, t.Row, t.Col, len(t.Values), len(t.Values[0]))
+			if err != nil {
+				return nil, fmt.Errorf("retarget %s: %w", t.Anchor, err)
+			}
+			t.Range = rng
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// insertRowRequests builds one InsertDimensionRequest per 1-based row, in the
+// order given.
+func insertRowRequests(gid int64, rows []int) []*sheets.Request {
+	requests := make([]*sheets.Request, 0, len(rows))
+	for _, row := range rows {
+		requests = append(requests, &sheets.Request{
+			InsertDimension: &sheets.InsertDimensionRequest{
+				Range: &sheets.DimensionRange{
+					SheetId:    gid,
+					Dimension:  "ROWS",
+					StartIndex: int64(row - 1),
+					EndIndex:   int64(row),
+				},
+				InheritFromBefore: row > 1,
+			},
+		})
+	}
+	return requests
+}
+
+// insertedRow returns where the row inserted above matchRow ends up once every
+// insert on the sheet has been applied.
+func insertedRow(insertedAbove []int, matchRow int) int {
+	shift := 0
+	for _, r := range insertedAbove {
+		if r < matchRow {
+			shift++
+		}
+	}
+	return matchRow + shift
+}
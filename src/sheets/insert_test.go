@@ -0,0 +1,79 @@
+package sheets
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+func TestInsertRowBeforeMatchRequestSequence(t *testing.T) {
+	path := writeWorkbook(t,
+		fixtureSheet{name: "Plan", rows: [][]string{
+			{"Week"},
+			{"TOTAL"},
+			{"x"},
+			{"TOTAL"},
+		}},
+		fixtureSheet{name: "Log", rows: [][]string{{"TOTAL"}}},
+	)
+	fake := &fakeSheets{meta: sheets.Spreadsheet{Sheets: []*sheets.Sheet{
+		{Properties: &sheets.SheetProperties{SheetId: 11, Title: "Plan"}},
+		{Properties: &sheets.SheetProperties{SheetId: 22, Title: "Log"}},
+	}}}
+	svc := newFakeService(t, fake)
+	cfg := config.Config{
+		SpreadsheetID:        "sheet-id",
+		LookupValue:          "TOTAL",
+		Workbook:             path,
+		InsertRowBeforeMatch: true,
+	}
+	if _, err := update(context.Background(), svc, cfg, Options{}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	type insert struct {
+		gid        int64
+		start, end int64
+		inherit    bool
+	}
+	var inserts []insert
+	for _, req := range fake.batches {
+		d := req.InsertDimension
+		if d == nil || d.Range.Dimension != "ROWS" {
+			t.Fatalf("unexpected request %+v", req)
+		}
+		inserts = append(inserts, insert{d.Range.SheetId, d.Range.StartIndex, d.Range.EndIndex, d.InheritFromBefore})
+	}
+	wantInserts := []insert{
+		{11, 3, 4, true},
+		{11, 1, 2, true},
+		{22, 0, 1, false},
+	}
+	if !reflect.DeepEqual(inserts, wantInserts) {
+		t.Errorf("inserts = %+v, want %+v", inserts, wantInserts)
+	}
+	// Plan rows 2 and 4 each gain a row above; the lower insert is pushed
+	// down by the upper one.
+	wantWrites := []string{"Plan!A2", "Plan!A5", "Log!A1"}
+	if got := fake.writes(); !reflect.DeepEqual(got, wantWrites) {
+		t.Errorf("writes = %v, want %v", got, wantWrites)
+	}
+}
+
+func TestInsertedRow(t *testing.T) {
+	inserted := []int{9, 4, 2}
+	tests := []struct{ match, want int }{
+		{2, 2},
+		{4, 5},
+		{9, 11},
+	}
+	for _, tt := range tests {
+		if got := insertedRow(inserted, tt.match); got != tt.want {
+			t.Errorf("insertedRow(%d) = %d, want %d", tt.match, got, tt.want)
+		}
+	}
+}
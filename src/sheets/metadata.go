@@ -0,0 +1,228 @@
+package sheets
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+// spreadsheetMeta holds the parts of the spreadsheet metadata used while planning writes.
+type spreadsheetMeta struct {
+	sheets      map[int64]*sheets.SheetProperties
+	namedRanges map[string]*sheets.NamedRange
+}
+
+func fetchMetadata(ctx context.Context, svc *sheets.Service, sheetID string) (*spreadsheetMeta, error) {
+	resp, err := svc.Spreadsheets.Get(sheetID).
+		Fields("sheets.properties", "namedRanges").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("fetch spreadsheet metadata: %w", err)
+	}
+	meta := &spreadsheetMeta{
+		sheets:      make(map[int64]*sheets.SheetProperties),
+		namedRanges: make(map[string]*sheets.NamedRange),
+	}
+	for _, sh := range resp.Sheets {
+		if sh.Properties != nil {
+			meta.sheets[sh.Properties.SheetId] = sh.Properties
+		}
+	}
+	for _, nr := range resp.NamedRanges {
+		meta.namedRanges[nr.Name] = nr
+	}
+	return meta, nil
+}
+
+// resolveNamedRanges turns named range names into A1 targets carrying value
+// in every cell, so a block such as a 3x3 named range is filled whole.
+func resolveNamedRanges(meta *spreadsheetMeta, names []string, value interface{}) ([]target, error) {
+	var targets []target
+	for _, name := range names {
+		nr, ok := meta.namedRanges[name]
+		if !ok {
+			return nil, fmt.Errorf("named range %q not found; defined names: %s", name, strings.Join(meta.namedRangeNames(), ", "))
+		}
+		rng, rows, cols, err := meta.gridRangeToA1(nr.Range)
+		if err != nil {
+			return nil, fmt.Errorf("resolve named range %q: %w", name, err)
+		}
+		targets = append(targets, target{Range: rng, Values: fillValues(value, rows, cols)})
+	}
+	return targets, nil
+}
+
+func (m *spreadsheetMeta) sheetIDByTitle(title string) (int64, bool) {
+	for id, props := range m.sheets {
+		if props.Title == title {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func (m *spreadsheetMeta) namedRangeNames() []string {
+	names := make([]string, 0, len(m.namedRanges))
+	for name := range m.namedRanges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return []string{"(none)"}
+	}
+	return names
+}
+
+// gridRangeToA1 converts a GridRange into an A1 range and its size in rows
+// and columns. Unbounded edges are clamped to the sheet's current grid size.
+func (m *spreadsheetMeta) gridRangeToA1(gr *sheets.GridRange) (string, int, int, error) {
+	if gr == nil {
+		return "", 0, 0, fmt.Errorf("missing grid range")
+	}
+	props, ok := m.sheets[gr.SheetId]
+	if !ok {
+		return "", 0, 0, fmt.Errorf("sheet id %d not found", gr.SheetId)
+	}
+	endRow, endCol := gr.EndRowIndex, gr.EndColumnIndex
+	if props.GridProperties != nil {
+		if endRow == 0 {
+			endRow = props.GridProperties.RowCount
+		}
+		if endCol == 0 {
+			endCol = props.GridProperties.ColumnCount
+		}
+	}
+	rows, cols := max(int(endRow-gr.StartRowIndex), 1), max(int(endCol-gr.StartColumnIndex), 1)
+	start, err := excelize.CoordinatesToCellName(int(gr.StartColumnIndex)+1, int(gr.StartRowIndex)+1)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if rows == 1 && cols == 1 {
+		return formatRange(props.Title, start), 1, 1, nil
+	}
+	end, err := excelize.CoordinatesToCellName(int(endCol), int(endRow))
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return formatRange(props.Title, start+":"+end), rows, cols, nil
+}
+
+// checkGrid fails when a workbook-derived target reaches past the rows or
+// columns its sheet currently has, since the values API does not grow the
+// grid. Sheets missing from meta are left to fail when their values are
+// fetched.
+func (m *spreadsheetMeta) checkGrid(targets []target) error {
+	var outside []string
+	for _, t := range targets {
+		if t.Match == nil || len(t.Values) == 0 {
+			continue
+		}
+		gid, ok := m.sheetIDByTitle(t.Sheet)
+		if !ok || m.sheets[gid].GridProperties == nil {
+			continue
+		}
+		grid := m.sheets[gid].GridProperties
+		lastRow, lastCol := t.Row+len(t.Values)-1, t.Col+len(t.Values[0])-1
+		if int64(lastRow) > grid.RowCount || int64(lastCol) > grid.ColumnCount {
+			outside = append(outside, fmt.Sprintf("%s (sheet has %d rows, %d columns)", t.Range, grid.RowCount, grid.ColumnCount))
+		}
+	}
+	if len(outside) > 0 {
+		return fmt.Errorf("%d target(s) extend past the sheet grid; add rows or columns in Google Sheets or shrink target_block_rows/target_block_cols: %s", len(outside), strings.Join(outside, "; "))
+	}
+	return nil
+}
+
+// resolveTabGIDs returns cfg with the gid: references of append_sheet and
+// touch_cell replaced by the tabs' current titles. It only fetches the
+// metadata when there is a gid to resolve.
+func resolveTabGIDs(ctx context.Context, svc *sheets.Service, cfg config.Config) (config.Config, error) {
+	appendGID, inAppend, _ := config.TabGID(cfg.AppendSheet)
+	var (
+		touchSheet, touchCell string
+		touchGID              int64
+		inTouch               bool
+	)
+	if i := strings.LastIndex(cfg.TouchCell, "!"); i >= 0 {
+		// sheet_maps may have renamed the sheet to a quoted gid:<number>.
+		touchSheet, touchCell = sheetNameFromRange(cfg.TouchCell), cfg.TouchCell[i+1:]
+		touchGID, inTouch, _ = config.TabGID(touchSheet)
+	}
+	if !inAppend && !inTouch {
+		return cfg, nil
+	}
+	meta, err := fetchMetadata(ctx, svc, cfg.SpreadsheetID)
+	if err != nil {
+		return cfg, err
+	}
+	if inAppend {
+		if cfg.AppendSheet, err = meta.titleByGID(appendGID, cfg.SpreadsheetID); err != nil {
+			return cfg, fmt.Errorf("append_sheet: %w", err)
+		}
+	}
+	if inTouch {
+		title, err := meta.titleByGID(touchGID, cfg.SpreadsheetID)
+		if err != nil {
+			return cfg, fmt.Errorf("touch_cell: %w", err)
+		}
+		cfg.TouchCell = formatRange(title, touchCell)
+	}
+	return cfg, nil
+}
+
+// onGIDTabs reports whether any target names its tab as gid:<number>.
+func onGIDTabs(targets []target) bool {
+	for _, t := range targets {
+		if strings.HasPrefix(t.Sheet, config.GIDPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTargetGIDs returns targets with those on a gid:<number> tab, from
+// sheet_maps or default_tab_from_url, moved to the tab's current title.
+func (m *spreadsheetMeta) resolveTargetGIDs(targets []target, spreadsheetID string) ([]target, error) {
+	out := make([]target, len(targets))
+	for i, t := range targets {
+		gid, ok, err := config.TabGID(t.Sheet)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			title, err := m.titleByGID(gid, spreadsheetID)
+			if err != nil {
+				return nil, err
+			}
+			t.Range = formatRange(title, t.Range[strings.LastIndex(t.Range, "!")+1:])
+			t.Sheet = title
+		}
+		out[i] = t
+	}
+	return out, nil
+}
+
+// titleByGID returns the title of the tab with the given gid, or an error
+// listing every tab's gid and title.
+func (m *spreadsheetMeta) titleByGID(gid int64, spreadsheetID string) (string, error) {
+	if props, ok := m.sheets[gid]; ok {
+		return props.Title, nil
+	}
+	ids := make([]int64, 0, len(m.sheets))
+	for id := range m.sheets {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return m.sheets[ids[i]].Index < m.sheets[ids[j]].Index })
+	tabs := make([]string, len(ids))
+	for i, id := range ids {
+		tabs[i] = fmt.Sprintf("%d (%s)", id, m.sheets[id].Title)
+	}
+	return "", tag(ErrSheetNotFound, fmt.Errorf("no tab with gid %d in spreadsheet %s; tabs: %s", gid, spreadsheetID, strings.Join(tabs, ", ")))
+}
@@ -0,0 +1,249 @@
+package sheets
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+func testMeta() *spreadsheetMeta {
+	return &spreadsheetMeta{
+		sheets: map[int64]*sheets.SheetProperties{
+			7: {SheetId: 7, Title: "Grid", GridProperties: &sheets.GridProperties{RowCount: 10, ColumnCount: 4}},
+		},
+		namedRanges: map[string]*sheets.NamedRange{
+			"Single": {Name: "Single", Range: &sheets.GridRange{SheetId: 7, StartRowIndex: 1, EndRowIndex: 2, StartColumnIndex: 1, EndColumnIndex: 2}},
+			"Block":  {Name: "Block", Range: &sheets.GridRange{SheetId: 7, StartRowIndex: 0, EndRowIndex: 3, StartColumnIndex: 0, EndColumnIndex: 3}},
+			"Column": {Name: "Column", Range: &sheets.GridRange{SheetId: 7, StartRowIndex: 8, StartColumnIndex: 3, EndColumnIndex: 4}},
+		},
+	}
+}
+
+func TestResolveNamedRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   string
+		values [][]interface{}
+	}{
+		{"Single", "Grid!B2", [][]interface{}{{"x"}}},
+		{"Block", "Grid!A1:C3", [][]interface{}{{"x", "x", "x"}, {"x", "x", "x"}, {"x", "x", "x"}}},
+		{"Column", "Grid!D9:D10", [][]interface{}{{"x"}, {"x"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveNamedRanges(testMeta(), []string{tt.name}, "x")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got[0].Range != tt.want || !reflect.DeepEqual(got[0].Values, tt.values) {
+				t.Errorf("target = %s %v, want %s %v", got[0].Range, got[0].Values, tt.want, tt.values)
+			}
+		})
+	}
+	if _, err := resolveNamedRanges(testMeta(), []string{"Missing"}, "x"); err == nil {
+		t.Error("unknown named range resolved without error")
+	}
+}
+
+func TestMultiCellNamedRangeSkipsPopulatedCells(t *testing.T) {
+	meta := testMeta()
+	fake := &fakeSheets{
+		meta: sheets.Spreadsheet{
+			Sheets:      []*sheets.Sheet{{Properties: meta.sheets[7]}},
+			NamedRanges: []*sheets.NamedRange{meta.namedRanges["Block"]},
+		},
+		cells: map[string][][]interface{}{
+			"Grid!A1:C3": {{"", "kept"}, {}, {"", "", "also kept"}},
+		},
+	}
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Bob"}}})
+	cfg := config.Config{
+		SpreadsheetID:     "sheet-id",
+		LookupValue:       "Alice",
+		Workbook:          path,
+		NamedRangeTargets: []string{"Block"},
+	}
+	if _, err := update(context.Background(), newFakeService(t, fake), cfg, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]interface{}{
+		{"Alice", "kept", "Alice"},
+		{"Alice", "Alice", "Alice"},
+		{"Alice", "Alice", "also kept"},
+	}
+	if got := fake.cells["Grid!A1:C3"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("block = %v, want %v", got, want)
+	}
+	// Kept cells go out as null so the API leaves them, formulas and all.
+	sent := [][]interface{}{
+		{"Alice", nil, "Alice"},
+		{"Alice", "Alice", "Alice"},
+		{"Alice", "Alice", nil},
+	}
+	if len(fake.written) != 1 || !reflect.DeepEqual(fake.written[0].Values, sent) {
+		t.Errorf("sent %v, want %v", fake.written, sent)
+	}
+}
+
+func gidSpreadsheet(tabs map[int64]string) sheets.Spreadsheet {
+	var s sheets.Spreadsheet
+	for gid, title := range tabs {
+		s.Sheets = append(s.Sheets, &sheets.Sheet{Properties: &sheets.SheetProperties{SheetId: gid, Title: title, Index: gid}})
+	}
+	return s
+}
+
+func TestResolveTabGIDs(t *testing.T) {
+	tests := []struct {
+		name       string
+		tabs       map[int64]string
+		cfg        config.Config
+		wantAppend string
+		wantTouch  string
+		wantErr    []string
+	}{
+		{
+			name: "append_sheet", tabs: map[int64]string{7: "Log", 9: "Meta"},
+			cfg:        config.Config{AppendSheet: "gid:7", TouchCell: "Meta!B1"},
+			wantAppend: "Log", wantTouch: "Meta!B1",
+		},
+		{
+			name: "touch_cell", tabs: map[int64]string{7: "Log", 9: "Meta"},
+			cfg:        config.Config{AppendSheet: "Log", TouchCell: "gid:9!B1"},
+			wantAppend: "Log", wantTouch: "Meta!B1",
+		},
+		{
+			name: "renamed tab", tabs: map[int64]string{7: "Log 2026", 9: "Run info"},
+			cfg:        config.Config{AppendSheet: "gid:7", TouchCell: "'gid:9'!B1"},
+			wantAppend: "Log 2026", wantTouch: "'Run info'!B1",
+		},
+		{
+			name: "unknown gid", tabs: map[int64]string{7: "Log", 9: "Meta"},
+			cfg:     config.Config{AppendSheet: "gid:8"},
+			wantErr: []string{"append_sheet", "no tab with gid 8", "7 (Log), 9 (Meta)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSheets{meta: gidSpreadsheet(tt.tabs)}
+			tt.cfg.SpreadsheetID = "sheet-id"
+			got, err := resolveTabGIDs(context.Background(), newFakeService(t, fake), tt.cfg)
+			if tt.wantErr != nil {
+				if !errors.Is(err, ErrSheetNotFound) {
+					t.Fatalf("err = %v, want ErrSheetNotFound", err)
+				}
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("err = %v, want it to mention %q", err, want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.AppendSheet != tt.wantAppend || got.TouchCell != tt.wantTouch {
+				t.Errorf("append_sheet, touch_cell = %q, %q, want %q, %q", got.AppendSheet, got.TouchCell, tt.wantAppend, tt.wantTouch)
+			}
+		})
+	}
+}
+
+func TestResolveTabGIDsSkipsMetadataWithoutGID(t *testing.T) {
+	fake := &fakeSheets{}
+	cfg := config.Config{SpreadsheetID: "sheet-id", AppendSheet: "Log", TouchCell: "Meta!B1"}
+	if _, err := resolveTabGIDs(context.Background(), newFakeService(t, fake), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("requests = %v, want none", fake.requests)
+	}
+}
+
+func TestUpdateWritesToGIDTabs(t *testing.T) {
+	path := writeWorkbook(t,
+		fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}},
+		fixtureSheet{name: "Notes", rows: [][]string{{"Alice"}}},
+	)
+	tabs := map[int64]string{42: "Week 1 (renamed)", 43: "Notes"}
+	t.Run("sheet_maps", func(t *testing.T) {
+		fake := &fakeSheets{cells: map[string][][]interface{}{}, meta: gidSpreadsheet(tabs)}
+		cfg := config.Config{
+			SpreadsheetIDs: []string{"s1"},
+			SheetMaps:      map[string]map[string]string{"s1": {"Plan": "gid:42"}},
+			LookupValue:    "Alice", WriteValue: "Done", TargetColOffset: 1, Workbook: path,
+		}
+		results, err := UpdateEach(context.Background(), newHandlerService(t, fakeSpreadsheets{"s1": fake}), cfg, Options{})
+		if err != nil || results[0].Err != nil {
+			t.Fatalf("UpdateEach = %v, %v", err, results[0].Err)
+		}
+		want := []string{"'Week 1 (renamed)'!B1", "Notes!B1"}
+		if got := fake.writes(); !reflect.DeepEqual(got, want) {
+			t.Errorf("writes = %v, want %v", got, want)
+		}
+	})
+	t.Run("default_tab_from_url", func(t *testing.T) {
+		fake := &fakeSheets{cells: map[string][][]interface{}{}, meta: gidSpreadsheet(tabs)}
+		cfg := config.Config{
+			SpreadsheetID:     "https://docs.google.com/spreadsheets/d/sheet-id/edit#gid=42",
+			DefaultTabFromURL: true,
+			SheetFilter:       config.SheetList{"Plan"},
+			LookupValue:       "Alice", WriteValue: "Done", TargetColOffset: 1, Workbook: path,
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := UpdateWithService(context.Background(), newFakeService(t, fake), cfg, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"'Week 1 (renamed)'!B1"}
+		if got := fake.writes(); !reflect.DeepEqual(got, want) {
+			t.Errorf("writes = %v, want %v", got, want)
+		}
+	})
+	t.Run("default_tab_from_url with sheet_maps", func(t *testing.T) {
+		fake := &fakeSheets{cells: map[string][][]interface{}{}, meta: gidSpreadsheet(tabs)}
+		cfg := config.Config{
+			SpreadsheetIDs:    []string{"https://docs.google.com/spreadsheets/d/s1/edit#gid=42"},
+			SheetMaps:         map[string]map[string]string{"s1": {"Plan": "gid:43"}},
+			DefaultTabFromURL: true,
+			LookupValue:       "Alice", WriteValue: "Done", TargetColOffset: 2, Workbook: path,
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		results, err := UpdateEach(context.Background(), newHandlerService(t, fakeSpreadsheets{"s1": fake}), cfg, Options{})
+		if err != nil || results[0].Err != nil {
+			t.Fatalf("UpdateEach = %v, %v", err, results[0].Err)
+		}
+		// Plan is mapped; Notes, which sheet_maps leaves alone, goes to the URL's tab.
+		want := []string{"Notes!C1", "'Week 1 (renamed)'!C1"}
+		if got := fake.writes(); !reflect.DeepEqual(got, want) {
+			t.Errorf("writes = %v, want %v", got, want)
+		}
+	})
+	t.Run("unknown gid", func(t *testing.T) {
+		fake := &fakeSheets{cells: map[string][][]interface{}{}, meta: gidSpreadsheet(tabs)}
+		cfg := config.Config{
+			SpreadsheetIDs: []string{"s1"},
+			SheetMaps:      map[string]map[string]string{"s1": {"Plan": "gid:99"}},
+			LookupValue:    "Alice", WriteValue: "Done", TargetColOffset: 1, Workbook: path,
+		}
+		results, err := UpdateEach(context.Background(), newHandlerService(t, fakeSpreadsheets{"s1": fake}), cfg, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := results[0].Err; !errors.Is(err, ErrSheetNotFound) || !strings.Contains(err.Error(), "42 (Week 1 (renamed)), 43 (Notes)") {
+			t.Errorf("err = %v, want ErrSheetNotFound listing the tabs", err)
+		}
+		if got := fake.writes(); len(got) != 0 {
+			t.Errorf("writes = %v, want none", got)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package sheets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+// applyNumberFormat sets cfg.NumberFormat on every changed cell that was
+// written as a number, with one RepeatCell request per cell limited to the
+// numberFormat field, and returns how many cells it formatted. Text
+// values, including numbers typed as strings, are left alone.
+func applyNumberFormat(ctx context.Context, svc *sheets.Service, cfg config.Config, changes []cellChange) (int, error) {
+	if cfg.NumberFormat == "" {
+		return 0, nil
+	}
+	var numeric []cellChange
+	for _, ch := range changes {
+		if isNumeric(ch.After) {
+			numeric = append(numeric, ch)
+		}
+	}
+	if len(numeric) == 0 {
+		return 0, nil
+	}
+	meta, err := fetchMetadata(ctx, svc, cfg.SpreadsheetID)
+	if err != nil {
+		return 0, fmt.Errorf("number format: %w", err)
+	}
+	sheetIDs := make(map[string]int64)
+	for id, props := range meta.sheets {
+		sheetIDs[props.Title] = id
+	}
+	requests := make([]*sheets.Request, 0, len(numeric))
+	for _, ch := range numeric {
+		sheet := sheetNameFromRange(ch.Cell)
+		id, ok := sheetIDs[sheet]
+		if !ok {
+			return 0, tag(ErrSheetNotFound, fmt.Errorf("number format: sheet %q not found in spreadsheet", sheet))
+		}
+		col, row, err := excelize.CellNameToCoordinates(ch.Cell[strings.LastIndex(ch.Cell, "!")+1:])
+		if err != nil {
+			return 0, fmt.Errorf("number format: cell %s: %w", ch.Cell, err)
+		}
+		requests = append(requests, &sheets.Request{RepeatCell: &sheets.RepeatCellRequest{
+			Range: &sheets.GridRange{
+				SheetId:          id,
+				StartRowIndex:    int64(row - 1),
+				EndRowIndex:      int64(row),
+				StartColumnIndex: int64(col - 1),
+				EndColumnIndex:   int64(col),
+				ForceSendFields:  []string{"SheetId", "StartRowIndex", "StartColumnIndex"},
+			},
+			Cell: &sheets.CellData{UserEnteredFormat: &sheets.CellFormat{
+				NumberFormat: &sheets.NumberFormat{Type: "NUMBER", Pattern: cfg.NumberFormat},
+			}},
+			Fields: "userEnteredFormat.numberFormat",
+		}})
+	}
+	batch := &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}
+	if _, err := svc.Spreadsheets.BatchUpdate(cfg.SpreadsheetID, batch).Context(ctx).Do(); err != nil {
+		return 0, fmt.Errorf("apply number format failed: %w", err)
+	}
+	return len(requests), nil
+}
+
+// isNumeric reports whether v is sent to the API as a JSON number.
+func isNumeric(v interface{}) bool {
+	switch v.(type) {
+	case float64, float32, int, int64, int32:
+		return true
+	}
+	return false
+}
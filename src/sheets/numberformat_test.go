@@ -0,0 +1,68 @@
+package sheets
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+func TestNumberFormatRoundTrip(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}, {""}, {"Alice"}}})
+	tests := []struct {
+		name       string
+		cfg        config.Config
+		wantValue  interface{}
+		wantFormat int
+	}{
+		{"user entered number", config.Config{WriteType: "number", WriteValue: "12.5", NumberFormat: "#,##0.00"}, 12.5, 2},
+		{"raw number", config.Config{WriteType: "number", WriteValue: "12.5", NumberFormat: "#,##0.00", ValueInputOption: config.InputRaw}, 12.5, 2},
+		{"decimal comma", config.Config{WriteType: "number", WriteValue: "1.234,50", DecimalComma: true, NumberFormat: "0.0"}, 1234.5, 2},
+		{"raw decimal comma", config.Config{WriteType: "number", WriteValue: "12,5", DecimalComma: true, NumberFormat: "0.0", ValueInputOption: config.InputRaw}, 12.5, 2},
+		{"string write is not formatted", config.Config{WriteValue: "12.5", NumberFormat: "0.0"}, "12.5", 0},
+		{"no number format", config.Config{WriteType: "number", WriteValue: "12.5"}, 12.5, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSheets{meta: sheets.Spreadsheet{Sheets: []*sheets.Sheet{
+				{Properties: &sheets.SheetProperties{SheetId: 4, Title: "Plan"}},
+			}}}
+			cfg := tt.cfg
+			cfg.SpreadsheetID, cfg.LookupValue, cfg.Workbook = "sheet-id", "Alice", path
+			summary, err := update(context.Background(), newFakeService(t, fake), cfg, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fake.valueRequests) != 1 {
+				t.Fatalf("value requests = %d, want 1", len(fake.valueRequests))
+			}
+			req := fake.valueRequests[0]
+			if req.ValueInputOption != cfg.InputOption() {
+				t.Errorf("value input option = %q, want %q", req.ValueInputOption, cfg.InputOption())
+			}
+			for _, vr := range req.Data {
+				if got := vr.Values[0][0]; got != tt.wantValue {
+					t.Errorf("%s = %#v, want %#v", vr.Range, got, tt.wantValue)
+				}
+			}
+			if summary.NumberFormatted != tt.wantFormat || len(fake.batches) != tt.wantFormat {
+				t.Fatalf("formatted %d cells with %d requests, want %d", summary.NumberFormatted, len(fake.batches), tt.wantFormat)
+			}
+			for i, wantRow := range []int64{0, 2}[:tt.wantFormat] {
+				rc := fake.batches[i].RepeatCell
+				if rc == nil {
+					t.Fatalf("request %d = %+v, want RepeatCell", i, fake.batches[i])
+				}
+				r := rc.Range
+				if r.SheetId != 4 || r.StartRowIndex != wantRow || r.EndRowIndex != wantRow+1 || r.StartColumnIndex != 0 || r.EndColumnIndex != 1 {
+					t.Errorf("request %d range = %+v, want Plan row %d column A", i, r, wantRow)
+				}
+				if rc.Fields != "userEnteredFormat.numberFormat" || rc.Cell.UserEnteredFormat.NumberFormat.Pattern != cfg.NumberFormat {
+					t.Errorf("request %d sets %q to %+v", i, rc.Fields, rc.Cell.UserEnteredFormat.NumberFormat)
+				}
+			}
+		})
+	}
+}
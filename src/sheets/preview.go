@@ -0,0 +1,236 @@
+package sheets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+// Confirmer is shown a one-line preview before anything is written and
+// returns false to abort the run without writing.
+type Confirmer func(preview string) (bool, error)
+
+// Options tune a single run beyond what config.Config describes.
+type Options struct {
+	// Confirm, when set, is asked before the first write.
+	Confirm Confirmer
+	// Review, when set, is asked about each range after Confirm, in write
+	// and sync modes, and only the ranges it approves are written.
+	Review Reviewer
+	// DryRun plans the run, including the precondition fetches, but stops
+	// before the first write.
+	DryRun bool
+	// CheckWrite makes a dry run probe write access with a no-op write.
+	CheckWrite bool
+	// InPlace makes pull mode overwrite the workbook instead of saving a
+	// <name>.updated.xlsx copy next to it.
+	InPlace bool
+	// Report, when set, receives a CSV reconciliation of every target cell
+	// against Google Sheets and the run writes nothing.
+	Report io.Writer
+	// Workbook, when set, is scanned instead of the file at cfg.Workbook.
+	Workbook *Workbook
+	// Source, when set, supplies the ranges and values to write instead
+	// of the workbook scan, import_file or ranges_from.
+	Source ValueSource
+	// Check compares every target cell with Google Sheets, as sync mode
+	// would before writing, and reports discrepancies without writing.
+	Check bool
+	// Reprocess ignores state_file entries, so lookup values already
+	// written are written again.
+	Reprocess bool
+	// EmitRanges, when set, receives the run's target ranges as JSON that
+	// a later run can load through ranges_from.
+	EmitRanges io.Writer
+	// ResponseOut, when set, receives the Sheets API response to the run's
+	// value writes as JSON, including the values echoed for each range.
+	ResponseOut io.Writer
+	// Retries, when set, retries transient API errors within its budget.
+	// It applies to services built by NewService.
+	Retries *RetryBudget
+	// Clock, when set, times the API requests of services built by
+	// NewService, for Summary.APIDuration.
+	Clock *APIClock
+	// Trace, when set, records each API request of services built by
+	// NewService, retries included, for Summary.APICalls.
+	Trace *APITrace
+
+	// derived, when set, holds targets already derived for another
+	// spreadsheet of spreadsheet_ids, used instead of deriving them again.
+	derived *derivation
+	// configHash fingerprints the config before its templates were
+	// expanded, for state_file entries.
+	configHash string
+	// expected, when set, is the dry run whose planned writes this run
+	// must repeat before it may write.
+	expected *Summary
+	// expandAt, when set, is the instant templates are expanded at
+	// instead of the run's start, so {{time}} repeats its dry run's value.
+	expandAt time.Time
+}
+
+// ExpectPlanned returns opts for a run that writes only what planned, the
+// summary of a dry run of the same config, planned to write. A run whose
+// ranges or values differ fails with ErrPlanChanged before the
+// confirmation prompt, writing nothing. Templates such as {{time}} expand
+// to the values they had in planned.
+func ExpectPlanned(opts Options, planned Summary) Options {
+	opts.expected = &planned
+	opts.expandAt = planned.expandedAt
+	return opts
+}
+
+// readOnly reports whether the run only reads, whatever the mode.
+func (o Options) readOnly() bool {
+	return o.Report != nil || o.Check
+}
+
+// RequiredScope returns the narrowest OAuth scope the run needs. Plain dry
+// runs, reports and checks only read, so they authenticate read-only;
+// anything that may write, including the dry-run write probe, needs the
+// full spreadsheets scope.
+func RequiredScope(opts Options) string {
+	if (opts.DryRun && !opts.CheckWrite) || opts.readOnly() {
+		return sheets.SpreadsheetsReadonlyScope
+	}
+	return sheets.SpreadsheetsScope
+}
+
+const declinedReason = "declined at confirmation prompt"
+
+// gate records preview and the planned writes on summary and decides
+// whether the run may write. Dry runs stop here (after the optional write
+// probe against probeRange); a declined confirmation is reported as a skip
+// rather than an error. Confirmed runs then probe write access, so a
+// read-only share fails up front with a hint rather than on the first
+// real write. Pull runs write the workbook, not the spreadsheet, and are
+// never probed.
+func (o Options) gate(ctx context.Context, svc *sheets.Service, cfg config.Config, probeRange, preview string, planned []*sheets.ValueRange, summary *Summary) (bool, error) {
+	summary.Preview = preview
+	summary.planned = planned
+	probe := cfg.Mode != config.ModePull
+	if o.DryRun {
+		summary.DryRun = true
+		if o.CheckWrite && probe {
+			if err := probeWrite(ctx, svc, cfg.SpreadsheetID, probeRange); err != nil {
+				return false, err
+			}
+			summary.WriteChecked = true
+		}
+		return false, nil
+	}
+	if o.expected != nil {
+		if diff := planDiff(o.expected.planned, planned); diff != "" {
+			return false, fmt.Errorf("%w: %s", ErrPlanChanged, diff)
+		}
+	}
+	if o.Confirm != nil {
+		ok, err := o.Confirm(preview)
+		if err != nil {
+			return false, fmt.Errorf("confirmation: %w", err)
+		}
+		if !ok {
+			summary.SkippedReason = declinedReason
+			return false, nil
+		}
+	}
+	if !probe {
+		return true, nil
+	}
+	if err := probeWrite(ctx, svc, cfg.SpreadsheetID, probeRange); err != nil {
+		return false, err
+	}
+	summary.WriteChecked = true
+	return true, nil
+}
+
+// planDiff describes the first difference between the planned writes and
+// got, or returns "" when they match.
+func planDiff(planned, got []*sheets.ValueRange) string {
+	for i := range max(len(planned), len(got)) {
+		switch {
+		case i >= len(planned):
+			return fmt.Sprintf("%s was not planned", got[i].Range)
+		case i >= len(got):
+			return fmt.Sprintf("%s is no longer written", planned[i].Range)
+		case planned[i].Range != got[i].Range:
+			return fmt.Sprintf("planned %s, now %s", planned[i].Range, got[i].Range)
+		case !reflect.DeepEqual(planned[i].Values, got[i].Values):
+			return fmt.Sprintf("%s planned %s, now %s", got[i].Range, jsonText(planned[i].Values), jsonText(got[i].Values))
+		}
+	}
+	return ""
+}
+
+// jsonText renders values as the API is sent them, so 2 and "2" differ.
+func jsonText(values [][]interface{}) string {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Sprint(values)
+	}
+	return string(b)
+}
+
+// plannedRanges lists ranges as planned writes without values, for runs
+// such as clears whose values are implied.
+func plannedRanges(ranges []string) []*sheets.ValueRange {
+	planned := make([]*sheets.ValueRange, len(ranges))
+	for i, rng := range ranges {
+		planned[i] = &sheets.ValueRange{Range: rng}
+	}
+	return planned
+}
+
+// plannedTargets lists the ranges and values of targets as planned writes.
+func plannedTargets(targets []target) []*sheets.ValueRange {
+	planned := make([]*sheets.ValueRange, len(targets))
+	for i, t := range targets {
+		planned[i] = &sheets.ValueRange{Range: t.Range, Values: t.Values}
+	}
+	return planned
+}
+
+// probeWrite sends a write whose only value is null, which the API skips,
+// so it exercises write permission without changing any cell.
+func probeWrite(ctx context.Context, svc *sheets.Service, sheetID, rng string) error {
+	req := &sheets.BatchUpdateValuesRequest{
+		ValueInputOption: "RAW",
+		Data: []*sheets.ValueRange{{
+			Range:  rng,
+			Values: [][]interface{}{{nil}},
+		}},
+	}
+	_, err := svc.Spreadsheets.Values.BatchUpdate(sheetID, req).Context(ctx).Do()
+	if err == nil {
+		return nil
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && (apiErr.Code == http.StatusForbidden || apiErr.Code == http.StatusUnauthorized) && !quotaProjectDenied(apiErr) {
+		return tag(ErrNoWriteAccess, fmt.Errorf("no write access to %s (share it as Editor with the account running the updater, and use the spreadsheets scope): %w", sheetID, err))
+	}
+	return fmt.Errorf("write check failed on %s: %w", rng, err)
+}
+
+// previewLine renders e.g. "About to write 12 cells across 3 sheets in spreadsheet XYZ."
+func previewLine(verb string, cells int, ranges []string, spreadsheetID string) string {
+	sheetCount := len(uniqueSheetNames(ranges))
+	return fmt.Sprintf("About to %s %s across %s in spreadsheet %s.",
+		verb, plural(cells, "cell"), plural(sheetCount, "sheet"), spreadsheetID)
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,347 @@
+package sheets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+func TestPreviewLine(t *testing.T) {
+	tests := []struct {
+		name   string
+		verb   string
+		cells  int
+		ranges []string
+		want   string
+	}{
+		{
+			name:   "several sheets",
+			verb:   "write",
+			cells:  12,
+			ranges: []string{"Plan!A1:D1", "Plan!B4", "'Week 2'!C3", "Log!A1"},
+			want:   "About to write 12 cells across 3 sheets in spreadsheet XYZ.",
+		},
+		{
+			name:   "singular",
+			verb:   "clear",
+			cells:  1,
+			ranges: []string{"Plan!A1"},
+			want:   "About to clear 1 cell across 1 sheet in spreadsheet XYZ.",
+		},
+		{
+			name: "nothing",
+			verb: "write",
+			want: "About to write 0 cells across 0 sheets in spreadsheet XYZ.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := previewLine(tt.verb, tt.cells, tt.ranges, "XYZ"); got != tt.want {
+				t.Errorf("previewLine = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfirmPreviewFromPayloads(t *testing.T) {
+	path := writeWorkbook(t,
+		fixtureSheet{name: "Plan", rows: [][]string{{"Alice", "x", "y"}, {"Alice"}}},
+		fixtureSheet{name: "Log", rows: [][]string{{"Alice"}}},
+	)
+	tests := []struct {
+		name    string
+		answer  bool
+		writes  int
+		skipped string
+	}{
+		{"accepted", true, 3, ""},
+		{"declined", false, 0, "declined at confirmation prompt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSheets{}
+			svc := newFakeService(t, fake)
+			// Plan!B1 already holds data, so only two of its three cells change.
+			fake.cells["Plan!A1:C1"] = [][]interface{}{{"", "kept", ""}}
+			cfg := config.Config{SpreadsheetID: "XYZ", LookupValue: "Alice", Workbook: path, WriteToRowEnd: true}
+			var shown string
+			confirm := Confirmer(func(preview string) (bool, error) {
+				shown = preview
+				return tt.answer, nil
+			})
+			summary, err := update(context.Background(), svc, cfg, Options{Confirm: confirm})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "About to write 4 cells across 2 sheets in spreadsheet XYZ."
+			if shown != want || summary.Preview != want {
+				t.Errorf("preview = %q (summary %q), want %q", shown, summary.Preview, want)
+			}
+			if got := len(fake.writes()); got != tt.writes {
+				t.Errorf("wrote %d ranges, want %d", got, tt.writes)
+			}
+			if summary.SkippedReason != tt.skipped {
+				t.Errorf("SkippedReason = %q, want %q", summary.SkippedReason, tt.skipped)
+			}
+		})
+	}
+}
+
+func TestDryRunWriteProbe(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	tests := []struct {
+		name        string
+		checkWrite  bool
+		writeStatus int
+		wantErr     string
+		wantChecked bool
+		wantProbes  int
+	}{
+		{name: "plain dry run never writes"},
+		{name: "probe succeeds", checkWrite: true, wantChecked: true, wantProbes: 1},
+		{name: "read-only credentials", checkWrite: true, writeStatus: http.StatusForbidden, wantErr: "no write access to XYZ"},
+		{name: "other failure", checkWrite: true, writeStatus: http.StatusInternalServerError, wantErr: "write check failed on Plan!A1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSheets{writeStatus: tt.writeStatus}
+			svc := newFakeService(t, fake)
+			cfg := config.Config{SpreadsheetID: "XYZ", LookupValue: "Alice", Workbook: path}
+			summary, err := update(context.Background(), svc, cfg, Options{DryRun: true, CheckWrite: tt.checkWrite})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !summary.DryRun || summary.WriteChecked != tt.wantChecked {
+				t.Errorf("DryRun = %v, WriteChecked = %v, want true, %v", summary.DryRun, summary.WriteChecked, tt.wantChecked)
+			}
+			if len(fake.written) != 0 {
+				t.Errorf("dry run wrote %d ranges", len(fake.written))
+			}
+			if len(fake.probes) != tt.wantProbes {
+				t.Fatalf("got %d probes, want %d", len(fake.probes), tt.wantProbes)
+			}
+			for _, rng := range fake.probes {
+				if rng != "Plan!A1" {
+					t.Errorf("probe wrote to %s, want Plan!A1", rng)
+				}
+			}
+		})
+	}
+}
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"normal run", Options{}, sheets.SpreadsheetsScope},
+		{"confirmed run", Options{Confirm: func(string) (bool, error) { return true, nil }}, sheets.SpreadsheetsScope},
+		{"plain dry run", Options{DryRun: true}, sheets.SpreadsheetsReadonlyScope},
+		{"dry run with write probe", Options{DryRun: true, CheckWrite: true}, sheets.SpreadsheetsScope},
+		{"write probe without dry run", Options{CheckWrite: true}, sheets.SpreadsheetsScope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RequiredScope(tt.opts); got != tt.want {
+				t.Errorf("RequiredScope = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestViewerOnlyPreflight(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	for _, status := range []int{http.StatusForbidden, http.StatusUnauthorized} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			fake := &fakeSheets{writeStatus: status}
+			cfg := config.Config{SpreadsheetID: "XYZ", LookupValue: "Alice", Workbook: path}
+			_, err := update(context.Background(), newFakeService(t, fake), cfg, Options{})
+			if !errors.Is(err, ErrNoWriteAccess) {
+				t.Fatalf("err = %v, want ErrNoWriteAccess", err)
+			}
+			if msg := err.Error(); !strings.Contains(msg, "no write access to XYZ") || !strings.Contains(msg, "Editor") {
+				t.Errorf("err = %q, want the spreadsheet ID and an Editor hint", msg)
+			}
+			if len(fake.written) != 0 || len(fake.batches) != 0 {
+				t.Errorf("wrote %d ranges and %d structural requests after a failed preflight", len(fake.written), len(fake.batches))
+			}
+		})
+	}
+}
+
+func TestGateProbesAfterConfirm(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	for _, accept := range []bool{false, true} {
+		t.Run(fmt.Sprintf("accept=%v", accept), func(t *testing.T) {
+			fake := &fakeSheets{}
+			var probedBefore int
+			confirm := func(string) (bool, error) {
+				probedBefore = len(fake.probes)
+				return accept, nil
+			}
+			cfg := config.Config{SpreadsheetID: "XYZ", LookupValue: "Alice", Workbook: path}
+			summary, err := update(context.Background(), newFakeService(t, fake), cfg, Options{Confirm: confirm})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if probedBefore != 0 {
+				t.Errorf("probed %d times before the confirmation prompt", probedBefore)
+			}
+			wantProbes := 0
+			if accept {
+				wantProbes = 1
+			}
+			if len(fake.probes) != wantProbes || summary.WriteChecked != accept {
+				t.Errorf("probes = %v, write checked %v; want %d probes", fake.probes, summary.WriteChecked, wantProbes)
+			}
+			if !accept && summary.SkippedReason != declinedReason {
+				t.Errorf("skipped reason = %q, want %q", summary.SkippedReason, declinedReason)
+			}
+		})
+	}
+}
+
+func TestPullSkipsWriteProbe(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	for _, dryRun := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dry-run=%v", dryRun), func(t *testing.T) {
+			// A viewer-only share still allows pulling, which never writes
+			// to the spreadsheet.
+			fake := &fakeSheets{writeStatus: http.StatusForbidden, cells: map[string][][]interface{}{"Plan!B1": {{"Done"}}}}
+			cfg := config.Config{SpreadsheetID: "XYZ", LookupValue: "Alice", Workbook: path, Mode: config.ModePull, TargetColOffset: 1}
+			summary, err := update(context.Background(), newFakeService(t, fake), cfg, Options{DryRun: dryRun, CheckWrite: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fake.probes) != 0 || summary.WriteChecked {
+				t.Errorf("pull probed write access: %v", fake.probes)
+			}
+			if want := []string{"Plan!B1"}; !reflect.DeepEqual(summary.Ranges, want) {
+				t.Errorf("ranges = %v, want %v", summary.Ranges, want)
+			}
+		})
+	}
+}
+
+func TestExpectPlanned(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}, {""}, {"Alice"}}})
+	tests := []struct {
+		name string
+		// between changes the spreadsheet after the plan is made.
+		between map[string][][]interface{}
+		wantErr string
+		want    []string
+	}{
+		{"unchanged", nil, "", []string{"Plan!B1", "Plan!B3"}},
+		{"one target filled", map[string][][]interface{}{"Plan!B1": {{"Other"}}}, "planned Plan!B1, now Plan!B3", nil},
+		{"every target filled", map[string][][]interface{}{"Plan!B1": {{"Other"}}, "Plan!B3": {{"Other"}}}, "nothing to write any more", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSheets{}
+			svc := newFakeService(t, fake)
+			cfg := config.Config{SpreadsheetID: "XYZ", LookupValue: "Alice", WriteValue: "Done", TargetColOffset: 1, Workbook: path}
+			plan, err := UpdateWithService(context.Background(), svc, cfg, Options{DryRun: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for rng, values := range tt.between {
+				fake.cells[rng] = values
+			}
+			confirmed := false
+			opts := ExpectPlanned(Options{Confirm: func(string) (bool, error) { confirmed = true; return true, nil }}, plan)
+			_, err = UpdateWithService(context.Background(), svc, cfg, opts)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrPlanChanged) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want ErrPlanChanged with %q", err, tt.wantErr)
+				}
+				if confirmed || len(fake.written) != 0 || len(fake.probes) != 0 {
+					t.Errorf("changed plan reached the prompt (%v), writes %v or probes %v", confirmed, fake.writes(), fake.probes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(fake.writes(), tt.want) {
+				t.Errorf("writes = %v, want %v", fake.writes(), tt.want)
+			}
+		})
+	}
+}
+
+func TestExpectPlannedTemplates(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	// The dry run expands its templates at an instant long past, so an
+	// apply expanding them again at its own start would plan other values.
+	planTime := time.Date(2024, 3, 5, 1, 2, 3, 0, time.UTC)
+	tests := []struct {
+		name string
+		cfg  config.Config
+		want string
+	}{
+		{"write_value", config.Config{WriteValue: "at {{time}}", TargetColOffset: 1}, "at 01:02:03"},
+		{"writes value", config.Config{Writes: []config.CellWrite{{Offset: "0,1", Value: "{{now}}"}}}, "2024-03-05T01:02:03Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSheets{}
+			svc := newFakeService(t, fake)
+			cfg := tt.cfg
+			cfg.SpreadsheetID, cfg.LookupValue, cfg.Timezone, cfg.Workbook = "XYZ", "Alice", "UTC", path
+			plan, err := UpdateWithService(context.Background(), svc, cfg, Options{DryRun: true, expandAt: planTime})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := UpdateWithService(context.Background(), svc, cfg, ExpectPlanned(Options{}, plan)); err != nil {
+				t.Fatalf("apply of an unchanged plan: %v", err)
+			}
+			if got := fake.cells["Plan!B1"]; !reflect.DeepEqual(got, [][]interface{}{{tt.want}}) {
+				t.Errorf("Plan!B1 = %v, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanDiff(t *testing.T) {
+	vr := func(rng string, v interface{}) *sheets.ValueRange {
+		return &sheets.ValueRange{Range: rng, Values: [][]interface{}{{v}}}
+	}
+	planned := []*sheets.ValueRange{vr("Plan!B1", "Done"), vr("Plan!B3", 2.0)}
+	tests := []struct {
+		name string
+		got  []*sheets.ValueRange
+		want string
+	}{
+		{"same", []*sheets.ValueRange{vr("Plan!B1", "Done"), vr("Plan!B3", 2.0)}, ""},
+		{"value changed", []*sheets.ValueRange{vr("Plan!B1", "Done"), vr("Plan!B3", 3.0)}, "Plan!B3 planned [[2]], now [[3]]"},
+		{"value type changed", []*sheets.ValueRange{vr("Plan!B1", "Done"), vr("Plan!B3", "2")}, `Plan!B3 planned [[2]], now [["2"]]`},
+		{"range dropped", []*sheets.ValueRange{vr("Plan!B1", "Done")}, "Plan!B3 is no longer written"},
+		{"range added", append(slices.Clone(planned), vr("Plan!B5", "Done")), "Plan!B5 was not planned"},
+		{"range moved", []*sheets.ValueRange{vr("Plan!C1", "Done"), vr("Plan!B3", 2.0)}, "planned Plan!B1, now Plan!C1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := planDiff(planned, tt.got); got != tt.want {
+				t.Errorf("planDiff = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
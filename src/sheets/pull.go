@@ -0,0 +1,156 @@
+package sheets
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+// pullPlan lists the workbook cells to refresh from Google Sheets.
+type pullPlan struct {
+	Cells     []pulledCell
+	Occupied  []string
+	Unchanged int
+	// Fatal lists the occupied cells under the error policy, and Setting
+	// names where the first of them got that policy.
+	Fatal   []string
+	Setting string
+}
+
+type pulledCell struct {
+	Sheet, Cell string
+	Value       interface{}
+}
+
+func (c pulledCell) ref() string {
+	return formatRange(c.Sheet, c.Cell)
+}
+
+// planned lists the cells to pull as planned writes.
+func (p pullPlan) planned() []*sheets.ValueRange {
+	planned := make([]*sheets.ValueRange, len(p.Cells))
+	for i, c := range p.Cells {
+		planned[i] = &sheets.ValueRange{Range: c.ref(), Values: [][]interface{}{{c.Value}}}
+	}
+	return planned
+}
+
+// pullTargets copies the current Google Sheets values of each target range
+// into the same cells of the workbook. Non-empty workbook cells that differ
+// are left alone unless occupied_cell_policy is overwrite.
+func pullTargets(ctx context.Context, svc *sheets.Service, cfg config.Config, targets []target, summary Summary, opts Options) (Summary, error) {
+	f, err := excelize.OpenFile(cfg.Workbook)
+	if err != nil {
+		return summary, fmt.Errorf("open workbook: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	plan, err := buildPulls(ctx, svc, cfg, f, targets)
+	if err != nil {
+		return summary, err
+	}
+	summary.Occupied = plan.Occupied
+	summary.AlreadyCorrect = plan.Unchanged
+	if len(plan.Fatal) > 0 {
+		return summary, tag(ErrOccupied, fmt.Errorf("%d workbook cell(s) already contain different data (%s): %s", len(plan.Fatal), plan.Setting, strings.Join(plan.Fatal, "; ")))
+	}
+	if len(plan.Cells) == 0 {
+		summary.SkippedReason = "workbook already matches Google Sheets"
+		return summary, nil
+	}
+
+	refs := make([]string, len(plan.Cells))
+	for i, c := range plan.Cells {
+		refs[i] = c.ref()
+	}
+	out := pullOutputPath(cfg.Workbook, opts.InPlace)
+	summary.Ranges = refs
+	preview := fmt.Sprintf("About to pull %s from spreadsheet %s into %s.", plural(len(plan.Cells), "cell"), cfg.SpreadsheetID, out)
+	if ok, err := opts.gate(ctx, svc, cfg, targets[0].Range, preview, plan.planned(), &summary); !ok || err != nil {
+		return summary, err
+	}
+	for _, c := range plan.Cells {
+		if err := f.SetCellValue(c.Sheet, c.Cell, c.Value); err != nil {
+			return summary, fmt.Errorf("set %s: %w", c.ref(), err)
+		}
+	}
+	if err := f.SaveAs(out); err != nil {
+		return summary, fmt.Errorf("save workbook %s: %w", out, err)
+	}
+	summary.Pulled = refs
+	summary.PulledTo = out
+	summary.TotalCells = int64(len(refs))
+	summary.TotalRows = int64(len(targets))
+	return summary, nil
+}
+
+// buildPulls reads each target from Google Sheets and plans the workbook
+// cells to set. Values are read unformatted, unless value_render_option
+// says otherwise, so numbers and dates land in Excel as numbers, and are
+// compared with the raw workbook values.
+func buildPulls(ctx context.Context, svc *sheets.Service, cfg config.Config, f *excelize.File, targets []target) (pullPlan, error) {
+	var plan pullPlan
+	read := cfg
+	if read.ValueRenderOption == "" {
+		read.ValueRenderOption = "UNFORMATTED_VALUE"
+	}
+	for _, t := range targets {
+		if t.Sheet == "" {
+			return plan, fmt.Errorf("pull %s: named range targets have no workbook cell to pull into", t.Range)
+		}
+		policy := t.occupiedPolicy(cfg)
+		remote, err := fetchRangeValues(ctx, svc, read, t.Range)
+		if err != nil {
+			return plan, fmt.Errorf("precondition failed for %s: %w", t.Range, err)
+		}
+		for r, row := range remote {
+			for c, val := range row {
+				if isBlank(val) {
+					continue
+				}
+				cell, err := excelize.CoordinatesToCellName(t.Col+c, t.Row+r)
+				if err != nil {
+					return plan, fmt.Errorf("pull %s: %w", t.Range, err)
+				}
+				current, err := f.GetCellValue(t.Sheet, cell, excelize.Options{RawCellValue: true})
+				if err != nil {
+					return plan, fmt.Errorf("read %s: %w", formatRange(t.Sheet, cell), err)
+				}
+				pc := pulledCell{Sheet: t.Sheet, Cell: cell, Value: val}
+				switch {
+				case valuesEqual(current, val, cfg):
+					plan.Unchanged++
+					continue
+				case !isBlank(current) && policy != config.OccupiedOverwrite:
+					occupied := fmt.Sprintf("%s holds %q, Google Sheets has %q", pc.ref(), current, fmt.Sprint(val))
+					plan.Occupied = append(plan.Occupied, occupied)
+					if policy == config.OccupiedError {
+						if plan.Setting == "" {
+							plan.Setting = t.occupiedSetting(cfg)
+						}
+						plan.Fatal = append(plan.Fatal, occupied)
+					}
+					continue
+				}
+				plan.Cells = append(plan.Cells, pc)
+			}
+		}
+	}
+	return plan, nil
+}
+
+// pullOutputPath is the workbook itself for in-place pulls, and otherwise
+// a sibling named <name>.updated.xlsx.
+func pullOutputPath(workbook string, inPlace bool) string {
+	if inPlace {
+		return workbook
+	}
+	ext := filepath.Ext(workbook)
+	return strings.TrimSuffix(workbook, ext) + ".updated" + ext
+}
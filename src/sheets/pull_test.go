@@ -0,0 +1,123 @@
+package sheets
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+func TestPullOutputPath(t *testing.T) {
+	tests := []struct {
+		workbook string
+		inPlace  bool
+		want     string
+	}{
+		{"cfg/Schedule.xlsx", false, "cfg/Schedule.updated.xlsx"},
+		{"cfg/Schedule.xlsx", true, "cfg/Schedule.xlsx"},
+		{"plan.v2.xlsm", false, "plan.v2.updated.xlsm"},
+		{"plan", false, "plan.updated"},
+	}
+	for _, tt := range tests {
+		if got := pullOutputPath(tt.workbook, tt.inPlace); got != tt.want {
+			t.Errorf("pullOutputPath(%q, %v) = %q, want %q", tt.workbook, tt.inPlace, got, tt.want)
+		}
+	}
+}
+
+func TestPull(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		inPlace bool
+		// want is column B of the saved workbook, raw.
+		want     []string
+		occupied int
+	}{
+		{"fills empty cells", "", false, []string{"1234.5", "old", "12.5"}, 1},
+		{"overwrite policy", config.OccupiedOverwrite, false, []string{"1234.5", "new", "12.5"}, 0},
+		{"in place", "", true, []string{"1234.5", "old", "12.5"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{
+				{"Alice"},
+				{"Alice", "old"},
+				{"Alice", "12.5"},
+			}})
+			// Formatted, the spreadsheet shows the display text; the pull
+			// reads unformatted values.
+			fake := &fakeSheets{
+				cells: map[string][][]interface{}{
+					"Plan!B1": {{"1,234.50"}},
+					"Plan!B2": {{"new"}},
+					"Plan!B3": {{"12.50"}},
+				},
+				renders: map[string]map[string][][]interface{}{"UNFORMATTED_VALUE": {
+					"Plan!B1": {{1234.5}},
+					"Plan!B2": {{"new"}},
+					"Plan!B3": {{12.5}},
+				}},
+			}
+			cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path, Mode: config.ModePull, TargetColOffset: 1, OccupiedCellPolicy: tt.policy}
+			summary, err := update(context.Background(), newFakeService(t, fake), cfg, Options{InPlace: tt.inPlace})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, q := range fake.gets {
+				if q.Get("valueRenderOption") != "UNFORMATTED_VALUE" {
+					t.Errorf("read with %v, want UNFORMATTED_VALUE", q)
+				}
+			}
+			out := filepath.Join(filepath.Dir(path), "fixture.updated.xlsx")
+			if tt.inPlace {
+				out = path
+			}
+			if summary.PulledTo != out {
+				t.Errorf("pulled to %s, want %s", summary.PulledTo, out)
+			}
+			if len(summary.Occupied) != tt.occupied || summary.AlreadyCorrect != 1 {
+				t.Errorf("occupied %q, already correct %d; want %d and 1", summary.Occupied, summary.AlreadyCorrect, tt.occupied)
+			}
+			f, err := excelize.OpenFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = f.Close() }()
+			var got []string
+			for _, cell := range []string{"B1", "B2", "B3"} {
+				v, err := f.GetCellValue("Plan", cell, excelize.Options{RawCellValue: true})
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, v)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("column B = %q, want %q", got, tt.want)
+			}
+			if typ, _ := f.GetCellType("Plan", "B1"); typ == excelize.CellTypeSharedString || typ == excelize.CellTypeInlineString {
+				t.Errorf("B1 saved as text (%v), want a number", typ)
+			}
+		})
+	}
+}
+
+func TestPullNamedRangeTargets(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Bob"}}})
+	meta := testMeta()
+	fake := &fakeSheets{meta: sheets.Spreadsheet{
+		Sheets:      []*sheets.Sheet{{Properties: meta.sheets[7]}},
+		NamedRanges: []*sheets.NamedRange{meta.namedRanges["Single"]},
+	}}
+	cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path, Mode: config.ModePull, NamedRangeTargets: []string{"Single"}}
+	_, err := update(context.Background(), newFakeService(t, fake), cfg, Options{})
+	if err == nil || !strings.Contains(err.Error(), "no workbook cell to pull into") {
+		t.Errorf("err = %v, want named ranges rejected", err)
+	}
+}
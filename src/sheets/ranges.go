@@ -0,0 +1,70 @@
+package sheets
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"update-google-sheets/src/config"
+)
+
+// savedRange is one target range as -emit-ranges records it: the full A1
+// range plus its sheet and cell part, e.g. 'Week 1'!C4, Week 1 and C4.
+type savedRange struct {
+	Range string `json:"range"`
+	Sheet string `json:"sheet"`
+	Cell  string `json:"cell"`
+}
+
+// rangesFile is the JSON document shared by -emit-ranges and ranges_from.
+type rangesFile struct {
+	Ranges []savedRange `json:"ranges"`
+}
+
+// emitRanges writes the ranges of targets to w, in target order.
+func emitRanges(w io.Writer, targets []target) error {
+	doc := rangesFile{Ranges: make([]savedRange, 0, len(targets))}
+	for _, t := range targets {
+		cell := t.Range[strings.LastIndex(t.Range, "!")+1:]
+		doc.Ranges = append(doc.Ranges, savedRange{Range: t.Range, Sheet: sheetNameFromRange(t.Range), Cell: cell})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("emit ranges: %w", err)
+	}
+	return nil
+}
+
+// readRanges turns a file written by -emit-ranges into targets carrying
+// the configured value; a rectangle receives it in every cell.
+func readRanges(path string, cfg config.Config) ([]target, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read ranges_from: %w", err)
+	}
+	var doc rangesFile
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	value, err := cfg.TypedWriteValue()
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]target, 0, len(doc.Ranges))
+	for i, r := range doc.Ranges {
+		rng := r.Range
+		if rng == "" {
+			rng = formatRange(r.Sheet, r.Cell)
+		}
+		t, err := importTarget(rng, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s ranges[%d]: %w", path, i, err)
+		}
+		t.Anchor = fmt.Sprintf("%s ranges[%d]", path, i)
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
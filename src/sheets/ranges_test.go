@@ -0,0 +1,94 @@
+package sheets
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"update-google-sheets/src/config"
+)
+
+func TestEmitAndLoadRanges(t *testing.T) {
+	path := writeWorkbook(t,
+		fixtureSheet{name: "Week 1", rows: [][]string{{"Alice", "Bob"}, {"", "Alice"}}},
+		fixtureSheet{name: "Plan", rows: [][]string{{"Carol"}, {"Alice"}}},
+	)
+	ctx := context.Background()
+	var buf bytes.Buffer
+	cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path}
+	first, err := update(ctx, newFakeService(t, &fakeSheets{}), cfg, Options{DryRun: true, EmitRanges: &buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRanges := []string{"'Week 1'!A1", "'Week 1'!B2", "Plan!A2"}
+	if first.EmittedRanges != len(wantRanges) {
+		t.Errorf("EmittedRanges = %d, want %d", first.EmittedRanges, len(wantRanges))
+	}
+
+	saved := filepath.Join(t.TempDir(), "ranges.json")
+	if err := os.WriteFile(saved, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeSheets{}
+	second := config.Config{SpreadsheetID: "sheet-id", WriteValue: "Present", RangesFrom: saved}
+	if _, err := update(ctx, newFakeService(t, fake), second, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.writes(); !reflect.DeepEqual(got, wantRanges) {
+		t.Errorf("second run wrote %v, want %v", got, wantRanges)
+	}
+	for _, rng := range wantRanges {
+		if got := fake.cells[rng]; !reflect.DeepEqual(got, [][]interface{}{{"Present"}}) {
+			t.Errorf("%s = %v, want Present", rng, got)
+		}
+	}
+}
+
+func TestReadRanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    []string
+		values  [][][]interface{}
+		wantErr bool
+	}{
+		{
+			name:   "full ranges",
+			json:   `{"ranges":[{"range":"'Week 1'!C4","sheet":"Week 1","cell":"C4"}]}`,
+			want:   []string{"'Week 1'!C4"},
+			values: [][][]interface{}{{{"x"}}},
+		},
+		{
+			name:   "sheet and cell only",
+			json:   `{"ranges":[{"sheet":"Week 1","cell":"A1:B2"},{"sheet":"Plan","cell":"D3"}]}`,
+			want:   []string{"'Week 1'!A1:B2", "Plan!D3"},
+			values: [][][]interface{}{{{"x", "x"}, {"x", "x"}}, {{"x"}}},
+		},
+		{name: "not JSON", json: `ranges:`, wantErr: true},
+		{name: "bad cell", json: `{"ranges":[{"sheet":"Plan","cell":"nope"}]}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "ranges.json")
+			if err := os.WriteFile(path, []byte(tt.json), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			targets, err := readRanges(path, config.Config{WriteValue: "x"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []string
+			var values [][][]interface{}
+			for _, tg := range targets {
+				got = append(got, tg.Range)
+				values = append(values, tg.Values)
+			}
+			if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("targets = %v %v, want %v %v", got, values, tt.want, tt.values)
+			}
+		})
+	}
+}
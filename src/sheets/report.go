@@ -0,0 +1,93 @@
+package sheets
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+// Reconciliation statuses written to the report's status column.
+const (
+	reportMatch       = "match"
+	reportMismatch    = "mismatch"
+	reportEmptyRemote = "empty-remote"
+)
+
+var reportHeader = []string{"workbook_sheet", "cell", "excel_value", "google_range", "google_value", "status"}
+
+// writeReport fetches every target range and writes one CSV row per target
+// cell comparing the workbook-derived value with what Google Sheets holds.
+// The file starts with a UTF-8 BOM so Excel detects the encoding.
+func writeReport(ctx context.Context, svc *sheets.Service, cfg config.Config, targets []target, w io.Writer, summary Summary) (Summary, error) {
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return summary, fmt.Errorf("write report: %w", err)
+	}
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	if err := cw.Write(reportHeader); err != nil {
+		return summary, fmt.Errorf("write report: %w", err)
+	}
+	for _, t := range targets {
+		remote, err := fetchRangeValues(ctx, svc, cfg, t.Range)
+		if err != nil {
+			return summary, fmt.Errorf("precondition failed for %s: %w", t.Range, err)
+		}
+		sheet, cell := sheetNameFromRange(t.Anchor), ""
+		if i := strings.LastIndex(t.Anchor, "!"); i >= 0 {
+			cell = t.Anchor[i+1:]
+		}
+		for r, row := range t.Values {
+			for c, want := range row {
+				got := ""
+				if remoteHasValue(remote, r, c, cfg) {
+					got = fmt.Sprint(remote[r][c])
+				}
+				status := reportMismatch
+				switch {
+				case got == "":
+					status = reportEmptyRemote
+				case valuesEqual(got, want, cfg):
+					status = reportMatch
+				}
+				rng, err := reportCellRange(t, r, c)
+				if err != nil {
+					return summary, err
+				}
+				excel := ""
+				if want != nil {
+					excel = fmt.Sprint(want)
+				}
+				if err := cw.Write([]string{sheet, cell, excel, rng, got, status}); err != nil {
+					return summary, fmt.Errorf("write report: %w", err)
+				}
+				summary.ReportRows++
+			}
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return summary, fmt.Errorf("write report: %w", err)
+	}
+	summary.Ranges = targetRanges(targets)
+	return summary, nil
+}
+
+// reportCellRange addresses one cell of a workbook-derived target; named
+// range targets carry no coordinates and are reported by their range.
+func reportCellRange(t target, r, c int) (string, error) {
+	if t.Sheet == "" {
+		return t.Range, nil
+	}
+	cell, err := excelize.CoordinatesToCellName(t.Col+c, t.Row+r)
+	if err != nil {
+		return "", fmt.Errorf("report %s: %w", t.Range, err)
+	}
+	return formatRange(t.Sheet, cell), nil
+}
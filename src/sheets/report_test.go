@@ -0,0 +1,71 @@
+package sheets
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"update-google-sheets/src/config"
+)
+
+func TestWriteReport(t *testing.T) {
+	fake := &fakeSheets{cells: map[string][][]interface{}{
+		"Plan!B2:E2": {{"Done", "say \"hi\", then\nleave", "", "extra"}},
+		"Totals":     {{"42"}},
+	}}
+	targets := []target{
+		{
+			Range: "Plan!B2:E2", Anchor: "Plan!A2", Sheet: "Plan", Row: 2, Col: 2,
+			Values: [][]interface{}{{"done", "say \"hi\", then\nleave", "Bob", nil}},
+		},
+		{Range: "Totals", Anchor: "Totals", Values: [][]interface{}{{"41"}}},
+	}
+	var buf bytes.Buffer
+	summary, err := writeReport(context.Background(), newFakeService(t, fake), config.Config{SpreadsheetID: "sheet-id"}, targets, &buf, Summary{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "\ufeff" +
+		"workbook_sheet,cell,excel_value,google_range,google_value,status\r\n" +
+		"Plan,A2,done,Plan!B2,Done,mismatch\r\n" +
+		"Plan,A2,\"say \"\"hi\"\", then\r\nleave\",Plan!C2,\"say \"\"hi\"\", then\r\nleave\",match\r\n" +
+		"Plan,A2,Bob,Plan!D2,,empty-remote\r\n" +
+		"Plan,A2,,Plan!E2,extra,mismatch\r\n" +
+		",,41,Totals,42,mismatch\r\n"
+	if got := buf.String(); got != want {
+		t.Errorf("report:\n%q\nwant:\n%q", got, want)
+	}
+	if summary.ReportRows != 5 {
+		t.Errorf("report rows = %d, want 5", summary.ReportRows)
+	}
+	if got := strings.Join(summary.Ranges, " "); got != "Plan!B2:E2 Totals" {
+		t.Errorf("ranges = %q", got)
+	}
+	if len(fake.written) != 0 {
+		t.Errorf("report wrote %v", fake.writes())
+	}
+}
+
+func TestReportOption(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}, {"Alice"}}})
+	fake := &fakeSheets{cells: map[string][][]interface{}{"Plan!B1": {{"Alice"}}}}
+	cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path, TargetColOffset: 1}
+	var buf bytes.Buffer
+	summary, err := update(context.Background(), newFakeService(t, fake), cfg, Options{Report: &buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")
+	want := []string{
+		"\ufeffworkbook_sheet,cell,excel_value,google_range,google_value,status",
+		"Plan,A1,Alice,Plan!B1,Alice,match",
+		"Plan,A2,Alice,Plan!B2,,empty-remote",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("report = %q, want %q", lines, want)
+	}
+	if summary.ReportRows != 2 || len(fake.written) != 0 {
+		t.Errorf("report rows %d, written %v; want 2 rows and no writes", summary.ReportRows, fake.writes())
+	}
+}
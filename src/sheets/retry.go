@@ -0,0 +1,161 @@
+package sheets
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"update-google-sheets/src/config"
+)
+
+// ErrRetryBudgetSpent means a transient API error was not retried because
+// the run had used up retry_budget or retry_budget_time.
+var ErrRetryBudgetSpent = errors.New("retry budget spent")
+
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 8 * time.Second
+)
+
+// RetryBudget bounds the retries of one run across every API call: each
+// call retries at most max_retries times, and all calls together at most
+// retry_budget times and retry_budget_time of waiting. It is safe for
+// concurrent use.
+type RetryBudget struct {
+	perCall int
+	max     int
+	maxWait time.Duration
+
+	mu     sync.Mutex
+	used   int
+	waited time.Duration
+}
+
+// NewRetryBudget returns the budget cfg describes, or nil when cfg disables
+// retries.
+func NewRetryBudget(cfg config.Config) *RetryBudget {
+	if cfg.MaxRetries <= 0 {
+		return nil
+	}
+	return &RetryBudget{perCall: cfg.MaxRetries, max: cfg.RetryBudget, maxWait: cfg.RetryBudgetWait()}
+}
+
+// Used returns how many retries the run has made so far.
+func (b *RetryBudget) Used() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// take claims one retry that will first wait for wait.
+func (b *RetryBudget) take(wait time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.max > 0 && b.used >= b.max {
+		return fmt.Errorf("%w: all %d retries allowed by retry_budget were used", ErrRetryBudgetSpent, b.max)
+	}
+	if b.maxWait > 0 && b.waited+wait > b.maxWait {
+		return fmt.Errorf("%w: %s of retry_budget_time already waited", ErrRetryBudgetSpent, b.waited.Round(time.Millisecond))
+	}
+	b.used++
+	b.waited += wait
+	return nil
+}
+
+// retryTransport retries rate-limited requests, and server errors on
+// requests that are safe to repeat, drawing on a shared RetryBudget.
+type retryTransport struct {
+	base   http.RoundTripper
+	budget *RetryBudget
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		try := req
+		if attempt > 0 {
+			try = req.Clone(req.Context())
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				try.Body = body
+			}
+		}
+		resp, err := t.base.RoundTrip(try)
+		if attempt >= t.budget.perCall || !shouldRetry(req, resp, err) {
+			return resp, err
+		}
+		wait := retryDelay(attempt, resp)
+		if berr := t.budget.take(wait); berr != nil {
+			if resp != nil {
+				_ = resp.Body.Close()
+				return nil, fmt.Errorf("%w; last response %s", berr, resp.Status)
+			}
+			return nil, fmt.Errorf("%w; last error: %v", berr, err)
+		}
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// shouldRetry reports whether a failed attempt is transient and may be
+// repeated. Rate limiting means the request was not applied, so it is
+// always retried; other failures only for requests that can be repeated
+// without effect, which excludes appends and structural batch updates.
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil || (req.Body != nil && req.GetBody == nil) {
+		return false
+	}
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if !idempotent(req) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// idempotent covers reads and the values endpoints that set or clear
+// cells, but not values:append or spreadsheets:batchUpdate.
+func idempotent(req *http.Request) bool {
+	if req.Method == http.MethodGet {
+		return true
+	}
+	return strings.Contains(req.URL.Path, "/values") && !strings.HasSuffix(req.URL.Path, ":append")
+}
+
+// retryDelay honours a Retry-After header in seconds, and otherwise backs
+// off exponentially with jitter.
+func retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs >= 0 {
+			return min(time.Duration(secs)*time.Second, retryMaxDelay)
+		}
+	}
+	d := min(retryBaseDelay<<attempt, retryMaxDelay)
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,64 @@
+package sheets
+
+import (
+	"fmt"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// Reviewer is shown each range about to be written, with one line per cell
+// it changes, and returns false to drop that range from the write.
+type Reviewer func(rng string, changes []string) (bool, error)
+
+// reviewPayloads asks review about every distinct range of payloads and
+// keeps the approved ones; see applyReview.
+func reviewPayloads(payloads []*sheets.ValueRange, stats mergeStats, review Reviewer) ([]*sheets.ValueRange, mergeStats, []string, error) {
+	lines := make(map[string][]string)
+	for _, ch := range stats.Changes {
+		lines[ch.Range] = append(lines[ch.Range], fmt.Sprintf("%s: %q -> %q", ch.Cell, fmt.Sprint(ch.Before), fmt.Sprint(ch.After)))
+	}
+	approved := make(map[string]bool)
+	for _, p := range payloads {
+		if _, asked := approved[p.Range]; asked {
+			continue
+		}
+		ok, err := review(p.Range, lines[p.Range])
+		if err != nil {
+			return nil, stats, nil, err
+		}
+		approved[p.Range] = ok
+	}
+	kept, stats, dropped := applyReview(payloads, stats, approved)
+	return kept, stats, dropped, nil
+}
+
+// applyReview keeps the payloads whose range approved maps to true, along
+// with their changes, and returns the ranges of the rest. The filled and
+// corrected counts lose the dropped cells, a cell that held a value having
+// been counted as corrected.
+func applyReview(payloads []*sheets.ValueRange, stats mergeStats, approved map[string]bool) ([]*sheets.ValueRange, mergeStats, []string) {
+	var (
+		kept    []*sheets.ValueRange
+		dropped []string
+	)
+	for _, p := range payloads {
+		if approved[p.Range] {
+			kept = append(kept, p)
+		} else {
+			dropped = append(dropped, p.Range)
+		}
+	}
+	changes := stats.Changes
+	stats.Changes = nil
+	for _, ch := range changes {
+		switch {
+		case approved[ch.Range]:
+			stats.Changes = append(stats.Changes, ch)
+		case !isBlank(ch.Before):
+			stats.Corrected--
+		default:
+			stats.Filled--
+		}
+	}
+	return kept, stats, dropped
+}
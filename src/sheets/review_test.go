@@ -0,0 +1,87 @@
+package sheets
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+func reviewFixture() ([]*sheets.ValueRange, mergeStats) {
+	payloads := []*sheets.ValueRange{
+		{Range: "Plan!A1"},
+		{Range: "Plan!B2:C2"},
+		{Range: "Plan!D4"},
+	}
+	stats := mergeStats{
+		Filled:    3,
+		Corrected: 1,
+		Changes: []cellChange{
+			{Range: "Plan!A1", Cell: "Plan!A1", After: "x"},
+			{Range: "Plan!B2:C2", Cell: "Plan!B2", After: "x"},
+			{Range: "Plan!B2:C2", Cell: "Plan!C2", Before: "old", After: "x"},
+			{Range: "Plan!D4", Cell: "Plan!D4", Before: " ", After: "x"},
+		},
+	}
+	return payloads, stats
+}
+
+func TestApplyReview(t *testing.T) {
+	tests := []struct {
+		name              string
+		approved          map[string]bool
+		kept, dropped     []string
+		filled, corrected int
+		changes           int
+	}{
+		{"all approved", map[string]bool{"Plan!A1": true, "Plan!B2:C2": true, "Plan!D4": true}, []string{"Plan!A1", "Plan!B2:C2", "Plan!D4"}, nil, 3, 1, 4},
+		{"all rejected", map[string]bool{}, nil, []string{"Plan!A1", "Plan!B2:C2", "Plan!D4"}, 0, 0, 0},
+		{"reject a corrected range", map[string]bool{"Plan!A1": true, "Plan!B2:C2": false, "Plan!D4": true}, []string{"Plan!A1", "Plan!D4"}, []string{"Plan!B2:C2"}, 2, 0, 2},
+		{"reject blank-before cells", map[string]bool{"Plan!B2:C2": true}, []string{"Plan!B2:C2"}, []string{"Plan!A1", "Plan!D4"}, 1, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payloads, stats := reviewFixture()
+			kept, stats, dropped := applyReview(payloads, stats, tt.approved)
+			var keptRanges []string
+			for _, p := range kept {
+				keptRanges = append(keptRanges, p.Range)
+			}
+			if !reflect.DeepEqual(keptRanges, tt.kept) || !reflect.DeepEqual(dropped, tt.dropped) {
+				t.Errorf("kept %v, dropped %v; want %v, %v", keptRanges, dropped, tt.kept, tt.dropped)
+			}
+			if stats.Filled != tt.filled || stats.Corrected != tt.corrected || len(stats.Changes) != tt.changes {
+				t.Errorf("filled %d, corrected %d, changes %d; want %d, %d, %d", stats.Filled, stats.Corrected, len(stats.Changes), tt.filled, tt.corrected, tt.changes)
+			}
+		})
+	}
+}
+
+func TestReviewPayloadsAsksOncePerRange(t *testing.T) {
+	payloads, stats := reviewFixture()
+	payloads = append(payloads, &sheets.ValueRange{Range: "Plan!A1"})
+	asked := map[string][]string{}
+	review := func(rng string, changes []string) (bool, error) {
+		asked[rng] = changes
+		return rng != "Plan!D4", nil
+	}
+	kept, _, dropped, err := reviewPayloads(payloads, stats, review)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(asked) != 3 {
+		t.Errorf("asked about %d ranges, want 3", len(asked))
+	}
+	if want := []string{`Plan!B2: "<nil>" -> "x"`, `Plan!C2: "old" -> "x"`}; !reflect.DeepEqual(asked["Plan!B2:C2"], want) {
+		t.Errorf("changes shown = %q, want %q", asked["Plan!B2:C2"], want)
+	}
+	if len(kept) != 3 || !reflect.DeepEqual(dropped, []string{"Plan!D4"}) {
+		t.Errorf("kept %d payloads, dropped %v; want 3 and [Plan!D4]", len(kept), dropped)
+	}
+
+	boom := errors.New("no terminal")
+	if _, _, _, err := reviewPayloads(payloads, stats, func(string, []string) (bool, error) { return false, boom }); !errors.Is(err, boom) {
+		t.Errorf("err = %v, want the reviewer's error", err)
+	}
+}
@@ -0,0 +1,496 @@
+package sheets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xuri/excelize/v2"
+
+	"update-google-sheets/src/config"
+)
+
+// scanArea bounds the workbook cells examined for matches. Coordinates are
+// 1-based and inclusive; zero values leave that edge unbounded.
+type scanArea struct {
+	MinRow, MinCol int
+	MaxRow, MaxCol int
+}
+
+func (a scanArea) contains(row, col int) bool {
+	if a.MinRow > 0 && row < a.MinRow {
+		return false
+	}
+	if a.MinCol > 0 && col < a.MinCol {
+		return false
+	}
+	if a.MaxRow > 0 && row > a.MaxRow {
+		return false
+	}
+	if a.MaxCol > 0 && col > a.MaxCol {
+		return false
+	}
+	return true
+}
+
+// limit narrows a to the first rows rows and cols columns; 0 leaves that
+// edge as it is.
+func (a scanArea) limit(rows, cols int) scanArea {
+	if rows > 0 && (a.MaxRow == 0 || a.MaxRow > rows) {
+		a.MaxRow = rows
+	}
+	if cols > 0 && (a.MaxCol == 0 || a.MaxCol > cols) {
+		a.MaxCol = cols
+	}
+	return a
+}
+
+// scanCut records whether max_scan_rows or max_scan_cols left cells of a
+// sheet unscanned that the search area would otherwise have covered, and
+// the row at which per_sheet_match_limit ended the scan, if it did.
+type scanCut struct {
+	Rows, Cols bool
+	StopRow    int
+}
+
+// note records row, a sheet row as read, against the limited area.
+func (c *scanCut) note(area, limited scanArea, rowNum int, row []string) {
+	if c.StopRow > 0 {
+		return
+	}
+	if rowNum > limited.MaxRow && limited.MaxRow != area.MaxRow && limited.MaxRow > 0 {
+		c.Rows = true
+		return
+	}
+	if len(row) > limited.MaxCol && limited.MaxCol != area.MaxCol && limited.MaxCol > 0 {
+		c.Cols = true
+	}
+}
+
+// describe says what the cut left out of sheet, or "" when nothing.
+func (c scanCut) describe(sheet string, cfg config.Config) string {
+	var parts []string
+	if c.Rows {
+		parts = append(parts, fmt.Sprintf("rows after %d (max_scan_rows)", cfg.MaxScanRows))
+	}
+	if c.Cols {
+		col, _ := excelize.ColumnNumberToName(cfg.MaxScanCols)
+		parts = append(parts, fmt.Sprintf("columns after %s (max_scan_cols)", col))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s: %s not scanned", sheet, strings.Join(parts, " and "))
+}
+
+// stoppedEarly says where per_sheet_match_limit ended the scan of sheet,
+// or "" when it did not.
+func (c scanCut) stoppedEarly(sheet string, cfg config.Config) string {
+	if c.StopRow == 0 {
+		return ""
+	}
+	limit, _, _ := cfg.MatchLimit()
+	return fmt.Sprintf("%s: stopped at row %d, per_sheet_match_limit %d reached", sheet, c.StopRow, limit)
+}
+
+// keepMatch decides what a scan does with a match once found already hold
+// the matches before it: keep it and go on, keep it and stop (the
+// per_sheet_match_limit is reached), or fail (it is one too many under a
+// -strict limit).
+func keepMatch(found []Match, m Match, cfg config.Config) (stop bool, err error) {
+	limit, strict, _ := cfg.MatchLimit()
+	switch {
+	case limit == 0:
+		return false, nil
+	case strict && len(found) >= limit:
+		cells := make([]string, 0, len(found)+1)
+		for _, f := range found {
+			cells = append(cells, f.A1)
+		}
+		cells = append(cells, m.A1)
+		return true, tag(ErrAnchorNotUnique, fmt.Errorf("lookup value %q appears more than %s on sheet %s (%s); per_sheet_match_limit is %s", cfg.LookupValue, plural(limit, "time"), m.Sheet, strings.Join(cells, ", "), cfg.PerSheetMatchLimit))
+	}
+	return !strict && len(found)+1 >= limit, nil
+}
+
+// resolveDefinedName looks up an Excel defined name and returns the sheet and
+// rectangle it refers to. Sheet-scoped names win over workbook-scoped ones
+// when sheetFilter names their sheet.
+func resolveDefinedName(f *excelize.File, name string, sheetFilter []string) (string, scanArea, error) {
+	var candidates []excelize.DefinedName
+	for _, dn := range f.GetDefinedName() {
+		if dn.Name == name {
+			candidates = append(candidates, dn)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", scanArea{}, fmt.Errorf("defined name %q not found; defined names: %s", name, strings.Join(definedNames(f), ", "))
+	}
+	chosen := candidates[0]
+	for _, dn := range candidates {
+		if slices.Contains(sheetFilter, dn.Scope) {
+			chosen = dn
+			break
+		}
+		if dn.Scope == "Workbook" {
+			chosen = dn
+		}
+	}
+	sheet, area, err := parseRefersTo(chosen.RefersTo)
+	if err != nil {
+		return "", scanArea{}, fmt.Errorf("defined name %q: %w", name, err)
+	}
+	return sheet, area, nil
+}
+
+func definedNames(f *excelize.File) []string {
+	seen := make(map[string]struct{})
+	var names []string
+	for _, dn := range f.GetDefinedName() {
+		if _, ok := seen[dn.Name]; ok {
+			continue
+		}
+		seen[dn.Name] = struct{}{}
+		names = append(names, dn.Name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return []string{"(none)"}
+	}
+	return names
+}
+
+// parseRefersTo splits a reference such as 'My Sheet'!$A$1:$F$20 into its
+// sheet name and rectangle.
+func parseRefersTo(ref string) (string, scanArea, error) {
+	ref = strings.TrimPrefix(strings.TrimSpace(ref), "=")
+	sheet := sheetNameFromRange(ref)
+	if sheet == "" {
+		return "", scanArea{}, fmt.Errorf("reference %q has no sheet name", ref)
+	}
+	area, err := parseArea(ref[strings.LastIndex(ref, "!")+1:])
+	if err != nil {
+		return "", scanArea{}, err
+	}
+	return sheet, area, nil
+}
+
+// parseArea converts an A1 cell or range without a sheet prefix into a scanArea.
+func parseArea(ref string) (scanArea, error) {
+	ref = strings.ReplaceAll(strings.TrimSpace(ref), "$", "")
+	start, end, found := strings.Cut(ref, ":")
+	if !found {
+		end = start
+	}
+	c1, r1, err := excelize.CellNameToCoordinates(start)
+	if err != nil {
+		return scanArea{}, fmt.Errorf("parse range %q: %w", ref, err)
+	}
+	c2, r2, err := excelize.CellNameToCoordinates(end)
+	if err != nil {
+		return scanArea{}, fmt.Errorf("parse range %q: %w", ref, err)
+	}
+	if r1 > r2 {
+		r1, r2 = r2, r1
+	}
+	if c1 > c2 {
+		c1, c2 = c2, c1
+	}
+	return scanArea{MinRow: r1, MinCol: c1, MaxRow: r2, MaxCol: c2}, nil
+}
+
+// Match is one workbook cell equal to the lookup value.
+type Match struct {
+	Sheet     string
+	Row, Col  int    // 1-based
+	CellValue string // the cell text as read, before trimming
+	A1        string // sheet-qualified reference, e.g. 'Week 1'!C4
+	// Width counts the populated cells in the matched row, and Source holds
+	// the cell picked by the source offsets, when configured.
+	Width  int
+	Source string
+	// SourceBlock holds the target_block_rows x target_block_cols cells
+	// whose top-left is Source, when a target block is configured.
+	SourceBlock [][]string
+	// Header is the column heading above the match, read from header_row.
+	Header string
+}
+
+func newMatch(sheet string, row, col int, cell string, width int) Match {
+	name, _ := excelize.CoordinatesToCellName(col, row)
+	return Match{Sheet: sheet, Row: row, Col: col, CellValue: cell, A1: formatRange(sheet, name), Width: width}
+}
+
+// lookupMatcher reports whether a cell holds cfg.LookupValue: the same text
+// once trimmed or, with numeric_tolerance, a number close enough to it.
+func lookupMatcher(cfg config.Config) func(cell string) bool {
+	want := strings.TrimSpace(cfg.LookupValue)
+	wantNum, err := strconv.ParseFloat(want, 64)
+	numeric := cfg.NumericTolerance > 0 && err == nil
+	return func(cell string) bool {
+		cell = strings.TrimSpace(cell)
+		if cell == want {
+			return true
+		}
+		if !numeric {
+			return false
+		}
+		n, err := strconv.ParseFloat(cell, 64)
+		return err == nil && math.Abs(n-wantNum) <= cfg.NumericTolerance
+	}
+}
+
+// cancelCheckRows is how many rows a scan covers between context checks.
+const cancelCheckRows = 1000
+
+// sheetScan is the result of scanning one sheet.
+type sheetScan struct {
+	found []Match
+	cut   scanCut
+	err   error
+}
+
+// scanSheets scans every sheet of list, up to cfg.ScanWorkers() at a time,
+// and returns the results in list order so the derivation does not depend
+// on which sheet finished first. Sequential scans stop at the first error;
+// parallel ones finish the sheets already handed out.
+func scanSheets(ctx context.Context, f *excelize.File, list []string, cfg config.Config, area scanArea) []sheetScan {
+	results := make([]sheetScan, len(list))
+	scan := func(i int) {
+		if err := ctx.Err(); err != nil {
+			results[i].err = fmt.Errorf("scan stopped before sheet %s: %w", list[i], err)
+			return
+		}
+		results[i].found, results[i].cut, results[i].err = scanSheet(ctx, f, list[i], cfg, area)
+	}
+	workers := min(cfg.ScanWorkers(), len(list))
+	if workers <= 1 || !concurrentReadSafe(f) {
+		for i := range list {
+			if scan(i); results[i].err != nil {
+				break
+			}
+		}
+		return results
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				scan(i)
+			}
+		}()
+	}
+	for i := range list {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// concurrentReadSafe reports whether distinct sheets of f may be read at
+// once. excelize guards its worksheet and in-memory shared string caches,
+// but indexes a shared string table it spilled to a temporary file (one
+// larger than UnzipXMLSizeLimit) lazily and without a lock, so a workbook
+// whose table is not in memory is scanned a sheet at a time.
+func concurrentReadSafe(f *excelize.File) bool {
+	if _, ok := f.Pkg.Load("xl/sharedStrings.xml"); ok {
+		return true
+	}
+	rels, _ := f.Pkg.Load("xl/_rels/workbook.xml.rels")
+	data, _ := rels.([]byte)
+	return !bytes.Contains(data, []byte("sharedStrings"))
+}
+
+// scanSheet finds the lookup value on one sheet, resolving source cells when
+// source offsets are configured. Long scans stop once ctx is done, and
+// max_scan_rows and max_scan_cols end them early; the scanCut says whether
+// they did.
+func scanSheet(ctx context.Context, f *excelize.File, sheet string, cfg config.Config, area scanArea) ([]Match, scanCut, error) {
+	if cfg.StreamWorkbook {
+		return streamSheet(ctx, f, sheet, cfg, area)
+	}
+	var cut scanCut
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		return nil, cut, fmt.Errorf("read sheet %s: %w", sheet, err)
+	}
+	limited := area.limit(cfg.MaxScanRows, cfg.MaxScanCols)
+	matches := lookupMatcher(cfg)
+	var found []Match
+rows:
+	for rIdx, row := range rows {
+		if rIdx%cancelCheckRows == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, cut, scanStopped(sheet, rIdx+1, err)
+			}
+		}
+		cut.note(area, limited, rIdx+1, row)
+		if cut.Rows {
+			break
+		}
+		for cIdx, cell := range row {
+			if !limited.contains(rIdx+1, cIdx+1) || !matches(cell) {
+				continue
+			}
+			m := newMatch(sheet, rIdx+1, cIdx+1, cell, len(row))
+			stop, err := keepMatch(found, m, cfg)
+			if err != nil {
+				return nil, cut, err
+			}
+			if cfg.UsesSourceCell() {
+				m.Source = cellAt(rows, rIdx+cfg.SourceRowOffset, cIdx+cfg.SourceColOffset)
+				if cfg.UsesTargetBlock() {
+					h, w := cfg.TargetBlock()
+					m.SourceBlock = blockAt(rows, rIdx+cfg.SourceRowOffset, cIdx+cfg.SourceColOffset, h, w)
+				}
+			}
+			found = append(found, m)
+			if stop {
+				cut.StopRow = rIdx + 1
+				break rows
+			}
+		}
+	}
+	setHeaders(found, headerCells(rows, cfg.HeaderRow))
+	return found, cut, nil
+}
+
+// streamSheet is scanSheet over excelize's row iterator, so the whole sheet
+// is never held in memory. Rows needed for source offsets are kept only as
+// long as a match may still refer to them, and past max_scan_rows the
+// iterator is read only as far as those rows and header_row need.
+func streamSheet(ctx context.Context, f *excelize.File, sheet string, cfg config.Config, area scanArea) ([]Match, scanCut, error) {
+	var cut scanCut
+	it, err := f.Rows(sheet)
+	if err != nil {
+		return nil, cut, fmt.Errorf("read sheet %s: %w", sheet, err)
+	}
+	defer func() { _ = it.Close() }()
+
+	limited := area.limit(cfg.MaxScanRows, cfg.MaxScanCols)
+	matches := lookupMatcher(cfg)
+	var (
+		found   []Match
+		pending = make(map[int][]int)    // source row -> indexes into found
+		recent  = make(map[int][]string) // rows kept for negative row offsets
+		keep    = -cfg.SourceRowOffset   // how many earlier rows to retain
+		header  []string
+	)
+	for rowNum := 1; it.Next(); rowNum++ {
+		if rowNum%cancelCheckRows == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, cut, scanStopped(sheet, rowNum, err)
+			}
+		}
+		row, err := it.Columns()
+		if err != nil {
+			return nil, cut, fmt.Errorf("read sheet %s row %d: %w", sheet, rowNum, err)
+		}
+		cut.note(area, limited, rowNum, row)
+		if (cut.Rows || cut.StopRow > 0) && len(pending) == 0 && rowNum > cfg.HeaderRow {
+			break
+		}
+		for _, i := range pending[rowNum] {
+			found[i].Source = rowCell(row, found[i].Col-1+cfg.SourceColOffset)
+		}
+		delete(pending, rowNum)
+		if rowNum == cfg.HeaderRow {
+			header = row
+		}
+		if keep > 0 {
+			recent[rowNum] = row
+			delete(recent, rowNum-keep-1)
+		}
+
+		for cIdx, cell := range row {
+			if cut.StopRow > 0 || !limited.contains(rowNum, cIdx+1) || !matches(cell) {
+				continue
+			}
+			m := newMatch(sheet, rowNum, cIdx+1, cell, len(row))
+			stop, err := keepMatch(found, m, cfg)
+			if err != nil {
+				return nil, cut, err
+			}
+			if cfg.UsesSourceCell() {
+				srcRow, srcCol := rowNum+cfg.SourceRowOffset, cIdx+cfg.SourceColOffset
+				switch {
+				case srcRow == rowNum:
+					m.Source = rowCell(row, srcCol)
+				case srcRow < rowNum:
+					m.Source = rowCell(recent[srcRow], srcCol)
+				default:
+					pending[srcRow] = append(pending[srcRow], len(found))
+				}
+			}
+			found = append(found, m)
+			if stop {
+				cut.StopRow = rowNum
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, cut, fmt.Errorf("read sheet %s: %w", sheet, err)
+	}
+	setHeaders(found, header)
+	return found, cut, nil
+}
+
+// headerCells returns the 1-based headerRow of rows, or nil when the sheet
+// is shorter than that.
+func headerCells(rows [][]string, headerRow int) []string {
+	if headerRow < 1 || headerRow > len(rows) {
+		return nil
+	}
+	return rows[headerRow-1]
+}
+
+// setHeaders labels each match with the heading of its column.
+func setHeaders(found []Match, header []string) {
+	for i := range found {
+		found[i].Header = strings.TrimSpace(rowCell(header, found[i].Col-1))
+	}
+}
+
+// scanStopped reports how far a cancelled scan got. err stays wrapped so
+// callers can match context.Canceled or context.DeadlineExceeded.
+func scanStopped(sheet string, row int, err error) error {
+	return fmt.Errorf("scan stopped on sheet %s at row %d: %w", sheet, row, err)
+}
+
+// cellAt returns the cell text at zero-based coordinates, or "" when out of bounds.
+func cellAt(rows [][]string, row, col int) string {
+	if row < 0 || row >= len(rows) {
+		return ""
+	}
+	return rowCell(rows[row], col)
+}
+
+// blockAt returns the h x w cells whose top-left is at zero-based (row, col),
+// with "" for cells out of bounds.
+func blockAt(rows [][]string, row, col, h, w int) [][]string {
+	block := make([][]string, h)
+	for r := range block {
+		block[r] = make([]string, w)
+		for c := range block[r] {
+			block[r][c] = cellAt(rows, row+r, col+c)
+		}
+	}
+	return block
+}
+
+func rowCell(row []string, col int) string {
+	if col < 0 || col >= len(row) {
+		return ""
+	}
+	return row[col]
+}
@@ -0,0 +1,572 @@
+package sheets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"update-google-sheets/src/config"
+)
+
+// writeLargeWorkbook streams a rows-by-4 sheet named Plan where every 97th
+// row holds the lookup value "Alice" and the rest hold filler text.
+func writeLargeWorkbook(t testing.TB, rows int) string {
+	t.Helper()
+	f := excelize.NewFile()
+	defer func() { _ = f.Close() }()
+	if err := f.SetSheetName("Sheet1", "Plan"); err != nil {
+		t.Fatal(err)
+	}
+	sw, err := f.NewStreamWriter("Plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r := 1; r <= rows; r++ {
+		row := []interface{}{fmt.Sprintf("id-%d", r), "filler", fmt.Sprintf("src-%d", r), "tail"}
+		if r%97 == 0 {
+			row[1] = "Alice"
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, r)
+		if err := sw.SetRow(cell, row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "large.xlsx")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestStreamWorkbookMatchesDefault(t *testing.T) {
+	path := writeLargeWorkbook(t, 20000)
+	tests := []struct {
+		name string
+		cfg  config.Config
+	}{
+		{"lookup only", config.Config{LookupValue: "Alice"}},
+		{"write to row end", config.Config{LookupValue: "Alice", WriteToRowEnd: true}},
+		{"source above", config.Config{LookupValue: "Alice", SourceRowOffset: -2, SourceColOffset: 1}},
+		{"source below", config.Config{LookupValue: "Alice", SourceRowOffset: 3, SourceColOffset: 1}},
+		{"scan range", config.Config{LookupValue: "Alice", ScanRange: "B100:D5000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := deriveFixture(t, path, tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(want.Ranges) == 0 {
+				t.Fatal("fixture produced no matches")
+			}
+			stream := tt.cfg
+			stream.StreamWorkbook = true
+			got, err := deriveFixture(t, path, stream)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("streamed scan differs:\n got %v\nwant %v", got.Ranges, want.Ranges)
+			}
+		})
+	}
+}
+
+func TestScanRange(t *testing.T) {
+	path := writeWorkbook(t,
+		fixtureSheet{name: "Plan", rows: [][]string{
+			{"Alice", "", "", ""},
+			{"", "Alice", "", ""},
+			{"", "", "Alice", "Alice"},
+			{"", "Alice", "", ""},
+		}},
+		fixtureSheet{name: "Spare", rows: [][]string{
+			{"", ""},
+			{"", "Alice"},
+		}},
+	)
+	tests := []struct {
+		name      string
+		scanRange string
+		want      []string
+	}{
+		{"unbounded", "", []string{"Plan!A1", "Plan!B2", "Plan!C3", "Plan!D3", "Plan!B4", "Spare!B2"}},
+		{"box excludes edges", "B2:C3", []string{"Plan!B2", "Plan!C3", "Spare!B2"}},
+		{"single cell", "B2", []string{"Plan!B2", "Spare!B2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, stream := range []bool{false, true} {
+				cfg := config.Config{LookupValue: "Alice", ScanRange: tt.scanRange, StreamWorkbook: stream}
+				got, err := deriveFixture(t, path, cfg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got.Ranges, tt.want) {
+					t.Errorf("stream=%v: ranges = %v, want %v", stream, got.Ranges, tt.want)
+				}
+			}
+		})
+	}
+
+	cfg := config.Config{LookupValue: "Alice", ScanRange: "E1:F9"}
+	if _, err := deriveFixture(t, path, cfg); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("match outside search_range: err = %v, want not found", err)
+	}
+}
+
+// deadlineAfter is a context whose deadline passes after its Err method has
+// been consulted checks times, standing in for a scan slow enough to outlive
+// -max-runtime.
+type deadlineAfter struct {
+	context.Context
+	checks int
+}
+
+func (d *deadlineAfter) Err() error {
+	if d.checks <= 0 {
+		return context.DeadlineExceeded
+	}
+	d.checks--
+	return nil
+}
+
+func TestScanStopsAtDeadline(t *testing.T) {
+	path := writeLargeWorkbook(t, 5000)
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream=%v", stream), func(t *testing.T) {
+			// The first check happens before the sheet is read, so the
+			// deadline passes partway through the rows.
+			ctx := &deadlineAfter{Context: context.Background(), checks: 2}
+			cfg := config.Config{LookupValue: "Alice", StreamWorkbook: stream}
+			_, err := deriveRangesFromExcel(ctx, path, cfg)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("err = %v, want deadline exceeded", err)
+			}
+			if !strings.Contains(err.Error(), "scan stopped on sheet Plan at row ") {
+				t.Errorf("err = %v, want it to say how far the scan got", err)
+			}
+		})
+	}
+}
+
+// cancelAfter cancels its context once Err has been consulted checks times,
+// as if the caller gave up partway through a scan.
+type cancelAfter struct {
+	context.Context
+	cancel context.CancelFunc
+	checks int
+}
+
+func (c *cancelAfter) Err() error {
+	if c.checks == 0 {
+		c.cancel()
+	}
+	c.checks--
+	return c.Context.Err()
+}
+
+func TestCancelBetweenSheets(t *testing.T) {
+	path := writeWorkbook(t,
+		fixtureSheet{name: "One", rows: [][]string{{"Alice"}}},
+		fixtureSheet{name: "Two", rows: [][]string{{"Alice"}}},
+		fixtureSheet{name: "Three", rows: [][]string{{"Alice"}}},
+	)
+	base, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Checks run before each sheet and at its first row: cancel once
+	// sheet One has been scanned.
+	ctx := &cancelAfter{Context: base, cancel: cancel, checks: 2}
+	start := time.Now()
+	_, err := deriveRangesFromExcel(ctx, path, config.Config{LookupValue: "Alice"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context canceled", err)
+	}
+	if !strings.Contains(err.Error(), "scan stopped before sheet Two") {
+		t.Errorf("err = %v, want it to name sheet Two", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancelled scan took %v", elapsed)
+	}
+}
+
+func TestCancelMidSheet(t *testing.T) {
+	path := writeLargeWorkbook(t, 20000)
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream=%v", stream), func(t *testing.T) {
+			base, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			ctx := &cancelAfter{Context: base, cancel: cancel, checks: 3}
+			_, err := deriveRangesFromExcel(ctx, path, config.Config{LookupValue: "Alice", StreamWorkbook: stream})
+			if !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "scan stopped on sheet Plan at row ") {
+				t.Fatalf("err = %v, want the row loop to stop with context canceled", err)
+			}
+		})
+	}
+}
+
+func TestPreCancelledScanAbortsQuickly(t *testing.T) {
+	path := writeLargeWorkbook(t, 50000)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream=%v", stream), func(t *testing.T) {
+			start := time.Now()
+			_, err := deriveRangesFromExcel(ctx, path, config.Config{LookupValue: "Alice", StreamWorkbook: stream})
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("err = %v, want context canceled", err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("pre-cancelled scan took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestHeaderRow(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{
+		{"Exported 2024-05-01", "Alice"},
+		{"Team A"},
+		{"Name", " Monday ", "Tuesday"},
+		{"x", "Alice", "y"},
+		{"x", "y", "Alice", "Alice"},
+	}})
+	tests := []struct {
+		name      string
+		headerRow int
+		want      []string
+	}{
+		{"row 3", 3, []string{"Monday", "Monday", "Tuesday", ""}},
+		{"row 1", 1, []string{"Alice", "Alice", "", ""}},
+		{"beyond the sheet", 9, []string{"", "", "", ""}},
+	}
+	for _, tt := range tests {
+		for _, stream := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/stream=%v", tt.name, stream), func(t *testing.T) {
+				cfg := config.Config{LookupValue: "Alice", HeaderRow: tt.headerRow, StreamWorkbook: stream}
+				der, err := deriveRangesFromExcel(context.Background(), path, cfg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var cells, headers []string
+				for _, m := range der.Matches {
+					cells = append(cells, m.A1)
+					headers = append(headers, m.Header)
+				}
+				// The scan still covers the rows above the header.
+				if want := []string{"Plan!B1", "Plan!B4", "Plan!C5", "Plan!D5"}; !reflect.DeepEqual(cells, want) {
+					t.Errorf("matches = %v, want %v", cells, want)
+				}
+				if !reflect.DeepEqual(headers, tt.want) {
+					t.Errorf("headers = %q, want %q", headers, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestLookupMatcherNumericTolerance(t *testing.T) {
+	tests := []struct {
+		name      string
+		lookup    string
+		tolerance float64
+		cell      string
+		want      bool
+	}{
+		{"trailing zero within tolerance", "3.1", 0.001, "3.10", true},
+		{"inside tolerance", "3.1", 0.01, "3.105", true},
+		{"on the boundary", "10", 0.5, "10.5", true},
+		{"outside tolerance", "3.1", 0.001, "3.2", false},
+		{"negative side", "-2", 0.1, " -2.05 ", true},
+		{"without tolerance text must match", "3.1", 0, "3.10", false},
+		{"without tolerance exact text", "3.1", 0, " 3.1 ", true},
+		{"non-numeric cell passes through", "3.1", 0.5, "three", false},
+		{"non-numeric lookup passes through", "Alice", 0.5, "Alice", true},
+		{"non-numeric lookup ignores numbers", "Alice", 0.5, "0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match := lookupMatcher(config.Config{LookupValue: tt.lookup, NumericTolerance: tt.tolerance})
+			if got := match(tt.cell); got != tt.want {
+				t.Errorf("match(%q) = %v, want %v", tt.cell, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNumericToleranceScan(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"3.10", "3.1", "3.2", "3.1x"}}})
+	for _, stream := range []bool{false, true} {
+		cfg := config.Config{LookupValue: "3.1", NumericTolerance: 0.01, StreamWorkbook: stream}
+		got, err := deriveFixture(t, path, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"Plan!A1", "Plan!B1"}; !reflect.DeepEqual(got.Ranges, want) {
+			t.Errorf("stream=%v: ranges = %v, want %v", stream, got.Ranges, want)
+		}
+	}
+}
+
+func BenchmarkScanSheet(b *testing.B) {
+	path := writeLargeWorkbook(b, 50000)
+	for _, stream := range []bool{false, true} {
+		b.Run(fmt.Sprintf("stream=%v", stream), func(b *testing.B) {
+			cfg := config.Config{LookupValue: "Alice", StreamWorkbook: stream}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := deriveFixture(b, path, cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// writeManySheets saves a workbook of n sheets, each rows-by-4, where every
+// 13th row holds the lookup value "Alice". Its cells are shared strings,
+// the table that parallel scans read from every worker.
+func writeManySheets(t testing.TB, n, rows int) string {
+	t.Helper()
+	var list []fixtureSheet
+	for s := 1; s <= n; s++ {
+		sh := fixtureSheet{name: fmt.Sprintf("Week %d", s)}
+		for r := 1; r <= rows; r++ {
+			row := []string{fmt.Sprintf("id-%d-%d", s, r), "filler", fmt.Sprintf("src-%d", r), "tail"}
+			if (r+s)%13 == 0 {
+				row[1] = "Alice"
+			}
+			sh.rows = append(sh.rows, row)
+		}
+		list = append(list, sh)
+	}
+	return writeWorkbook(t, list...)
+}
+
+// TestParallelScanMatchesSequential pins that scanning sheets in parallel
+// gives the sequential result. Run it with -race: it is the check that
+// excelize reads distinct sheets and the shared string table safely.
+func TestParallelScanMatchesSequential(t *testing.T) {
+	path := writeManySheets(t, 50, 60)
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream=%v", stream), func(t *testing.T) {
+			cfg := config.Config{LookupValue: "Alice", SourceColOffset: 1, StreamWorkbook: stream, ScanConcurrency: 1}
+			want, err := deriveFixture(t, path, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(want.Ranges) == 0 {
+				t.Fatal("fixture produced no matches")
+			}
+			for _, workers := range []int{2, 4, 8} {
+				cfg.ScanConcurrency = workers
+				got, err := deriveFixture(t, path, cfg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%d workers: ranges = %v, want %v", workers, got.Ranges, want.Ranges)
+				}
+			}
+		})
+	}
+}
+
+func TestConcurrentReadSafe(t *testing.T) {
+	path := writeManySheets(t, 2, 10)
+	tests := []struct {
+		name string
+		opts excelize.Options
+		want bool
+	}{
+		{"shared strings in memory", excelize.Options{}, true},
+		{"shared strings spilled to disk", excelize.Options{UnzipXMLSizeLimit: 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := excelize.OpenFile(path, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = f.Close() }()
+			if got := concurrentReadSafe(f); got != tt.want {
+				t.Errorf("concurrentReadSafe = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func BenchmarkScanSheets(b *testing.B) {
+	path := writeManySheets(b, 50, 400)
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			cfg := config.Config{LookupValue: "Alice", ScanConcurrency: workers}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := deriveFixture(b, path, cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestPerSheetMatchLimit(t *testing.T) {
+	path := writeWorkbook(t,
+		fixtureSheet{name: "Plan", rows: [][]string{{"Alice", "x", "Alice"}, {"x"}, {"x", "Alice"}, {"Alice"}}},
+		fixtureSheet{name: "Week2", rows: [][]string{{"x"}, {"Alice"}}},
+	)
+	tests := []struct {
+		limit   string
+		want    []string
+		stopped []string
+		wantErr string
+	}{
+		{"", []string{"Plan!A1", "Plan!C1", "Plan!B3", "Plan!A4", "Week2!A2"}, nil, ""},
+		{"all", []string{"Plan!A1", "Plan!C1", "Plan!B3", "Plan!A4", "Week2!A2"}, nil, ""},
+		{"1", []string{"Plan!A1", "Week2!A2"}, []string{
+			"Plan: stopped at row 1, per_sheet_match_limit 1 reached",
+			"Week2: stopped at row 2, per_sheet_match_limit 1 reached",
+		}, ""},
+		{"3", []string{"Plan!A1", "Plan!C1", "Plan!B3", "Week2!A2"}, []string{
+			"Plan: stopped at row 3, per_sheet_match_limit 3 reached",
+		}, ""},
+		{"1-strict", nil, nil, `lookup value "Alice" appears more than 1 time on sheet Plan (Plan!A1, Plan!C1); per_sheet_match_limit is 1-strict`},
+		{"3-strict", nil, nil, `appears more than 3 times on sheet Plan (Plan!A1, Plan!C1, Plan!B3, Plan!A4)`},
+		{"4-strict", []string{"Plan!A1", "Plan!C1", "Plan!B3", "Plan!A4", "Week2!A2"}, nil, ""},
+	}
+	for _, tt := range tests {
+		for _, stream := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/stream=%v", tt.limit, stream), func(t *testing.T) {
+				cfg := config.Config{LookupValue: "Alice", PerSheetMatchLimit: tt.limit, StreamWorkbook: stream}
+				der, err := deriveRangesFromExcel(context.Background(), path, cfg)
+				if tt.wantErr != "" {
+					if !errors.Is(err, ErrAnchorNotUnique) || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Fatalf("err = %v, want %q", err, tt.wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				var cells []string
+				for _, m := range der.Matches {
+					cells = append(cells, m.A1)
+				}
+				if !reflect.DeepEqual(cells, tt.want) {
+					t.Errorf("matches = %v, want %v", cells, tt.want)
+				}
+				if !reflect.DeepEqual(der.Stopped, tt.stopped) {
+					t.Errorf("stopped = %q, want %q", der.Stopped, tt.stopped)
+				}
+			})
+		}
+	}
+}
+
+func TestStoppedEarlyInSummary(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}, {"Alice"}}})
+	cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path, TargetColOffset: 1, PerSheetMatchLimit: "1"}
+	summary, err := update(context.Background(), newFakeService(t, &fakeSheets{}), cfg, Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Plan: stopped at row 1, per_sheet_match_limit 1 reached"}; !reflect.DeepEqual(summary.StoppedEarly, want) {
+		t.Errorf("stopped early = %q, want %q", summary.StoppedEarly, want)
+	}
+	if want := []string{"Plan!B1"}; !reflect.DeepEqual(summary.Ranges, want) {
+		t.Errorf("ranges = %v, want %v", summary.Ranges, want)
+	}
+}
+
+func TestMaxScanLimits(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{
+		{"Alice", "x", "x", "Alice"},
+		{"x"},
+		{"x", "Alice"},
+		{},
+		{"Alice"},
+	}})
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetDefinedName(&excelize.DefinedName{Name: "Block", RefersTo: "Plan!$A$1:$D$3"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Save(); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	tests := []struct {
+		name      string
+		cfg       config.Config
+		want      []string
+		truncated []string
+	}{
+		{"rows", config.Config{MaxScanRows: 3},
+			[]string{"Plan!A1", "Plan!D1", "Plan!B3"}, []string{"Plan: rows after 3 (max_scan_rows) not scanned"}},
+		{"columns", config.Config{MaxScanCols: 2},
+			[]string{"Plan!A1", "Plan!B3", "Plan!A5"}, []string{"Plan: columns after B (max_scan_cols) not scanned"}},
+		{"rows and columns", config.Config{MaxScanRows: 3, MaxScanCols: 2},
+			[]string{"Plan!A1", "Plan!B3"}, []string{"Plan: rows after 3 (max_scan_rows) and columns after B (max_scan_cols) not scanned"}},
+		{"limits past the data", config.Config{MaxScanRows: 10, MaxScanCols: 10},
+			[]string{"Plan!A1", "Plan!D1", "Plan!B3", "Plan!A5"}, nil},
+		{"search_range smaller than the limit", config.Config{ScanRange: "A1:D3", MaxScanRows: 10},
+			[]string{"Plan!A1", "Plan!D1", "Plan!B3"}, nil},
+		{"limit inside search_range", config.Config{ScanRange: "B1:D5", MaxScanRows: 2},
+			[]string{"Plan!D1"}, []string{"Plan: rows after 2 (max_scan_rows) not scanned"}},
+		{"limit inside a defined name", config.Config{SearchDefinedName: "Block", MaxScanRows: 2, MaxScanCols: 3},
+			[]string{"Plan!A1"}, []string{"Plan: rows after 2 (max_scan_rows) and columns after C (max_scan_cols) not scanned"}},
+		{"defined name smaller than the limit", config.Config{SearchDefinedName: "Block", MaxScanRows: 10},
+			[]string{"Plan!A1", "Plan!D1", "Plan!B3"}, nil},
+	}
+	for _, tt := range tests {
+		for _, stream := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/stream=%v", tt.name, stream), func(t *testing.T) {
+				cfg := tt.cfg
+				cfg.LookupValue, cfg.StreamWorkbook = "Alice", stream
+				der, err := deriveRangesFromExcel(context.Background(), path, cfg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var cells []string
+				for _, m := range der.Matches {
+					cells = append(cells, m.A1)
+				}
+				if !reflect.DeepEqual(cells, tt.want) {
+					t.Errorf("matches = %v, want %v", cells, tt.want)
+				}
+				if !reflect.DeepEqual(der.Truncated, tt.truncated) {
+					t.Errorf("truncated = %q, want %q", der.Truncated, tt.truncated)
+				}
+			})
+		}
+	}
+}
+
+func TestScanTruncatedInSummary(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}, {"x"}, {"Alice"}}})
+	cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path, TargetColOffset: 1, MaxScanRows: 2}
+	summary, err := update(context.Background(), newFakeService(t, &fakeSheets{}), cfg, Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Plan: rows after 2 (max_scan_rows) not scanned"}; !reflect.DeepEqual(summary.ScanTruncated, want) {
+		t.Errorf("scan truncated = %q, want %q", summary.ScanTruncated, want)
+	}
+	if want := []string{"Plan!B1"}; !reflect.DeepEqual(summary.Ranges, want) {
+		t.Errorf("ranges = %v, want %v", summary.Ranges, want)
+	}
+}
@@ -0,0 +1,86 @@
+package sheets
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+	"gopkg.in/yaml.v3"
+
+	"update-google-sheets/src/config"
+)
+
+// workbookSchema is the structure schema_file expects of the workbook.
+type workbookSchema struct {
+	Sheets []sheetSchema `yaml:"sheets"`
+}
+
+// sheetSchema names a sheet the workbook must have and the labels its
+// header_row must hold from column A onwards; a blank label accepts any.
+type sheetSchema struct {
+	Name    string   `yaml:"name"`
+	Headers []string `yaml:"headers,omitempty"`
+}
+
+// loadSchema reads schema_file. Unknown keys are rejected so a misspelt
+// expectation is not silently skipped.
+func loadSchema(path string) (workbookSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return workbookSchema{}, fmt.Errorf("read schema_file: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var schema workbookSchema
+	if err := dec.Decode(&schema); err != nil {
+		return workbookSchema{}, fmt.Errorf("parse schema_file %s: %w", path, err)
+	}
+	for i, s := range schema.Sheets {
+		if strings.TrimSpace(s.Name) == "" {
+			return workbookSchema{}, fmt.Errorf("schema_file %s: sheets[%d] needs a name", path, i)
+		}
+	}
+	return schema, nil
+}
+
+// validateWorkbookSchema checks f against cfg's schema_file and lists every
+// missing sheet and header that differs, so structural drift in the
+// workbook fails the run before anything is derived from it.
+func validateWorkbookSchema(f *excelize.File, cfg config.Config) error {
+	if cfg.SchemaFile == "" {
+		return nil
+	}
+	schema, err := loadSchema(cfg.SchemaFile)
+	if err != nil {
+		return err
+	}
+	all := f.GetSheetList()
+	var problems []string
+	for _, s := range schema.Sheets {
+		if !slices.Contains(all, s.Name) {
+			problems = append(problems, notFound(s.Name, suggestSheets(s.Name, all)))
+			continue
+		}
+		for i, want := range s.Headers {
+			want = strings.TrimSpace(want)
+			if want == "" {
+				continue
+			}
+			cell, _ := excelize.CoordinatesToCellName(i+1, cfg.HeaderRow)
+			got, err := f.GetCellValue(s.Name, cell)
+			if err != nil {
+				return fmt.Errorf("read %s!%s: %w", s.Name, cell, err)
+			}
+			if got = strings.TrimSpace(got); got != want {
+				problems = append(problems, fmt.Sprintf("%s: expected header %q, found %q", formatRange(s.Name, cell), want, got))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return tag(ErrSchemaMismatch, fmt.Errorf("workbook does not match schema_file %s: %s", cfg.SchemaFile, strings.Join(problems, "; ")))
+	}
+	return nil
+}
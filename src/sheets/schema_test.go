@@ -0,0 +1,111 @@
+package sheets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"update-google-sheets/src/config"
+)
+
+func TestValidateWorkbookSchema(t *testing.T) {
+	path := writeWorkbook(t,
+		fixtureSheet{name: "Week 1", rows: [][]string{{"Day", "Morning", " Evening "}, {"Mon", "Alice", "Bob"}}},
+		fixtureSheet{name: "Notes", rows: [][]string{{"Text"}}},
+	)
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+
+	tests := []struct {
+		name      string
+		schema    string
+		headerRow int
+		wantErr   []string
+	}{
+		{
+			name:   "matching workbook",
+			schema: "sheets:\n  - name: Week 1\n    headers: [Day, Morning, Evening]\n  - name: Notes\n",
+		},
+		{
+			name:   "blank label accepts any header",
+			schema: "sheets:\n  - name: Week 1\n    headers: [\"\", Morning]\n",
+		},
+		{
+			name:    "missing sheet with suggestion",
+			schema:  "sheets:\n  - name: week 1\n  - name: Archive\n",
+			wantErr: []string{`sheet "week 1" not found (did you mean "Week 1"?)`, `sheet "Archive" not found`},
+		},
+		{
+			name:    "renamed and missing headers",
+			schema:  "sheets:\n  - name: Week 1\n    headers: [Day, Afternoon, Evening, Night]\n",
+			wantErr: []string{`'Week 1'!B1: expected header "Afternoon", found "Morning"`, `'Week 1'!D1: expected header "Night", found ""`},
+		},
+		{
+			name:      "headers read from header_row",
+			schema:    "sheets:\n  - name: Week 1\n    headers: [Day]\n",
+			headerRow: 2,
+			wantErr:   []string{`'Week 1'!A2: expected header "Day", found "Mon"`},
+		},
+		{
+			name:    "unknown key",
+			schema:  "sheets:\n  - name: Week 1\n    header: [Day]\n",
+			wantErr: []string{"field header not found"},
+		},
+		{
+			name:    "sheet without a name",
+			schema:  "sheets:\n  - headers: [Day]\n",
+			wantErr: []string{"sheets[0] needs a name"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := filepath.Join(t.TempDir(), "schema.yaml")
+			if err := os.WriteFile(schema, []byte(tt.schema), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cfg := config.Config{SchemaFile: schema, HeaderRow: max(tt.headerRow, 1)}
+			err := validateWorkbookSchema(f, cfg)
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("schema violation passed")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("err = %v, want it to mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSchemaMismatchIsTagged(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	schema := filepath.Join(t.TempDir(), "schema.yaml")
+	if err := os.WriteFile(schema, []byte("sheets:\n  - name: Roster\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err = validateWorkbookSchema(f, config.Config{SchemaFile: schema, HeaderRow: 1})
+	if !errors.Is(err, ErrSchemaMismatch) {
+		t.Errorf("err = %v, want ErrSchemaMismatch", err)
+	}
+	if err := validateWorkbookSchema(f, config.Config{}); err != nil {
+		t.Errorf("without schema_file: %v", err)
+	}
+}
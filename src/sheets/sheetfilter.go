@@ -0,0 +1,182 @@
+package sheets
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"update-google-sheets/src/config"
+)
+
+// selectSheets applies config_sheet, then sheet_regex, to the sheets of f.
+// With workbook_log, the SyncLog audit trail is not a template and is left
+// out unless named explicitly, so it is never matched and never counted by
+// #N indexes.
+func selectSheets(f *excelize.File, cfg config.Config) ([]string, []string, error) {
+	all := f.GetSheetList()
+	if cfg.WorkbookLog && !slices.Contains(cfg.SheetFilter, WorkbookLogSheet) {
+		all = slices.DeleteFunc(all, func(s string) bool { return s == WorkbookLogSheet })
+	}
+	kept, resolved, err := filterSheets(all, cfg.SheetFilter, cfg.SheetFilterFoldsCase())
+	if err != nil {
+		return nil, nil, err
+	}
+	if re := cfg.SheetPattern(); re != nil {
+		candidates := kept
+		kept = slices.DeleteFunc(slices.Clone(kept), func(s string) bool { return !re.MatchString(s) })
+		if len(kept) == 0 {
+			return nil, nil, fmt.Errorf("sheet_regex %q matches none of %s", cfg.SheetRegex, quoteList(candidates))
+		}
+	}
+	return kept, resolved, nil
+}
+
+// checkOverrideSheets fails when sheet_overrides names a sheet the workbook
+// does not have, since its settings would otherwise never apply.
+func checkOverrideSheets(f *excelize.File, cfg config.Config) error {
+	all := f.GetSheetList()
+	var problems []string
+	for _, sheet := range cfg.OverrideSheets() {
+		if !slices.Contains(all, sheet) {
+			problems = append(problems, notFound(sheet, suggestSheets(sheet, all)))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("sheet_overrides: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// maxSuggestions caps the "did you mean" names offered for one filter.
+const maxSuggestions = 3
+
+// filterSheets keeps the sheets named in filters, in workbook order, and
+// returns how each index filter was resolved, e.g. "#1 = Week 42". An
+// empty filter keeps every sheet. A filter such as #1 or #-1 picks a sheet
+// by its 1-based position, negative counting from the end. Any other
+// filter matches its sheet exactly or, failing that, once both are trimmed
+// and, with fold, case-folded; an exact match always wins over normalised
+// ones. Filters that match nothing, or several sheets only after
+// normalising, are reported in the error along with the closest sheet names.
+func filterSheets(all []string, filters []string, fold bool) ([]string, []string, error) {
+	if len(filters) == 0 {
+		return all, nil, nil
+	}
+	norm := func(s string) string {
+		s = strings.TrimSpace(s)
+		if fold {
+			s = strings.ToLower(s)
+		}
+		return s
+	}
+	keep := make(map[string]bool, len(filters))
+	var problems, resolved []string
+	for _, f := range filters {
+		if i, ok := config.SheetIndex(f); ok {
+			if i < 0 {
+				i += len(all) + 1
+			}
+			if i < 1 || i > len(all) {
+				problems = append(problems, fmt.Sprintf("sheet index %s is out of range; the workbook has %s", f, plural(len(all), "sheet")))
+				continue
+			}
+			keep[all[i-1]] = true
+			resolved = append(resolved, fmt.Sprintf("%s = %s", f, all[i-1]))
+			continue
+		}
+		if slices.Contains(all, f) {
+			keep[f] = true
+			continue
+		}
+		var near []string
+		for _, s := range all {
+			if norm(s) == norm(f) {
+				near = append(near, s)
+			}
+		}
+		switch len(near) {
+		case 1:
+			keep[near[0]] = true
+		case 0:
+			problems = append(problems, notFound(f, suggestSheets(f, all)))
+		default:
+			problems = append(problems, fmt.Sprintf("%q matches several sheets (%s); use the exact name", f, quoteList(near)))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, nil, fmt.Errorf("sheet filter: %s", strings.Join(problems, "; "))
+	}
+	var kept []string
+	for _, s := range all {
+		if keep[s] {
+			kept = append(kept, s)
+		}
+	}
+	return kept, resolved, nil
+}
+
+func notFound(filter string, suggestions []string) string {
+	if len(suggestions) == 0 {
+		return fmt.Sprintf("sheet %q not found", filter)
+	}
+	return fmt.Sprintf("sheet %q not found (did you mean %s?)", filter, quoteList(suggestions))
+}
+
+// suggestSheets returns up to maxSuggestions sheet names within a small
+// edit distance of filter, nearest first. Case and surrounding spaces are
+// ignored here whatever the filter setting, since they make the likeliest
+// typos.
+func suggestSheets(filter string, all []string) []string {
+	norm := func(s string) string { return strings.ToLower(strings.TrimSpace(s)) }
+	type scored struct {
+		name string
+		dist int
+	}
+	want := norm(filter)
+	limit := max(2, len([]rune(want))/3)
+	var found []scored
+	for _, s := range all {
+		if d := editDistance(want, norm(s)); d <= limit {
+			found = append(found, scored{s, d})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].dist < found[j].dist })
+	var names []string
+	for _, s := range found[:min(len(found), maxSuggestions)] {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+// editDistance is the Levenshtein distance between a and b, in runes.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func quoteList(names []string) string {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = fmt.Sprintf("%q", n)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,93 @@
+package sheets
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"update-google-sheets/src/config"
+)
+
+func TestSelectSheetsRegex(t *testing.T) {
+	f := excelize.NewFile()
+	t.Cleanup(func() { _ = f.Close() })
+	for _, name := range []string{"Week1", "Week 2", "Summary", "Week10", "week3"} {
+		if _, err := f.NewSheet(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.DeleteSheet("Sheet1"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		filter  config.SheetList
+		regex   string
+		want    []string
+		wantErr string
+	}{
+		{name: "no regex", want: []string{"Week1", "Week 2", "Summary", "Week10", "week3"}},
+		{name: "week tabs", regex: `^Week\d+$`, want: []string{"Week1", "Week10"}},
+		{name: "case-insensitive pattern", regex: `(?i)^week\d+$`, want: []string{"Week1", "Week10", "week3"}},
+		{name: "narrows config_sheet", filter: config.SheetList{"Week1", "Summary", "Week 2"}, regex: `^Week`, want: []string{"Week1", "Week 2"}},
+		{name: "matches nothing", filter: config.SheetList{"Summary"}, regex: `^Week\d+$`, wantErr: `matches none of "Summary"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{SheetFilter: tt.filter, SheetRegex: tt.regex}
+			got, _, err := selectSheets(f, cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sheets = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterSheetsIndex(t *testing.T) {
+	all := []string{"Summary", "Week 41", "Week 42"}
+	tests := []struct {
+		name         string
+		filters      []string
+		want         []string
+		wantResolved []string
+		wantErr      string
+	}{
+		{"first", []string{"#1"}, []string{"Summary"}, []string{"#1 = Summary"}, ""},
+		{"last", []string{"#3"}, []string{"Week 42"}, []string{"#3 = Week 42"}, ""},
+		{"from the end", []string{"#-1"}, []string{"Week 42"}, []string{"#-1 = Week 42"}, ""},
+		{"first from the end", []string{"#-3"}, []string{"Summary"}, []string{"#-3 = Summary"}, ""},
+		{"kept in workbook order", []string{"#-1", "Week 41"}, []string{"Week 41", "Week 42"}, []string{"#-1 = Week 42"}, ""},
+		{"past the end", []string{"#4"}, nil, nil, "sheet index #4 is out of range; the workbook has 3 sheets"},
+		{"before the start", []string{"#-4"}, nil, nil, "sheet index #-4 is out of range; the workbook has 3 sheets"},
+		{"zero is a name", []string{"#0"}, nil, nil, `sheet "#0" not found`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, resolved, err := filterSheets(all, tt.filters, true)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(resolved, tt.wantResolved) {
+				t.Errorf("sheets = %q resolved %q, want %q resolved %q", got, resolved, tt.want, tt.wantResolved)
+			}
+		})
+	}
+}
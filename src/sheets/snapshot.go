@@ -0,0 +1,129 @@
+package sheets
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+// unsafeFileChars percent-encodes the characters file names cannot hold,
+// and % itself, so every tab name maps to its own file: "a/b" becomes
+// a%2Fb.csv and never collides with a tab named "a_b".
+var unsafeFileChars = strings.NewReplacer("%", "%25", "/", "%2F", `\`, "%5C", ":", "%3A", "*", "%2A", "?", "%3F", `"`, "%22", "<", "%3C", ">", "%3E", "|", "%7C")
+
+// takeSnapshot saves the tabs ranges touch under snapshot_dir before the
+// run changes them, recording the directory in summary. Tabs it could not
+// save are listed in summary.SnapshotSkipped, or fail the run under
+// snapshot_policy: fail.
+func takeSnapshot(ctx context.Context, svc *sheets.Service, cfg config.Config, ranges []string, summary *Summary) error {
+	if cfg.SnapshotDir == "" {
+		return nil
+	}
+	dir, problems, err := snapshotTabs(ctx, svc, cfg, summary.RunID, uniqueSheetNames(ranges))
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	summary.Snapshot = dir
+	if len(problems) > 0 && cfg.SnapshotPolicy == config.SnapshotPolicyFail {
+		return fmt.Errorf("snapshot incomplete, nothing written (snapshot_policy: %s): %s", cfg.SnapshotPolicy, strings.Join(problems, "; "))
+	}
+	summary.SnapshotSkipped = problems
+	return nil
+}
+
+// snapshotTabs writes each of tabs as <name>.csv into snapshot_dir/<runID>
+// and returns that directory along with the tabs it had to leave out.
+func snapshotTabs(ctx context.Context, svc *sheets.Service, cfg config.Config, runID string, tabs []string) (string, []string, error) {
+	meta, err := fetchMetadata(ctx, svc, cfg.SpreadsheetID)
+	if err != nil {
+		return "", nil, err
+	}
+	var (
+		ranges   []string
+		names    []string
+		problems []string
+	)
+	for _, tab := range tabs {
+		id, ok := meta.sheetIDByTitle(tab)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: not found in spreadsheet", tab))
+			continue
+		}
+		grid := meta.sheets[id].GridProperties
+		if grid == nil || grid.RowCount == 0 || grid.ColumnCount == 0 {
+			problems = append(problems, fmt.Sprintf("%s: not a grid sheet", tab))
+			continue
+		}
+		if cells := grid.RowCount * grid.ColumnCount; cells > int64(cfg.SnapshotCellLimit()) {
+			problems = append(problems, fmt.Sprintf("%s: %d cells exceed snapshot_max_cells %d", tab, cells, cfg.SnapshotCellLimit()))
+			continue
+		}
+		last, err := excelize.CoordinatesToCellName(int(grid.ColumnCount), int(grid.RowCount))
+		if err != nil {
+			return "", problems, fmt.Errorf("snapshot %s: %w", tab, err)
+		}
+		ranges = append(ranges, formatRange(tab, "A1:"+last))
+		names = append(names, tab)
+	}
+	if len(ranges) == 0 {
+		return "", problems, nil
+	}
+	resp, err := svc.Spreadsheets.Values.BatchGet(cfg.SpreadsheetID).
+		Ranges(ranges...).
+		ValueRenderOption("FORMULA").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return "", problems, fmt.Errorf("download tabs for snapshot: %w", err)
+	}
+	if len(resp.ValueRanges) != len(names) {
+		return "", problems, fmt.Errorf("download tabs for snapshot: got %d ranges, asked for %d", len(resp.ValueRanges), len(names))
+	}
+	dir := filepath.Join(cfg.SnapshotDir, runID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", problems, fmt.Errorf("create snapshot directory: %w", err)
+	}
+	for i, vr := range resp.ValueRanges {
+		path := filepath.Join(dir, unsafeFileChars.Replace(names[i])+".csv")
+		if err := writeSnapshotCSV(path, vr.Values); err != nil {
+			return dir, problems, err
+		}
+	}
+	return dir, problems, nil
+}
+
+// writeSnapshotCSV writes values, formulas included, to path.
+func writeSnapshotCSV(path string, values [][]interface{}) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	w := csv.NewWriter(f)
+	for _, row := range values {
+		record := make([]string, len(row))
+		for i, v := range row {
+			record[i] = fmt.Sprint(v)
+		}
+		if err := w.Write(record); err != nil {
+			f.Close()
+			return fmt.Errorf("write snapshot %s: %w", path, err)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return fmt.Errorf("write snapshot %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write snapshot %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package sheets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+func TestSnapshot(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	meta := sheets.Spreadsheet{Sheets: []*sheets.Sheet{{Properties: &sheets.SheetProperties{
+		SheetId: 1, Title: "Plan", GridProperties: &sheets.GridProperties{RowCount: 2, ColumnCount: 3},
+	}}}}
+	tests := []struct {
+		name     string
+		cfg      config.Config
+		opts     Options
+		wantCSV  string
+		skipped  string
+		wantErr  string
+		noWrites bool
+	}{
+		{name: "saves the tab", wantCSV: "Alice,,=SUM(A2:B2)\n1,2,3\n"},
+		{name: "tab over snapshot_max_cells warns",
+			cfg:     config.Config{SnapshotMaxCells: 5},
+			skipped: "Plan: 6 cells exceed snapshot_max_cells 5"},
+		{name: "tab over snapshot_max_cells fails",
+			cfg:      config.Config{SnapshotMaxCells: 5, SnapshotPolicy: config.SnapshotPolicyFail},
+			wantErr:  "snapshot incomplete, nothing written (snapshot_policy: fail): Plan: 6 cells exceed snapshot_max_cells 5",
+			noWrites: true},
+		{name: "dry run takes none", opts: Options{DryRun: true}, noWrites: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSheets{
+				meta: meta,
+				renders: map[string]map[string][][]interface{}{"FORMULA": {
+					"Plan!A1:C2": {{"Alice", "", "=SUM(A2:B2)"}, {"1", "2", "3"}},
+				}},
+			}
+			cfg := tt.cfg
+			cfg.SpreadsheetID, cfg.LookupValue, cfg.Workbook = "sheet-id", "Alice", path
+			cfg.TargetColOffset = 1
+			cfg.SnapshotDir = filepath.Join(t.TempDir(), "snapshots")
+			summary, err := update(context.Background(), newFakeService(t, fake), cfg, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(fake.written) == 0; got != tt.noWrites {
+				t.Errorf("written = %v, want none %v", fake.writes(), tt.noWrites)
+			}
+			if got := strings.Join(summary.SnapshotSkipped, "; "); got != tt.skipped {
+				t.Errorf("snapshot skipped = %q, want %q", got, tt.skipped)
+			}
+			if tt.wantCSV == "" {
+				if _, err := os.Stat(filepath.Join(cfg.SnapshotDir, summary.RunID, "Plan.csv")); !os.IsNotExist(err) {
+					t.Errorf("Plan.csv saved (stat err %v), want no snapshot", err)
+				}
+				return
+			}
+			if want := filepath.Join(cfg.SnapshotDir, summary.RunID); summary.Snapshot != want {
+				t.Errorf("snapshot = %q, want %q", summary.Snapshot, want)
+			}
+			data, err := os.ReadFile(filepath.Join(summary.Snapshot, "Plan.csv"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.wantCSV {
+				t.Errorf("Plan.csv = %q, want %q", data, tt.wantCSV)
+			}
+		})
+	}
+}
+
+func TestSnapshotFileNames(t *testing.T) {
+	var props []*sheets.Sheet
+	cells := map[string][][]interface{}{}
+	tabs := []string{"a/b", "a_b", "a%2Fb", "Q1: plan?"}
+	for i, tab := range tabs {
+		props = append(props, &sheets.Sheet{Properties: &sheets.SheetProperties{
+			SheetId: int64(i + 1), Title: tab, GridProperties: &sheets.GridProperties{RowCount: 1, ColumnCount: 1},
+		}})
+		cells[formatRange(tab, "A1:A1")] = [][]interface{}{{tab}}
+	}
+	fake := &fakeSheets{meta: sheets.Spreadsheet{Sheets: props}, cells: cells}
+	cfg := config.Config{SpreadsheetID: "sheet-id", SnapshotDir: t.TempDir()}
+	dir, problems, err := snapshotTabs(context.Background(), newFakeService(t, fake), cfg, "run", tabs)
+	if err != nil || len(problems) > 0 {
+		t.Fatalf("snapshotTabs: %v, %q", err, problems)
+	}
+	want := map[string]string{
+		"a%2Fb.csv":         "a/b",
+		"a_b.csv":           "a_b",
+		"a%252Fb.csv":       "a%2Fb",
+		"Q1%3A plan%3F.csv": "Q1: plan?",
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(want) {
+		t.Errorf("saved %d files, want %d", len(entries), len(want))
+	}
+	for name, tab := range want {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got := strings.TrimSpace(string(data)); got != tab {
+			t.Errorf("%s holds %q, want tab %q", name, got, tab)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package sheets
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+// ValueSource supplies the ranges a run writes and their values, in place
+// of scanning the workbook. values[i] belongs to ranges[i]: a single value
+// fills every cell of the range, and otherwise it holds one value per
+// cell, left to right, top to bottom. Each range must name its sheet.
+type ValueSource interface {
+	Values(ctx context.Context, cfg config.Config) (ranges []string, values [][]interface{}, err error)
+}
+
+// ExcelSource is the workbook scan a run performs without a ValueSource,
+// as one: the targets derived from cfg.Workbook, or from Workbook when it
+// is set. A run given an ExcelSource scans the workbook itself, so its
+// summary keeps the matches and skipped matches Values cannot return.
+type ExcelSource struct {
+	Workbook *Workbook
+}
+
+// Values scans the workbook for cfg.LookupValue.
+func (s ExcelSource) Values(ctx context.Context, cfg config.Config) ([]string, [][]interface{}, error) {
+	d, err := s.derive(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	ranges, values := sourceValues(d.Targets)
+	return ranges, values, nil
+}
+
+func (s ExcelSource) derive(ctx context.Context, cfg config.Config) (derivation, error) {
+	if s.Workbook != nil {
+		return deriveTargets(ctx, s.Workbook, cfg)
+	}
+	return deriveRangesFromExcel(ctx, cfg.Workbook, cfg)
+}
+
+// NamedRangeSource writes Value into every cell of the named ranges Names
+// of cfg.SpreadsheetID, looked up through Service.
+type NamedRangeSource struct {
+	Service *sheets.Service
+	Names   []string
+	Value   interface{}
+}
+
+// Values resolves Names to their ranges, each filled with Value.
+func (s NamedRangeSource) Values(ctx context.Context, cfg config.Config) ([]string, [][]interface{}, error) {
+	meta, err := fetchMetadata(ctx, s.Service, cfg.SpreadsheetID)
+	if err != nil {
+		return nil, nil, err
+	}
+	targets, err := resolveNamedRanges(meta, s.Names, s.Value)
+	if err != nil {
+		return nil, nil, err
+	}
+	ranges, values := sourceValues(targets)
+	return ranges, values, nil
+}
+
+// sourceValues lists targets the way a ValueSource returns them.
+func sourceValues(targets []target) ([]string, [][]interface{}) {
+	ranges := make([]string, len(targets))
+	values := make([][]interface{}, len(targets))
+	for i, t := range targets {
+		ranges[i] = t.Range
+		for _, row := range t.Values {
+			values[i] = append(values[i], row...)
+		}
+	}
+	return ranges, values
+}
+
+// StaticSource writes Value into every cell of Ranges.
+type StaticSource struct {
+	Ranges []string
+	Value  interface{}
+}
+
+// Values returns Ranges, each with Value.
+func (s StaticSource) Values(context.Context, config.Config) ([]string, [][]interface{}, error) {
+	values := make([][]interface{}, len(s.Ranges))
+	for i := range values {
+		values[i] = []interface{}{s.Value}
+	}
+	return s.Ranges, values, nil
+}
+
+// sourceTargets asks src for the run's ranges and turns them into targets.
+func sourceTargets(ctx context.Context, src ValueSource, cfg config.Config) ([]target, error) {
+	ranges, values, err := src.Values(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("value source: %w", err)
+	}
+	if len(values) != len(ranges) {
+		return nil, fmt.Errorf("value source returned %d ranges but %d value lists", len(ranges), len(values))
+	}
+	targets := make([]target, 0, len(ranges))
+	for i, rng := range ranges {
+		if len(values[i]) == 0 {
+			return nil, fmt.Errorf("value source: range %s has no values", rng)
+		}
+		t, err := importTarget(rng, values[i][0])
+		if err != nil {
+			return nil, fmt.Errorf("value source: %w", err)
+		}
+		if len(values[i]) > 1 {
+			rows, cols := len(t.Values), len(t.Values[0])
+			if len(values[i]) != rows*cols {
+				return nil, fmt.Errorf("value source: range %s has %d cells but %d values", rng, rows*cols, len(values[i]))
+			}
+			for r := range t.Values {
+				copy(t.Values[r], values[i][r*cols:(r+1)*cols])
+			}
+		}
+		t.Anchor = fmt.Sprintf("value source range %d", i+1)
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
@@ -0,0 +1,148 @@
+package sheets
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+// memorySource is a ValueSource over fixed ranges and values.
+type memorySource struct {
+	ranges []string
+	values [][]interface{}
+	err    error
+	calls  int
+}
+
+func (s *memorySource) Values(context.Context, config.Config) ([]string, [][]interface{}, error) {
+	s.calls++
+	return s.ranges, s.values, s.err
+}
+
+func TestCustomValueSource(t *testing.T) {
+	src := &memorySource{
+		ranges: []string{"Plan!B2", "'Week 2'!A1:B2", "Plan!D1:D2"},
+		values: [][]interface{}{{"Alice"}, {1, 2, 3, 4}, {"fill"}},
+	}
+	fake := &fakeSheets{}
+	cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "unused", Workbook: "does-not-exist.xlsx"}
+	summary, err := update(context.Background(), newFakeService(t, fake), cfg, Options{Source: src})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.calls != 1 {
+		t.Errorf("source asked %d times, want 1", src.calls)
+	}
+	got := map[string][][]interface{}{}
+	for _, vr := range fake.written {
+		got[vr.Range] = vr.Values
+	}
+	want := map[string][][]interface{}{
+		"Plan!B2":        {{"Alice"}},
+		"'Week 2'!A1:B2": {{float64(1), float64(2)}, {float64(3), float64(4)}},
+		"Plan!D1:D2":     {{"fill"}, {"fill"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("written = %v, want %v", got, want)
+	}
+	if summary.TotalCells != 7 {
+		t.Errorf("TotalCells = %d, want 7", summary.TotalCells)
+	}
+}
+
+func TestValueSourceErrors(t *testing.T) {
+	boom := errors.New("backend down")
+	tests := []struct {
+		name    string
+		src     *memorySource
+		wantErr string
+	}{
+		{"source error", &memorySource{err: boom}, "value source: backend down"},
+		{"length mismatch", &memorySource{ranges: []string{"Plan!A1", "Plan!A2"}, values: [][]interface{}{{"x"}}}, "2 ranges but 1 value lists"},
+		{"no values", &memorySource{ranges: []string{"Plan!A1"}, values: [][]interface{}{{}}}, "range Plan!A1 has no values"},
+		{"wrong cell count", &memorySource{ranges: []string{"Plan!A1:B2"}, values: [][]interface{}{{1, 2, 3}}}, "has 4 cells but 3 values"},
+		{"no sheet", &memorySource{ranges: []string{"A1"}, values: [][]interface{}{{"x"}}}, "must include the sheet name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := sourceTargets(context.Background(), tt.src, config.Config{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuiltInSources(t *testing.T) {
+	ctx := context.Background()
+	ranges, values, err := StaticSource{Ranges: []string{"Plan!A1", "Plan!B1:C1"}, Value: "x"}.Values(ctx, config.Config{})
+	if err != nil || !reflect.DeepEqual(ranges, []string{"Plan!A1", "Plan!B1:C1"}) || !reflect.DeepEqual(values, [][]interface{}{{"x"}, {"x"}}) {
+		t.Errorf("StaticSource = %v, %v, %v", ranges, values, err)
+	}
+
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice", "Bob"}, {"", "Alice"}}})
+	cfg := config.Config{LookupValue: "Alice", Workbook: path, WriteValue: "Present"}
+	ranges, values, err = ExcelSource{}.Values(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ranges, []string{"Plan!A1", "Plan!B2"}) || !reflect.DeepEqual(values, [][]interface{}{{"Present"}, {"Present"}}) {
+		t.Errorf("ExcelSource = %v, %v", ranges, values)
+	}
+}
+
+func TestExcelSourceKeepsMatches(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}, {"Alice"}}})
+	one := 1
+	cfg := config.Config{
+		SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path, TargetColOffset: 1,
+		SheetOverrides: map[string]config.Override{"Plan": {MaxMatches: &one}},
+	}
+	scan, err := update(context.Background(), newFakeService(t, &fakeSheets{}), cfg, Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scan.Matches) != 2 || len(scan.SkippedMatches) != 1 {
+		t.Fatalf("scan found %d matches, skipped %q; want 2 and 1", len(scan.Matches), scan.SkippedMatches)
+	}
+	src, err := update(context.Background(), newFakeService(t, &fakeSheets{}), cfg, Options{DryRun: true, Source: ExcelSource{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(src.Matches, scan.Matches) || !reflect.DeepEqual(src.SkippedMatches, scan.SkippedMatches) || !reflect.DeepEqual(src.Ranges, scan.Ranges) {
+		t.Errorf("with ExcelSource: matches %v, skipped %q, ranges %v; want %v, %q, %v",
+			src.Matches, src.SkippedMatches, src.Ranges, scan.Matches, scan.SkippedMatches, scan.Ranges)
+	}
+}
+
+func TestNamedRangeSource(t *testing.T) {
+	meta := testMeta()
+	fake := &fakeSheets{meta: sheets.Spreadsheet{
+		Sheets:      []*sheets.Sheet{{Properties: meta.sheets[7]}},
+		NamedRanges: []*sheets.NamedRange{meta.namedRanges["Single"], meta.namedRanges["Block"]},
+	}}
+	svc := newFakeService(t, fake)
+	cfg := config.Config{SpreadsheetID: "sheet-id"}
+
+	ranges, values, err := NamedRangeSource{Service: svc, Names: []string{"Single", "Block"}, Value: "x"}.Values(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Grid!B2", "Grid!A1:C3"}; !reflect.DeepEqual(ranges, want) {
+		t.Errorf("ranges = %v, want %v", ranges, want)
+	}
+	if want := [][]interface{}{{"x"}, {"x", "x", "x", "x", "x", "x", "x", "x", "x"}}; !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %v, want %v", values, want)
+	}
+
+	_, _, err = NamedRangeSource{Service: svc, Names: []string{"Missing"}, Value: "x"}.Values(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), `named range "Missing" not found; defined names: Block, Single`) {
+		t.Errorf("err = %v, want the missing name reported", err)
+	}
+}
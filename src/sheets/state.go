@@ -0,0 +1,104 @@
+package sheets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"update-google-sheets/src/config"
+)
+
+// stateEntry records the last successful write for one lookup value, and
+// the hash of the config that made it.
+type stateEntry struct {
+	LastSuccess time.Time `json:"last_success"`
+	Ranges      []string  `json:"ranges"`
+	ConfigHash  string    `json:"config_hash,omitempty"`
+}
+
+// runState is the state_file contents: entries by spreadsheet ID, then by
+// lookup value.
+type runState map[string]map[string]stateEntry
+
+// usesState reports whether the run consults and updates state_file. Pull
+// mode and read-only runs never push, so they leave it alone.
+func usesState(cfg config.Config, opts Options) bool {
+	return cfg.StateFile != "" && cfg.Mode != config.ModePull && !opts.readOnly()
+}
+
+func loadState(path string) (runState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return runState{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read state_file: %w", err)
+	}
+	st := runState{}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("parse state_file %s: %w", path, err)
+	}
+	return st, nil
+}
+
+// alreadyDone returns a skip reason when cfg's lookup value was written to
+// its spreadsheet within state_ttl by a config hashing to hash, or "" when
+// the run should go ahead. Entries recorded without a hash match any config.
+func alreadyDone(cfg config.Config, hash string, now time.Time) (string, error) {
+	st, err := loadState(cfg.StateFile)
+	if err != nil {
+		return "", err
+	}
+	entry, ok := st[cfg.SpreadsheetID][cfg.LookupValue]
+	if !ok || (entry.ConfigHash != "" && entry.ConfigHash != hash) {
+		return "", nil
+	}
+	if ttl := cfg.StateMaxAge(); ttl > 0 && now.Sub(entry.LastSuccess) > ttl {
+		return "", nil
+	}
+	return fmt.Sprintf("lookup value %q already written to %s at %s (%s); use -reprocess to run it again",
+		cfg.LookupValue, strings.Join(entry.Ranges, ", "), entry.LastSuccess.In(cfg.Location()).Format(time.RFC3339), cfg.StateFile), nil
+}
+
+// recordDone marks cfg's lookup value as written to ranges by a config
+// hashing to hash. The file is replaced by rename so a crash never leaves
+// it half written.
+func recordDone(cfg config.Config, hash string, ranges []string, now time.Time) error {
+	st, err := loadState(cfg.StateFile)
+	if err != nil {
+		return err
+	}
+	if st[cfg.SpreadsheetID] == nil {
+		st[cfg.SpreadsheetID] = make(map[string]stateEntry)
+	}
+	st[cfg.SpreadsheetID][cfg.LookupValue] = stateEntry{LastSuccess: now.UTC(), Ranges: ranges, ConfigHash: hash}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode state_file: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cfg.StateFile), filepath.Base(cfg.StateFile)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("write state_file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write state_file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write state_file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write state_file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), cfg.StateFile); err != nil {
+		return fmt.Errorf("write state_file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package sheets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"update-google-sheets/src/config"
+)
+
+func TestStateFileConfigHash(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	tests := []struct {
+		name string
+		// legacy is written to state_file before the first run.
+		legacy   string
+		first    string
+		second   string
+		wantSkip bool
+	}{
+		{"same config", "", "Done", "Done", true},
+		{"changed config", "", "Done", "Redone", false},
+		{"templated value", "", "Done at {{time}}", "Done at {{time}}", true},
+		{"entry without a hash", `{"XYZ": {"Alice": {"last_success": "2026-01-01T00:00:00Z", "ranges": ["Plan!B1"]}}}`, "", "Redone", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := filepath.Join(t.TempDir(), "state.json")
+			if tt.legacy != "" {
+				if err := os.WriteFile(state, []byte(tt.legacy), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg := config.Config{SpreadsheetID: "XYZ", LookupValue: "Alice", TargetColOffset: 1, OccupiedCellPolicy: config.OccupiedOverwrite, Workbook: path, StateFile: state}
+			if tt.first != "" {
+				cfg.WriteValue = tt.first
+				if _, err := UpdateWithService(context.Background(), newFakeService(t, &fakeSheets{}), cfg, Options{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			fake := &fakeSheets{}
+			cfg.WriteValue = tt.second
+			summary, err := UpdateWithService(context.Background(), newFakeService(t, fake), cfg, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			skipped := strings.Contains(summary.SkippedReason, "already written")
+			if skipped != tt.wantSkip || skipped == (len(fake.written) > 0) {
+				t.Errorf("skipped %v (%q) with writes %v, want skipped %v", skipped, summary.SkippedReason, fake.writes(), tt.wantSkip)
+			}
+		})
+	}
+}
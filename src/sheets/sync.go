@@ -0,0 +1,157 @@
+package sheets
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"update-google-sheets/src/config"
+)
+
+// mergeStats counts how each desired cell was resolved during a merge.
+type mergeStats struct {
+	Filled    int // empty remote cell receives the value
+	Corrected int // sync mode: differing remote value is overwritten
+	Unchanged int // sync mode: remote value already equals the desired one
+	// Unexpected lists cells skipped because they did not hold
+	// expect_current_value.
+	Unexpected []string
+	// Occupied lists cells that already held data, with the policy applied.
+	Occupied []string
+	// Formulas lists cells left alone because they hold a formula.
+	Formulas []string
+	// Differing lists, in sync mode, every cell that is filled or corrected.
+	Differing []Discrepancy
+	// Changes lists every cell a payload sets, with its value before.
+	Changes []cellChange
+}
+
+// Discrepancy is a target cell whose Google Sheets value differs from the
+// workbook-derived one.
+type Discrepancy struct {
+	Cell     string `json:"cell"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+func (s *mergeStats) add(o mergeStats) {
+	s.Filled += o.Filled
+	s.Corrected += o.Corrected
+	s.Unchanged += o.Unchanged
+	s.Unexpected = append(s.Unexpected, o.Unexpected...)
+	s.Occupied = append(s.Occupied, o.Occupied...)
+	s.Formulas = append(s.Formulas, o.Formulas...)
+	s.Differing = append(s.Differing, o.Differing...)
+	s.Changes = append(s.Changes, o.Changes...)
+}
+
+// mergeOccupied applies occupied_cell_policy to a fill-if-empty merge. skip
+// keeps occupied cells, overwrite replaces them, and error keeps them so the
+// caller can abort; every occupied cell is reported either way.
+func mergeOccupied(rng string, existing, desired [][]interface{}, policy string, cfg config.Config) ([][]interface{}, mergeStats) {
+	merged, filled := mergeValues(existing, desired, cfg)
+	stats := mergeStats{Filled: filled}
+	for r, row := range desired {
+		for c, val := range row {
+			if !remoteHasValue(existing, r, c, cfg) || isBlank(val) {
+				continue
+			}
+			stats.Occupied = append(stats.Occupied, fmt.Sprintf("%s[%d,%d] (%s): current value %q", rng, r, c, policy, fmt.Sprint(existing[r][c])))
+			if policy == config.OccupiedOverwrite {
+				merged[r][c] = val
+				stats.Corrected++
+			}
+		}
+	}
+	return merged, stats
+}
+
+// mergeSync makes every remote cell equal to the desired value, comparing
+// with the normalisation selected in cfg. Cells it changes are recorded as
+// discrepancies within rng; cells already equal are left nil so the write
+// skips them rather than replacing a formula with its rendered text.
+func mergeSync(rng string, existing, desired [][]interface{}, cfg config.Config) ([][]interface{}, mergeStats) {
+	var stats mergeStats
+	merged := make([][]interface{}, len(desired))
+	for r, row := range desired {
+		mergedRow := make([]interface{}, len(row))
+		for c, val := range row {
+			if val == nil {
+				continue
+			}
+			mergedRow[c] = val
+			switch {
+			case !remoteHasValue(existing, r, c, cfg):
+				if !isBlank(val) {
+					stats.Filled++
+					stats.Differing = append(stats.Differing, Discrepancy{Cell: cellInRange(rng, r, c), Expected: fmt.Sprint(val)})
+				}
+			case valuesEqual(existing[r][c], val, cfg):
+				mergedRow[c] = nil
+				stats.Unchanged++
+			default:
+				stats.Corrected++
+				stats.Differing = append(stats.Differing, Discrepancy{Cell: cellInRange(rng, r, c), Expected: fmt.Sprint(val), Actual: fmt.Sprint(existing[r][c])})
+			}
+		}
+		merged[r] = mergedRow
+	}
+	return merged, stats
+}
+
+// cellInRange addresses the cell at zero-based offset (r, c) from the
+// top-left of rng, falling back to rng[r,c] when rng cannot be parsed.
+func cellInRange(rng string, r, c int) string {
+	area, err := parseArea(rng[strings.LastIndex(rng, "!")+1:])
+	if err == nil {
+		if cell, err := excelize.CoordinatesToCellName(area.MinCol+c, area.MinRow+r); err == nil {
+			return formatRange(sheetNameFromRange(rng), cell)
+		}
+	}
+	return fmt.Sprintf("%s[%d,%d]", rng, r, c)
+}
+
+func valuesEqual(remote, desired interface{}, cfg config.Config) bool {
+	a, b := fmt.Sprint(remote), fmt.Sprint(desired)
+	if !cfg.SyncExactWhitespace {
+		a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	}
+	if cfg.SyncIgnoreCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// mergeExpected writes each desired value only where the remote cell currently
+// equals expected; "" means the cell must be empty. Cells holding anything
+// else are left nil, so the write skips them, and reported by their offset
+// within rng.
+func mergeExpected(rng string, existing, desired [][]interface{}, expected string, cfg config.Config) ([][]interface{}, mergeStats) {
+	var stats mergeStats
+	merged := make([][]interface{}, len(desired))
+	for r, row := range desired {
+		mergedRow := make([]interface{}, len(row))
+		for c, val := range row {
+			if val == nil {
+				continue
+			}
+			var current interface{} = ""
+			if remoteHasValue(existing, r, c, cfg) {
+				current = existing[r][c]
+			}
+			if !valuesEqual(current, expected, cfg) {
+				stats.Unexpected = append(stats.Unexpected, fmt.Sprintf("%s[%d,%d]: current value %q, expected %q", rng, r, c, fmt.Sprint(current), expected))
+				continue
+			}
+			mergedRow[c] = val
+			if isBlank(current) {
+				stats.Filled++
+			} else {
+				stats.Corrected++
+			}
+		}
+		merged[r] = mergedRow
+	}
+	return merged, stats
+}
@@ -0,0 +1,128 @@
+package sheets
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"update-google-sheets/src/config"
+)
+
+func TestMergeExpected(t *testing.T) {
+	tests := []struct {
+		name       string
+		current    interface{}
+		expected   string
+		want       interface{}
+		unexpected int
+	}{
+		{"holds the expected value", "PENDING", "PENDING", "CONFIRMED", 0},
+		{"holds another value", "DONE", "PENDING", nil, 1},
+		{"empty when it must be empty", nil, "", "CONFIRMED", 0},
+		{"whitespace counts as empty", "  ", "", "CONFIRMED", 0},
+		{"whitespace is kept when a value is expected", "  ", "PENDING", nil, 1},
+		{"formula rendering another value is kept", "6", "PENDING", nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing := [][]interface{}{{tt.current}}
+			merged, stats := mergeExpected("Plan!A1", existing, [][]interface{}{{"CONFIRMED"}}, tt.expected, config.Config{})
+			if merged[0][0] != tt.want {
+				t.Errorf("merged = %#v, want %#v", merged[0][0], tt.want)
+			}
+			if len(stats.Unexpected) != tt.unexpected {
+				t.Errorf("unexpected = %q, want %d", stats.Unexpected, tt.unexpected)
+			}
+		})
+	}
+}
+
+func TestMergeSync(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		current interface{}
+		want    interface{}
+	}{
+		{"empty is filled", config.Config{}, nil, "Done"},
+		{"differing is corrected", config.Config{}, "Pending", "Done"},
+		{"equal is left alone", config.Config{}, "Done", nil},
+		{"equal ignoring case is left alone", config.Config{SyncIgnoreCase: true}, "DONE", nil},
+		{"equal ignoring whitespace is left alone", config.Config{}, " Done ", nil},
+		{"whitespace differs when exact", config.Config{SyncExactWhitespace: true}, " Done ", "Done"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, _ := mergeSync("Plan!A1", [][]interface{}{{tt.current}}, [][]interface{}{{"Done"}}, tt.cfg)
+			if merged[0][0] != tt.want {
+				t.Errorf("merged = %#v, want %#v", merged[0][0], tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncLeavesFormulaRenderingDesiredValue(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice", "a"}}})
+	fake := &fakeSheets{
+		cells: map[string][][]interface{}{"Plan!A1:B1": {{"done", "old"}}},
+		renders: map[string]map[string][][]interface{}{
+			"FORMULA": {"Plan!A1:B1": {{`=LOWER("DONE")`, "old"}}},
+		},
+	}
+	cfg := config.Config{
+		SpreadsheetID:  "sheet-id",
+		LookupValue:    "Alice",
+		WriteValue:     "Done",
+		Workbook:       path,
+		WriteToRowEnd:  true,
+		Mode:           config.ModeSync,
+		SyncIgnoreCase: true,
+		// Even when formulas may be replaced, one that already renders the
+		// desired value is left alone.
+		AllowOverwritingFormulas: true,
+	}
+	summary, err := update(context.Background(), newFakeService(t, fake), cfg, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.written) != 1 || !reflect.DeepEqual(fake.written[0].Values, [][]interface{}{{nil, "Done"}}) {
+		t.Fatalf("sent %v, want only B1", fake.written)
+	}
+	if summary.AlreadyCorrect != 1 || summary.CorrectedDiffering != 1 {
+		t.Errorf("already correct %d, corrected %d, want 1 and 1", summary.AlreadyCorrect, summary.CorrectedDiffering)
+	}
+}
+
+func TestExpectCurrentValueLeavesOtherCells(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice", "a", "b", "c"}}})
+	fake := &fakeSheets{
+		cells: map[string][][]interface{}{
+			"Plan!A1:D1": {{"PENDING", "  ", "6", "DONE"}},
+		},
+		renders: map[string]map[string][][]interface{}{
+			"FORMULA": {"Plan!A1:D1": {{"PENDING", "  ", "=SUM(X1:X3)", "DONE"}}},
+		},
+	}
+	expected := "PENDING"
+	cfg := config.Config{
+		SpreadsheetID:      "sheet-id",
+		LookupValue:        "Alice",
+		WriteValue:         "CONFIRMED",
+		Workbook:           path,
+		WriteToRowEnd:      true,
+		ExpectCurrentValue: &expected,
+	}
+	summary, err := update(context.Background(), newFakeService(t, fake), cfg, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.written) != 1 || !reflect.DeepEqual(fake.written[0].Values, [][]interface{}{{"CONFIRMED", nil, nil, nil}}) {
+		t.Fatalf("sent %v, want only A1", fake.written)
+	}
+	if got, want := fake.cells["Plan!A1:D1"], [][]interface{}{{"CONFIRMED", "  ", "6", "DONE"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("row = %q, want %q", got, want)
+	}
+	if len(summary.SkippedMatches) != 3 {
+		t.Errorf("skipped = %q, want the three other cells", summary.SkippedMatches)
+	}
+}
@@ -0,0 +1,172 @@
+package sheets
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of APIMethodStats.Buckets; the last
+// bucket counts the calls slower than all of them.
+var LatencyBuckets = []time.Duration{100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond, time.Second, 2500 * time.Millisecond}
+
+// APICall is one HTTP request to the Sheets API, retries counted
+// separately.
+type APICall struct {
+	// Method names the API method, e.g. values.get or values.batchUpdate.
+	Method string
+	// Ranges lists the A1 ranges named in the URL; ranges sent in a
+	// request body are not included.
+	Ranges []string
+	// Status is the HTTP status, 0 when no response arrived.
+	Status int
+	// Bytes is the size of the response body read.
+	Bytes   int64
+	Latency time.Duration
+	Err     error
+}
+
+// APIMethodStats summarises the calls of one API method.
+type APIMethodStats struct {
+	Method string
+	Calls  int
+	Total  time.Duration
+	Max    time.Duration
+	// Buckets counts the calls by latency, per LatencyBuckets.
+	Buckets []int
+}
+
+// APITrace records every Sheets API request of the services built with it
+// in Options.Trace, passing each to OnCall as it completes. It is safe for
+// concurrent use.
+type APITrace struct {
+	OnCall func(APICall)
+
+	mu      sync.Mutex
+	methods map[string]*APIMethodStats
+}
+
+// Take returns the per-method statistics recorded since the last Take,
+// slowest method first, and starts over.
+func (t *APITrace) Take() []APIMethodStats {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := make([]APIMethodStats, 0, len(t.methods))
+	for _, s := range t.methods {
+		stats = append(stats, *s)
+	}
+	t.methods = nil
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Total > stats[j].Total })
+	return stats
+}
+
+func (t *APITrace) record(call APICall) {
+	t.mu.Lock()
+	if t.methods == nil {
+		t.methods = make(map[string]*APIMethodStats)
+	}
+	s, ok := t.methods[call.Method]
+	if !ok {
+		s = &APIMethodStats{Method: call.Method, Buckets: make([]int, len(LatencyBuckets)+1)}
+		t.methods[call.Method] = s
+	}
+	s.Calls++
+	s.Total += call.Latency
+	s.Max = max(s.Max, call.Latency)
+	s.Buckets[sort.Search(len(LatencyBuckets), func(i int) bool { return call.Latency <= LatencyBuckets[i] })]++
+	t.mu.Unlock()
+	if t.OnCall != nil {
+		t.OnCall(call)
+	}
+}
+
+// tracedTransport records each request on its APITrace once the response
+// body is closed, so the latency and size cover the whole response.
+type tracedTransport struct {
+	base  http.RoundTripper
+	trace *APITrace
+}
+
+func (t *tracedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	call := APICall{}
+	call.Method, call.Ranges = apiMethod(req)
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		call.Latency, call.Err = time.Since(start), err
+		t.trace.record(call)
+		return resp, err
+	}
+	call.Status = resp.StatusCode
+	resp.Body = &tracedBody{ReadCloser: resp.Body, done: func(n int64) {
+		call.Latency, call.Bytes = time.Since(start), n
+		t.trace.record(call)
+	}}
+	return resp, nil
+}
+
+// tracedBody counts the bytes read and calls done once, on Close.
+type tracedBody struct {
+	io.ReadCloser
+	n    int64
+	once sync.Once
+	done func(n int64)
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.done(b.n) })
+	return err
+}
+
+// apiMethod names the Sheets API method req calls, from its URL, and the
+// ranges the URL names.
+func apiMethod(req *http.Request) (string, []string) {
+	path := req.URL.EscapedPath()
+	_, rest, ok := strings.Cut(path, "/spreadsheets/")
+	if !ok {
+		return strings.ToLower(req.Method) + " " + req.URL.Path, nil
+	}
+	ranges := req.URL.Query()["ranges"]
+	_, after, hasValues := strings.Cut(rest, "/values")
+	if !hasValues {
+		if _, verb, ok := strings.Cut(rest, ":"); ok {
+			return "spreadsheets." + verb, ranges
+		}
+		return "spreadsheets.get", ranges
+	}
+	if verb, ok := strings.CutPrefix(after, ":"); ok {
+		return "values." + verb, ranges
+	}
+	rng := strings.TrimPrefix(after, "/")
+	verb := ""
+	for _, v := range []string{"append", "clear"} {
+		if r, ok := strings.CutSuffix(rng, ":"+v); ok {
+			rng, verb = r, v
+		}
+	}
+	if unescaped, err := url.PathUnescape(rng); err == nil {
+		rng = unescaped
+	}
+	ranges = append(ranges, rng)
+	switch {
+	case verb != "":
+		return "values." + verb, ranges
+	case req.Method == http.MethodPut:
+		return "values.update", ranges
+	}
+	return "values.get", ranges
+}
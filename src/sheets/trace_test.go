@@ -0,0 +1,137 @@
+package sheets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+
+	"update-google-sheets/src/config"
+)
+
+func TestAPIMethod(t *testing.T) {
+	const base = "https://sheets.googleapis.com/v4/spreadsheets/sheet-id"
+	tests := []struct {
+		method, url string
+		want        string
+		ranges      []string
+	}{
+		{"GET", base + "?alt=json&fields=sheets.properties", "spreadsheets.get", nil},
+		{"POST", base + ":batchUpdate?alt=json", "spreadsheets.batchUpdate", nil},
+		{"GET", base + "/values/Plan%21A1:B2?alt=json&valueRenderOption=FORMULA", "values.get", []string{"Plan!A1:B2"}},
+		{"GET", base + "/values/%27My%20Tab%27%21A1?alt=json", "values.get", []string{"'My Tab'!A1"}},
+		{"PUT", base + "/values/Plan%21C3?alt=json&valueInputOption=RAW", "values.update", []string{"Plan!C3"}},
+		{"POST", base + "/values/Log%21A1:append?alt=json&valueInputOption=RAW", "values.append", []string{"Log!A1"}},
+		{"POST", base + "/values/Plan%21A1:D9:clear?alt=json", "values.clear", []string{"Plan!A1:D9"}},
+		{"GET", base + "/values:batchGet?alt=json&ranges=Plan%21A1&ranges=Week2%21B2", "values.batchGet", []string{"Plan!A1", "Week2!B2"}},
+		{"POST", base + "/values:batchUpdate?alt=json", "values.batchUpdate", nil},
+		{"POST", base + "/values:batchClear?alt=json", "values.batchClear", nil},
+		{"POST", "https://oauth2.googleapis.com/token", "post /token", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			method, ranges := apiMethod(req)
+			if method != tt.want || !reflect.DeepEqual(ranges, tt.ranges) {
+				t.Errorf("apiMethod(%s %s) = %q, %q; want %q, %q", tt.method, tt.url, method, ranges, tt.want, tt.ranges)
+			}
+		})
+	}
+}
+
+func TestAPITraceRecord(t *testing.T) {
+	var seen []string
+	trace := &APITrace{OnCall: func(c APICall) { seen = append(seen, c.Method) }}
+	for _, latency := range []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 300 * time.Millisecond, 3 * time.Second} {
+		trace.record(APICall{Method: "values.get", Latency: latency})
+	}
+	trace.record(APICall{Method: "spreadsheets.get", Latency: 5 * time.Second})
+	trace.record(APICall{Method: "values.batchUpdate", Latency: time.Second})
+
+	got := trace.Take()
+	want := []APIMethodStats{
+		{Method: "spreadsheets.get", Calls: 1, Total: 5 * time.Second, Max: 5 * time.Second, Buckets: []int{0, 0, 0, 0, 0, 1}},
+		{Method: "values.get", Calls: 4, Total: 3450 * time.Millisecond, Max: 3 * time.Second, Buckets: []int{2, 0, 1, 0, 0, 1}},
+		{Method: "values.batchUpdate", Calls: 1, Total: time.Second, Max: time.Second, Buckets: []int{0, 0, 0, 1, 0, 0}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Take = %+v, want %+v", got, want)
+	}
+	if len(seen) != 6 {
+		t.Errorf("OnCall saw %q, want every call", seen)
+	}
+	if again := trace.Take(); len(again) != 0 {
+		t.Errorf("second Take = %+v, want nothing", again)
+	}
+	var none *APITrace
+	if got := none.Take(); got != nil {
+		t.Errorf("nil trace Take = %+v", got)
+	}
+}
+
+func TestTraceReachesSummary(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}, {"x"}, {"Alice"}}})
+	fake := &fakeSheets{cells: map[string][][]interface{}{}}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	var (
+		mu    sync.Mutex
+		calls []APICall
+	)
+	ctx := context.Background()
+	cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path, TargetColOffset: 1}
+	opts := Options{Trace: &APITrace{OnCall: func(c APICall) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, c)
+	}}}
+	svc, err := NewService(ctx, cfg, opts, option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := UpdateWithService(ctx, svc, cfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.mu.Lock()
+	requests := len(fake.requests)
+	fake.mu.Unlock()
+	total := 0
+	var methods []string
+	for _, s := range summary.APICalls {
+		total += s.Calls
+		methods = append(methods, s.Method)
+	}
+	if total != requests {
+		t.Errorf("APICalls count %d calls, the server saw %d", total, requests)
+	}
+	for _, m := range []string{"values.get", "values.batchUpdate"} {
+		if !slices.Contains(methods, m) {
+			t.Errorf("APICalls methods = %q, want %s", methods, m)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	var read []string
+	for _, c := range calls {
+		if c.Status != http.StatusOK || c.Bytes == 0 {
+			t.Errorf("call %+v, want a 200 with a body", c)
+		}
+		if c.Method == "values.get" {
+			read = append(read, c.Ranges...)
+		}
+	}
+	slices.Sort(read)
+	// Each empty target is read once as shown and once for its formula.
+	if want := []string{"Plan!B1", "Plan!B1", "Plan!B3", "Plan!B3"}; !reflect.DeepEqual(read, want) {
+		t.Errorf("ranges read = %q, want %q", read, want)
+	}
+}
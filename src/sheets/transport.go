@@ -0,0 +1,138 @@
+package sheets
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+
+	"update-google-sheets/src/config"
+)
+
+// baseTransport builds the transport used underneath the credentials when
+// proxy_url or ca_bundle_file is set. It returns nil when neither is.
+func baseTransport(cfg config.Config) (*http.Transport, error) {
+	if cfg.ProxyURL == "" && cfg.CABundleFile == "" {
+		return nil, nil
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.ProxyURL != "" {
+		proxy, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("proxy_url: %w", err)
+		}
+		tr.Proxy = http.ProxyURL(proxy)
+	}
+	if cfg.CABundleFile != "" {
+		pool, err := certPool(cfg.CABundleFile)
+		if err != nil {
+			return nil, err
+		}
+		tr.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return tr, nil
+}
+
+// certPool returns the system roots plus the PEM certificates in path.
+func certPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read ca_bundle_file: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("ca_bundle_file %s holds no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+// withHTTPClient builds the HTTP client a run uses when a custom transport
+// is configured or the run retries, times or traces API calls. The credentials
+// named by clientOpts are layered onto that transport, since the API client
+// ignores them once an HTTP client is supplied; extra, the caller's own
+// options such as an endpoint, are kept alongside it. required reports
+// whether the client is needed for proxy_url or ca_bundle_file rather than
+// being best effort. It returns nil options when no client is needed.
+func withHTTPClient(ctx context.Context, cfg config.Config, opts Options, clientOpts, extra []option.ClientOption) (httpOpts []option.ClientOption, required bool, err error) {
+	base, err := baseTransport(cfg)
+	if err != nil {
+		return nil, false, err
+	}
+	if base == nil && opts.Retries == nil && opts.Clock == nil && opts.Trace == nil {
+		return nil, false, nil
+	}
+	rt := http.DefaultTransport
+	if base != nil {
+		rt = base
+	}
+	if opts.Trace != nil {
+		rt = &tracedTransport{base: rt, trace: opts.Trace}
+	}
+	if opts.Retries != nil {
+		rt = &retryTransport{base: rt, budget: opts.Retries}
+	}
+	if opts.Clock != nil {
+		rt = &timedTransport{base: rt, clock: opts.Clock}
+	}
+	rt, err = htransport.NewTransport(ctx, rt, clientOpts...)
+	if err != nil {
+		if base == nil {
+			// Retries, timing and tracing are best effort: a caller-supplied HTTP
+			// client, or credentials sheets.NewService will report on, are
+			// used as given.
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("build authenticated transport: %w", err)
+	}
+	httpOpts = append(slices.Clone(extra), option.WithHTTPClient(&http.Client{Transport: rt}))
+	return httpOpts, base != nil, nil
+}
+
+// APIClock adds up the time spent in Sheets API requests, including retries
+// and the waits between them. It is safe for concurrent use.
+type APIClock struct {
+	mu    sync.Mutex
+	total time.Duration
+}
+
+// Elapsed returns the time recorded so far.
+func (c *APIClock) Elapsed() time.Duration {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total
+}
+
+func (c *APIClock) add(d time.Duration) {
+	c.mu.Lock()
+	c.total += d
+	c.mu.Unlock()
+}
+
+// timedTransport records how long each request takes, up to the response
+// headers, on its APIClock.
+type timedTransport struct {
+	base  http.RoundTripper
+	clock *APIClock
+}
+
+func (t *timedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	t.clock.add(time.Since(start))
+	return resp, err
+}
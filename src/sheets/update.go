@@ -1,11 +1,21 @@
 package sheets
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/xuri/excelize/v2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 
@@ -14,42 +24,461 @@ import (
 
 // Summary describes the outcome of an update run.
 type Summary struct {
+	// RunID identifies the run in snapshot_dir and audit_log.
+	RunID          string
 	Ranges         []string
 	TotalCells     int64
 	TotalRows      int64
 	SkippedReason  string
+	Preview        string
+	DryRun         bool
+	WriteChecked   bool
+	Touched        string
+	SkippedMatches []string
+	Cleared        []string
+	Occupied       []string
+	Anchors        []string
 	TemplateSheets []string
 	TargetSheets   []string
+	// ResolvedSheetFilters records the sheet each index filter picked,
+	// e.g. "#1 = Week 42".
+	ResolvedSheetFilters []string
+	// Matches lists every workbook cell that held the lookup value.
+	Matches []Match
+	// Pulled lists the workbook cells refreshed in pull mode and PulledTo
+	// the file they were saved to.
+	Pulled   []string
+	PulledTo string
+	// ReportRows counts the rows written by a reconciliation report.
+	ReportRows int
+	// Discrepancies lists the cells a consistency check found out of sync.
+	Discrepancies []Discrepancy
+	// ConditionalFormats lists the column ranges that received the
+	// configured conditional-format rule.
+	ConditionalFormats []string
+	// NumberFormatted counts the written numeric cells given number_format.
+	NumberFormatted int
+	// Unverified lists written cells whose echoed value differs from the
+	// one sent, when verify_writes is set.
+	Unverified []string
+	// Protected lists the targets protect_header_row kept from writing
+	// into the header row.
+	Protected []string
+	// CreatedSheets lists the tabs create_missing_sheets added.
+	CreatedSheets []string
+	// ScanTruncated lists the sheets max_scan_rows or max_scan_cols cut
+	// short, with what was left unscanned.
+	ScanTruncated []string
+	// StoppedEarly lists the sheets whose scan per_sheet_match_limit
+	// ended before their last row.
+	StoppedEarly []string
+	// Overrides lists each written range whose settings came from
+	// sheet_overrides, e.g. "Archive!B4: sheet_overrides[Archive]".
+	Overrides []string
+	// ResponseSaved reports whether the API response was written to
+	// Options.ResponseOut.
+	ResponseSaved bool
+	// EmittedRanges counts the target ranges saved for -emit-ranges.
+	EmittedRanges int
+	// Snapshot is the directory snapshot_dir saved the touched tabs to
+	// before writing, and SnapshotSkipped lists the tabs it left out.
+	Snapshot        string
+	SnapshotSkipped []string
+	// UndoFile is where undo_dir saved the cells a clear blanked.
+	UndoFile string
+	// WorkbookLogged counts the rows appended to the workbook's SyncLog sheet.
+	WorkbookLogged int
+	// AuditLogged counts the records appended to audit_log.
+	AuditLogged int
+	// Rejected lists the ranges dropped at interactive review.
+	Rejected []string
+	// RetryCount counts retried API calls; RetryBudget is the run's cap,
+	// 0 when uncapped.
+	RetryCount  int
+	RetryBudget int
+	// APIDuration is the time spent in Sheets API requests, including
+	// retries. It is only measured for services built by NewService.
+	APIDuration time.Duration
+	// APICalls summarises the API requests per method, slowest first,
+	// when Options.Trace is set.
+	APICalls []APIMethodStats
+	// Per-cell outcome counts. AlreadyCorrect and CorrectedDiffering are
+	// only populated in sync mode.
+	FilledEmpty        int
+	CorrectedDiffering int
+	AlreadyCorrect     int
+
+	writes  []writeRecord
+	changes []cellChange
+	// planned holds the ranges and values the run meant to write when it
+	// reached the confirmation prompt, for ExpectPlanned.
+	planned []*sheets.ValueRange
+	// expandedAt is the instant the run's templates were expanded at, for
+	// ExpectPlanned.
+	expandedAt time.Time
+}
+
+// target pairs a Google Sheets range with the values destined for it.
+// Workbook-derived targets also carry the sheet, the 1-based top-left cell
+// and the matched row so they can be re-addressed after row inserts.
+type target struct {
+	Range    string
+	Anchor   string
+	Values   [][]interface{}
+	Sheet    string
+	Row, Col int
+	Match    *Match // nil for named range and import targets
+	// Policy is the occupied_cell_policy for this target, and Override
+	// names the sheet_overrides entry that set it or the target's other
+	// settings; both are empty when the global settings apply.
+	Policy   string
+	Override string
+	// InputOption is the value input option for this target's values;
+	// empty means the config's.
+	InputOption string
+}
+
+// occupiedPolicy returns the occupied_cell_policy that applies to t.
+func (t target) occupiedPolicy(cfg config.Config) string {
+	if t.Policy != "" {
+		return t.Policy
+	}
+	return cfg.OccupiedCellPolicy
 }
 
 // Update synchronises lookup-derived cells with the given spreadsheet.
 func Update(ctx context.Context, cfg config.Config) (Summary, error) {
-	var summary Summary
+	return UpdateWithOptions(ctx, cfg, Options{})
+}
+
+// UpdateWithOptions behaves like Update with run-time options such as
+// confirmation and dry run applied.
+func UpdateWithOptions(ctx context.Context, cfg config.Config, opts Options) (Summary, error) {
+	if opts.Retries == nil {
+		opts.Retries = NewRetryBudget(cfg)
+	}
+	if opts.Clock == nil {
+		opts.Clock = &APIClock{}
+	}
+	svc, err := NewService(ctx, cfg, opts)
+	if err != nil {
+		return Summary{}, err
+	}
+	return UpdateWithService(ctx, svc, cfg, opts)
+}
+
+// UpdateWithService behaves like UpdateWithOptions against a caller-built
+// Sheets service, e.g. one with custom credentials or endpoint.
+func UpdateWithService(ctx context.Context, svc *sheets.Service, cfg config.Config, opts Options) (Summary, error) {
+	if usesState(cfg, opts) {
+		// Hash the config as written, so a {{time}} value does not make
+		// every run look like a new config.
+		hash, err := cfg.Hash()
+		if err != nil {
+			return Summary{}, err
+		}
+		opts.configHash = hash
+	}
+	now := opts.expandAt
+	if now.IsZero() {
+		now = time.Now()
+	}
+	cfg, err := cfg.ExpandTemplates(now)
+	if err != nil {
+		return Summary{}, err
+	}
+	summary, err := updateWithService(ctx, svc, cfg, opts)
+	summary.expandedAt = now
+	if opts.Retries != nil {
+		summary.RetryCount = opts.Retries.Used()
+		summary.RetryBudget = opts.Retries.max
+	}
+	summary.APIDuration = opts.Clock.Elapsed()
+	summary.APICalls = opts.Trace.Take()
+	return summary, err
+}
 
-	values := [][]interface{}{{cfg.LookupValue}}
+func updateWithService(ctx context.Context, svc *sheets.Service, cfg config.Config, opts Options) (Summary, error) {
+	if usesState(cfg, opts) && !opts.Reprocess {
+		reason, err := alreadyDone(cfg, opts.configHash, time.Now())
+		if err != nil || reason != "" {
+			return Summary{SkippedReason: reason}, err
+		}
+	}
+	cfg, err := resolveTabGIDs(ctx, svc, cfg)
+	if err != nil {
+		return Summary{}, withQuotaHint(err, cfg)
+	}
+	summary, err := update(ctx, svc, cfg, opts)
+	// Cells are audited as soon as they are written, even when a later
+	// step such as formatting them failed.
+	if cfg.AuditLog != "" && len(summary.changes) > 0 {
+		if aerr := appendAuditLog(cfg, summary.RunID, summary.changes); aerr != nil {
+			if err == nil {
+				return summary, fmt.Errorf("update succeeded but recording it in audit_log failed: %w", aerr)
+			}
+			err = errors.Join(err, fmt.Errorf("recording the written cells in audit_log failed: %w", aerr))
+		} else {
+			summary.AuditLogged = len(summary.changes)
+		}
+	}
+	if err != nil {
+		return summary, withQuotaHint(err, cfg)
+	}
+	if opts.expected != nil && summary.planned == nil {
+		return summary, fmt.Errorf("%w: nothing to write any more (%s)", ErrPlanChanged, summary.SkippedReason)
+	}
+	if summary.DryRun || summary.SkippedReason == declinedReason || opts.readOnly() {
+		return summary, nil
+	}
+	if cfg.WorkbookLog {
+		if err := appendWorkbookLog(cfg, summary.writes); err != nil {
+			return summary, err
+		}
+		summary.WorkbookLogged = len(summary.writes)
+	}
+	if cfg.TouchCell != "" {
+		if err := touch(ctx, svc, cfg); err != nil {
+			return summary, withQuotaHint(err, cfg)
+		}
+		summary.Touched = cfg.TouchCell
+	}
+	if usesState(cfg, opts) && summary.SkippedReason == "" && len(summary.Ranges) > 0 {
+		if err := recordDone(cfg, opts.configHash, summary.Ranges, time.Now()); err != nil {
+			return summary, fmt.Errorf("update succeeded but recording it failed: %w", err)
+		}
+	}
+	return summary, nil
+}
 
-	svc, err := sheets.NewService(ctx, option.WithScopes(sheets.SpreadsheetsScope))
+// NewService builds the Sheets service a run with cfg and opts needs:
+// Application Default Credentials with RequiredScope, plus quota_project,
+// proxy_url and ca_bundle_file. extra client options are applied last.
+func NewService(ctx context.Context, cfg config.Config, opts Options, extra ...option.ClientOption) (*sheets.Service, error) {
+	clientOpts := []option.ClientOption{option.WithScopes(RequiredScope(opts))}
+	if cfg.QuotaProject != "" {
+		clientOpts = append(clientOpts, option.WithQuotaProject(cfg.QuotaProject))
+	}
+	clientOpts = append(clientOpts, extra...)
+	httpOpts, required, err := withHTTPClient(ctx, cfg, opts, clientOpts, extra)
+	if err != nil {
+		return nil, err
+	}
+	if httpOpts != nil {
+		svc, err := sheets.NewService(ctx, httpOpts...)
+		switch {
+		case err == nil:
+			return svc, nil
+		case required:
+			return nil, fmt.Errorf("initialise Sheets service: %w", err)
+		}
+		// extra conflicts with an HTTP client, e.g. WithQuotaProject; go
+		// without retries, timing and tracing rather than fail.
+	}
+	svc, err := sheets.NewService(ctx, clientOpts...)
 	if err != nil {
-		return summary, fmt.Errorf("initialise Sheets service: %w", err)
+		return nil, fmt.Errorf("initialise Sheets service: %w", err)
+	}
+	return svc, nil
+}
+
+// withQuotaHint points at quota_project when the API rejects the quota
+// project used for billing or reports its quota used up. Other errors are
+// returned unchanged.
+func withQuotaHint(err error, cfg config.Config) error {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	switch {
+	case quotaProjectDenied(apiErr) && cfg.QuotaProject == "":
+		return fmt.Errorf("%w (hint: set quota_project in the config to bill a project your credentials may use)", err)
+	case quotaProjectDenied(apiErr):
+		return fmt.Errorf("%w (hint: quota_project %q is not allowed for these credentials; grant serviceusage.services.use on it or pick another project)", err, cfg.QuotaProject)
+	case quotaExceeded(apiErr) && cfg.QuotaProject == "":
+		return fmt.Errorf("%w (hint: the API quota is used up; wait, or set quota_project in the config to bill another project)", err)
+	case quotaExceeded(apiErr):
+		return fmt.Errorf("%w (hint: quota_project %q has used up its API quota; wait, or raise its quota)", err, cfg.QuotaProject)
+	}
+	return err
+}
+
+// quotaProjectDenied reports whether the API refused the quota project
+// billed for the request, rather than access to the spreadsheet.
+func quotaProjectDenied(apiErr *googleapi.Error) bool {
+	if apiErr.Code != http.StatusForbidden {
+		return false
+	}
+	msg := strings.ToLower(apiErr.Error())
+	return strings.Contains(msg, "quota project") || strings.Contains(msg, "user_project_denied") || strings.Contains(msg, "serviceusage.services.use")
+}
+
+// quotaExceeded reports whether the API refused the request for running
+// out of quota, which it answers with 429 or, for some limits, 403.
+func quotaExceeded(apiErr *googleapi.Error) bool {
+	return apiErr.Code == http.StatusTooManyRequests ||
+		apiErr.Code == http.StatusForbidden && strings.Contains(strings.ToLower(apiErr.Error()), "quota exceeded")
+}
+
+func update(ctx context.Context, svc *sheets.Service, cfg config.Config, opts Options) (Summary, error) {
+	summary := Summary{RunID: newRunID(cfg)}
+
+	if cfg.Mode == config.ModeAppend {
+		preview := fmt.Sprintf("About to append 1 row to sheet %s in spreadsheet %s.", cfg.AppendSheet, cfg.SpreadsheetID)
+		if ok, err := opts.gate(ctx, svc, cfg, formatRange(cfg.AppendSheet, "A1"), preview, plannedAppend(cfg), &summary); !ok || err != nil {
+			return summary, err
+		}
+		return appendRow(ctx, svc, cfg, summary)
 	}
 
-	ranges, templateSheets, err := deriveRangesFromExcel(config.DefaultWorkbook, cfg.SheetFilter, cfg.LookupValue)
+	d, err := derive(ctx, cfg, opts)
 	if err != nil {
 		return summary, err
 	}
-	summary.TemplateSheets = templateSheets
-	summary.TargetSheets = uniqueSheetNames(ranges)
+	d = renameTabs(d, nil, cfg.DefaultTab(cfg.SpreadsheetID))
+	targets := d.Targets
+	summary.Matches = d.Matches
+	summary.TemplateSheets = d.Sheets
+	summary.ResolvedSheetFilters = d.Resolved
+	summary.SkippedMatches = d.Skipped
+	summary.Protected = d.Protected
+	summary.ScanTruncated = d.Truncated
+	summary.StoppedEarly = d.Stopped
 
-	payloads, err := buildPayloads(ctx, svc, cfg.SpreadsheetID, ranges, values)
+	var meta *spreadsheetMeta
+	if len(cfg.NamedRangeTargets) > 0 || cfg.InsertRowBeforeMatch || cfg.UsesTargetBlock() || onGIDTabs(targets) {
+		if meta, err = fetchMetadata(ctx, svc, cfg.SpreadsheetID); err != nil {
+			return summary, err
+		}
+	}
+	if onGIDTabs(targets) {
+		if targets, err = meta.resolveTargetGIDs(targets, cfg.SpreadsheetID); err != nil {
+			return summary, err
+		}
+	}
+	if cfg.UsesTargetBlock() {
+		if err := meta.checkGrid(targets); err != nil {
+			return summary, err
+		}
+	}
+	if cfg.InsertRowBeforeMatch && len(targets) > 0 && !opts.readOnly() {
+		preview := previewLine(fmt.Sprintf("insert %s and write", plural(len(targets), "row")), len(targets), targetRanges(targets), cfg.SpreadsheetID)
+		if ok, err := opts.gate(ctx, svc, cfg, targets[0].Range, preview, plannedTargets(targets), &summary); !ok || err != nil {
+			summary.Ranges = targetRanges(targets)
+			return summary, err
+		}
+		if err := takeSnapshot(ctx, svc, cfg, targetRanges(targets), &summary); err != nil {
+			return summary, err
+		}
+		if targets, err = insertRowsBeforeMatches(ctx, svc, cfg.SpreadsheetID, meta, targets); err != nil {
+			return summary, err
+		}
+	}
+	if cfg.TargetRelativeTo != "" {
+		for _, t := range targets {
+			summary.Anchors = append(summary.Anchors, t.Anchor+" -> "+t.Range)
+		}
+	}
+	if len(cfg.NamedRangeTargets) > 0 {
+		value, err := cfg.TypedWriteValue()
+		if err != nil {
+			return summary, err
+		}
+		named, err := resolveNamedRanges(meta, cfg.NamedRangeTargets, value)
+		if err != nil {
+			return summary, err
+		}
+		targets = append(targets, named...)
+	}
+	summary.TargetSheets = uniqueSheetNames(targetRanges(targets))
+	if opts.EmitRanges != nil {
+		if err := emitRanges(opts.EmitRanges, targets); err != nil {
+			return summary, err
+		}
+		summary.EmittedRanges = len(targets)
+	}
+	if len(targets) == 0 {
+		summary.SkippedReason = "no target cells remain after skipping matches"
+		if len(summary.Protected) > 0 && len(summary.SkippedMatches) == 0 {
+			summary.SkippedReason = fmt.Sprintf("every target is on the protected header row %d", cfg.HeaderRow)
+		}
+		return summary, nil
+	}
+
+	if opts.Report != nil {
+		return writeReport(ctx, svc, cfg, targets, opts.Report, summary)
+	}
+	if opts.Check {
+		return checkTargets(ctx, svc, cfg, targets, summary)
+	}
+	if cfg.Mode == config.ModeClear {
+		return clearTargets(ctx, svc, cfg, targets, summary, opts)
+	}
+	if cfg.Mode == config.ModePull {
+		return pullTargets(ctx, svc, cfg, targets, summary, opts)
+	}
+
+	missing, probe, err := missingTabs(ctx, svc, cfg, targets)
 	if err != nil {
 		return summary, err
 	}
+	payloads, stats, err := buildPayloads(ctx, svc, cfg, targets, missing)
+	if err != nil {
+		return summary, err
+	}
+	summary.FilledEmpty = stats.Filled
+	summary.CorrectedDiffering = stats.Corrected
+	summary.AlreadyCorrect = stats.Unchanged
+	summary.SkippedMatches = append(summary.SkippedMatches, stats.Unexpected...)
+	summary.SkippedMatches = append(summary.SkippedMatches, stats.Formulas...)
+	summary.Occupied = stats.Occupied
 	if len(payloads) == 0 {
 		summary.SkippedReason = "all target cells already contain data"
+		switch {
+		case cfg.ExpectCurrentValue != nil:
+			summary.SkippedReason = "no target cell holds expect_current_value"
+		case cfg.Mode == config.ModeSync:
+			summary.SkippedReason = "all target cells already hold the desired values"
+		}
 		return summary, nil
 	}
 
-	resp, err := batchUpdate(ctx, svc, cfg.SpreadsheetID, payloads)
+	summary.Overrides = appliedOverrides(targets, payloadRanges(payloads))
+
+	if !cfg.InsertRowBeforeMatch {
+		preview := previewLine("write", stats.Filled+stats.Corrected, payloadRanges(payloads), cfg.SpreadsheetID)
+		if tabs := usedTabs(payloads, missing); len(tabs) > 0 {
+			preview += fmt.Sprintf(" Missing sheets created first: %s.", strings.Join(tabs, ", "))
+		}
+		if ok, err := opts.gate(ctx, svc, cfg, probeRange(payloads, missing, probe), preview, payloads, &summary); !ok || err != nil {
+			summary.Ranges = payloadRanges(payloads)
+			return summary, err
+		}
+	}
+	if opts.Review != nil {
+		if cfg.InsertRowBeforeMatch {
+			return summary, errors.New("interactive review cannot be combined with insert_row_before_match, whose rows are inserted before the review")
+		}
+		if payloads, stats, summary.Rejected, err = reviewPayloads(payloads, stats, opts.Review); err != nil {
+			return summary, err
+		}
+		summary.FilledEmpty = stats.Filled
+		summary.CorrectedDiffering = stats.Corrected
+		if len(payloads) == 0 {
+			summary.SkippedReason = "every range was rejected at review"
+			return summary, nil
+		}
+	}
+	if !cfg.InsertRowBeforeMatch {
+		if err := takeSnapshot(ctx, svc, cfg, withoutTabs(payloadRanges(payloads), missing), &summary); err != nil {
+			return summary, err
+		}
+	}
+	if summary.CreatedSheets, err = addSheets(ctx, svc, cfg.SpreadsheetID, missing, payloads); err != nil {
+		return summary, err
+	}
+
+	resp, err := batchUpdate(ctx, svc, cfg, payloads, inputOptions(targets))
 	if err != nil {
 		return summary, err
 	}
@@ -59,69 +488,394 @@ func Update(ctx context.Context, cfg config.Config) (Summary, error) {
 	for _, p := range payloads {
 		summary.Ranges = append(summary.Ranges, p.Range)
 	}
+	summary.writes = payloadRecords(payloads)
+	summary.changes = stats.Changes
+	if opts.ResponseOut != nil {
+		if err := writeResponse(opts.ResponseOut, resp); err != nil {
+			return summary, fmt.Errorf("update succeeded but saving the API response failed: %w", err)
+		}
+		summary.ResponseSaved = true
+	}
+	if cfg.VerifyWrites {
+		summary.Unverified = verifyWrites(payloads, resp, cfg)
+	}
+	if summary.ConditionalFormats, err = applyConditionalFormat(ctx, svc, cfg, targets); err != nil {
+		return summary, err
+	}
+	if summary.NumberFormatted, err = applyNumberFormat(ctx, svc, cfg, stats.Changes); err != nil {
+		return summary, err
+	}
 
 	return summary, nil
 }
 
-func buildPayloads(ctx context.Context, svc *sheets.Service, sheetID string, ranges []string, desired [][]interface{}) ([]*sheets.ValueRange, error) {
-	var payloads []*sheets.ValueRange
+// appliedOverrides pairs each of ranges with the sheet_overrides entry of
+// its target, leaving out ranges the global settings covered.
+func appliedOverrides(targets []target, ranges []string) []string {
+	override := make(map[string]string)
+	for _, t := range targets {
+		if t.Override != "" {
+			override[t.Range] = t.Override
+		}
+	}
+	var out []string
 	for _, rng := range ranges {
-		existing, err := fetchRangeValues(ctx, svc, sheetID, rng)
-		if err != nil {
-			return nil, fmt.Errorf("precondition failed for %s: %w", rng, err)
+		if o, ok := override[rng]; ok {
+			out = append(out, rng+": "+o)
 		}
-		merged, needsUpdate := mergeValues(existing, desired)
-		if !needsUpdate {
+	}
+	return out
+}
+
+// touch stamps cfg.TouchCell with the current time in the configured timezone.
+func touch(ctx context.Context, svc *sheets.Service, cfg config.Config) error {
+	stamp := time.Now().In(cfg.Location()).Format("2006-01-02 15:04:05")
+	data := []*sheets.ValueRange{{
+		MajorDimension: "ROWS",
+		Range:          cfg.TouchCell,
+		Values:         [][]interface{}{{stamp}},
+	}}
+	if _, err := batchUpdate(ctx, svc, cfg, data, nil); err != nil {
+		return fmt.Errorf("touch %s: %w", cfg.TouchCell, err)
+	}
+	return nil
+}
+
+func clearTargets(ctx context.Context, svc *sheets.Service, cfg config.Config, targets []target, summary Summary, opts Options) (Summary, error) {
+	sheetID := cfg.SpreadsheetID
+	plan, err := buildClears(ctx, svc, cfg, targets)
+	if err != nil {
+		return summary, err
+	}
+	for _, rng := range plan.Empty {
+		summary.SkippedMatches = append(summary.SkippedMatches, rng+": already empty")
+	}
+	if len(plan.Ranges) == 0 {
+		summary.SkippedReason = "all target cells are already empty"
+		return summary, nil
+	}
+	if ok, err := opts.gate(ctx, svc, cfg, plan.Ranges[0], previewLine("clear", int(plan.Cells), plan.Ranges, sheetID), plannedRanges(plan.Ranges), &summary); !ok || err != nil {
+		summary.Ranges = plan.Ranges
+		summary.Cleared = plan.Previous
+		return summary, err
+	}
+	if err := takeSnapshot(ctx, svc, cfg, plan.Ranges, &summary); err != nil {
+		return summary, err
+	}
+	if summary.UndoFile, err = writeUndo(cfg, summary.RunID, plan.Changes); err != nil {
+		return summary, fmt.Errorf("undo file not saved, nothing cleared: %w", err)
+	}
+	if err := batchClear(ctx, svc, sheetID, plan.Ranges); err != nil {
+		return summary, err
+	}
+	summary.Ranges = plan.Ranges
+	summary.Cleared = plan.Previous
+	for _, rng := range plan.Ranges {
+		summary.writes = append(summary.writes, writeRecord{Range: rng, Value: "(cleared)"})
+	}
+	summary.changes = plan.Changes
+	summary.TotalCells = plan.Cells
+	summary.TotalRows = int64(len(plan.Ranges))
+	return summary, nil
+}
+
+// buildPayloads merges each target with its current values into the
+// payload to write. Targets on a tab of missing are merged as if empty.
+func buildPayloads(ctx context.Context, svc *sheets.Service, cfg config.Config, targets []target, missing map[string]bool) ([]*sheets.ValueRange, mergeStats, error) {
+	var (
+		payloads []*sheets.ValueRange
+		total    mergeStats
+		// fatal lists occupied cells under the error policy, and setting
+		// names where the first of them got that policy.
+		fatal   []string
+		setting string
+	)
+	for _, t := range targets {
+		var (
+			existing [][]interface{}
+			err      error
+		)
+		if !missing[t.Sheet] {
+			if existing, err = fetchRangeValues(ctx, svc, cfg, t.Range); err != nil {
+				return nil, total, fmt.Errorf("precondition failed for %s: %w", t.Range, err)
+			}
+		}
+		desired := t.Values
+		if !cfg.AllowOverwritingFormulas && !missing[t.Sheet] {
+			var formulas []string
+			if desired, formulas, err = protectFormulas(ctx, svc, cfg, t.Range, existing, desired, t.overwrites(cfg)); err != nil {
+				return nil, total, fmt.Errorf("precondition failed for %s: %w", t.Range, err)
+			}
+			total.Formulas = append(total.Formulas, formulas...)
+		}
+		var (
+			merged [][]interface{}
+			stats  mergeStats
+		)
+		switch {
+		case cfg.ExpectCurrentValue != nil:
+			merged, stats = mergeExpected(t.Range, existing, desired, *cfg.ExpectCurrentValue, cfg)
+		case cfg.Mode == config.ModeSync:
+			merged, stats = mergeSync(t.Range, existing, desired, cfg)
+		default:
+			merged, stats = mergeOccupied(t.Range, existing, desired, t.occupiedPolicy(cfg), cfg)
+		}
+		total.add(stats)
+		if len(stats.Occupied) > 0 && t.occupiedPolicy(cfg) == config.OccupiedError {
+			if setting == "" {
+				setting = t.occupiedSetting(cfg)
+			}
+			fatal = append(fatal, stats.Occupied...)
+		}
+		if stats.Filled+stats.Corrected == 0 {
 			continue
 		}
+		total.Changes = append(total.Changes, changedCells(t.Range, existing, merged, cfg)...)
 		payloads = append(payloads, &sheets.ValueRange{
 			MajorDimension: "ROWS",
-			Range:          rng,
+			Range:          t.Range,
 			Values:         merged,
 		})
 	}
-	return payloads, nil
+	if len(fatal) > 0 {
+		return nil, total, tag(ErrOccupied, fmt.Errorf("%d target cell(s) already contain data (%s): %s", len(fatal), setting, strings.Join(fatal, "; ")))
+	}
+	if len(total.Unexpected) > 0 && cfg.ExpectPolicy == config.ExpectPolicyFail {
+		return nil, total, tag(ErrExpectationNotMet, fmt.Errorf("expect_current_value not met for %d cell(s): %s", len(total.Unexpected), strings.Join(total.Unexpected, "; ")))
+	}
+	return payloads, total, nil
 }
 
-func batchUpdate(ctx context.Context, svc *sheets.Service, sheetID string, data []*sheets.ValueRange) (*sheets.BatchUpdateValuesResponse, error) {
-	req := &sheets.BatchUpdateValuesRequest{
-		ValueInputOption:        "USER_ENTERED",
-		IncludeValuesInResponse: true,
-		Data:                    data,
+// inputOptions maps the range of each target that sets its own value input
+// option to that option.
+func inputOptions(targets []target) map[string]string {
+	options := make(map[string]string)
+	for _, t := range targets {
+		if t.InputOption != "" {
+			options[t.Range] = t.InputOption
+		}
+	}
+	return options
+}
+
+// batchUpdate writes data, sending each range with the value input option
+// inputs gives it, or the config's. Ranges sharing an option go out
+// together, a request per option and chunk; the combined response lists
+// the ranges' responses in the order of data.
+func batchUpdate(ctx context.Context, svc *sheets.Service, cfg config.Config, data []*sheets.ValueRange, inputs map[string]string) (*sheets.BatchUpdateValuesResponse, error) {
+	var (
+		order  []string
+		groups = make(map[string][]int)
+	)
+	for i, vr := range data {
+		option := inputs[vr.Range]
+		if option == "" {
+			option = cfg.InputOption()
+		}
+		if _, ok := groups[option]; !ok {
+			order = append(order, option)
+		}
+		groups[option] = append(groups[option], i)
+	}
+	type request struct {
+		option string
+		chunk  []*sheets.ValueRange
+		index  []int
+	}
+	var requests []request
+	for _, option := range order {
+		group := make([]*sheets.ValueRange, len(groups[option]))
+		for j, i := range groups[option] {
+			group[j] = data[i]
+		}
+		chunks, err := chunkPayloads(group, cfg.MaxRequestBytes)
+		if err != nil {
+			return nil, err
+		}
+		index := groups[option]
+		for _, chunk := range chunks {
+			requests = append(requests, request{option: option, chunk: chunk, index: index[:len(chunk)]})
+			index = index[len(chunk):]
+		}
+	}
+	total := &sheets.BatchUpdateValuesResponse{SpreadsheetId: cfg.SpreadsheetID}
+	responses := make([]*sheets.UpdateValuesResponse, len(data))
+	for i, r := range requests {
+		req := &sheets.BatchUpdateValuesRequest{
+			ValueInputOption:          r.option,
+			IncludeValuesInResponse:   true,
+			ResponseValueRenderOption: cfg.ResponseValueRenderOption,
+			Data:                      r.chunk,
+		}
+		resp, err := svc.Spreadsheets.Values.BatchUpdate(cfg.SpreadsheetID, req).Context(ctx).Do()
+		if err != nil {
+			if nf := missingSpreadsheet(ctx, cfg.SpreadsheetID, err); nf != nil {
+				err = nf
+			}
+			if len(requests) > 1 {
+				return nil, fmt.Errorf("batch update failed on request %d of %d (earlier requests were written): %w", i+1, len(requests), err)
+			}
+			return nil, fmt.Errorf("batch update failed: %w", err)
+		}
+		total.TotalUpdatedCells += resp.TotalUpdatedCells
+		total.TotalUpdatedRows += resp.TotalUpdatedRows
+		total.TotalUpdatedColumns += resp.TotalUpdatedColumns
+		total.TotalUpdatedSheets += resp.TotalUpdatedSheets
+		for j, rr := range resp.Responses {
+			if j < len(r.index) {
+				responses[r.index[j]] = rr
+			}
+		}
+	}
+	for _, rr := range responses {
+		if rr == nil {
+			rr = &sheets.UpdateValuesResponse{}
+		}
+		total.Responses = append(total.Responses, rr)
 	}
-	resp, err := svc.Spreadsheets.Values.BatchUpdate(sheetID, req).Context(ctx).Do()
+	return total, nil
+}
+
+// writeResponse encodes resp, the combined response of every write request
+// of the run, as indented JSON.
+func writeResponse(w io.Writer, resp *sheets.BatchUpdateValuesResponse) error {
+	data, err := json.MarshalIndent(resp, "", "  ")
 	if err != nil {
-		return nil, fmt.Errorf("batch update failed: %w", err)
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// verifyWrites compares the values echoed in resp with the payloads sent,
+// skipping cells the merge left alone, and lists every cell that differs.
+func verifyWrites(payloads []*sheets.ValueRange, resp *sheets.BatchUpdateValuesResponse, cfg config.Config) []string {
+	var mismatched []string
+	for i, p := range payloads {
+		var echoed [][]interface{}
+		if i < len(resp.Responses) && resp.Responses[i].UpdatedData != nil {
+			echoed = resp.Responses[i].UpdatedData.Values
+		}
+		for r, row := range p.Values {
+			for c, sent := range row {
+				if sent == nil {
+					continue
+				}
+				var got interface{} = ""
+				if cellHasValue(echoed, r, c) {
+					got = echoed[r][c]
+				}
+				if !valuesEqual(got, sent, cfg) {
+					mismatched = append(mismatched, fmt.Sprintf("%s: sent %q, sheet holds %q", cellInRange(p.Range, r, c), fmt.Sprint(sent), fmt.Sprint(got)))
+				}
+			}
+		}
+	}
+	return mismatched
+}
+
+// overwrites reports whether the merge for t may replace cells that
+// already hold a value.
+func (t target) overwrites(cfg config.Config) bool {
+	return cfg.Mode == config.ModeSync || cfg.ExpectCurrentValue != nil || t.occupiedPolicy(cfg) == config.OccupiedOverwrite
+}
+
+// occupiedSetting is occupiedSetting for the policy that applies to t.
+func (t target) occupiedSetting(cfg config.Config) string {
+	if t.Policy != "" {
+		return t.Override + " occupied_cell_policy: " + t.Policy
 	}
-	return resp, nil
+	return occupiedSetting(cfg)
 }
 
-func fetchRangeValues(ctx context.Context, svc *sheets.Service, sheetID, rng string) ([][]interface{}, error) {
-	resp, err := svc.Spreadsheets.Values.Get(sheetID, rng).Context(ctx).Do()
+// occupiedSetting names the config entry that made occupied cells fatal.
+func occupiedSetting(cfg config.Config) string {
+	if cfg.InsertOnly {
+		return "insert_only"
+	}
+	return "occupied_cell_policy: " + config.OccupiedError
+}
+
+func fetchRangeValues(ctx context.Context, svc *sheets.Service, cfg config.Config, rng string) ([][]interface{}, error) {
+	call := svc.Spreadsheets.Values.Get(cfg.SpreadsheetID, rng)
+	if cfg.ValueRenderOption != "" {
+		call = call.ValueRenderOption(cfg.ValueRenderOption)
+	}
+	if cfg.DateTimeRenderOption != "" {
+		call = call.DateTimeRenderOption(cfg.DateTimeRenderOption)
+	}
+	resp, err := call.Context(ctx).Do()
 	if err != nil {
+		if missingTab(err) {
+			return nil, tag(ErrSheetNotFound, fmt.Errorf("fetch current value: sheet %q not found in spreadsheet %s (add the tab before running, or set create_missing_sheets): %w", sheetNameFromRange(rng), cfg.SpreadsheetID, err))
+		}
+		if nf := missingSpreadsheet(ctx, cfg.SpreadsheetID, err); nf != nil {
+			err = nf
+		}
 		return nil, fmt.Errorf("fetch current value: %w", err)
 	}
+	// An empty range comes back without values; callers treat nil as every
+	// cell empty.
 	return resp.Values, nil
 }
 
-func mergeValues(existing, desired [][]interface{}) ([][]interface{}, bool) {
+// missingTab reports whether the API rejected a range because its sheet
+// does not exist in the spreadsheet.
+func missingTab(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest &&
+		strings.Contains(apiErr.Message, "Unable to parse range")
+}
+
+// missingSpreadsheet turns a 404 from the API into an ErrSpreadsheetNotFound
+// error naming the service account to share id with, when the default
+// credentials reveal it. It returns nil for any other error.
+func missingSpreadsheet(ctx context.Context, id string, err error) error {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusNotFound {
+		return nil
+	}
+	account := "the service account"
+	if email := serviceAccountEmail(ctx); email != "" {
+		account += " " + email
+	}
+	return tag(ErrSpreadsheetNotFound, fmt.Errorf("spreadsheet %s not found or not shared with %s (check spreadsheet_id, the part of the URL after /d/): %w", id, account, err))
+}
+
+// serviceAccountEmail returns the client_email of the Application Default
+// Credentials, or "" when they are not a service account key.
+func serviceAccountEmail(ctx context.Context) string {
+	creds, err := google.FindDefaultCredentials(ctx, sheets.SpreadsheetsScope)
+	if err != nil || len(creds.JSON) == 0 {
+		return ""
+	}
+	var key struct {
+		ClientEmail string `json:"client_email"`
+	}
+	_ = json.Unmarshal(creds.JSON, &key)
+	return key.ClientEmail
+}
+
+// mergeValues fills empty remote cells with the desired values and keeps
+// everything else, returning how many cells it filled. Kept cells are left
+// nil, which the API skips, so their formulas and formats survive.
+func mergeValues(existing, desired [][]interface{}, cfg config.Config) ([][]interface{}, int) {
 	merged := make([][]interface{}, len(desired))
-	var wrote bool
+	var filled int
 	for r, row := range desired {
 		mergedRow := make([]interface{}, len(row))
 		for c, val := range row {
-			if cellHasValue(existing, r, c) {
-				mergedRow[c] = existing[r][c]
+			if remoteHasValue(existing, r, c, cfg) {
 				continue
 			}
 			mergedRow[c] = val
-			if strings.TrimSpace(fmt.Sprint(val)) != "" {
-				wrote = true
+			if !isBlank(val) {
+				filled++
 			}
 		}
 		merged[r] = mergedRow
 	}
-	return merged, wrote
+	return merged, filled
 }
 
 func cellHasValue(values [][]interface{}, row, col int) bool {
@@ -131,67 +885,465 @@ func cellHasValue(values [][]interface{}, row, col int) bool {
 	if col >= len(values[row]) {
 		return false
 	}
-	return strings.TrimSpace(fmt.Sprint(values[row][col])) != ""
+	return !isBlank(values[row][col])
+}
+
+// remoteHasValue is cellHasValue for cells read from Google Sheets. Under
+// occupied_if_whitespace, text made only of whitespace holds a value too.
+func remoteHasValue(values [][]interface{}, row, col int, cfg config.Config) bool {
+	if cfg.OccupiedIfWhitespace && row < len(values) && col < len(values[row]) {
+		if s, ok := values[row][col].(string); ok && s != "" {
+			return true
+		}
+	}
+	return cellHasValue(values, row, col)
+}
+
+// isBlank reports whether a cell value is nil or whitespace-only text,
+// counting any Unicode space such as a tab or non-breaking space. Numbers
+// and booleans, including 0 and false, are never blank.
+func isBlank(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(val) == ""
+	}
+	return false
 }
 
-func deriveRangesFromExcel(path, sheetFilter, lookup string) ([]string, []string, error) {
-	f, err := excelize.OpenFile(path)
+func deriveRangesFromExcel(ctx context.Context, path string, cfg config.Config) (derivation, error) {
+	wb, err := OpenWorkbookFile(path)
 	if err != nil {
-		return nil, nil, fmt.Errorf("open config workbook: %w", err)
+		return derivation{}, err
+	}
+	defer func() { _ = wb.Close() }()
+	return deriveTargets(ctx, wb, cfg)
+}
+
+// derivation is what scanning the workbook produced.
+type derivation struct {
+	Targets []target
+	Matches []Match
+	Sheets  []string // sheets scanned
+	// Resolved says which sheet each index filter such as #1 picked.
+	Resolved []string
+	Skipped  []string // matches that produced no target, with the reason
+	// Protected lists targets dropped by protect_header_row.
+	Protected []string
+	// Truncated lists the sheets max_scan_rows or max_scan_cols cut short,
+	// and Stopped those per_sheet_match_limit ended early.
+	Truncated []string
+	Stopped   []string
+}
+
+// derive builds the run's targets from import_file, ranges_from or the
+// workbook, unless opts already carries them.
+func derive(ctx context.Context, cfg config.Config, opts Options) (derivation, error) {
+	if opts.derived != nil {
+		return *opts.derived, nil
 	}
-	defer func() { _ = f.Close() }()
+	var (
+		d   derivation
+		err error
+	)
+	switch {
+	case opts.Source != nil:
+		if cfg.Mode == config.ModePull || cfg.WorkbookLog {
+			return d, errors.New("pull mode and workbook_log need the workbook scan and cannot use a value source")
+		}
+		if src, ok := opts.Source.(ExcelSource); ok {
+			d, err = src.derive(ctx, cfg)
+		} else {
+			d.Targets, err = sourceTargets(ctx, opts.Source, cfg)
+		}
+	case cfg.ImportFile != "":
+		d.Targets, err = readImport(cfg.ImportFile)
+	case cfg.RangesFrom != "":
+		d.Targets, err = readRanges(cfg.RangesFrom, cfg)
+	case opts.Workbook != nil:
+		if cfg.Mode == config.ModePull || cfg.WorkbookLog {
+			return d, errors.New("pull mode and workbook_log write back to config_xlsx and cannot use a workbook opened from a reader")
+		}
+		d, err = deriveTargets(ctx, opts.Workbook, cfg)
+	default:
+		d, err = deriveRangesFromExcel(ctx, cfg.Workbook, cfg)
+	}
+	return d, err
+}
 
-	want := strings.TrimSpace(lookup)
-	sheetsList := filterSheets(f.GetSheetList(), sheetFilter)
-	if sheetFilter != "" && len(sheetsList) == 0 {
-		return nil, nil, fmt.Errorf("sheet %q not found in %s", sheetFilter, path)
+// deriveTargets scans an opened workbook for the lookup value and builds a
+// target per match.
+func deriveTargets(ctx context.Context, wb *Workbook, cfg config.Config) (derivation, error) {
+	f, path := wb.f, wb.name
+	var (
+		sheetsList []string
+		resolved   []string
+		area       scanArea
+	)
+	if cfg.SearchDefinedName != "" {
+		sheet, a, err := resolveDefinedName(f, cfg.SearchDefinedName, cfg.SheetFilter)
+		if err != nil {
+			return derivation{}, err
+		}
+		sheetsList, area = []string{sheet}, a
+	} else {
+		var err error
+		if sheetsList, resolved, err = selectSheets(f, cfg); err != nil {
+			return derivation{}, tag(ErrSheetNotFound, fmt.Errorf("%w in %s", err, path))
+		}
+		if cfg.ScanRange != "" {
+			var err error
+			if area, err = parseArea(cfg.ScanRange); err != nil {
+				return derivation{}, fmt.Errorf("search_range: %w", err)
+			}
+		}
 	}
 
-	var matches []string
-	for _, sheet := range sheetsList {
-		rows, err := f.GetRows(sheet)
+	if err := validateWorkbookSchema(f, cfg); err != nil {
+		return derivation{}, fmt.Errorf("%w in %s", err, path)
+	}
+	if err := checkOverrideSheets(f, cfg); err != nil {
+		return derivation{}, fmt.Errorf("%w in %s", err, path)
+	}
+	d := derivation{Sheets: sheetsList, Resolved: resolved}
+	scans := scanSheets(ctx, f, sheetsList, cfg, area)
+	for i, sheet := range sheetsList {
+		found, cut, err := scans[i].found, scans[i].cut, scans[i].err
+		if err != nil {
+			return derivation{}, err
+		}
+		if note := cut.describe(sheet, cfg); note != "" {
+			d.Truncated = append(d.Truncated, note)
+		}
+		if note := cut.stoppedEarly(sheet, cfg); note != "" {
+			d.Stopped = append(d.Stopped, note)
+		}
+		if cfg.AnchorMustBeUnique && len(found) > 1 {
+			cells := make([]string, len(found))
+			for i, m := range found {
+				cells[i] = m.A1
+			}
+			return derivation{}, tag(ErrAnchorNotUnique, fmt.Errorf("anchor %q appears %d times on sheet %s (%s); anchor_must_be_unique is set", cfg.LookupValue, len(found), sheet, strings.Join(cells, ", ")))
+		}
+		d.Matches = append(d.Matches, found...)
+		scfg := cfg.ForSheet(sheet)
+		writeValue, err := scfg.TypedWriteValue()
 		if err != nil {
-			return nil, nil, fmt.Errorf("read sheet %s: %w", sheet, err)
+			return derivation{}, err
 		}
-		for rIdx, row := range rows {
-			for cIdx, cell := range row {
-				if strings.TrimSpace(cell) != want {
+		o, overridden := cfg.SheetOverrides[sheet]
+		for i, m := range found {
+			if overridden && o.MaxMatches != nil && i >= *o.MaxMatches {
+				d.Skipped = append(d.Skipped, fmt.Sprintf("%s: beyond sheet_overrides[%s] max_matches %d", m.A1, sheet, *o.MaxMatches))
+				continue
+			}
+			ts, reason, err := buildTargets(m, scfg, writeValue)
+			if err != nil {
+				return derivation{}, err
+			}
+			if reason != "" {
+				d.Skipped = append(d.Skipped, reason)
+				continue
+			}
+			for _, t := range ts {
+				if cfg.ProtectHeaderRow && t.Row <= cfg.HeaderRow && cfg.HeaderRow < t.Row+len(t.Values) {
+					what := t.Range
+					if t.Range != m.A1 {
+						what += " (match " + m.A1 + ")"
+					}
+					d.Protected = append(d.Protected, fmt.Sprintf("%s: header row %d is protected", what, cfg.HeaderRow))
 					continue
 				}
-				cellName, err := excelize.CoordinatesToCellName(cIdx+1, rIdx+1)
-				if err != nil {
-					return nil, nil, fmt.Errorf("build cell name: %w", err)
+				if overridden {
+					t.Policy = scfg.OccupiedCellPolicy
+					t.Override = fmt.Sprintf("sheet_overrides[%s]", sheet)
 				}
-				matches = append(matches, formatRange(sheet, cellName))
+				d.Targets = append(d.Targets, t)
 			}
 		}
 	}
 
-	if len(matches) == 0 {
-		return nil, nil, fmt.Errorf("value %q not found in %s", lookup, path)
+	sortCanonical(&d)
+	limitMatches(&d, cfg.WriteLimit)
+	if len(d.Matches) == 0 && len(cfg.NamedRangeTargets) == 0 && cfg.TouchCell == "" {
+		return derivation{}, tag(ErrValueNotFound, fmt.Errorf("value %q not found in %s", cfg.LookupValue, path))
 	}
-	return matches, sheetsList, nil
+	return d, nil
 }
 
-func filterSheets(all []string, filter string) []string {
-	if filter == "" {
-		return all
+// sortCanonical puts matches and targets in the order every range list
+// follows: workbook sheet order, then row, then column of the match, then
+// the order the match's targets were built in. Scanning already yields
+// this order; sorting makes it a guarantee rather than a side effect.
+func sortCanonical(d *derivation) {
+	order := make(map[string]int, len(d.Sheets))
+	for i, s := range d.Sheets {
+		order[s] = i
 	}
-	for _, s := range all {
-		if s == filter {
-			return []string{filter}
+	compare := func(a, b *Match) int {
+		return cmp.Or(cmp.Compare(order[a.Sheet], order[b.Sheet]), cmp.Compare(a.Row, b.Row), cmp.Compare(a.Col, b.Col))
+	}
+	slices.SortStableFunc(d.Matches, func(a, b Match) int { return compare(&a, &b) })
+	slices.SortStableFunc(d.Targets, func(a, b target) int {
+		if a.Match == nil || b.Match == nil {
+			// Targets without a match keep their place after those with one.
+			return cmp.Compare(boolRank(a.Match == nil), boolRank(b.Match == nil))
 		}
+		return compare(a.Match, b.Match)
+	})
+}
+
+// limitMatches keeps the targets of the first limit matches that produce
+// any, in canonical order, and records the other matches as skipped. A
+// limit of 0 keeps everything.
+func limitMatches(d *derivation, limit int) {
+	if limit <= 0 {
+		return
 	}
-	return nil
+	// write records, per match, whether its targets are kept.
+	write := make(map[string]bool)
+	var kept []target
+	for _, t := range d.Targets {
+		if t.Match == nil {
+			kept = append(kept, t)
+			continue
+		}
+		ok, seen := write[t.Match.A1]
+		if !seen {
+			ok = len(write) < limit
+			write[t.Match.A1] = ok
+			if !ok {
+				d.Skipped = append(d.Skipped, fmt.Sprintf("%s: beyond write_limit %d", t.Match.A1, limit))
+			}
+		}
+		if ok {
+			kept = append(kept, t)
+		}
+	}
+	d.Targets = kept
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// buildTargets turns a match into its targets: one per entry of writes,
+// or else the single target buildTarget makes.
+func buildTargets(m Match, cfg config.Config, writeValue interface{}) ([]target, string, error) {
+	if len(cfg.Writes) == 0 {
+		t, reason, err := buildTarget(m, cfg, writeValue)
+		if err != nil || reason != "" {
+			return nil, reason, err
+		}
+		return []target{t}, "", nil
+	}
+	targets := make([]target, 0, len(cfg.Writes))
+	for i, w := range cfg.Writes {
+		rowOffset, colOffset, err := w.Offsets()
+		if err != nil {
+			return nil, "", fmt.Errorf("writes[%d]: %w", i, err)
+		}
+		row, col := m.Row+rowOffset, m.Col+colOffset
+		rng, err := targetRange(m.Sheet, row, col, 1, 1)
+		if err != nil {
+			return nil, "", fmt.Errorf("build writes[%d] for match at %s: %w", i, m.A1, err)
+		}
+		targets = append(targets, target{
+			Range:       rng,
+			Anchor:      m.A1,
+			Values:      [][]interface{}{{w.Value}},
+			Sheet:       m.Sheet,
+			Row:         row,
+			Col:         col,
+			Match:       &m,
+			InputOption: w.ValueInputOption,
+		})
+	}
+	return targets, "", nil
+}
+
+// buildTarget turns a match into the Google Sheets target it should write.
+// A non-empty reason means the match was skipped.
+func buildTarget(m Match, cfg config.Config, writeValue interface{}) (target, string, error) {
+	anchor := m.A1
+	value := writeValue
+	if cfg.UsesSourceCell() {
+		if strings.TrimSpace(m.Source) == "" && blockIsBlank(m.SourceBlock) {
+			what := "cell"
+			if cfg.UsesTargetBlock() {
+				what = "block"
+			}
+			return target{}, fmt.Sprintf("%s: source %s at offset (%d,%d) is empty", anchor, what, cfg.SourceRowOffset, cfg.SourceColOffset), nil
+		}
+		value = m.Source
+	}
+	if cfg.WriteMatchedCell {
+		value = m.CellValue
+	}
+	var values [][]interface{}
+	if cfg.UsesTargetBlock() {
+		values = buildBlockValues(m, cfg, value)
+	} else {
+		width := 1
+		if cfg.WriteToRowEnd {
+			width = m.Width - m.Col + 1
+		}
+		values = [][]interface{}{buildRowValues(value, cfg.RowValues, width)}
+	}
+	rowOffset, colOffset := cfg.TargetOffset()
+	row, col := m.Row+rowOffset, m.Col+colOffset
+	fixed, err := cfg.TargetColumnNumber()
+	if err != nil {
+		return target{}, "", err
+	}
+	if fixed > 0 {
+		col = fixed
+	}
+	rng, err := targetRange(m.Sheet, row, col, len(values), len(values[0]))
+	if err != nil {
+		return target{}, "", fmt.Errorf("build target for match at %s: %w", anchor, err)
+	}
+	return target{
+		Range:  rng,
+		Anchor: anchor,
+		Values: values,
+		Sheet:  m.Sheet,
+		Row:    row,
+		Col:    col,
+		Match:  &m,
+	}, "", nil
 }
 
+// buildBlockValues lays out the target block of a match: block_values row
+// by row when set, else the source block, else value in every cell.
+func buildBlockValues(m Match, cfg config.Config, value interface{}) [][]interface{} {
+	rows, cols := cfg.TargetBlock()
+	switch {
+	case len(cfg.BlockValues) > 0:
+		values := make([][]interface{}, rows)
+		for r := range values {
+			values[r] = make([]interface{}, cols)
+			for c := range values[r] {
+				values[r][c] = cfg.BlockValues[r*cols+c]
+			}
+		}
+		return values
+	case m.SourceBlock != nil:
+		values := make([][]interface{}, len(m.SourceBlock))
+		for r, row := range m.SourceBlock {
+			values[r] = make([]interface{}, len(row))
+			for c, cell := range row {
+				values[r][c] = cell
+			}
+		}
+		return values
+	}
+	return fillValues(value, rows, cols)
+}
+
+func blockIsBlank(block [][]string) bool {
+	for _, row := range block {
+		for _, cell := range row {
+			if strings.TrimSpace(cell) != "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// fillValues is a rows x cols block holding value in every cell.
+func fillValues(value interface{}, rows, cols int) [][]interface{} {
+	values := make([][]interface{}, max(rows, 1))
+	for i := range values {
+		values[i] = buildRowValues(value, nil, cols)
+	}
+	return values
+}
+
+// buildRowValues lays out a single-row payload of the given width. RowValues
+// take priority and narrow the row when shorter; otherwise value is repeated.
+func buildRowValues(value interface{}, rowValues []string, width int) []interface{} {
+	if width < 1 {
+		width = 1
+	}
+	if len(rowValues) > 0 {
+		if len(rowValues) < width {
+			width = len(rowValues)
+		}
+		out := make([]interface{}, width)
+		for i := range out {
+			out[i] = rowValues[i]
+		}
+		return out
+	}
+	out := make([]interface{}, width)
+	for i := range out {
+		out[i] = value
+	}
+	return out
+}
+
+// targetRange builds an A1 range of height rows and width columns starting
+// at the 1-based cell.
+func targetRange(sheet string, row, col, height, width int) (string, error) {
+	start, err := excelize.CoordinatesToCellName(col, row)
+	if err != nil {
+		return "", err
+	}
+	if height <= 1 && width <= 1 {
+		return formatRange(sheet, start), nil
+	}
+	end, err := excelize.CoordinatesToCellName(col+max(width, 1)-1, row+max(height, 1)-1)
+	if err != nil {
+		return "", err
+	}
+	return formatRange(sheet, start+":"+end), nil
+}
+
+// formatRange joins a sheet title and an A1 cell or range. The title is
+// left bare only when it is a plain identifier (ASCII letter or underscore,
+// then ASCII letters, digits and underscores) that could not be read as a
+// cell reference; anything else, such as "Week 1", "2024", "A1" or Thai
+// text, is quoted with apostrophes doubled. Only the sheet title and cell
+// reference go into a range; values never do.
 func formatRange(sheet, cell string) string {
-	if strings.ContainsAny(sheet, " !'") {
+	if needsQuotes(sheet) {
 		return fmt.Sprintf("'%s'!%s", strings.ReplaceAll(sheet, "'", "''"), cell)
 	}
 	return fmt.Sprintf("%s!%s", sheet, cell)
 }
 
+var (
+	bareSheetName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// cellLikeName matches titles the API would read as an A1 or R1C1 cell.
+	cellLikeName = regexp.MustCompile(`^(?i:[A-Z]{1,3}[0-9]+|R[0-9]*C[0-9]*)$`)
+)
+
+func needsQuotes(sheet string) bool {
+	return !bareSheetName.MatchString(sheet) || cellLikeName.MatchString(sheet)
+}
+
+func payloadRanges(payloads []*sheets.ValueRange) []string {
+	ranges := make([]string, 0, len(payloads))
+	for _, p := range payloads {
+		ranges = append(ranges, p.Range)
+	}
+	return ranges
+}
+
+func targetRanges(targets []target) []string {
+	ranges := make([]string, 0, len(targets))
+	for _, t := range targets {
+		ranges = append(ranges, t.Range)
+	}
+	return ranges
+}
+
 func uniqueSheetNames(ranges []string) []string {
 	seen := make(map[string]struct{})
 	var names []string
@@ -210,7 +1362,9 @@ func uniqueSheetNames(ranges []string) []string {
 }
 
 func sheetNameFromRange(rng string) string {
-	idx := strings.Index(rng, "!")
+	// The cell part never holds "!", so the last one ends the (possibly
+	// quoted) sheet title even when the title itself contains "!".
+	idx := strings.LastIndex(rng, "!")
 	if idx == -1 {
 		return ""
 	}
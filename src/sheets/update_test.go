@@ -0,0 +1,1223 @@
+package sheets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+func TestWriteToRowEndRaggedRows(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{
+		{"Alice", "a", "b", "c"},
+		{"x", "Alice"},
+		{"x", "y", "z", "Alice"},
+		{"Alice"},
+	}})
+	tests := []struct {
+		name   string
+		cfg    config.Config
+		ranges []string
+		values [][][]interface{}
+	}{
+		{
+			name:   "single cell without write_to_row_end",
+			cfg:    config.Config{LookupValue: "Alice"},
+			ranges: []string{"Plan!A1", "Plan!B2", "Plan!D3", "Plan!A4"},
+			values: [][][]interface{}{{{"Alice"}}, {{"Alice"}}, {{"Alice"}}, {{"Alice"}}},
+		},
+		{
+			name:   "repeats the value to each row's last column",
+			cfg:    config.Config{LookupValue: "Alice", WriteToRowEnd: true},
+			ranges: []string{"Plan!A1:D1", "Plan!B2", "Plan!D3", "Plan!A4"},
+			values: [][][]interface{}{
+				{{"Alice", "Alice", "Alice", "Alice"}},
+				{{"Alice"}},
+				{{"Alice"}},
+				{{"Alice"}},
+			},
+		},
+		{
+			name:   "row_values narrow the row when shorter",
+			cfg:    config.Config{LookupValue: "Alice", WriteToRowEnd: true, RowValues: []string{"1", "2"}},
+			ranges: []string{"Plan!A1:B1", "Plan!B2", "Plan!D3", "Plan!A4"},
+			values: [][][]interface{}{{{"1", "2"}}, {{"1"}}, {{"1"}}, {{"1"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := deriveFixture(t, path, tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Ranges, tt.ranges) {
+				t.Errorf("ranges = %v, want %v", got.Ranges, tt.ranges)
+			}
+			if !reflect.DeepEqual(got.Values, tt.values) {
+				t.Errorf("values = %v, want %v", got.Values, tt.values)
+			}
+		})
+	}
+}
+
+func TestBuildRowValues(t *testing.T) {
+	tests := []struct {
+		name      string
+		rowValues []string
+		width     int
+		want      []interface{}
+	}{
+		{"repeats the value", nil, 3, []interface{}{"v", "v", "v"}},
+		{"width below one writes one cell", nil, 0, []interface{}{"v"}},
+		{"row values fill the width", []string{"a", "b", "c"}, 2, []interface{}{"a", "b"}},
+		{"short row values narrow the row", []string{"a"}, 4, []interface{}{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildRowValues("v", tt.rowValues, tt.width); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildRowValues = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTypedWriteValuePayload(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	tests := []struct {
+		name      string
+		writeType string
+		value     string
+		want      interface{}
+	}{
+		{"number", "number", " 42.5 ", 42.5},
+		{"bool", "bool", "TRUE", true},
+		{"false is kept", "bool", "false", false},
+		{"string", "string", "007", "007"},
+		{"default is string", "", "42", "42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{LookupValue: "Alice", WriteValue: tt.value, WriteType: tt.writeType}
+			got, err := deriveFixture(t, path, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Values) != 1 {
+				t.Fatalf("got %d payloads, want 1", len(got.Values))
+			}
+			cell := got.Values[0][0][0]
+			if reflect.TypeOf(cell) != reflect.TypeOf(tt.want) || cell != tt.want {
+				t.Errorf("payload = %#v (%T), want %#v (%T)", cell, cell, tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsBlank(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want bool
+	}{
+		{nil, true},
+		{"", true},
+		{"  ", true},
+		{"\t", true},
+		{"\u00a0", true},
+		{" \t\u00a0\n", true},
+		{"x", false},
+		{"\u00a0x", false},
+		{0.0, false},
+		{false, false},
+	}
+	for _, tt := range tests {
+		if got := isBlank(tt.v); got != tt.want {
+			t.Errorf("isBlank(%#v) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestOccupiedIfWhitespace(t *testing.T) {
+	contents := []struct {
+		name string
+		cell string
+	}{
+		{"space", " "},
+		{"tab", "\t"},
+		{"nbsp", "\u00a0"},
+	}
+	for _, c := range contents {
+		for _, occupied := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/occupied_if_whitespace=%v", c.name, occupied), func(t *testing.T) {
+				cfg := config.Config{OccupiedIfWhitespace: occupied}
+				existing := [][]interface{}{{c.cell, "kept"}}
+				desired := [][]interface{}{{"x", "x"}}
+				// Kept cells are left nil so the write skips them.
+				wantFirst := interface{}("x")
+				if occupied {
+					wantFirst = nil
+				}
+
+				if got := remoteHasValue(existing, 0, 0, cfg); got != occupied {
+					t.Errorf("remoteHasValue = %v, want %v", got, occupied)
+				}
+
+				merged, stats := mergeOccupied("Plan!A1:B1", existing, desired, config.OccupiedSkip, cfg)
+				if merged[0][0] != wantFirst || merged[0][1] != nil {
+					t.Errorf("fill merge = %q, want [%q <nil>]", merged[0], wantFirst)
+				}
+				wantOccupied := 1
+				if occupied {
+					wantOccupied = 2
+				}
+				if len(stats.Occupied) != wantOccupied {
+					t.Errorf("occupied cells = %q, want %d", stats.Occupied, wantOccupied)
+				}
+
+				_, stats = mergeSync("Plan!A1:B1", existing, desired, cfg)
+				if occupied && (stats.Filled != 0 || stats.Corrected != 2) || !occupied && (stats.Filled != 1 || stats.Corrected != 1) {
+					t.Errorf("sync filled %d, corrected %d", stats.Filled, stats.Corrected)
+				}
+			})
+		}
+	}
+}
+
+func TestTouchWithAndWithoutMatches(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice", "Bob"}}})
+	tests := []struct {
+		name   string
+		lookup string
+		want   []string
+	}{
+		{"with matches", "Alice", []string{"Plan!A1", "Meta!B1"}},
+		{"without matches", "Carol", []string{"Meta!B1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSheets{}
+			svc := newFakeService(t, fake)
+			cfg := config.Config{
+				SpreadsheetID: "sheet-id",
+				LookupValue:   tt.lookup,
+				Workbook:      path,
+				TouchCell:     "Meta!B1",
+				Timezone:      "UTC",
+			}
+			if _, err := update(context.Background(), svc, cfg, Options{}); err != nil {
+				t.Fatalf("update: %v", err)
+			}
+			if err := touch(context.Background(), svc, cfg); err != nil {
+				t.Fatalf("touch: %v", err)
+			}
+			if got := fake.writes(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("writes = %v, want %v", got, tt.want)
+			}
+			stamp := fmt.Sprint(fake.cells["Meta!B1"][0][0])
+			if _, err := time.Parse("2006-01-02 15:04:05", stamp); err != nil {
+				t.Errorf("touch value %q is not a timestamp: %v", stamp, err)
+			}
+		})
+	}
+}
+
+func TestRenderOptionsReachRequest(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	tests := []struct {
+		name               string
+		valueRender        string
+		dateTimeRender     string
+		wantValue, wantDTR string
+	}{
+		{name: "api defaults"},
+		{name: "unformatted serial", valueRender: "UNFORMATTED_VALUE", dateTimeRender: "SERIAL_NUMBER",
+			wantValue: "UNFORMATTED_VALUE", wantDTR: "SERIAL_NUMBER"},
+		{name: "formula", valueRender: "FORMULA", wantValue: "FORMULA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSheets{}
+			svc := newFakeService(t, fake)
+			fake.cells["Plan!A1"] = [][]interface{}{{"occupied"}}
+			cfg := config.Config{
+				SpreadsheetID:        "sheet-id",
+				LookupValue:          "Alice",
+				Workbook:             path,
+				ValueRenderOption:    tt.valueRender,
+				DateTimeRenderOption: tt.dateTimeRender,
+			}
+			if _, err := update(context.Background(), svc, cfg, Options{}); err != nil {
+				t.Fatal(err)
+			}
+			if len(fake.gets) != 1 {
+				t.Fatalf("got %d reads, want 1", len(fake.gets))
+			}
+			q := fake.gets[0]
+			if q.Get("valueRenderOption") != tt.wantValue || q.Get("dateTimeRenderOption") != tt.wantDTR {
+				t.Errorf("query = %v, want valueRenderOption=%q dateTimeRenderOption=%q", q, tt.wantValue, tt.wantDTR)
+			}
+		})
+	}
+}
+
+func TestUnformattedReadChangesSyncDecision(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	tests := []struct {
+		valueRender string
+		wantWrites  int
+	}{
+		// "1,234.50" does not equal 1234.5, so the formatted read rewrites it.
+		{"", 1},
+		{"UNFORMATTED_VALUE", 0},
+	}
+	for _, tt := range tests {
+		t.Run("render="+tt.valueRender, func(t *testing.T) {
+			fake := &fakeSheets{renders: map[string]map[string][][]interface{}{
+				"UNFORMATTED_VALUE": {"Plan!A1": {{1234.5}}},
+			}}
+			svc := newFakeService(t, fake)
+			fake.cells["Plan!A1"] = [][]interface{}{{"1,234.50"}}
+			cfg := config.Config{
+				SpreadsheetID:     "sheet-id",
+				LookupValue:       "Alice",
+				Workbook:          path,
+				Mode:              config.ModeSync,
+				WriteValue:        "1234.5",
+				WriteType:         "number",
+				ValueRenderOption: tt.valueRender,
+			}
+			if _, err := update(context.Background(), svc, cfg, Options{}); err != nil {
+				t.Fatal(err)
+			}
+			if got := len(fake.writes()); got != tt.wantWrites {
+				t.Errorf("got %d writes, want %d", got, tt.wantWrites)
+			}
+		})
+	}
+}
+
+func TestAdversarialLookupValues(t *testing.T) {
+	values := []string{"Alice!B2", "O'Brien", "two  words", "'quoted'!A1", "Sheet1!A1:B2"}
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{values}})
+	for i, v := range values {
+		t.Run(v, func(t *testing.T) {
+			got, err := deriveFixture(t, path, config.Config{LookupValue: v})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cell, _ := excelize.CoordinatesToCellName(i+1, 1)
+			want := []string{"Plan!" + cell}
+			if !reflect.DeepEqual(got.Ranges, want) {
+				t.Errorf("ranges = %v, want %v", got.Ranges, want)
+			}
+			if got.Values[0][0][0] != v {
+				t.Errorf("value = %#v, want %q", got.Values[0][0][0], v)
+			}
+		})
+	}
+}
+
+func TestFormatRange(t *testing.T) {
+	tests := []struct {
+		sheet, cell, want string
+	}{
+		{"Plan", "A1", "Plan!A1"},
+		{"Week_2", "B3:C4", "Week_2!B3:C4"},
+		{"Week 2", "A1", "'Week 2'!A1"},
+		{"Alice!B2", "A1", "'Alice!B2'!A1"},
+		{"O'Brien", "A1", "'O''Brien'!A1"},
+		{"Q1-2024", "A1", "'Q1-2024'!A1"},
+		{"Übersicht", "A1", "'Übersicht'!A1"},
+		{"Budget, 2024", "A1", "'Budget, 2024'!A1"},
+		{"Costs (draft)", "A1", "'Costs (draft)'!A1"},
+		{"ตารางงาน", "A1", "'ตารางงาน'!A1"},
+		{"สัปดาห์ที่ 1", "A1", "'สัปดาห์ที่ 1'!A1"},
+		{"2024", "A1", "'2024'!A1"},
+		{"1st_week", "A1", "'1st_week'!A1"},
+		{"A1", "B2", "'A1'!B2"},
+		{"xfd1048576", "A1", "'xfd1048576'!A1"},
+		{"R1C1", "A1", "'R1C1'!A1"},
+		{"rc", "A1", "'rc'!A1"},
+		{"ABCD1", "A1", "ABCD1!A1"},
+		{"_hidden", "A1", "_hidden!A1"},
+		{"Sheet1", "A1", "Sheet1!A1"},
+		{"Week-1", "A1", "'Week-1'!A1"},
+		{"Tab.Name", "A1", "'Tab.Name'!A1"},
+		{"Trailing ", "A1", "'Trailing '!A1"},
+		{"''", "A1", "''''''!A1"},
+	}
+	for _, tt := range tests {
+		rng := formatRange(tt.sheet, tt.cell)
+		if rng != tt.want {
+			t.Errorf("formatRange(%q, %q) = %q, want %q", tt.sheet, tt.cell, rng, tt.want)
+		}
+		if got := sheetNameFromRange(rng); got != tt.sheet {
+			t.Errorf("sheetNameFromRange(%q) = %q, want %q", rng, got, tt.sheet)
+		}
+	}
+}
+
+func TestInsertOnly(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}, {"Alice"}}})
+	tests := []struct {
+		name       string
+		remote     map[string][][]interface{}
+		wantWrites []string
+		wantErr    string
+	}{
+		{
+			name:       "all empty writes",
+			wantWrites: []string{"Plan!A1", "Plan!A2"},
+		},
+		{
+			name:    "any populated errors",
+			remote:  map[string][][]interface{}{"Plan!A2": {{"Bob"}}},
+			wantErr: `1 target cell(s) already contain data (insert_only): Plan!A2[0,0] (error): current value "Bob"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSheets{cells: tt.remote}
+			svc := newFakeService(t, fake)
+			cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path, InsertOnly: true}
+			if err := cfg.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			_, err := update(context.Background(), svc, cfg, Options{})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got := fake.writes(); !reflect.DeepEqual(got, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", got, tt.wantWrites)
+			}
+		})
+	}
+}
+
+func TestSheetOverrides(t *testing.T) {
+	path := writeWorkbook(t,
+		fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}},
+		fixtureSheet{name: "Archive", rows: [][]string{{"Alice"}}},
+		fixtureSheet{name: "Log", rows: [][]string{{"Alice"}}},
+	)
+	intp := func(n int) *int { return &n }
+	strp := func(s string) *string { return &s }
+	fake := &fakeSheets{cells: map[string][][]interface{}{
+		"Archive!A2": {{"old"}},
+		"Log!C1":     {{"kept"}},
+	}}
+	svc := newFakeService(t, fake)
+	cfg := config.Config{
+		SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path,
+		WriteValue: "Done", TargetColOffset: 2,
+		SheetOverrides: map[string]config.Override{
+			"Plan":    {TargetColOffset: intp(1), WriteValue: strp("Planned")},
+			"Archive": {TargetRowOffset: intp(1), TargetColOffset: intp(0), WriteValue: strp("Archived"), OccupiedCellPolicy: "overwrite"},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := update(context.Background(), svc, cfg, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Log keeps the global settings, so its occupied target is skipped.
+	want := map[string]string{"Plan!B1": "Planned", "Archive!A2": "Archived", "Log!C1": "kept"}
+	for rng, value := range want {
+		if got := fake.cells[rng]; !reflect.DeepEqual(got, [][]interface{}{{value}}) {
+			t.Errorf("%s = %v, want %q", rng, got, value)
+		}
+	}
+	wantRanges := []string{"Archive!A2", "Plan!B1"}
+	if got := slices.Sorted(slices.Values(fake.writes())); !reflect.DeepEqual(got, wantRanges) {
+		t.Errorf("writes = %v, want %v", got, wantRanges)
+	}
+	wantOverrides := []string{"Archive!A2: sheet_overrides[Archive]", "Plan!B1: sheet_overrides[Plan]"}
+	if got := slices.Sorted(slices.Values(summary.Overrides)); !reflect.DeepEqual(got, wantOverrides) {
+		t.Errorf("overrides = %v, want %v", got, wantOverrides)
+	}
+	wantOccupied := []string{`Archive!A2[0,0] (overwrite): current value "old"`, `Log!C1[0,0] (skip): current value "kept"`}
+	if got := slices.Sorted(slices.Values(summary.Occupied)); !reflect.DeepEqual(got, wantOccupied) {
+		t.Errorf("occupied = %q, want %q", got, wantOccupied)
+	}
+}
+
+func TestWithQuotaHint(t *testing.T) {
+	apiErr := func(code int, message string) error {
+		return &googleapi.Error{Code: code, Message: message}
+	}
+	denied := apiErr(http.StatusForbidden, "Caller does not have required permission to use project billing. Grant the caller the roles/serviceusage.serviceUsageConsumer role (serviceusage.services.use)")
+	tests := []struct {
+		name         string
+		err          error
+		quotaProject string
+		want         string // hint text; "" means err comes back unchanged
+	}{
+		{"quota project denied", denied, "", "set quota_project in the config"},
+		{"configured quota project denied", denied, "billing", `quota_project "billing" is not allowed`},
+		{"rate limited", apiErr(http.StatusTooManyRequests, "Quota exceeded for quota metric 'Read requests'"), "", "the API quota is used up"},
+		{"configured quota project rate limited", apiErr(http.StatusTooManyRequests, "Too many requests"), "billing", `quota_project "billing" has used up its API quota`},
+		{"quota exceeded as 403", apiErr(http.StatusForbidden, "Quota exceeded for quota metric 'Write requests'"), "", "the API quota is used up"},
+		{"wrapped", fmt.Errorf("fetch spreadsheet: %w", apiErr(http.StatusTooManyRequests, "")), "", "the API quota is used up"},
+		{"not shared", apiErr(http.StatusForbidden, "The caller does not have permission"), "", ""},
+		{"not found", apiErr(http.StatusNotFound, "Requested entity was not found."), "billing", ""},
+		{"server error", apiErr(http.StatusInternalServerError, "Internal error"), "", ""},
+		{"not an API error", errors.New("dial tcp: connection refused"), "billing", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := withQuotaHint(tt.err, config.Config{QuotaProject: tt.quotaProject})
+			if tt.want == "" {
+				if got != tt.err {
+					t.Errorf("withQuotaHint = %v, want %v unchanged", got, tt.err)
+				}
+				return
+			}
+			if !errors.Is(got, tt.err) || !strings.Contains(got.Error(), "(hint: "+tt.want) {
+				t.Errorf("withQuotaHint = %v, want %v with hint %q", got, tt.err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyWritesWithResponseRenderOption(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	// The sheet displays numbers with a thousands separator and two decimals.
+	echo := func(option string, sent interface{}) interface{} {
+		if _, ok := sent.(float64); ok && option != "UNFORMATTED_VALUE" {
+			return "1,234.50"
+		}
+		return sent
+	}
+	tests := []struct {
+		option         string
+		wantUnverified []string
+	}{
+		{"", []string{`Plan!A1: sent "1234.5", sheet holds "1,234.50"`}},
+		{"FORMATTED_VALUE", []string{`Plan!A1: sent "1234.5", sheet holds "1,234.50"`}},
+		{"UNFORMATTED_VALUE", nil},
+	}
+	for _, tt := range tests {
+		t.Run("option="+tt.option, func(t *testing.T) {
+			fake := &fakeSheets{echo: echo}
+			svc := newFakeService(t, fake)
+			cfg := config.Config{
+				SpreadsheetID:             "sheet-id",
+				LookupValue:               "Alice",
+				Workbook:                  path,
+				WriteValue:                "1234.5",
+				WriteType:                 "number",
+				ResponseValueRenderOption: tt.option,
+				VerifyWrites:              true,
+			}
+			summary, err := update(context.Background(), svc, cfg, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fake.valueRequests) != 1 {
+				t.Fatalf("got %d write requests, want 1", len(fake.valueRequests))
+			}
+			if got := fake.valueRequests[0].ResponseValueRenderOption; got != tt.option {
+				t.Errorf("ResponseValueRenderOption = %q, want %q", got, tt.option)
+			}
+			if !reflect.DeepEqual(summary.Unverified, tt.wantUnverified) {
+				t.Errorf("Unverified = %v, want %v", summary.Unverified, tt.wantUnverified)
+			}
+		})
+	}
+}
+
+func TestSortCanonical(t *testing.T) {
+	m := func(sheet string, row, col int) *Match {
+		return &Match{Sheet: sheet, Row: row, Col: col, A1: fmt.Sprintf("%s!R%dC%d", sheet, row, col)}
+	}
+	d := derivation{
+		Sheets: []string{"Zeta", "Alpha"},
+		Matches: []Match{
+			*m("Alpha", 1, 1), *m("Zeta", 2, 1), *m("Zeta", 1, 3), *m("Zeta", 1, 2),
+		},
+		Targets: []target{
+			{Range: "named"},
+			{Range: "alpha-1", Match: m("Alpha", 1, 1)},
+			{Range: "zeta-3a", Match: m("Zeta", 1, 3)},
+			{Range: "import"},
+			{Range: "zeta-3b", Match: m("Zeta", 1, 3)},
+			{Range: "zeta-2", Match: m("Zeta", 1, 2)},
+			{Range: "zeta-row2", Match: m("Zeta", 2, 1)},
+		},
+	}
+	sortCanonical(&d)
+
+	var matches, targets []string
+	for _, m := range d.Matches {
+		matches = append(matches, m.A1)
+	}
+	for _, tg := range d.Targets {
+		targets = append(targets, tg.Range)
+	}
+	if want := []string{"Zeta!R1C2", "Zeta!R1C3", "Zeta!R2C1", "Alpha!R1C1"}; !reflect.DeepEqual(matches, want) {
+		t.Errorf("matches = %v, want %v", matches, want)
+	}
+	if want := []string{"zeta-2", "zeta-3a", "zeta-3b", "zeta-row2", "alpha-1", "named", "import"}; !reflect.DeepEqual(targets, want) {
+		t.Errorf("targets = %v, want %v", targets, want)
+	}
+}
+
+func TestSummaryStableAcrossRuns(t *testing.T) {
+	path := writeWorkbook(t,
+		fixtureSheet{name: "Week 2", rows: [][]string{{"Bob", "Alice"}, {"Alice", "Alice"}}},
+		fixtureSheet{name: "Week 1", rows: [][]string{{"Alice"}, {"Carol", "Alice"}}},
+	)
+	cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path}
+	var first string
+	for run := 0; run < 5; run++ {
+		summary, err := update(context.Background(), newFakeService(t, &fakeSheets{}), cfg, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := fmt.Sprintf("%v\n%v\n%s\n", summary.Ranges, summary.Matches, summary.Preview)
+		if run == 0 {
+			first = out
+			want := "['Week 2'!B1 'Week 2'!A2 'Week 2'!B2 'Week 1'!A1 'Week 1'!B2]"
+			if got := fmt.Sprint(summary.Ranges); got != want {
+				t.Errorf("ranges = %s, want %s", got, want)
+			}
+			continue
+		}
+		if out != first {
+			t.Fatalf("run %d summary differs:\n%s\nfirst run:\n%s", run, out, first)
+		}
+	}
+}
+
+func TestBuildTargetsWrites(t *testing.T) {
+	now := time.Date(2024, 3, 5, 1, 2, 3, 0, time.UTC)
+	cfg, err := config.Config{
+		LookupValue: "Alice",
+		Timezone:    "UTC",
+		Writes: []config.CellWrite{
+			{Offset: "+1,0", Value: "DONE"},
+			{Offset: "0, +2", Value: "{{now}}"},
+			{Offset: "-1,-1", Value: "by {{lookup}}"},
+		},
+	}.ExpandTemplates(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := Match{Sheet: "Week 1", Row: 4, Col: 3, A1: "'Week 1'!C4"}
+	targets, reason, err := buildTargets(m, cfg, "ignored")
+	if err != nil || reason != "" {
+		t.Fatalf("buildTargets = %q, %v", reason, err)
+	}
+	wantRanges := []string{"'Week 1'!C5", "'Week 1'!E4", "'Week 1'!B3"}
+	if len(targets) != len(wantRanges) {
+		t.Fatalf("got %d targets, want %d", len(targets), len(wantRanges))
+	}
+	for i, tg := range targets {
+		if tg.Range != wantRanges[i] || tg.Anchor != m.A1 || tg.Match == nil || tg.Match.A1 != m.A1 {
+			t.Errorf("target %d = %s anchored at %s, want %s anchored at %s", i, tg.Range, tg.Anchor, wantRanges[i], m.A1)
+		}
+	}
+	if got := targets[0].Values; !reflect.DeepEqual(got, [][]interface{}{{"DONE"}}) {
+		t.Errorf("first value = %v, want DONE", got)
+	}
+	if got := targets[1].Values[0][0]; got != "2024-03-05T01:02:03Z" {
+		t.Errorf("{{now}} expanded to %v, want 2024-03-05T01:02:03Z", got)
+	}
+	if got := targets[2].Values[0][0]; got != "by Alice" {
+		t.Errorf("{{lookup}} expanded to %v, want by Alice", got)
+	}
+
+	m.Row, m.Col = 1, 1
+	if _, _, err := buildTargets(m, cfg, "ignored"); err == nil {
+		t.Error("an offset above row 1 built a target")
+	}
+}
+
+func TestProtectHeaderRow(t *testing.T) {
+	tests := []struct {
+		name       string
+		rows       [][]string
+		headerRow  int
+		protect    bool
+		wantWrites []string
+		protected  []string
+		skipped    string
+	}{
+		{
+			name:       "unprotected header is written",
+			rows:       [][]string{{"Alice"}, {"Bob"}, {"Alice"}},
+			headerRow:  1,
+			wantWrites: []string{"Plan!A1", "Plan!A3"},
+		},
+		{
+			name:       "header match filtered out",
+			rows:       [][]string{{"Alice"}, {"Bob"}, {"Alice"}},
+			headerRow:  1,
+			protect:    true,
+			wantWrites: []string{"Plan!A3"},
+			protected:  []string{"Plan!A1: header row 1 is protected"},
+		},
+		{
+			name:       "custom header row",
+			rows:       [][]string{{"Alice"}, {"Alice"}, {"Alice"}},
+			headerRow:  2,
+			protect:    true,
+			wantWrites: []string{"Plan!A1", "Plan!A3"},
+			protected:  []string{"Plan!A2: header row 2 is protected"},
+		},
+		{
+			name:      "only the header matched",
+			rows:      [][]string{{"Alice"}, {"Bob"}},
+			headerRow: 1,
+			protect:   true,
+			protected: []string{"Plan!A1: header row 1 is protected"},
+			skipped:   "every target is on the protected header row 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: tt.rows})
+			fake := &fakeSheets{}
+			cfg := config.Config{
+				SpreadsheetID:    "sheet-id",
+				LookupValue:      "Alice",
+				Workbook:         path,
+				HeaderRow:        tt.headerRow,
+				ProtectHeaderRow: tt.protect,
+			}
+			summary, err := update(context.Background(), newFakeService(t, fake), cfg, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fake.writes(); !reflect.DeepEqual(got, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", got, tt.wantWrites)
+			}
+			if !reflect.DeepEqual(summary.Protected, tt.protected) {
+				t.Errorf("Protected = %v, want %v", summary.Protected, tt.protected)
+			}
+			if summary.SkippedReason != tt.skipped {
+				t.Errorf("SkippedReason = %q, want %q", summary.SkippedReason, tt.skipped)
+			}
+		})
+	}
+}
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+func TestResponseOutMatchesGolden(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Week 1", rows: [][]string{{"Alice", "Bob"}, {"", "Alice"}}})
+	// USER_ENTERED turns the text "007" into the number 7.
+	echo := func(_ string, sent interface{}) interface{} {
+		if sent == "007" {
+			return 7
+		}
+		return sent
+	}
+	fake := &fakeSheets{echo: echo}
+	cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path, WriteValue: "007"}
+	var buf bytes.Buffer
+	summary, err := update(context.Background(), newFakeService(t, fake), cfg, Options{ResponseOut: &buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !summary.ResponseSaved {
+		t.Error("ResponseSaved = false")
+	}
+	golden := filepath.Join("testdata", "response.golden.json")
+	if *updateGolden {
+		if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("response differs from %s:\n%s\nwant:\n%s", golden, buf.Bytes(), want)
+	}
+}
+
+func TestFirstWriteIntoEmptySheet(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice", ""}, {"", "Alice"}}})
+	empty := ""
+	tests := []struct {
+		name string
+		cfg  config.Config
+	}{
+		{"write", config.Config{}},
+		{"sync", config.Config{Mode: config.ModeSync}},
+		{"occupied policy error", config.Config{OccupiedCellPolicy: config.OccupiedError}},
+		{"expect empty current value", config.Config{ExpectCurrentValue: &empty}},
+		{"verify writes", config.Config{VerifyWrites: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The fake answers every read with no values, as the API does
+			// for an empty range.
+			fake := &fakeSheets{}
+			cfg := tt.cfg
+			cfg.SpreadsheetID, cfg.LookupValue, cfg.Workbook = "sheet-id", "Alice", path
+			summary, err := update(context.Background(), newFakeService(t, fake), cfg, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{"Plan!A1", "Plan!B2"}; !reflect.DeepEqual(fake.writes(), want) {
+				t.Errorf("writes = %v, want %v", fake.writes(), want)
+			}
+			if summary.SkippedReason != "" || len(summary.Occupied) != 0 || len(summary.Unverified) != 0 {
+				t.Errorf("summary reports skipped %q, occupied %v, unverified %v for an empty sheet", summary.SkippedReason, summary.Occupied, summary.Unverified)
+			}
+		})
+	}
+}
+
+func TestMissingTabIsSheetNotFound(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	fake := &fakeSheets{missingTabs: []string{"Plan"}}
+	cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path}
+	_, err := update(context.Background(), newFakeService(t, fake), cfg, Options{})
+	if !errors.Is(err, ErrSheetNotFound) {
+		t.Fatalf("err = %v, want ErrSheetNotFound", err)
+	}
+	if !strings.Contains(err.Error(), `sheet "Plan" not found in spreadsheet sheet-id`) {
+		t.Errorf("err = %v, want it to name the sheet", err)
+	}
+	if len(fake.written) != 0 {
+		t.Errorf("wrote %v after the read failed", fake.writes())
+	}
+}
+
+func TestWriteLimit(t *testing.T) {
+	path := writeWorkbook(t,
+		fixtureSheet{name: "Week 1", rows: [][]string{{"Alice", "Alice"}, {"Bob", "Alice"}}},
+		fixtureSheet{name: "Week 2", rows: [][]string{{"Alice"}, {"Alice"}}},
+	)
+	tests := []struct {
+		name    string
+		limit   int
+		writes  []config.CellWrite
+		want    []string
+		skipped []string
+	}{
+		{
+			name: "no limit",
+			want: []string{"'Week 1'!A1", "'Week 1'!B1", "'Week 1'!B2", "'Week 2'!A1", "'Week 2'!A2"},
+		},
+		{
+			name:    "first two matches",
+			limit:   2,
+			want:    []string{"'Week 1'!A1", "'Week 1'!B1"},
+			skipped: []string{"'Week 1'!B2: beyond write_limit 2", "'Week 2'!A1: beyond write_limit 2", "'Week 2'!A2: beyond write_limit 2"},
+		},
+		{
+			name:    "limit spans sheets",
+			limit:   4,
+			want:    []string{"'Week 1'!A1", "'Week 1'!B1", "'Week 1'!B2", "'Week 2'!A1"},
+			skipped: []string{"'Week 2'!A2: beyond write_limit 4"},
+		},
+		{
+			name:  "limit above the match count",
+			limit: 10,
+			want:  []string{"'Week 1'!A1", "'Week 1'!B1", "'Week 1'!B2", "'Week 2'!A1", "'Week 2'!A2"},
+		},
+		{
+			name:    "a match counts once for all its writes",
+			limit:   1,
+			writes:  []config.CellWrite{{Offset: "0,2", Value: "x"}, {Offset: "0,3", Value: "y"}},
+			want:    []string{"'Week 1'!C1", "'Week 1'!D1"},
+			skipped: []string{"'Week 1'!B1: beyond write_limit 1", "'Week 1'!B2: beyond write_limit 1", "'Week 2'!A1: beyond write_limit 1", "'Week 2'!A2: beyond write_limit 1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSheets{}
+			cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path, WriteLimit: tt.limit, Writes: tt.writes}
+			summary, err := update(context.Background(), newFakeService(t, fake), cfg, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fake.writes(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("writes = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(summary.SkippedMatches, tt.skipped) {
+				t.Errorf("SkippedMatches = %q, want %q", summary.SkippedMatches, tt.skipped)
+			}
+		})
+	}
+}
+
+func TestAnchorMustBeUnique(t *testing.T) {
+	tests := []struct {
+		name    string
+		rows    [][]string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "unique anchor",
+			rows: [][]string{{"Total", ""}, {"Other", ""}},
+			want: []string{"Plan!A2"},
+		},
+		{
+			name:    "duplicated anchor",
+			rows:    [][]string{{"Total", ""}, {"Other", "Total"}},
+			wantErr: `anchor "Total" appears 2 times on sheet Plan (Plan!A1, Plan!B2); anchor_must_be_unique is set`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: tt.rows})
+			fake := &fakeSheets{}
+			cfg := config.Config{
+				SpreadsheetID: "sheet-id", LookupValue: "Total", WriteValue: "42", Workbook: path,
+				TargetRelativeTo: "below", AnchorMustBeUnique: true,
+			}
+			_, err := update(context.Background(), newFakeService(t, fake), cfg, Options{})
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrAnchorNotUnique) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want ErrAnchorNotUnique with %q", err, tt.wantErr)
+				}
+				for _, req := range fake.requests {
+					if strings.HasSuffix(req, ":batchUpdate") {
+						t.Errorf("sent %s for an ambiguous anchor", req)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fake.writes(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("writes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetColumn(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}, {"", "", "Alice"}}})
+	tests := []struct {
+		name      string
+		column    string
+		rowOffset int
+		want      []string
+	}{
+		{"single letter", "F", 0, []string{"Plan!F1", "Plan!F2"}},
+		{"multi letter", "AA", 0, []string{"Plan!AA1", "Plan!AA2"}},
+		{"with row offset", "B", 1, []string{"Plan!B2", "Plan!B3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSheets{}
+			cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", WriteValue: "x", Workbook: path, TargetColumn: tt.column, TargetRowOffset: tt.rowOffset}
+			if _, err := update(context.Background(), newFakeService(t, fake), cfg, Options{}); err != nil {
+				t.Fatal(err)
+			}
+			if got := fake.writes(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("writes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	t.Run("invalid column without Validate", func(t *testing.T) {
+		fake := &fakeSheets{}
+		cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path, TargetColumn: "F1"}
+		_, err := update(context.Background(), newFakeService(t, fake), cfg, Options{})
+		if err == nil || !strings.Contains(err.Error(), "target_column") {
+			t.Fatalf("err = %v, want a target_column error", err)
+		}
+		if len(fake.written) != 0 {
+			t.Errorf("wrote %v", fake.writes())
+		}
+	})
+}
+
+func TestSpreadsheetNotFound(t *testing.T) {
+	key := filepath.Join(t.TempDir(), "key.json")
+	if err := os.WriteFile(key, []byte(`{"type":"service_account","client_email":"updater@proj.iam.gserviceaccount.com","private_key":"x","token_uri":"https://oauth2.example/token"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	cfg := config.Config{SpreadsheetID: "wrong-id", LookupValue: "Alice", Workbook: path}
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		creds   string
+		account string
+		run     func(svc *sheets.Service) error
+	}{
+		{
+			name:    "read",
+			creds:   key,
+			account: "the service account updater@proj.iam.gserviceaccount.com",
+			run: func(svc *sheets.Service) error {
+				_, err := fetchRangeValues(ctx, svc, cfg, "Plan!A1")
+				return err
+			},
+		},
+		{
+			name:    "write",
+			creds:   key,
+			account: "the service account updater@proj.iam.gserviceaccount.com",
+			run: func(svc *sheets.Service) error {
+				_, err := batchUpdate(ctx, svc, cfg, []*sheets.ValueRange{{Range: "Plan!A1", Values: [][]interface{}{{"x"}}}}, nil)
+				return err
+			},
+		},
+		{
+			name:    "credentials without an email",
+			creds:   filepath.Join(t.TempDir(), "missing.json"),
+			account: "the service account (check",
+			run: func(svc *sheets.Service) error {
+				_, err := fetchRangeValues(ctx, svc, cfg, "Plan!A1")
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", tt.creds)
+			fake := &fakeSheets{readStatus: http.StatusNotFound, writeStatus: http.StatusNotFound}
+			err := tt.run(newFakeService(t, fake))
+			if !errors.Is(err, ErrSpreadsheetNotFound) {
+				t.Fatalf("err = %v, want ErrSpreadsheetNotFound", err)
+			}
+			msg := err.Error()
+			if !strings.Contains(msg, "spreadsheet wrong-id not found or not shared with "+tt.account) {
+				t.Errorf("err = %q, want it to name the spreadsheet and %q", msg, tt.account)
+			}
+		})
+	}
+}
+
+func TestWriteMatchedCell(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"  Alice "}, {"Alice"}, {"3.10"}}})
+	tests := []struct {
+		name       string
+		cfg        config.Config
+		matched    bool
+		wantValues [][][]interface{}
+	}{
+		{"untrimmed text", config.Config{LookupValue: "Alice"}, true, [][][]interface{}{{{"  Alice "}}, {{"Alice"}}}},
+		{"numeric tolerance keeps the workbook spelling", config.Config{LookupValue: "3.1", NumericTolerance: 0.01}, true, [][][]interface{}{{{"3.10"}}}},
+		{"lookup value without the setting", config.Config{LookupValue: "Alice"}, false, [][][]interface{}{{{"Alice"}}, {{"Alice"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.TargetColOffset = 1
+			cfg.WriteMatchedCell = tt.matched
+			got, err := deriveFixture(t, path, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Values, tt.wantValues) {
+				t.Errorf("values = %#v, want %#v", got.Values, tt.wantValues)
+			}
+		})
+	}
+}
+
+func TestBuildBlockValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		match Match
+		cfg   config.Config
+		want  [][]interface{}
+	}{
+		{"block_values row by row", Match{},
+			config.Config{TargetBlockRows: 2, TargetBlockCols: 2, BlockValues: []string{"a", "b", "c", "d"}},
+			[][]interface{}{{"a", "b"}, {"c", "d"}}},
+		{"source block", Match{SourceBlock: [][]string{{"Bob", "555-0100", ""}}},
+			config.Config{TargetBlockCols: 3, SourceColOffset: 1},
+			[][]interface{}{{"Bob", "555-0100", ""}}},
+		{"value in every cell", Match{},
+			config.Config{TargetBlockRows: 2, TargetBlockCols: 3},
+			[][]interface{}{{"x", "x", "x"}, {"x", "x", "x"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildBlockValues(tt.match, tt.cfg, "x"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("block = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetBlock(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{
+		{"Alice", "", "", "", "Bob", "555-0100", "B2"},
+		{"Alice"},
+	}})
+	grid := func(rows, cols int64) sheets.Spreadsheet {
+		return sheets.Spreadsheet{Sheets: []*sheets.Sheet{{Properties: &sheets.SheetProperties{
+			SheetId: 1, Title: "Plan", GridProperties: &sheets.GridProperties{RowCount: rows, ColumnCount: cols},
+		}}}}
+	}
+	tests := []struct {
+		name     string
+		cfg      config.Config
+		meta     sheets.Spreadsheet
+		cells    map[string][][]interface{}
+		want     map[string][][]interface{}
+		skipped  []string
+		occupied int
+		wantErr  string
+	}{
+		{
+			name: "block_values",
+			cfg:  config.Config{TargetColOffset: 1, TargetBlockCols: 3, BlockValues: []string{"Name", "Phone", "Shift"}},
+			meta: grid(10, 10),
+			want: map[string][][]interface{}{
+				"Plan!B1:D1": {{"Name", "Phone", "Shift"}},
+				"Plan!B2:D2": {{"Name", "Phone", "Shift"}},
+			},
+		},
+		{
+			name:  "each cell of the block has its own occupied check",
+			cfg:   config.Config{TargetColOffset: 1, TargetBlockCols: 3, BlockValues: []string{"Name", "Phone", "Shift"}},
+			meta:  grid(10, 10),
+			cells: map[string][][]interface{}{"Plan!B1:D1": {{"", "taken", ""}}},
+			want: map[string][][]interface{}{
+				"Plan!B1:D1": {{"Name", nil, "Shift"}},
+				"Plan!B2:D2": {{"Name", "Phone", "Shift"}},
+			},
+			occupied: 1,
+		},
+		{
+			name:    "occupied cell under the error policy",
+			cfg:     config.Config{TargetColOffset: 1, TargetBlockCols: 3, BlockValues: []string{"Name", "Phone", "Shift"}, OccupiedCellPolicy: config.OccupiedError},
+			meta:    grid(10, 10),
+			cells:   map[string][][]interface{}{"Plan!B1:D1": {{"", "taken", ""}}},
+			wantErr: "already contain data",
+		},
+		{
+			name: "source block",
+			cfg:  config.Config{TargetColOffset: 1, TargetBlockCols: 3, SourceColOffset: 4},
+			meta: grid(10, 10),
+			want: map[string][][]interface{}{
+				"Plan!B1:D1": {{"Bob", "555-0100", "B2"}},
+			},
+			skipped: []string{"Plan!A2: source block at offset (0,4) is empty"},
+		},
+		{
+			name:    "past the grid",
+			cfg:     config.Config{TargetColOffset: 1, TargetBlockRows: 2, TargetBlockCols: 3},
+			meta:    grid(2, 3),
+			wantErr: "2 target(s) extend past the sheet grid; add rows or columns in Google Sheets or shrink target_block_rows/target_block_cols: Plan!B1:D2 (sheet has 2 rows, 3 columns); Plan!B2:D3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSheets{meta: tt.meta, cells: tt.cells}
+			cfg := tt.cfg
+			cfg.SpreadsheetID, cfg.LookupValue, cfg.Workbook = "sheet-id", "Alice", path
+			summary, err := update(context.Background(), newFakeService(t, fake), cfg, Options{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				if len(fake.written) != 0 {
+					t.Errorf("wrote %v before failing", fake.writes())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			sent := make(map[string][][]interface{})
+			for _, vr := range fake.written {
+				sent[vr.Range] = vr.Values
+			}
+			if !reflect.DeepEqual(sent, tt.want) {
+				t.Errorf("sent %v, want %v", sent, tt.want)
+			}
+			if !reflect.DeepEqual(summary.SkippedMatches, tt.skipped) {
+				t.Errorf("skipped = %q, want %q", summary.SkippedMatches, tt.skipped)
+			}
+			if len(summary.Occupied) != tt.occupied {
+				t.Errorf("occupied = %q, want %d", summary.Occupied, tt.occupied)
+			}
+		})
+	}
+}
+
+func TestSourceOffsets(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{
+		{"Team A", "Lead"},
+		{"Alice", "555-0100", "Mon"},
+		{"Alice", "", "Tue"},
+		{"x", "Alice", "555-0199"},
+	}})
+	tests := []struct {
+		name       string
+		cfg        config.Config
+		wantRanges []string
+		wantValues [][][]interface{}
+		skipped    []string
+	}{
+		{
+			name:       "cell to the right",
+			cfg:        config.Config{SourceColOffset: 1},
+			wantRanges: []string{"Plan!A2", "Plan!B4"},
+			wantValues: [][][]interface{}{{{"555-0100"}}, {{"555-0199"}}},
+			skipped:    []string{"Plan!A3: source cell at offset (0,1) is empty"},
+		},
+		{
+			name:       "two cells right, written one column over",
+			cfg:        config.Config{SourceColOffset: 2, TargetColOffset: 1},
+			wantRanges: []string{"Plan!B2", "Plan!B3"},
+			wantValues: [][][]interface{}{{{"Mon"}}, {{"Tue"}}},
+			skipped:    []string{"Plan!B4: source cell at offset (0,2) is empty"},
+		},
+		{
+			name:       "cell above",
+			cfg:        config.Config{SourceRowOffset: -1},
+			wantRanges: []string{"Plan!A2", "Plan!A3"},
+			wantValues: [][][]interface{}{{{"Team A"}}, {{"Alice"}}},
+			skipped:    []string{"Plan!B4: source cell at offset (-1,0) is empty"},
+		},
+		{
+			name:       "no source offsets writes the lookup value",
+			cfg:        config.Config{},
+			wantRanges: []string{"Plan!A2", "Plan!A3", "Plan!B4"},
+			wantValues: [][][]interface{}{{{"Alice"}}, {{"Alice"}}, {{"Alice"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.LookupValue = "Alice"
+			got, err := deriveFixture(t, path, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Ranges, tt.wantRanges) || !reflect.DeepEqual(got.Values, tt.wantValues) {
+				t.Errorf("targets = %v %#v, want %v %#v", got.Ranges, got.Values, tt.wantRanges, tt.wantValues)
+			}
+			if !reflect.DeepEqual(got.Skipped, tt.skipped) {
+				t.Errorf("skipped = %q, want %q", got.Skipped, tt.skipped)
+			}
+		})
+	}
+}
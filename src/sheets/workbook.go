@@ -0,0 +1,73 @@
+package sheets
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/xuri/excelize/v2"
+
+	"update-google-sheets/src/config"
+)
+
+// Workbook is an opened Excel workbook to scan for matches. Close it when
+// done.
+type Workbook struct {
+	f    *excelize.File
+	name string
+}
+
+// WorkbookOption adjusts how a workbook is opened.
+type WorkbookOption func(*excelize.Options)
+
+// WithPassword opens an encrypted workbook.
+func WithPassword(password string) WorkbookOption {
+	return func(o *excelize.Options) { o.Password = password }
+}
+
+// WithUnzipSizeLimit caps the unpacked size of the workbook in bytes, to
+// guard against oversized uploads.
+func WithUnzipSizeLimit(limit int64) WorkbookOption {
+	return func(o *excelize.Options) { o.UnzipSizeLimit = limit }
+}
+
+func workbookOptions(opts []WorkbookOption) excelize.Options {
+	var o excelize.Options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// OpenWorkbook reads a workbook from r, e.g. an HTTP upload or a file in an
+// fs.FS. name is used only in messages.
+func OpenWorkbook(r io.Reader, name string, opts ...WorkbookOption) (*Workbook, error) {
+	f, err := excelize.OpenReader(r, workbookOptions(opts))
+	if err != nil {
+		return nil, fmt.Errorf("open workbook %s: %w", name, err)
+	}
+	return &Workbook{f: f, name: name}, nil
+}
+
+// OpenWorkbookFile opens the workbook at path.
+func OpenWorkbookFile(path string, opts ...WorkbookOption) (*Workbook, error) {
+	f, err := excelize.OpenFile(path, workbookOptions(opts))
+	if err != nil {
+		return nil, fmt.Errorf("open config workbook: %w", err)
+	}
+	return &Workbook{f: f, name: path}, nil
+}
+
+// Sheets returns the sheets a run with cfg would scan, in workbook order,
+// resolving config_sheet names and indexes such as #1.
+func (w *Workbook) Sheets(cfg config.Config) ([]string, error) {
+	kept, _, err := selectSheets(w.f, cfg)
+	if err != nil {
+		return nil, tag(ErrSheetNotFound, fmt.Errorf("%w in %s", err, w.name))
+	}
+	return kept, nil
+}
+
+// Close releases the workbook's temporary files.
+func (w *Workbook) Close() error {
+	return w.f.Close()
+}
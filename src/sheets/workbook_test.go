@@ -0,0 +1,70 @@
+package sheets
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"update-google-sheets/src/config"
+)
+
+func TestOpenWorkbook(t *testing.T) {
+	plain, err := os.ReadFile(writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := excelize.NewFile()
+	t.Cleanup(func() { _ = f.Close() })
+	if err := f.SetSheetName("Sheet1", "Plan"); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "secret.xlsx")
+	if err := f.SaveAs(path, excelize.Options{Password: "s3cret"}); err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		opts    []WorkbookOption
+		wantErr string
+	}{
+		{"plain", plain, nil, ""},
+		{"password", encrypted, []WorkbookOption{WithPassword("s3cret")}, ""},
+		{"wrong password", encrypted, []WorkbookOption{WithPassword("guess")}, "open workbook upload.xlsx: the supplied open workbook password is not correct"},
+		{"no password", encrypted, nil, "open workbook upload.xlsx: zip: not a valid zip file"},
+		{"within the size limit", plain, []WorkbookOption{WithUnzipSizeLimit(1 << 20)}, ""},
+		{"over the size limit", plain, []WorkbookOption{WithUnzipSizeLimit(100)}, "open workbook upload.xlsx: unzip size exceeds the 100 bytes limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := OpenWorkbook(bytes.NewReader(tt.data), "upload.xlsx", tt.opts...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = w.Close() })
+			got, err := w.Sheets(config.Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, []string{"Plan"}) {
+				t.Errorf("sheets = %q, want [Plan]", got)
+			}
+		})
+	}
+}
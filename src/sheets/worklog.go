@@ -0,0 +1,91 @@
+package sheets
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+	"google.golang.org/api/sheets/v4"
+
+	"update-google-sheets/src/config"
+)
+
+// WorkbookLogSheet is the workbook sheet that workbook_log appends to.
+const WorkbookLogSheet = "SyncLog"
+
+var workbookLogHeader = []interface{}{"range", "value", "timestamp"}
+
+// writeRecord is one range the run changed and the value it now holds.
+type writeRecord struct {
+	Range string
+	Value string
+}
+
+// payloadRecords summarises each written range. Cells the merge left
+// alone (nil) are omitted from the value.
+func payloadRecords(payloads []*sheets.ValueRange) []writeRecord {
+	records := make([]writeRecord, 0, len(payloads))
+	for _, p := range payloads {
+		var vals []string
+		for _, row := range p.Values {
+			for _, v := range row {
+				if v != nil {
+					vals = append(vals, fmt.Sprint(v))
+				}
+			}
+		}
+		records = append(records, writeRecord{Range: p.Range, Value: strings.Join(vals, ", ")})
+	}
+	return records
+}
+
+// appendWorkbookLog appends one row per record to the WorkbookLogSheet of
+// cfg.Workbook, creating the sheet with a header row when missing, and
+// saves the workbook.
+func appendWorkbookLog(cfg config.Config, records []writeRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	f, err := excelize.OpenFile(cfg.Workbook)
+	if err != nil {
+		return fmt.Errorf("open workbook for %s: %w", WorkbookLogSheet, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	next := 1
+	if idx, err := f.GetSheetIndex(WorkbookLogSheet); err != nil || idx == -1 {
+		if _, err := f.NewSheet(WorkbookLogSheet); err != nil {
+			return fmt.Errorf("create %s sheet: %w", WorkbookLogSheet, err)
+		}
+	} else {
+		rows, err := f.GetRows(WorkbookLogSheet)
+		if err != nil {
+			return fmt.Errorf("read %s sheet: %w", WorkbookLogSheet, err)
+		}
+		next = len(rows) + 1
+	}
+	if next == 1 {
+		if err := f.SetSheetRow(WorkbookLogSheet, "A1", &workbookLogHeader); err != nil {
+			return fmt.Errorf("write %s header: %w", WorkbookLogSheet, err)
+		}
+		next = 2
+	}
+	stamp := time.Now().In(cfg.Location()).Format("2006-01-02 15:04:05")
+	for _, r := range records {
+		row := []interface{}{r.Range, r.Value, stamp}
+		if err := f.SetSheetRow(WorkbookLogSheet, fmt.Sprintf("A%d", next), &row); err != nil {
+			return fmt.Errorf("write %s row %d: %w", WorkbookLogSheet, next, err)
+		}
+		next++
+	}
+	if err := f.Save(); err != nil {
+		if errors.Is(err, fs.ErrPermission) {
+			return fmt.Errorf("workbook %s is read-only; cannot record %s: %w", cfg.Workbook, WorkbookLogSheet, err)
+		}
+		return fmt.Errorf("save %s to %s: %w", WorkbookLogSheet, cfg.Workbook, err)
+	}
+	return nil
+}
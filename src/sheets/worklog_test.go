@@ -0,0 +1,82 @@
+package sheets
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"update-google-sheets/src/config"
+)
+
+func TestWorkbookLogContents(t *testing.T) {
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice", "x"}, {"y", "Alice"}}})
+	fake := &fakeSheets{}
+	svc := newFakeService(t, fake)
+	cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path, WorkbookLog: true, Timezone: "UTC"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for run := 1; run <= 2; run++ {
+		fake.cells = map[string][][]interface{}{}
+		summary, err := UpdateWithService(context.Background(), svc, cfg, Options{})
+		if err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		if summary.WorkbookLogged != 2 {
+			t.Errorf("run %d: WorkbookLogged = %d, want 2", run, summary.WorkbookLogged)
+		}
+		// The logged "Alice" values must not become matches on the next run.
+		if want := []string{"Plan!A1", "Plan!B2"}; !reflect.DeepEqual(summary.Ranges, want) {
+			t.Errorf("run %d: ranges = %v, want %v", run, summary.Ranges, want)
+		}
+	}
+
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	rows, err := f.GetRows(WorkbookLogSheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 5 {
+		t.Fatalf("got %d %s rows, want header plus 4: %v", len(rows), WorkbookLogSheet, rows)
+	}
+	if want := []string{"range", "value", "timestamp"}; !reflect.DeepEqual(rows[0], want) {
+		t.Errorf("header = %v, want %v", rows[0], want)
+	}
+	for i, want := range []string{"Plan!A1", "Plan!B2", "Plan!A1", "Plan!B2"} {
+		row := rows[i+1]
+		if row[0] != want || row[1] != "Alice" {
+			t.Errorf("row %d = %v, want %s, Alice", i+2, row, want)
+		}
+		if _, err := time.Parse("2006-01-02 15:04:05", row[2]); err != nil {
+			t.Errorf("row %d timestamp %q: %v", i+2, row[2], err)
+		}
+	}
+}
+
+func TestWorkbookLogReadOnly(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("file permissions are not enforced for root")
+	}
+	path := writeWorkbook(t, fixtureSheet{name: "Plan", rows: [][]string{{"Alice"}}})
+	if err := os.Chmod(path, 0o444); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Config{SpreadsheetID: "sheet-id", LookupValue: "Alice", Workbook: path, WorkbookLog: true}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "is not writable") {
+		t.Errorf("Validate err = %v, want not writable", err)
+	}
+	err := appendWorkbookLog(cfg, []writeRecord{{Range: "Plan!A1", Value: "Alice"}})
+	if err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Errorf("appendWorkbookLog err = %v, want read-only", err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"update-google-sheets/src/config"
+	"update-google-sheets/src/sheets"
+)
+
+// runValidate lints the config at path for -validate: it must parse and
+// validate, its workbook must open and hold the config_sheet sheets, and
+// its spreadsheet ID must look like one. Each document of a multi-document
+// config is linted. Secret references are left unresolved since nothing is
+// fetched. Each problem is printed to stderr; the result is the exit code.
+func runValidate(path, importPath string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return printProblems(path, []string{err.Error()})
+	}
+	cfgs, err := config.ParseAll(data)
+	if err != nil {
+		return printProblems(path, []string{fmt.Sprintf("parse %s: %v", path, err)})
+	}
+	var problems []string
+	for i, cfg := range cfgs {
+		for _, p := range lintConfig(cfg, importPath) {
+			if len(cfgs) > 1 {
+				p = fmt.Sprintf("document %d: %s", i+1, p)
+			}
+			problems = append(problems, p)
+		}
+	}
+	return printProblems(path, problems)
+}
+
+// lintConfig returns the problems -validate finds in one config.
+func lintConfig(cfg config.Config, importPath string) []string {
+	var problems []string
+	report := func(err error) {
+		problems = append(problems, err.Error())
+	}
+	if importPath != "" {
+		cfg.ImportFile = importPath
+	}
+
+	// Optional settings held in secrets cannot be checked offline.
+	for _, v := range []*string{&cfg.ProxyURL, &cfg.CABundleFile} {
+		if strings.HasPrefix(strings.TrimSpace(*v), config.SecretScheme) {
+			*v = ""
+		}
+	}
+	workbookRef := strings.HasPrefix(strings.TrimSpace(cfg.Workbook), config.SecretScheme)
+	validate := cfg.Validate
+	if workbookRef {
+		validate = cfg.ValidateSettings
+	}
+	if err := validate(); err != nil {
+		report(err)
+	} else if cfg.ScansWorkbook() && !workbookRef {
+		wb, err := sheets.OpenWorkbookFile(cfg.Workbook)
+		if err != nil {
+			report(err)
+		} else {
+			if cfg.SearchDefinedName == "" {
+				if _, err := wb.Sheets(cfg); err != nil {
+					report(err)
+				}
+			}
+			_ = wb.Close()
+		}
+	}
+	if id := cfg.SpreadsheetID; id != "" && !strings.HasPrefix(id, config.SecretScheme) && !config.ValidSpreadsheetID(id) {
+		report(fmt.Errorf("spreadsheet_id %q does not look like a spreadsheet ID (the part of the URL after /d/)", id))
+	}
+	for i, id := range cfg.SpreadsheetIDs {
+		if !config.ValidSpreadsheetID(id) {
+			report(fmt.Errorf("spreadsheet_ids[%d] %q does not look like a spreadsheet ID (the part of the URL after /d/)", i, id))
+		}
+	}
+	return problems
+}
+
+func printProblems(path string, problems []string) int {
+	if len(problems) == 0 {
+		fmt.Printf("%s: ok\n", path)
+		return 0
+	}
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, p)
+	}
+	return 1
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestRunValidate(t *testing.T) {
+	dir := t.TempDir()
+	workbook := filepath.Join(dir, "book.xlsx")
+	f := excelize.NewFile()
+	if err := f.SaveAs(workbook); err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(dir, "broken.xlsx")
+	if err := os.WriteFile(broken, []byte("not a zip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	const id = "1AbCdEfGhIjKlMnOpQrStUvWxYz0123456789"
+
+	tests := []struct {
+		name string
+		yaml string
+		want int
+	}{
+		{"good", "spreadsheet_id: " + id + "\nlookup_value: Alice\nconfig_xlsx: " + workbook + "\n", 0},
+		{"secret workbook", "spreadsheet_id: " + id + "\nlookup_value: Alice\nconfig_xlsx: sm://projects/p/secrets/book\n", 0},
+		{"not yaml", "spreadsheet_id: [\n", 1},
+		{"missing spreadsheet id", "lookup_value: Alice\nconfig_xlsx: " + workbook + "\n", 1},
+		{"malformed spreadsheet id", "spreadsheet_id: short\nlookup_value: Alice\nconfig_xlsx: " + workbook + "\n", 1},
+		{"missing lookup value", "spreadsheet_id: " + id + "\nconfig_xlsx: " + workbook + "\n", 1},
+		{"missing workbook", "spreadsheet_id: " + id + "\nlookup_value: Alice\nconfig_xlsx: " + filepath.Join(dir, "none.xlsx") + "\n", 1},
+		{"unreadable workbook", "spreadsheet_id: " + id + "\nlookup_value: Alice\nconfig_xlsx: " + broken + "\n", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if got := runValidate(path, ""); got != tt.want {
+				t.Errorf("runValidate = %d, want %d", got, tt.want)
+			}
+		})
+	}
+	if got := runValidate(filepath.Join(dir, "absent.yaml"), ""); got != 1 {
+		t.Errorf("runValidate on a missing file = %d, want 1", got)
+	}
+}